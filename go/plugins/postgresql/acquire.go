@@ -0,0 +1,208 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrAcquireTimeout is wrapped by the errors of operations that waited for a
+// connection of the pool longer than the timeout set with
+// [WithAcquireTimeout].
+var ErrAcquireTimeout = errors.New("connection acquire timeout exceeded")
+
+// acquiringPool runs statements on connections of a pool acquired within a
+// timeout, rather than within the deadline of the statement as the pool
+// itself does. Connections are released once the statement is done: when
+// its rows are read or closed, its row scanned, its batch closed or its
+// transaction ended.
+type acquiringPool struct {
+	pool    *pgxpool.Pool
+	timeout time.Duration
+}
+
+var _ pgxExecutor = acquiringPool{}
+
+// executor returns the executor of the statements run on pool, which bounds
+// the acquisition of connections by the acquire timeout of the engine.
+func (pgEngine *PostgresEngine) executor(pool *pgxpool.Pool) pgxExecutor {
+	return acquiring(pool, pgEngine.config.acquireTimeout)
+}
+
+// acquiring returns an executor acquiring the connections of pool within
+// timeout, or pool itself if timeout is 0.
+func acquiring(pool *pgxpool.Pool, timeout time.Duration) pgxExecutor {
+	if timeout <= 0 {
+		return pool
+	}
+	return acquiringPool{pool, timeout}
+}
+
+// acquire acquires a connection of the pool, waiting up to the acquire
+// timeout.
+func (p acquiringPool) acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	actx, cancel := context.WithTimeoutCause(ctx, p.timeout, ErrAcquireTimeout)
+	defer cancel()
+	conn, err := p.pool.Acquire(actx)
+	if err != nil && errors.Is(context.Cause(actx), ErrAcquireTimeout) {
+		return nil, fmt.Errorf("%w: %w", ErrAcquireTimeout, err)
+	}
+	return conn, err
+}
+
+// acquire acquires a connection of pool for a statement of the engine,
+// waiting up to its acquire timeout.
+func (pgEngine *PostgresEngine) acquire(ctx context.Context, pool *pgxpool.Pool) (*pgxpool.Conn, error) {
+	if pgEngine.config.acquireTimeout <= 0 {
+		return pool.Acquire(ctx)
+	}
+	return acquiringPool{pool, pgEngine.config.acquireTimeout}.acquire(ctx)
+}
+
+func (p acquiringPool) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	defer conn.Release()
+	return conn.Exec(ctx, sql, args...)
+}
+
+func (p acquiringPool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		conn.Release()
+		return nil, err
+	}
+	return &releasingRows{Rows: rows, conn: conn}, nil
+}
+
+func (p acquiringPool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return errRow{err}
+	}
+	return releasingRow{row: conn.QueryRow(ctx, sql, args...), conn: conn}
+}
+
+func (p acquiringPool) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return errBatchResults{err}
+	}
+	return &releasingBatchResults{BatchResults: conn.SendBatch(ctx, b), conn: conn}
+}
+
+func (p acquiringPool) Begin(ctx context.Context) (pgx.Tx, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		conn.Release()
+		return nil, err
+	}
+	return &releasingTx{Tx: tx, conn: conn}, nil
+}
+
+// releasingRows releases their connection once read or closed.
+type releasingRows struct {
+	pgx.Rows
+	conn *pgxpool.Conn
+}
+
+func (r *releasingRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.release()
+	return false
+}
+
+func (r *releasingRows) Close() {
+	r.Rows.Close()
+	r.release()
+}
+
+func (r *releasingRows) release() {
+	if r.conn != nil {
+		r.conn.Release()
+		r.conn = nil
+	}
+}
+
+// releasingRow releases its connection once scanned.
+type releasingRow struct {
+	row  pgx.Row
+	conn *pgxpool.Conn
+}
+
+func (r releasingRow) Scan(dest ...any) error {
+	defer r.conn.Release()
+	return r.row.Scan(dest...)
+}
+
+// errRow is a row failing with err.
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...any) error { return r.err }
+
+// releasingBatchResults release their connection once closed.
+type releasingBatchResults struct {
+	pgx.BatchResults
+	conn *pgxpool.Conn
+}
+
+func (r *releasingBatchResults) Close() error {
+	err := r.BatchResults.Close()
+	if r.conn != nil {
+		r.conn.Release()
+		r.conn = nil
+	}
+	return err
+}
+
+// errBatchResults are the results of a batch failing with err.
+type errBatchResults struct {
+	err error
+}
+
+func (r errBatchResults) Exec() (pgconn.CommandTag, error) { return pgconn.CommandTag{}, r.err }
+func (r errBatchResults) Query() (pgx.Rows, error)         { return nil, r.err }
+func (r errBatchResults) QueryRow() pgx.Row                { return errRow{r.err} }
+func (r errBatchResults) Close() error                     { return r.err }
+
+// releasingTx releases its connection once committed or rolled back.
+type releasingTx struct {
+	pgx.Tx
+	conn *pgxpool.Conn
+}
+
+func (tx *releasingTx) Commit(ctx context.Context) error {
+	defer tx.release()
+	return tx.Tx.Commit(ctx)
+}
+
+func (tx *releasingTx) Rollback(ctx context.Context) error {
+	defer tx.release()
+	return tx.Tx.Rollback(ctx)
+}
+
+func (tx *releasingTx) release() {
+	if tx.conn != nil {
+		tx.conn.Release()
+		tx.conn = nil
+	}
+}
@@ -0,0 +1,27 @@
+package postgresql
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquiring(t *testing.T) {
+	pool := &pgxpool.Pool{}
+	assert.Same(t, pool, acquiring(pool, 0))
+	assert.Equal(t, acquiringPool{pool, time.Second}, acquiring(pool, time.Second))
+}
+
+func TestErrBatchResults(t *testing.T) {
+	err := errors.New("acquire failed")
+	br := errBatchResults{err}
+	_, execErr := br.Exec()
+	assert.Same(t, err, execErr)
+	_, queryErr := br.Query()
+	assert.Same(t, err, queryErr)
+	assert.Same(t, err, br.QueryRow().Scan())
+	assert.Same(t, err, br.Close())
+}
@@ -0,0 +1,40 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/firebase/genkit/go/core/logger"
+)
+
+// Analyze runs ANALYZE on a table of the engine's schema, so that the query
+// planner has statistics of its current rows, such as after a bulk load,
+// without waiting for autovacuum. [WithAutoAnalyze] runs it after bulk
+// operations. The query timeout set by [WithQueryTimeout] does not apply.
+func (pgEngine *PostgresEngine) Analyze(ctx context.Context, tableName string) error {
+	if err := pgEngine.checkWrite("analyze a table"); err != nil {
+		return err
+	}
+	tableName = pgEngine.tableName(tableName)
+	return pgEngine.analyze(ctx, pgEngine.schemaName(), tableName)
+}
+
+// analyze runs ANALYZE on schema.table.
+func (pgEngine *PostgresEngine) analyze(ctx context.Context, schema, table string) error {
+	if _, err := pgEngine.querier().Exec(ctx, "ANALYZE "+qualifiedName(schema, table)); err != nil {
+		return fmt.Errorf("failed to analyze table %q: %w", table, describeTableError(err, table))
+	}
+	return nil
+}
+
+// autoAnalyze runs ANALYZE on schema.table after a bulk operation with
+// [WithAutoAnalyze]. As the operation succeeded, a failure is only logged.
+func (pgEngine *PostgresEngine) autoAnalyze(ctx context.Context, schema, table string) {
+	if !pgEngine.config.autoAnalyze {
+		return
+	}
+	if err := pgEngine.analyze(ctx, schema, table); err != nil {
+		logger.FromContext(ctx).Warn("failed to analyze the table after a bulk operation; query plans may be poor until autovacuum analyzes it",
+			"schema", schema, "table", table, "error", err)
+	}
+}
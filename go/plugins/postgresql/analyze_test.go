@@ -0,0 +1,23 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoAnalyzeOption(t *testing.T) {
+	config, err := applyEngineOptions([]Option{WithPool(&pgxpool.Pool{}), WithDatabase("testdb"), WithAutoAnalyze()})
+	assert.NoError(t, err)
+	assert.True(t, config.autoAnalyze)
+
+	// Without the option, bulk operations do not reach the database.
+	(&PostgresEngine{}).autoAnalyze(context.Background(), "public", "documents")
+}
+
+func TestAnalyzeReadOnly(t *testing.T) {
+	pgEngine := &PostgresEngine{config: engineConfig{readOnly: true}}
+	assert.ErrorIs(t, pgEngine.Analyze(context.Background(), "documents"), ErrReadOnly)
+}
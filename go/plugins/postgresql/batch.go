@@ -0,0 +1,171 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// RetrieveBatch runs a similarity search for each of queries against the
+// table described by cfg, in a single query and round trip, and returns the
+// documents of each search in the order of queries. It is meant for callers
+// that already hold the query embeddings, such as evaluations that search
+// for many questions at once.
+//
+// Each search uses the options of opts, which may be nil, like a search with
+// [RetrieverOptions.QueryEmbedding]. [RetrieverOptions.MMR],
+// [RetrieverOptions.Hybrid], [RetrieverOptions.After],
+// [RetrieverOptions.GroupBy], [RetrieverOptions.MultiVector],
+// [RetrieverOptions.RollUp], [RetrieverOptions.Boost] and
+// [RetrieverOptions.OrderBy] are not supported, and results are not
+// reranked.
+func (pgEngine *PostgresEngine) RetrieveBatch(ctx context.Context, cfg *Config, queries [][]float32, opts *RetrieverOptions) ([][]*ai.Document, error) {
+	ds, err := newEngineDocStore(ctx, *pgEngine, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return ds.retrieveBatch(ctx, queries, opts)
+}
+
+// retrieveBatch runs the searches of RetrieveBatch.
+func (ds *docStore) retrieveBatch(ctx context.Context, queries [][]float32, opts *RetrieverOptions) (results [][]*ai.Document, err error) {
+	count := 0
+	start := time.Now()
+	ctx, cancel := ds.engine.withFallbackTimeout(ctx)
+	defer cancel()
+	ctx, span := ds.startSpan(ctx, "postgresql.retrieve_batch",
+		attribute.String("postgresql.distance_strategy", string(ds.config.DistanceStrategy)),
+		attribute.Int("postgresql.query_count", len(queries)))
+	defer func() {
+		span.SetAttributes(attribute.Int("postgresql.result_count", count))
+		endSpan(span, err)
+		ds.recordRequest(ctx, "retrieve", count, err)
+		k, _ := ds.resolveK(opts)
+		ds.logSlowRequest(ctx, "retrieve_batch", start, err, "k", k, "queries", len(queries), "documents", count)
+	}()
+
+	if opts == nil {
+		opts = &RetrieverOptions{}
+	}
+	if len(queries) == 0 {
+		return [][]*ai.Document{}, nil
+	}
+	query, args, err := ds.buildBatchQuery(ctx, queries, opts)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.RetrieveBatch: %w", err)
+	}
+	settings, err := indexSettings(opts)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.RetrieveBatch: %w", err)
+	}
+	if k, err := ds.resolveK(opts); err == nil {
+		settings = ds.rescoreSettings(settings, k, opts)
+	}
+
+	qctx, cancel := ds.engine.withQueryTimeout(ctx)
+	defer cancel()
+	r := &retrieval{query: query, args: args, settings: settings}
+	rows, err := r.run(qctx, ds)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.RetrieveBatch: query failed: %w", queryTimeoutError(qctx, describeQueryError(err, ds.config)))
+	}
+	defer rows.Close()
+
+	results = make([][]*ai.Document, len(queries))
+	for i := range results {
+		results[i] = []*ai.Document{}
+	}
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, fmt.Errorf("postgres.RetrieveBatch: failed to read row: %w", queryTimeoutError(qctx, err))
+		}
+		ord, ok := values[0].(int64)
+		if !ok || ord < 1 || ord > int64(len(queries)) {
+			return nil, fmt.Errorf("postgres.RetrieveBatch: unexpected query ordinal %v", values[0])
+		}
+		values = values[1:]
+		if !ds.finiteDistance(ctx, values) || !ds.meetsThreshold(values, opts.ScoreThreshold) {
+			continue
+		}
+		doc, err := ds.rowToDocument(values)
+		if err != nil {
+			return nil, err
+		}
+		if opts.ReturnEmbedding {
+			emb, err := ds.rowEmbedding(values)
+			if err != nil {
+				return nil, fmt.Errorf("postgres.RetrieveBatch: %w", err)
+			}
+			doc.Metadata[EmbeddingMetadataKey] = ds.returnedEmbedding(emb)
+		}
+		results[ord-1] = append(results[ord-1], doc)
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres.RetrieveBatch: %w", queryTimeoutError(qctx, describeQueryError(err, ds.config)))
+	}
+	if err := ds.resolveContent(ctx, slices.Concat(results...)); err != nil {
+		return nil, fmt.Errorf("postgres.RetrieveBatch: %w", err)
+	}
+	for i, docs := range results {
+		if results[i], err = ds.engine.transformResult(ctx, docs); err != nil {
+			return nil, fmt.Errorf("postgres.RetrieveBatch: query %d: %w", i, err)
+		}
+	}
+	return results, nil
+}
+
+// buildBatchQuery returns the query running the search of opts for each of
+// queries and its arguments. The query vectors are bound to $1 as a text
+// array, and each is searched for in a lateral subquery. Rows are selected
+// with the 1-based index of their query first, and ordered by it.
+func (ds *docStore) buildBatchQuery(ctx context.Context, queries [][]float32, opts *RetrieverOptions) (string, []any, error) {
+	if opts.MMR != nil || opts.Hybrid != nil || opts.After != nil || opts.AfterToken != "" || opts.GroupBy != nil || opts.MultiVector != nil || opts.CountTotal || opts.RollUp != nil || opts.Boost != nil || opts.MergeChunks != nil || ordered(opts) {
+		return "", nil, errors.New("batch retrieval cannot be combined with MMR, hybrid retrieval, pagination, grouping, multi-vector retrieval, total counts, roll-ups, boosts, merged chunks or ordering")
+	}
+	if ds.config.QueryTemplate != "" || ds.config.TextSearch != nil {
+		return "", nil, errors.New("batch retrieval cannot be combined with a query template or text search")
+	}
+	if opts.QueryEmbedding != nil || opts.QueryEmbeddingBytes != nil {
+		return "", nil, errors.New("batch retrieval takes its query embeddings as an argument, not as an option")
+	}
+	opts, err := ds.routeEmbedder(opts)
+	if err != nil {
+		return "", nil, err
+	}
+	k, err := ds.resolveK(opts)
+	if err != nil {
+		return "", nil, err
+	}
+	texts := make([]string, len(queries))
+	for i, q := range queries {
+		qopts := *opts
+		qopts.QueryEmbedding = q
+		vec, err := ds.queryEmbedding(ctx, &ai.RetrieverRequest{}, &qopts)
+		if err != nil {
+			return "", nil, fmt.Errorf("query %d: %w", i, err)
+		}
+		pv, err := newVector(vec)
+		if err != nil {
+			return "", nil, fmt.Errorf("query %d: %w", i, err)
+		}
+		texts[i] = ds.engine.vectorText(pv)
+	}
+
+	args := &queryArgs{}
+	arrayParam := args.add(texts)
+	search, err := ds.buildSearchQuery(fmt.Sprintf("q.query::%s", ds.engine.vectorType()), k, opts, args,
+		fmt.Sprintf(`"%s" AS batch_tiebreaker`, ds.config.TiebreakerColumn))
+	if err != nil {
+		return "", nil, err
+	}
+	query := fmt.Sprintf(`SELECT q.ord, r.* FROM unnest(%s::text[]) WITH ORDINALITY AS q(query, ord)`+
+		` CROSS JOIN LATERAL (%s) AS r ORDER BY q.ord, r.distance, r.batch_tiebreaker`, arrayParam, search)
+	return query, args.args, nil
+}
@@ -0,0 +1,50 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildBatchQuery(t *testing.T) {
+	ds := testDocStore()
+	ds.config.K = 3
+	query, args, err := ds.buildBatchQuery(context.Background(), [][]float32{{1, 2}, {0.5, -1}}, &RetrieverOptions{
+		Filters: []Filter{{Key: "lang", Value: "en"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT q.ord, r.* FROM unnest($1::text[]) WITH ORDINALITY AS q(query, ord) CROSS JOIN LATERAL (`+
+		`SELECT "id", "content", "metadata", "source", "embedding" <=> q.query::vector AS distance, "id" AS batch_tiebreaker FROM "public"."documents"`+
+		` WHERE "metadata"->>$2 = $3 ORDER BY distance, "id" LIMIT 3) AS r ORDER BY q.ord, r.distance, r.batch_tiebreaker`, query)
+	assert.Equal(t, []any{[]string{"[1,2]", "[0.5,-1]"}, "lang", "en"}, args)
+
+	// The dimension of each query is checked.
+	ds.dimension = 2
+	_, _, err = ds.buildBatchQuery(context.Background(), [][]float32{{1, 2}, {1}}, &RetrieverOptions{})
+	assert.ErrorIs(t, err, ErrDimensionMismatch)
+	assert.ErrorContains(t, err, "query 1")
+}
+
+func TestBuildBatchQueryUnsupportedOptions(t *testing.T) {
+	ds := testDocStore()
+	for _, opts := range []*RetrieverOptions{
+		{MMR: &MMROptions{Lambda: 0.5}},
+		{Hybrid: &HybridOptions{Query: "chunks"}},
+		{After: &Cursor{Key: "doc-1"}},
+		{GroupBy: &GroupOptions{Key: "source"}},
+		{QueryEmbedding: []float32{1, 2}},
+		{K: -1},
+		{CountTotal: true},
+	} {
+		_, _, err := ds.buildBatchQuery(context.Background(), [][]float32{{1, 2}}, opts)
+		assert.Error(t, err, "%+v", opts)
+	}
+}
+
+func TestRetrieveBatchEmpty(t *testing.T) {
+	ds := testDocStore()
+	results, err := ds.retrieveBatch(context.Background(), nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
@@ -0,0 +1,83 @@
+package postgresql
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// EncodeEmbedding returns emb in the binary format of
+// [WithBinaryEmbeddingFormat]: its values as IEEE 754 single-precision
+// floats of 4 little-endian bytes each, without a header, as written by
+// numpy's float32 tobytes on little-endian hosts.
+func EncodeEmbedding(emb []float32) []byte {
+	b := make([]byte, 0, 4*len(emb))
+	for _, v := range emb {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(v))
+	}
+	return b
+}
+
+// DecodeEmbedding returns the embedding encoded in b by [EncodeEmbedding].
+// It returns an error if the length of b is not a multiple of 4.
+func DecodeEmbedding(b []byte) ([]float32, error) {
+	if len(b)%4 != 0 {
+		return nil, fmt.Errorf("binary embedding has %d bytes, which is not a multiple of 4", len(b))
+	}
+	emb := make([]float32, len(b)/4)
+	for i := range emb {
+		emb[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return emb, nil
+}
+
+// decodeBinaryEmbedding returns the embedding held by v, a []byte in the
+// format of [EncodeEmbedding] or its standard base64 encoding. It reports
+// false if v has another type.
+func decodeBinaryEmbedding(v any) ([]float32, bool, error) {
+	var b []byte
+	switch v := v.(type) {
+	case []byte:
+		b = v
+	case string:
+		var err error
+		if b, err = base64.StdEncoding.DecodeString(v); err != nil {
+			return nil, true, fmt.Errorf("invalid base64 embedding: %w", err)
+		}
+	default:
+		return nil, false, nil
+	}
+	emb, err := DecodeEmbedding(b)
+	return emb, true, err
+}
+
+// returnedEmbedding returns emb as added to the metadata of retrieved
+// documents by [RetrieverOptions.ReturnEmbedding]: in the format of
+// [EncodeEmbedding] with [WithBinaryEmbeddingFormat], and as is otherwise.
+func (ds *docStore) returnedEmbedding(emb []float32) any {
+	if ds.engine.config.binaryEmbeddings {
+		return EncodeEmbedding(emb)
+	}
+	return emb
+}
+
+// withQueryEmbeddingBytes returns opts, or a copy of opts whose
+// QueryEmbedding is decoded from [RetrieverOptions.QueryEmbeddingBytes].
+func withQueryEmbeddingBytes(opts *RetrieverOptions) (*RetrieverOptions, error) {
+	if opts.QueryEmbeddingBytes == nil {
+		return opts, nil
+	}
+	if opts.QueryEmbedding != nil {
+		return nil, errors.New("QueryEmbedding and QueryEmbeddingBytes cannot both be set")
+	}
+	emb, err := DecodeEmbedding(opts.QueryEmbeddingBytes)
+	if err != nil {
+		return nil, fmt.Errorf("query embedding: %w", err)
+	}
+	decoded := *opts
+	decoded.QueryEmbedding = emb
+	decoded.QueryEmbeddingBytes = nil
+	return &decoded, nil
+}
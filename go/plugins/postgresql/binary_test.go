@@ -0,0 +1,70 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeEmbedding(t *testing.T) {
+	b := EncodeEmbedding([]float32{1, -2.5})
+	assert.Equal(t, []byte{0x00, 0x00, 0x80, 0x3f, 0x00, 0x00, 0x20, 0xc0}, b)
+	emb, err := DecodeEmbedding(b)
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{1, -2.5}, emb)
+
+	emb, err = DecodeEmbedding(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, emb)
+	_, err = DecodeEmbedding([]byte{1, 2, 3})
+	assert.ErrorContains(t, err, "not a multiple of 4")
+}
+
+func TestWithQueryEmbeddingBytes(t *testing.T) {
+	opts := &RetrieverOptions{K: 2}
+	got, err := withQueryEmbeddingBytes(opts)
+	assert.NoError(t, err)
+	assert.Same(t, opts, got)
+
+	// Options decoded from JSON carry the bytes in base64.
+	var decoded RetrieverOptions
+	assert.NoError(t, json.Unmarshal([]byte(`{"queryEmbeddingBytes":"AACAPwAAIMA="}`), &decoded))
+	got, err = withQueryEmbeddingBytes(&decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{1, -2.5}, got.QueryEmbedding)
+	assert.Nil(t, got.QueryEmbeddingBytes)
+	assert.NotNil(t, decoded.QueryEmbeddingBytes)
+
+	_, err = withQueryEmbeddingBytes(&RetrieverOptions{QueryEmbeddingBytes: []byte{1}})
+	assert.ErrorContains(t, err, "query embedding")
+	_, err = withQueryEmbeddingBytes(&RetrieverOptions{QueryEmbedding: []float32{1}, QueryEmbeddingBytes: EncodeEmbedding([]float32{1})})
+	assert.ErrorContains(t, err, "cannot both be set")
+}
+
+func TestEmbedDocumentsBinary(t *testing.T) {
+	emb := &fakeEmbedder{}
+	ds := testDocStore()
+	ds.config.Embedder = emb
+
+	docs := testDocuments("0", "1", "2")
+	docs[0].Metadata = map[string]any{EmbeddingMetadataKey: EncodeEmbedding([]float32{7})}
+	docs[2].Metadata = map[string]any{EmbeddingMetadataKey: base64.StdEncoding.EncodeToString(EncodeEmbedding([]float32{8}))}
+	_, err := ds.embedDocuments(context.Background(), docs)
+	assert.ErrorContains(t, err, "has type []uint8; set a decoder")
+
+	ds.engine.config.binaryEmbeddings = true
+	embeddings, err := ds.embedDocuments(context.Background(), docs)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]float32{{7}, {1}, {8}}, embeddings)
+	assert.Equal(t, EncodeEmbedding([]float32{7}), ds.returnedEmbedding([]float32{7}))
+
+	docs[1].Metadata = map[string]any{EmbeddingMetadataKey: "not base64!"}
+	_, err = ds.embedDocuments(context.Background(), docs)
+	assert.ErrorContains(t, err, "document 1: failed to decode the embedding in metadata key")
+
+	ds.engine.config.binaryEmbeddings = false
+	assert.Equal(t, []float32{7}, ds.returnedEmbedding([]float32{7}))
+}
@@ -0,0 +1,153 @@
+package postgresql
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// BoostOptions configures the ranking of a similarity search by distance
+// minus weighted boosts read from the metadata of the documents, such as an
+// authority score or the freshness of a publication date. The FetchK
+// nearest candidates are selected by distance, so that vector indexes are
+// still used, and the K of them with the lowest boosted distance are
+// returned. The distance and score of the returned documents are unboosted.
+type BoostOptions struct {
+	// Terms are the boosts, summed and subtracted from the distance. At
+	// least one is required.
+	Terms []BoostTerm `json:"terms,omitempty"`
+	// FetchK is the number of nearest candidates ranked by boosted distance.
+	// It defaults to 5*K and must be at least K.
+	FetchK int `json:"fetchK,omitempty"`
+}
+
+// BoostTerm is a boost of [BoostOptions]: Weight times the value of Key.
+// Documents without a value for Key are not boosted.
+type BoostTerm struct {
+	// Key is a column of [Config.MetadataColumns], or else a key of the JSON
+	// metadata column. The column must be numeric, or a timestamp or date
+	// with HalfLife; values of a JSON key other than numbers are ignored.
+	Key string `json:"key"`
+	// Weight scales the value of Key in units of distance. A positive weight
+	// ranks documents with higher values first. It must be finite.
+	Weight float64 `json:"weight"`
+	// HalfLife, if set, makes the value the freshness of Key, a timestamp or
+	// date column: 1 for now or later, halving every HalfLife before.
+	HalfLife time.Duration `json:"halfLife,omitempty"`
+}
+
+// withDefaults returns a copy of o with the defaults applied for a retrieval
+// of k documents, or an error if o is invalid.
+func (o BoostOptions) withDefaults(k int) (BoostOptions, error) {
+	if len(o.Terms) == 0 {
+		return BoostOptions{}, errors.New("boost requires at least one term")
+	}
+	for _, t := range o.Terms {
+		if t.Key == "" {
+			return BoostOptions{}, errors.New("boost key must not be empty")
+		}
+		if math.IsNaN(t.Weight) || math.IsInf(t.Weight, 0) {
+			return BoostOptions{}, fmt.Errorf("boost weight of %q must be finite, got %v", t.Key, t.Weight)
+		}
+		if t.HalfLife < 0 {
+			return BoostOptions{}, fmt.Errorf("boost half-life of %q must be positive, got %v", t.Key, t.HalfLife)
+		}
+	}
+	if o.FetchK == 0 {
+		o.FetchK = 5 * k
+	}
+	if o.FetchK < k {
+		return BoostOptions{}, fmt.Errorf("boost fetchK (%d) must be at least k (%d)", o.FetchK, k)
+	}
+	return o, nil
+}
+
+// checkBoost returns an error if the boost of opts cannot be applied to the
+// retrieval of req.
+func (ds *docStore) checkBoost(req *ai.RetrieverRequest, opts *RetrieverOptions) error {
+	switch {
+	case isLookup(req, opts):
+		return errors.New("boosting requires a query")
+	case ds.config.TextSearch != nil || ds.config.QueryTemplate != "":
+		return errors.New("boosting cannot be combined with text search or a query template")
+	case opts.MMR != nil || opts.Hybrid != nil || opts.GroupBy != nil || opts.MultiVector != nil || opts.After != nil || opts.RollUp != nil:
+		return errors.New("boosting cannot be combined with MMR, hybrid retrieval, grouping, multi-vector retrieval, pagination or roll-ups")
+	}
+	return nil
+}
+
+// boostExpr returns the expression of the sum of the weighted terms of o,
+// binding the weights and JSON keys in args.
+func (ds *docStore) boostExpr(o BoostOptions, args *queryArgs) (string, error) {
+	terms := make([]string, len(o.Terms))
+	for i, t := range o.Terms {
+		weight := args.add(t.Weight)
+		value, err := ds.boostValue(t, args)
+		if err != nil {
+			return "", err
+		}
+		terms[i] = fmt.Sprintf("%s::float8 * %s", weight, value)
+	}
+	return "(" + strings.Join(terms, " + ") + ")", nil
+}
+
+// boostValue returns the expression of the value of t, 0 for documents
+// without one.
+func (ds *docStore) boostValue(t BoostTerm, args *queryArgs) (string, error) {
+	if !slices.Contains(ds.config.MetadataColumns, t.Key) {
+		if ds.config.MetadataJSONColumn == "" {
+			return "", fmt.Errorf("boost key %q requires a metadata JSON column", t.Key)
+		}
+		if t.HalfLife > 0 {
+			return "", fmt.Errorf("boost key %q with a half-life must be a timestamp or date metadata column", t.Key)
+		}
+		key := args.add(t.Key)
+		return fmt.Sprintf(`COALESCE(CASE WHEN jsonb_typeof("%s"::jsonb->%s) = 'number' THEN ("%s"::jsonb->>%s)::float8 END, 0)`,
+			ds.config.MetadataJSONColumn, key, ds.config.MetadataJSONColumn, key), nil
+	}
+	typ, known := ds.columnTypes[t.Key]
+	if t.HalfLife > 0 {
+		if known && !strings.HasPrefix(typ, "timestamp") && typ != "date" {
+			return "", fmt.Errorf("boost column %q with a half-life is type %s, want a timestamp or date", t.Key, typ)
+		}
+		return fmt.Sprintf(`COALESCE(power(0.5, greatest(extract(epoch FROM now() - "%s")::float8, 0) / %s::float8), 0)`,
+			t.Key, args.add(t.HalfLife.Seconds())), nil
+	}
+	if known && !numericTypes[typ] {
+		return "", fmt.Errorf("boost column %q is type %s, want a numeric type", t.Key, typ)
+	}
+	return fmt.Sprintf(`COALESCE("%s"::float8, 0)`, t.Key), nil
+}
+
+// numericTypes holds the information_schema data types that cast to float8.
+var numericTypes = map[string]bool{
+	"smallint":         true,
+	"integer":          true,
+	"bigint":           true,
+	"numeric":          true,
+	"real":             true,
+	"double precision": true,
+}
+
+// boostSettings returns settings with the HNSW search list raised to the
+// number of candidates fetched by a boosted search of k documents, unless
+// opts sets it.
+func boostSettings(settings []setting, k int, opts *RetrieverOptions) []setting {
+	if opts.Boost == nil {
+		return settings
+	}
+	return efSearchSettings(settings, cmp.Or(opts.Boost.FetchK, 5*k), opts)
+}
+
+// boostQuery returns the query returning the k candidates of query with the
+// lowest boosted distance. query selects the candidates with their boost as
+// boost and the tiebreaker as boost_tiebreaker.
+func boostQuery(query string, k int) string {
+	return fmt.Sprintf(`SELECT * FROM (%s) AS candidates ORDER BY distance - boost, boost_tiebreaker LIMIT %d`, query, k)
+}
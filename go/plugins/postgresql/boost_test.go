@@ -0,0 +1,96 @@
+package postgresql
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildRetrieveQueryBoost(t *testing.T) {
+	ds := testDocStore()
+	ds.config.MetadataColumns = []string{"source", "published_at"}
+	boost := &BoostOptions{Terms: []BoostTerm{
+		{Key: "authority", Weight: 0.1},
+		{Key: "published_at", Weight: 0.05, HalfLife: 24 * time.Hour},
+	}}
+	query, args, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{Boost: boost})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM (SELECT "id", "content", "metadata", "source", "published_at", "embedding" <=> $1 AS distance,`+
+		` ($2::float8 * COALESCE(CASE WHEN jsonb_typeof("metadata"::jsonb->$3) = 'number' THEN ("metadata"::jsonb->>$3)::float8 END, 0)`+
+		` + $4::float8 * COALESCE(power(0.5, greatest(extract(epoch FROM now() - "published_at")::float8, 0) / $5::float8), 0)) AS boost,`+
+		` "id" AS boost_tiebreaker FROM "public"."documents" ORDER BY distance, "id" LIMIT 20) AS candidates`+
+		` ORDER BY distance - boost, boost_tiebreaker LIMIT 4`, query)
+	assert.Equal(t, []any{0.1, "authority", 0.05, 86400.0}, args[1:])
+
+	// Rescoring is replaced by the boosted ranking.
+	ds.engine.config.rescoreMultiplier = 4
+	query, _, err = ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{Boost: &BoostOptions{Terms: []BoostTerm{{Key: "source", Weight: 1}}, FetchK: 8}})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM (SELECT "id", "content", "metadata", "source", "published_at", "embedding" <=> $1 AS distance,`+
+		` ($2::float8 * COALESCE("source"::float8, 0)) AS boost, "id" AS boost_tiebreaker FROM "public"."documents"`+
+		` ORDER BY distance, "id" LIMIT 8) AS candidates ORDER BY distance - boost, boost_tiebreaker LIMIT 4`, query)
+}
+
+func TestBoostErrors(t *testing.T) {
+	ds := testDocStore()
+	ds.columnTypes = map[string]string{"source": "text"}
+	for _, boost := range []*BoostOptions{
+		{},
+		{Terms: []BoostTerm{{Weight: 1}}},
+		{Terms: []BoostTerm{{Key: "authority", Weight: math.Inf(1)}}},
+		{Terms: []BoostTerm{{Key: "authority", Weight: 1, HalfLife: -time.Hour}}},
+		{Terms: []BoostTerm{{Key: "authority", Weight: 1}}, FetchK: 2},
+		{Terms: []BoostTerm{{Key: "authority", Weight: 1, HalfLife: time.Hour}}},
+		{Terms: []BoostTerm{{Key: "source", Weight: 1}}},
+		{Terms: []BoostTerm{{Key: "source", Weight: 1, HalfLife: time.Hour}}},
+	} {
+		_, _, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{Boost: boost})
+		assert.Error(t, err, "%+v", boost)
+	}
+
+	query := &ai.RetrieverRequest{Query: ai.DocumentFromText("query", nil)}
+	boost := &BoostOptions{Terms: []BoostTerm{{Key: "authority", Weight: 1}}}
+	assert.NoError(t, ds.checkBoost(query, &RetrieverOptions{Boost: boost}))
+	assert.Error(t, ds.checkBoost(&ai.RetrieverRequest{}, &RetrieverOptions{Boost: boost, Filters: []Filter{{Key: "source", Value: "wiki"}}}))
+	assert.Error(t, ds.checkBoost(query, &RetrieverOptions{Boost: boost, MMR: &MMROptions{}}))
+}
+
+func TestBoostSettings(t *testing.T) {
+	boost := &BoostOptions{Terms: []BoostTerm{{Key: "authority", Weight: 1}}}
+	assert.Empty(t, boostSettings(nil, 4, &RetrieverOptions{}))
+	assert.Empty(t, boostSettings(nil, 4, &RetrieverOptions{Boost: boost}))
+	assert.Equal(t, []setting{{"hnsw.ef_search", "100"}}, boostSettings(nil, 20, &RetrieverOptions{Boost: boost}))
+}
+
+func TestBoostDerivedColumns(t *testing.T) {
+	db := &fakeDB{results: map[string]fakeResult{
+		"information_schema.columns": informationSchemaResult("id", "text", "content", "text", "embedding", "USER-DEFINED",
+			"metadata", "jsonb", "authority", "double precision", "region", "text", "published_at", "timestamp with time zone"),
+	}}
+	ds := testDocStore()
+	ds.engine = PostgresEngine{config: engineConfig{db: db.open(t)}}
+	ds.config.MetadataColumns = nil
+	ds.config.IgnoreMetadataColumns = []string{"unused"}
+	require.NoError(t, ds.validateConfiguration(context.Background()))
+
+	// The columns derived with IgnoreMetadataColumns are checked by type.
+	for _, term := range []BoostTerm{
+		{Key: "authority", Weight: 1},
+		{Key: "published_at", Weight: 1, HalfLife: time.Hour},
+	} {
+		_, _, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{Boost: &BoostOptions{Terms: []BoostTerm{term}}})
+		assert.NoError(t, err, "%+v", term)
+	}
+	for _, term := range []BoostTerm{
+		{Key: "region", Weight: 1},
+		{Key: "authority", Weight: 1, HalfLife: time.Hour},
+	} {
+		_, _, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{Boost: &BoostOptions{Terms: []BoostTerm{term}}})
+		assert.ErrorContains(t, err, "boost column", "%+v", term)
+	}
+}
@@ -0,0 +1,38 @@
+package postgresql
+
+import (
+	"unicode/utf8"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// charsPerToken is the number of characters per token assumed by
+// [WithTokenBudget] without a counter.
+const charsPerToken = 4
+
+// withinTokenBudget returns the first documents of docs whose text fits in
+// the budget set with [WithTokenBudget], and at least one, or docs if no
+// budget is set.
+func (pgEngine *PostgresEngine) withinTokenBudget(docs []*ai.Document) []*ai.Document {
+	budget := pgEngine.config.tokenBudget
+	if budget <= 0 {
+		return docs
+	}
+	used := 0
+	for i, doc := range docs {
+		used += pgEngine.countTokens(documentText(doc))
+		if used > budget && i > 0 {
+			return docs[:i]
+		}
+	}
+	return docs
+}
+
+// countTokens returns the number of tokens of text, as counted by the
+// counter of [WithTokenBudget] or else estimated from its length.
+func (pgEngine *PostgresEngine) countTokens(text string) int {
+	if counter := pgEngine.config.tokenCounter; counter != nil {
+		return counter(text)
+	}
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken
+}
@@ -0,0 +1,36 @@
+package postgresql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithinTokenBudget(t *testing.T) {
+	docs := []*ai.Document{
+		ai.DocumentFromText("one two three", nil),
+		ai.DocumentFromText("four five", nil),
+		ai.DocumentFromText("six seven eight nine", nil),
+	}
+	words := func(text string) int { return len(strings.Fields(text)) }
+
+	pgEngine := &PostgresEngine{}
+	assert.Equal(t, docs, pgEngine.withinTokenBudget(docs))
+
+	for budget, want := range map[int]int{1: 1, 3: 1, 5: 2, 8: 2, 9: 3, 100: 3} {
+		pgEngine.config = engineConfig{tokenBudget: budget, tokenCounter: words}
+		assert.Equal(t, docs[:want], pgEngine.withinTokenBudget(docs), "budget %d", budget)
+	}
+	assert.Empty(t, pgEngine.withinTokenBudget([]*ai.Document{}))
+
+	// Without a counter, tokens are estimated from the length of the text.
+	pgEngine.config = engineConfig{tokenBudget: 4}
+	assert.Equal(t, 4, pgEngine.countTokens("one two three"))
+	assert.Equal(t, docs[:1], pgEngine.withinTokenBudget(docs))
+
+	_, err := applyEngineOptions([]Option{WithPool(&pgxpool.Pool{}), WithDatabase("testdb"), WithTokenBudget(-1, nil)})
+	assert.Error(t, err)
+}
@@ -0,0 +1,148 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pgvector/pgvector-go"
+)
+
+// vectorCodec is a pgx codec for the vector and halfvec types, in their text
+// format. It lets []float32 and []float64 values bind directly to vector
+// parameters, and vector values be scanned into []float32 or
+// [pgvector.Vector]. Decoded into any, vectors remain strings, as they are
+// for unregistered types.
+type vectorCodec struct{}
+
+func (vectorCodec) FormatSupported(format int16) bool {
+	return format == pgtype.TextFormatCode
+}
+
+func (vectorCodec) PreferredFormat() int16 {
+	return pgtype.TextFormatCode
+}
+
+func (vectorCodec) PlanEncode(m *pgtype.Map, oid uint32, format int16, value any) pgtype.EncodePlan {
+	if format == pgtype.BinaryFormatCode {
+		// COPY always uses the binary format; CopyDocuments encodes
+		// embeddings itself, as returned by encodeVectorBinary.
+		if _, ok := value.([]byte); ok {
+			return encodePlanVectorBinaryBytes{}
+		}
+		return nil
+	}
+	if format != pgtype.TextFormatCode {
+		return nil
+	}
+	switch value.(type) {
+	case []float32, []float64, pgvector.Vector:
+		return encodePlanVectorText{}
+	}
+	return nil
+}
+
+type encodePlanVectorBinaryBytes struct{}
+
+func (encodePlanVectorBinaryBytes) Encode(value any, buf []byte) ([]byte, error) {
+	return append(buf, value.([]byte)...), nil
+}
+
+type encodePlanVectorText struct{}
+
+func (encodePlanVectorText) Encode(value any, buf []byte) ([]byte, error) {
+	var vec pgvector.Vector
+	var err error
+	switch v := value.(type) {
+	case []float32:
+		vec, err = newVector(v)
+	case []float64:
+		vec, err = newVector(v)
+	case pgvector.Vector:
+		vec, err = newVector(v.Slice())
+	}
+	if err != nil {
+		return nil, err
+	}
+	text, err := vec.Value()
+	if err != nil {
+		return nil, err
+	}
+	return append(buf, text.(string)...), nil
+}
+
+func (vectorCodec) PlanScan(m *pgtype.Map, oid uint32, format int16, target any) pgtype.ScanPlan {
+	if format != pgtype.TextFormatCode {
+		return nil
+	}
+	switch target.(type) {
+	case *[]float32, *pgvector.Vector, *string:
+		return scanPlanVectorText{}
+	}
+	return nil
+}
+
+type scanPlanVectorText struct{}
+
+func (scanPlanVectorText) Scan(src []byte, target any) error {
+	if src == nil {
+		switch t := target.(type) {
+		case *[]float32:
+			*t = nil
+			return nil
+		case *pgvector.Vector:
+			*t = pgvector.Vector{}
+			return nil
+		}
+		return fmt.Errorf("cannot scan NULL into %T", target)
+	}
+	switch t := target.(type) {
+	case *string:
+		*t = string(src)
+		return nil
+	case *pgvector.Vector:
+		return t.Scan(string(src))
+	case *[]float32:
+		var vec pgvector.Vector
+		if err := vec.Scan(string(src)); err != nil {
+			return err
+		}
+		*t = vec.Slice()
+		return nil
+	}
+	return fmt.Errorf("cannot scan vector into %T", target)
+}
+
+func (c vectorCodec) DecodeDatabaseSQLValue(m *pgtype.Map, oid uint32, format int16, src []byte) (driver.Value, error) {
+	return c.DecodeValue(m, oid, format, src)
+}
+
+func (vectorCodec) DecodeValue(m *pgtype.Map, oid uint32, format int16, src []byte) (any, error) {
+	if src == nil {
+		return nil, nil
+	}
+	return string(src), nil
+}
+
+// registerVectorTypes registers vectorCodec for the vector and halfvec types
+// of the database on conn, if the extension defining them is installed. It
+// is run for each connection of the pools built by the engine; connections
+// opened before the extension is created are left unchanged, which only
+// means that raw slices cannot be bound on them.
+func registerVectorTypes(ctx context.Context, conn *pgx.Conn) error {
+	const query = `SELECT COALESCE(to_regtype('vector')::oid, 0), COALESCE(to_regtype('halfvec')::oid, 0)`
+	var vectorOID, halfvecOID uint32
+	if err := conn.QueryRow(ctx, query).Scan(&vectorOID, &halfvecOID); err != nil {
+		return fmt.Errorf("failed to look up the vector types: %w", err)
+	}
+	m := conn.TypeMap()
+	if vectorOID != 0 {
+		m.RegisterType(&pgtype.Type{Name: string(Vector), OID: vectorOID, Codec: vectorCodec{}})
+	}
+	if halfvecOID != 0 {
+		m.RegisterType(&pgtype.Type{Name: string(HalfVec), OID: halfvecOID, Codec: vectorCodec{}})
+	}
+	return nil
+}
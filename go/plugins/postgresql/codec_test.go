@@ -0,0 +1,76 @@
+package postgresql
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pgvector/pgvector-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// testVectorOID stands for the OID of the vector type in a database.
+const testVectorOID = 100000
+
+func newVectorTypeMap() *pgtype.Map {
+	m := pgtype.NewMap()
+	m.RegisterType(&pgtype.Type{Name: "vector", OID: testVectorOID, Codec: vectorCodec{}})
+	return m
+}
+
+func TestVectorCodecEncode(t *testing.T) {
+	m := newVectorTypeMap()
+	for _, v := range []any{[]float32{1, 2.5}, []float64{1, 2.5}, pgvector.NewVector([]float32{1, 2.5})} {
+		buf, err := m.Encode(testVectorOID, pgtype.TextFormatCode, v, nil)
+		assert.NoError(t, err, "%T", v)
+		assert.Equal(t, "[1,2.5]", string(buf), "%T", v)
+	}
+
+	bin, err := encodeVectorBinary([]float32{1}, Vector)
+	assert.NoError(t, err)
+	buf, err := m.Encode(testVectorOID, pgtype.BinaryFormatCode, bin, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, bin, buf)
+
+	for _, v := range []any{[]float32{}, []float64{math.NaN()}, []float64{math.Inf(1)}, []float64{1e300}} {
+		_, err := m.Encode(testVectorOID, pgtype.TextFormatCode, v, nil)
+		assert.Error(t, err, "%v", v)
+	}
+}
+
+func TestVectorCodecScan(t *testing.T) {
+	m := newVectorTypeMap()
+	src := []byte("[1,2.5]")
+
+	var slice []float32
+	assert.NoError(t, m.Scan(testVectorOID, pgtype.TextFormatCode, src, &slice))
+	assert.Equal(t, []float32{1, 2.5}, slice)
+
+	var vec pgvector.Vector
+	assert.NoError(t, m.Scan(testVectorOID, pgtype.TextFormatCode, src, &vec))
+	assert.Equal(t, []float32{1, 2.5}, vec.Slice())
+
+	var s string
+	assert.NoError(t, m.Scan(testVectorOID, pgtype.TextFormatCode, src, &s))
+	assert.Equal(t, "[1,2.5]", s)
+
+	assert.NoError(t, m.Scan(testVectorOID, pgtype.TextFormatCode, nil, &slice))
+	assert.Nil(t, slice)
+
+	v, err := vectorCodec{}.DecodeValue(m, testVectorOID, pgtype.TextFormatCode, src)
+	assert.NoError(t, err)
+	assert.Equal(t, "[1,2.5]", v)
+}
+
+func TestNewVector(t *testing.T) {
+	vec, err := newVector([]float64{1, -0.5})
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{1, -0.5}, vec.Slice())
+
+	_, err = newVector([]float32{})
+	assert.ErrorContains(t, err, "empty")
+	_, err = newVector([]float32{1, float32(math.NaN())})
+	assert.ErrorContains(t, err, "element 1")
+	_, err = newVector([]float32{float32(math.Inf(-1))})
+	assert.Error(t, err)
+}
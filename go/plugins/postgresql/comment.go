@@ -0,0 +1,93 @@
+package postgresql
+
+import (
+	"context"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type queryTagsKey struct{}
+
+// WithQueryTags returns a context whose queries are tagged with tags, such
+// as the flow and action that run them, when [WithSQLCommenter] is enabled.
+// The tags are added to those already in ctx.
+func WithQueryTags(ctx context.Context, tags map[string]string) context.Context {
+	merged := maps.Clone(queryTags(ctx))
+	if merged == nil {
+		merged = make(map[string]string, len(tags))
+	}
+	maps.Copy(merged, tags)
+	return context.WithValue(ctx, queryTagsKey{}, merged)
+}
+
+// queryTags returns the tags added to ctx by WithQueryTags.
+func queryTags(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(queryTagsKey{}).(map[string]string)
+	return tags
+}
+
+// sqlComment returns the sqlcommenter comment describing the query run with
+// ctx: its query tags, and the traceparent of the span of ctx if any. Keys
+// and values are URL encoded, which leaves no quote or comment delimiter in
+// them. It returns the empty string if there is nothing to describe.
+func sqlComment(ctx context.Context) string {
+	tags := maps.Clone(queryTags(ctx))
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		if tags == nil {
+			tags = make(map[string]string, 1)
+		}
+		tags["traceparent"] = "00-" + sc.TraceID().String() + "-" + sc.SpanID().String() + "-" + sc.TraceFlags().String()
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(tags))
+	for _, k := range slices.Sorted(maps.Keys(tags)) {
+		pairs = append(pairs, url.PathEscape(k)+"='"+url.PathEscape(tags[k])+"'")
+	}
+	return "/*" + strings.Join(pairs, ",") + "*/ "
+}
+
+// commentingQuerier prepends the sqlcommenter comment of their context to
+// the statements of a querier.
+type commentingQuerier struct {
+	q querier
+}
+
+// commented returns q, prepending sqlcommenter comments to its statements if
+// [WithSQLCommenter] is enabled.
+func (pgEngine *PostgresEngine) commented(q querier) querier {
+	if !pgEngine.config.sqlCommenter {
+		return q
+	}
+	return commentingQuerier{q}
+}
+
+func (q commentingQuerier) Exec(ctx context.Context, query string, args ...any) (int64, error) {
+	return q.q.Exec(ctx, sqlComment(ctx)+query, args...)
+}
+
+func (q commentingQuerier) Query(ctx context.Context, query string, args ...any) (queryRows, error) {
+	return q.q.Query(ctx, sqlComment(ctx)+query, args...)
+}
+
+func (q commentingQuerier) QueryRow(ctx context.Context, query string, args ...any) pgx.Row {
+	return q.q.QueryRow(ctx, sqlComment(ctx)+query, args...)
+}
+
+func (q commentingQuerier) QueryBatch(ctx context.Context, query string, argLists [][]any, scan func(i int, row pgx.Row) error) (int, error) {
+	return q.q.QueryBatch(ctx, sqlComment(ctx)+query, argLists, scan)
+}
+
+func (q commentingQuerier) QueryLocal(ctx context.Context, settings []setting, query string, args ...any) (queryRows, error) {
+	return q.q.QueryLocal(ctx, settings, sqlComment(ctx)+query, args...)
+}
+
+func (q commentingQuerier) QueryCursor(ctx context.Context, settings []setting, fetchSize int, query string, args ...any) (queryRows, error) {
+	return q.q.QueryCursor(ctx, settings, fetchSize, sqlComment(ctx)+query, args...)
+}
@@ -0,0 +1,39 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSQLComment(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "", sqlComment(ctx))
+
+	ctx = WithQueryTags(ctx, map[string]string{"flow": "answer question", "action": "retrieve"})
+	ctx = WithQueryTags(ctx, map[string]string{"action": "index", "note": "it's */ done"})
+	assert.Equal(t, `/*action='index',flow='answer%20question',note='it%27s%20%2A%2F%20done'*/ `, sqlComment(ctx))
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx = trace.ContextWithSpanContext(context.Background(), sc)
+	assert.Equal(t, `/*traceparent='00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01'*/ `, sqlComment(ctx))
+}
+
+func TestCommentingQuerier(t *testing.T) {
+	ctx := WithQueryTags(context.Background(), map[string]string{"flow": "search"})
+	tx := &localTx{}
+	q := (&PostgresEngine{config: engineConfig{sqlCommenter: true}}).commented(poolQuerier{localPool{tx: tx}})
+	rows, err := q.QueryLocal(ctx, []setting{{"hnsw.ef_search", "100"}}, "SELECT 1")
+	assert.NoError(t, err)
+	rows.Close()
+	assert.Equal(t, [][]any{{setLocalQuery, "hnsw.ef_search", "100"}}, tx.execs)
+	assert.Equal(t, []string{"/*flow='search'*/ SELECT 1"}, tx.queries)
+
+	assert.IsType(t, poolQuerier{}, (&PostgresEngine{}).commented(poolQuerier{}))
+}
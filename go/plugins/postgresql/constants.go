@@ -1,5 +1,31 @@
 package postgresql
 
+import "time"
+
+// Metadata keys under which retrieved documents carry their similarity and,
+// if requested, their embedding, and which the indexer sets.
+const (
+	// DistanceMetadataKey holds the distance between the document and the
+	// query, as computed by the configured [DistanceStrategy].
+	DistanceMetadataKey = "_distance"
+	// ScoreMetadataKey holds a similarity score derived from the distance,
+	// where higher is more similar. See [DistanceStrategy.Score].
+	ScoreMetadataKey = "_score"
+	// EmbeddingMetadataKey holds the stored embedding of the document, as a
+	// []float32, or a []byte with [WithBinaryEmbeddingFormat], with
+	// [RetrieverOptions.ReturnEmbedding]. Indexed documents
+	// may carry a precomputed embedding under it, which is stored instead of
+	// embedding the document; see [WithEmbeddingDecoder].
+	EmbeddingMetadataKey = "_embedding"
+	// TruncatedMetadataKey is set to true in the metadata of documents
+	// whose content was truncated when indexed, with
+	// [OverflowTruncateAndMark].
+	TruncatedMetadataKey = "_truncated"
+	// ContentRefMetadataKey holds the reference to the content of documents
+	// retrieved from tables with [Config.ExternalContent].
+	ContentRefMetadataKey = "_content_ref"
+)
+
 const (
 	defaultSchemaName         = "public"
 	defaultIDColumn           = "id"
@@ -7,5 +33,13 @@ const (
 	defaultEmbeddingColumn    = "embedding"
 	defaultMetadataJsonColumn = "metadata"
 	defaultCount              = 4
+	defaultIndexBatchSize     = 100
+	defaultAcquireTimeout     = 30 * time.Second
 	defaultUserAgent          = "genkit-cloud-sql-pg-go/0.0.0"
+	defaultApplicationName    = "genkit-postgresql"
+	// maxIndexableDimensions is the largest vector dimension pgvector
+	// supports in HNSW and IVFFlat indexes.
+	maxIndexableDimensions = 2000
+	// maxIndexableHalfVecDimensions is the same limit for halfvec columns.
+	maxIndexableHalfVecDimensions = 4000
 )
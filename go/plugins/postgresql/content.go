@@ -0,0 +1,278 @@
+package postgresql
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// ContentType is the type of the content column of a table.
+type ContentType string
+
+const (
+	// TextContent stores the text of the documents: the concatenated text
+	// of their text parts, returned as a single text part. Documents with
+	// other parts, such as media, cannot be indexed.
+	TextContent ContentType = "text"
+	// JSONBContent stores the content parts of the documents as a JSON
+	// array, in the JSON form of [ai.Part], so that multi-part content,
+	// including media and data parts, is returned as it was indexed and
+	// can be queried.
+	JSONBContent ContentType = "jsonb"
+	// ByteaContent stores the text of the documents as bytes, like
+	// TextContent.
+	ByteaContent ContentType = "bytea"
+)
+
+// validate returns an error if t is not a known content type.
+func (t ContentType) validate() error {
+	switch t {
+	case TextContent, JSONBContent, ByteaContent:
+		return nil
+	}
+	return fmt.Errorf("invalid content type %q: must be text, jsonb or bytea", t)
+}
+
+// ContentOverflow is the handling of indexed documents whose content exceeds
+// the limit set with [WithMaxContentLength].
+type ContentOverflow string
+
+const (
+	// OverflowTruncate keeps the first characters of the content, up to
+	// the limit. Text parts past the limit are dropped; other parts are
+	// kept.
+	OverflowTruncate ContentOverflow = "truncate"
+	// OverflowTruncateAndMark truncates the content like OverflowTruncate
+	// and sets [TruncatedMetadataKey] in the metadata of the document,
+	// which is stored in the JSON metadata column.
+	OverflowTruncateAndMark ContentOverflow = "truncate_and_mark"
+	// OverflowReject rejects the index request.
+	OverflowReject ContentOverflow = "reject"
+)
+
+// validate returns an error if o is not a known overflow handling.
+func (o ContentOverflow) validate() error {
+	switch o {
+	case OverflowTruncate, OverflowTruncateAndMark, OverflowReject:
+		return nil
+	}
+	return fmt.Errorf("invalid content overflow %q: must be truncate, truncate_and_mark or reject", o)
+}
+
+// contentTypeOf returns the content type of a column of the given data type,
+// as reported by information_schema.columns.
+func contentTypeOf(dataType string) (ContentType, bool) {
+	switch {
+	case dataType == "text" || strings.Contains(dataType, "char"):
+		return TextContent, true
+	case dataType == "jsonb" || dataType == "json":
+		return JSONBContent, true
+	case dataType == "bytea":
+		return ByteaContent, true
+	}
+	return "", false
+}
+
+// contentValue returns the value written to the content column for doc. With
+// [Config.ExternalContent], it is nil, and the reference to the stored
+// content is set by storeContent.
+func (ds *docStore) contentValue(doc *ai.Document) (any, error) {
+	if ds.config.ExternalContent != nil {
+		return nil, nil
+	}
+	switch ds.contentType {
+	case JSONBContent:
+		parts := doc.Content
+		if parts == nil {
+			parts = []*ai.Part{}
+		}
+		b, err := json.Marshal(parts)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling document content: %w", err)
+		}
+		return string(b), nil
+	}
+	if err := ds.checkContentParts(doc); err != nil {
+		return nil, err
+	}
+	if ds.contentType == ByteaContent {
+		return []byte(documentText(doc)), nil
+	}
+	return documentText(doc), nil
+}
+
+// checkContentParts returns an error if the content column cannot store
+// all the parts of doc.
+func (ds *docStore) checkContentParts(doc *ai.Document) error {
+	if ds.contentType == JSONBContent || ds.config.ExternalContent != nil {
+		return nil
+	}
+	for i, p := range doc.Content {
+		if p.Kind != ai.PartText {
+			return fmt.Errorf("content part %d is a %s part, which a %s content column cannot store; use a %s content column for multi-part content",
+				i, partKindName(p.Kind), ds.contentType, JSONBContent)
+		}
+	}
+	return nil
+}
+
+// partKindName returns a name of the kind of a part for error messages.
+func partKindName(k ai.PartKind) string {
+	switch k {
+	case ai.PartText:
+		return "text"
+	case ai.PartMedia:
+		return "media"
+	case ai.PartData:
+		return "data"
+	case ai.PartToolRequest:
+		return "tool request"
+	case ai.PartToolResponse:
+		return "tool response"
+	}
+	return fmt.Sprintf("kind %d", k)
+}
+
+// contentParts returns the content parts of a document read from a content
+// column holding v.
+func (ds *docStore) contentParts(v any) ([]*ai.Part, error) {
+	if v == nil {
+		return []*ai.Part{ai.NewTextPart("")}, nil
+	}
+	if ds.contentType != JSONBContent {
+		switch v := v.(type) {
+		case string:
+			return []*ai.Part{ai.NewTextPart(v)}, nil
+		case []byte:
+			return []*ai.Part{ai.NewTextPart(string(v))}, nil
+		}
+		return nil, fmt.Errorf("content column %q has type %T, want string", ds.config.ContentColumn, v)
+	}
+	var b []byte
+	switch v := v.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		// pgx decodes JSON values.
+		var err error
+		if b, err = json.Marshal(v); err != nil {
+			return nil, fmt.Errorf("invalid content in column %q: %w", ds.config.ContentColumn, err)
+		}
+	}
+	var parts []*ai.Part
+	if err := json.Unmarshal(b, &parts); err != nil {
+		return nil, fmt.Errorf("invalid content in column %q: %w", ds.config.ContentColumn, err)
+	}
+	for _, p := range parts {
+		// The JSON form of text parts has no content type; restore that
+		// of [ai.NewTextPart].
+		if p.Kind == ai.PartText && p.ContentType == "" {
+			p.ContentType = "plain/text"
+		}
+	}
+	return parts, nil
+}
+
+// limitContent applies the content length limit set with
+// [WithMaxContentLength] to docs. It returns docs itself if no document
+// exceeds the limit, and otherwise a copy in which those that do are
+// replaced by truncated copies; the documents of the caller are not
+// modified.
+func (ds *docStore) limitContent(docs []*ai.Document) ([]*ai.Document, error) {
+	if ds.engine.config.maxContentLength == 0 {
+		return docs, nil
+	}
+	limited, copied := docs, false
+	for i, doc := range docs {
+		ldoc, err := ds.limitDocument(doc)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		if ldoc == doc {
+			continue
+		}
+		if !copied {
+			limited, copied = slices.Clone(docs), true
+		}
+		limited[i] = ldoc
+	}
+	return limited, nil
+}
+
+// limitDocument applies the content length limit of limitContent to doc,
+// returning doc itself if it does not exceed the limit.
+func (ds *docStore) limitDocument(doc *ai.Document) (*ai.Document, error) {
+	limit := ds.engine.config.maxContentLength
+	if limit == 0 {
+		return doc, nil
+	}
+	n := 0
+	for _, p := range doc.Content {
+		if p.Kind == ai.PartText {
+			n += utf8.RuneCountInString(p.Text)
+		}
+	}
+	if n <= limit {
+		return doc, nil
+	}
+	overflow := cmp.Or(ds.engine.config.contentOverflow, OverflowTruncate)
+	if overflow == OverflowReject {
+		return nil, fmt.Errorf("content has %d characters, more than the limit of %d", n, limit)
+	}
+	return truncateContent(doc, limit, overflow == OverflowTruncateAndMark), nil
+}
+
+// truncateContent returns a copy of doc whose text parts hold at most limit
+// characters in total. With mark, [TruncatedMetadataKey] is set in the
+// metadata of the copy.
+func truncateContent(doc *ai.Document, limit int, mark bool) *ai.Document {
+	parts := make([]*ai.Part, 0, len(doc.Content))
+	remaining := limit
+	for _, p := range doc.Content {
+		if p.Kind != ai.PartText {
+			parts = append(parts, p)
+			continue
+		}
+		if remaining == 0 {
+			continue
+		}
+		text, n := truncateRunes(p.Text, remaining)
+		remaining -= n
+		if text != p.Text {
+			tp := *p
+			tp.Text = text
+			p = &tp
+		}
+		parts = append(parts, p)
+	}
+	metadata := doc.Metadata
+	if mark {
+		metadata = maps.Clone(metadata)
+		if metadata == nil {
+			metadata = make(map[string]any)
+		}
+		metadata[TruncatedMetadataKey] = true
+	}
+	return &ai.Document{Content: parts, Metadata: metadata}
+}
+
+// truncateRunes returns the prefix of s made of at most n runes, so that
+// multibyte characters are not split, and the number of runes in it.
+func truncateRunes(s string, n int) (string, int) {
+	count := 0
+	for i := range s {
+		if count == n {
+			return s[:i], count
+		}
+		count++
+	}
+	return s, count
+}
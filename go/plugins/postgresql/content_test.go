@@ -0,0 +1,141 @@
+package postgresql
+
+import (
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentRoundTrip(t *testing.T) {
+	doc := &ai.Document{Content: []*ai.Part{
+		ai.NewTextPart("hello "),
+		ai.NewMediaPart("image/png", "data:image/png;base64,AAAA"),
+	}}
+
+	ds := testDocStore()
+	ds.contentType = JSONBContent
+	v, err := ds.contentValue(doc)
+	require.NoError(t, err)
+	assert.IsType(t, "", v)
+	parts, err := ds.contentParts(v)
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+	assert.Equal(t, doc.Content[0], parts[0])
+	assert.True(t, parts[1].IsMedia())
+	assert.Equal(t, "image/png", parts[1].ContentType)
+	assert.Equal(t, "data:image/png;base64,AAAA", parts[1].Text)
+
+	// pgx decodes jsonb values into Go values.
+	parts, err = ds.contentParts([]any{map[string]any{"text": "decoded"}})
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+	assert.Equal(t, "decoded", parts[0].Text)
+	_, err = ds.contentParts(`{"text": "not an array"}`)
+	assert.Error(t, err)
+
+	// Text columns store the concatenated text parts and reject other parts.
+	textDoc := &ai.Document{Content: []*ai.Part{ai.NewTextPart("hello "), ai.NewTextPart("world")}}
+	ds.contentType = ByteaContent
+	v, err = ds.contentValue(textDoc)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello world"), v)
+	parts, err = ds.contentParts(v)
+	require.NoError(t, err)
+	assert.Equal(t, []*ai.Part{ai.NewTextPart("hello world")}, parts)
+	_, err = ds.contentValue(doc)
+	assert.ErrorContains(t, err, "content part 1 is a media part")
+
+	ds.contentType = TextContent
+	v, err = ds.contentValue(textDoc)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", v)
+	_, err = ds.contentValue(&ai.Document{Content: []*ai.Part{ai.NewDataPart(`{"a": 1}`)}})
+	assert.ErrorContains(t, err, "content part 0 is a data part")
+	_, err = ds.contentParts(42)
+	assert.Error(t, err)
+}
+
+func TestContentTypeOf(t *testing.T) {
+	for dataType, want := range map[string]ContentType{
+		"text":              TextContent,
+		"character varying": TextContent,
+		"varchar":           TextContent,
+		"jsonb":             JSONBContent,
+		"json":              JSONBContent,
+		"bytea":             ByteaContent,
+	} {
+		got, ok := contentTypeOf(dataType)
+		assert.True(t, ok, dataType)
+		assert.Equal(t, want, got, dataType)
+	}
+	_, ok := contentTypeOf("integer")
+	assert.False(t, ok)
+
+	assert.NoError(t, JSONBContent.validate())
+	assert.Error(t, ContentType("xml").validate())
+}
+
+func TestLimitContent(t *testing.T) {
+	ds := testDocStore()
+	ds.engine.config.maxContentLength = 5
+	short := ai.DocumentFromText("héllo", nil)
+	long := &ai.Document{
+		Content: []*ai.Part{
+			ai.NewTextPart("日本"),
+			ai.NewMediaPart("image/png", "data:image/png;base64,AAAA"),
+			ai.NewTextPart("語テキスト"),
+			ai.NewTextPart("more"),
+		},
+		Metadata: map[string]any{"source": "a"},
+	}
+	docs := []*ai.Document{short, long}
+
+	limited, err := ds.limitContent(docs)
+	assert.NoError(t, err)
+	assert.Same(t, short, limited[0])
+	if assert.Len(t, limited[1].Content, 3) {
+		assert.Equal(t, "日本", limited[1].Content[0].Text)
+		assert.Same(t, long.Content[1], limited[1].Content[1])
+		assert.Equal(t, "語テキ", limited[1].Content[2].Text)
+	}
+	assert.Equal(t, map[string]any{"source": "a"}, limited[1].Metadata)
+	// The caller's documents are unchanged.
+	assert.Same(t, long, docs[1])
+	assert.Equal(t, "語テキスト", long.Content[2].Text)
+
+	ds.engine.config.contentOverflow = OverflowTruncateAndMark
+	limited, err = ds.limitContent(docs)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"source": "a", TruncatedMetadataKey: true}, limited[1].Metadata)
+	assert.Equal(t, map[string]any{"source": "a"}, long.Metadata)
+
+	ds.engine.config.contentOverflow = OverflowReject
+	_, err = ds.limitContent(docs)
+	assert.ErrorContains(t, err, "document 1: content has 11 characters, more than the limit of 5")
+
+	// Without a limit, documents are kept as they are.
+	ds.engine.config.maxContentLength = 0
+	limited, err = ds.limitContent(docs)
+	assert.NoError(t, err)
+	assert.Same(t, long, limited[1])
+}
+
+func TestTruncateRunes(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"hello", 3, "hel"},
+		{"héllo", 2, "hé"},
+		{"日本語", 5, "日本語"},
+		{"🙂🙂", 1, "🙂"},
+		{"abc", 0, ""},
+	} {
+		got, n := truncateRunes(tc.s, tc.n)
+		assert.Equal(t, tc.want, got, tc.s)
+		assert.Equal(t, len([]rune(tc.want)), n, tc.s)
+	}
+}
@@ -0,0 +1,132 @@
+package postgresql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// contentHash returns the hash written to [Config.ContentHashColumn] for doc:
+// the hex-encoded SHA-256 of its JSON encoding, which covers its content
+// and metadata, with map keys in sorted order.
+func contentHash(doc *ai.Document) (string, error) {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling document: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// validateContentHash checks that [Config.ContentHashColumn], if set, can
+// identify the row of each document by its id.
+func (ds *docStore) validateContentHash() error {
+	if ds.config.ContentHashColumn == "" {
+		return nil
+	}
+	switch {
+	case ds.customConflict():
+		return errors.New("a content hash column cannot be combined with conflict columns")
+	case len(ds.config.ColumnEmbedders) > 0:
+		return errors.New("a content hash column cannot be combined with column embedders")
+	case ds.config.ExternalContent != nil:
+		return errors.New("a content hash column cannot be combined with external content")
+	}
+	return nil
+}
+
+// unchangedRows looks up the rows of docs whose content hash is that of their
+// document. It returns, for each document, the stored embedding of such a
+// row, which spares embedding the document again, or nil, and whether the
+// row is live, so that writing the document would not change it. A
+// soft-deleted row is written again to restore it. Documents whose id or
+// hash cannot be computed are left to fail when their row is built.
+func (ds *docStore) unchangedRows(ctx context.Context, q querier, docs []*ai.Document) (stored [][]float32, unchanged []bool, err error) {
+	ids := make([]string, len(docs))
+	hashes := make([]string, len(docs))
+	var lookupIDs, lookupHashes []string
+	for i, doc := range docs {
+		id, err := ds.rowID(doc)
+		if err != nil {
+			continue
+		}
+		hash, err := contentHash(doc)
+		if err != nil {
+			continue
+		}
+		ids[i], hashes[i] = id, hash
+		lookupIDs = append(lookupIDs, id)
+		lookupHashes = append(lookupHashes, hash)
+	}
+	stored = make([][]float32, len(docs))
+	unchanged = make([]bool, len(docs))
+	if len(lookupIDs) == 0 {
+		return stored, unchanged, nil
+	}
+
+	qctx, cancel := ds.engine.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := q.Query(qctx, ds.contentHashQuery(), lookupIDs, lookupHashes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to look up content hashes: %w", queryTimeoutError(qctx, describeQueryError(err, ds.config)))
+	}
+	defer rows.Close()
+	type storedRow struct {
+		hash      string
+		embedding []float32
+		deleted   bool
+	}
+	found := make(map[string]storedRow)
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read content hash: %w", queryTimeoutError(qctx, err))
+		}
+		hash, _ := values[1].(string)
+		deleted, _ := values[3].(bool)
+		emb, err := parseEmbedding(values[2])
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid embedding of row %q: %w", idToString(values[0]), err)
+		}
+		found[idToString(values[0])] = storedRow{hash: hash, embedding: emb, deleted: deleted}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to look up content hashes: %w", queryTimeoutError(qctx, describeQueryError(err, ds.config)))
+	}
+
+	for i := range docs {
+		if r, ok := found[ids[i]]; ok && ids[i] != "" && r.hash == hashes[i] {
+			stored[i] = r.embedding
+			unchanged[i] = !r.deleted
+		}
+	}
+	return stored, unchanged, nil
+}
+
+// contentHashQuery returns the query selecting the id, content hash and
+// embedding of the rows whose id is in $1 and content hash in $2, and
+// whether they are soft-deleted.
+func (ds *docStore) contentHashQuery() string {
+	deleted := "false"
+	if col := ds.engine.config.softDeleteColumn; col != "" {
+		deleted = fmt.Sprintf(`"%s" IS NOT NULL`, col)
+	}
+	return fmt.Sprintf(`SELECT "%s"::text, "%s", "%s", %s FROM %s WHERE "%s" = ANY($1) AND "%s" = ANY($2)`,
+		ds.config.IDColumn, ds.config.ContentHashColumn, ds.config.EmbeddingColumn, deleted,
+		qualifiedName(ds.config.SchemaName, ds.config.TableName), ds.config.IDColumn, ds.config.ContentHashColumn)
+}
+
+// markUnchanged sets the status of the results of the documents whose row
+// was left untouched as unchanged, given by their position in the request.
+func markUnchanged(results []IndexResult, unchanged map[int]bool) {
+	for i := range results {
+		if unchanged[i] && results[i].Status == IndexSkipped {
+			results[i].Status = IndexUnchanged
+		}
+	}
+}
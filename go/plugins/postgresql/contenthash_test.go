@@ -0,0 +1,141 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hashQuerier returns stored rows for content hash lookups, and reports the
+// rows written whose hash is in unchanged as left untouched.
+type hashQuerier struct {
+	querier
+	stored    [][]any
+	unchanged map[string]bool
+	query     string
+	args      []any
+	written   [][]any
+}
+
+func (q *hashQuerier) Query(ctx context.Context, query string, args ...any) (queryRows, error) {
+	q.query, q.args = query, args
+	return &valueRows{rows: q.stored}, nil
+}
+
+func (q *hashQuerier) QueryBatch(ctx context.Context, query string, argLists [][]any, scan func(i int, row pgx.Row) error) (int, error) {
+	for i, args := range argLists {
+		q.written = append(q.written, args)
+		row := fakeRow{value: true}
+		if q.unchanged[args[len(args)-1].(string)] {
+			row = fakeRow{err: pgx.ErrNoRows}
+		}
+		if err := scan(i, row); err != nil {
+			return i, err
+		}
+	}
+	return len(argLists), nil
+}
+
+func contentHashDocStore() *docStore {
+	ds := testDocStore()
+	ds.config.Embedder = &fakeEmbedder{}
+	ds.config.IndexBatchSize = 10
+	ds.config.ContentHashColumn = "content_hash"
+	ds.config.Overwrite = true
+	ds.contentType = TextContent
+	ds.dimension = 1
+	return ds
+}
+
+func TestIndexUnchanged(t *testing.T) {
+	ds := contentHashDocStore()
+	// The first document would fail to embed, so its stored embedding must
+	// be reused; the second has changed, and the third is new.
+	docs := []*ai.Document{
+		ai.DocumentFromText("fail", map[string]any{"id": "a"}),
+		ai.DocumentFromText("2", map[string]any{"id": "b"}),
+		ai.DocumentFromText("3", map[string]any{"id": "c"}),
+	}
+	hashA, err := contentHash(docs[0])
+	require.NoError(t, err)
+	hashB, err := contentHash(docs[1])
+	require.NoError(t, err)
+	q := &hashQuerier{
+		stored:    [][]any{{"a", hashA, "[9]", false}, {"b", "stale", "[8]", false}},
+		unchanged: map[string]bool{hashA: true},
+	}
+	results, err := ds.index(context.Background(), docs, q)
+	require.NoError(t, err)
+	assert.Equal(t, []IndexResult{{ID: "a", Status: IndexUnchanged}, {ID: "b", Status: IndexInserted}, {ID: "c", Status: IndexInserted}}, results)
+	assert.Equal(t, `SELECT "id"::text, "content_hash", "embedding", false FROM "public"."documents" WHERE "id" = ANY($1) AND "content_hash" = ANY($2)`, q.query)
+	assert.Equal(t, []string{"a", "b", "c"}, q.args[0])
+	assert.Contains(t, q.args[1], hashB)
+	if assert.Len(t, q.written, 3) {
+		assert.Equal(t, hashA, q.written[0][len(q.written[0])-1])
+		assert.Equal(t, hashB, q.written[1][len(q.written[1])-1])
+	}
+	assert.Equal(t, 1, writtenCount(results[:2]))
+}
+
+func TestIndexUnchangedSoftDeleted(t *testing.T) {
+	ds := contentHashDocStore()
+	ds.engine.config.softDeleteColumn = "deleted_at"
+	docs := []*ai.Document{ai.DocumentFromText("fail", map[string]any{"id": "a"})}
+	hash, err := contentHash(docs[0])
+	require.NoError(t, err)
+	// A deleted row reuses its embedding, and is written to restore it.
+	q := &hashQuerier{stored: [][]any{{"a", hash, "[9]", true}}}
+	results, err := ds.index(context.Background(), docs, q)
+	require.NoError(t, err)
+	assert.Equal(t, []IndexResult{{ID: "a", Status: IndexInserted}}, results)
+	assert.Contains(t, q.query, `"deleted_at" IS NOT NULL FROM`)
+}
+
+func TestBuildInsertQueryContentHash(t *testing.T) {
+	ds := contentHashDocStore()
+	ds.engine.config.softDeleteColumn = "deleted_at"
+	assert.Equal(t, []string{"id", "content", "embedding", "metadata", "source", "content_hash"}, ds.insertColumns())
+	query := ds.buildInsertQuery()
+	assert.Contains(t, query, `"content_hash" = EXCLUDED."content_hash", "deleted_at" = NULL`+
+		` WHERE "public"."documents"."content_hash" IS DISTINCT FROM EXCLUDED."content_hash" OR "public"."documents"."deleted_at" IS NOT NULL RETURNING (xmax = 0)`)
+
+	ds.config.Overwrite = false
+	assert.NotContains(t, ds.buildInsertQuery(), "IS DISTINCT FROM")
+}
+
+func TestValidateContentHash(t *testing.T) {
+	ds := contentHashDocStore()
+	assert.NoError(t, ds.validateContentHash())
+	ds.config.ConflictColumns = []string{"id", "source"}
+	assert.ErrorContains(t, ds.validateContentHash(), "conflict columns")
+
+	ds = contentHashDocStore()
+	ds.config.ColumnEmbedders = []ColumnEmbedder{{Column: "title_embedding", Embedder: &fakeEmbedder{}}}
+	assert.ErrorContains(t, ds.validateContentHash(), "column embedders")
+}
+
+func TestContentHash(t *testing.T) {
+	a, err := contentHash(ai.DocumentFromText("hello", map[string]any{"x": 1, "y": 2}))
+	require.NoError(t, err)
+	b, err := contentHash(ai.DocumentFromText("hello", map[string]any{"y": 2, "x": 1}))
+	require.NoError(t, err)
+	assert.Equal(t, a, b)
+	assert.Len(t, a, 64)
+	c, err := contentHash(ai.DocumentFromText("hello", map[string]any{"x": 1, "y": 3}))
+	require.NoError(t, err)
+	assert.NotEqual(t, a, c)
+}
+
+func TestCreateTableQueryContentHash(t *testing.T) {
+	pgEngine := &PostgresEngine{}
+	opts := VectorstoreTableOptions{TableName: "documents", VectorSize: 3, StoreMetadata: true, ContentHashColumn: "content_hash"}
+	require.NoError(t, pgEngine.validateVectorstoreTableOptions(&opts))
+	assert.Contains(t, pgEngine.createTableQuery(opts), `"metadata" JSON, "content_hash" TEXT);`)
+
+	opts.ContentHashColumn = `bad"name`
+	assert.Error(t, pgEngine.validateVectorstoreTableOptions(&opts))
+}
@@ -0,0 +1,232 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// CopyDocuments embeds docs and appends them to the table described by cfg
+// with the COPY protocol, which is much faster than the INSERT statements of
+// the indexer for large loads. It returns the number of rows written.
+//
+// COPY cannot update or skip existing rows: a document whose id already
+// exists fails the whole copy, and nothing is written. CopyDocuments is
+// therefore best used to load a fresh table, creating its vector indexes
+// afterwards, which is also faster than maintaining them during the load.
+// Documents are embedded in chunks of [Config.IndexBatchSize] ×
+// [Config.EmbedConcurrency] while the rows are streamed, so that memory use
+// does not grow with the number of documents. The query timeout set by
+// [WithQueryTimeout] does not apply. CopyDocuments requires a pgx pool and
+// cannot be used with [WithDB].
+func (pgEngine *PostgresEngine) CopyDocuments(ctx context.Context, cfg *Config, docs []*ai.Document) (n int64, err error) {
+	if err := pgEngine.checkWrite("copy documents"); err != nil {
+		return 0, fmt.Errorf("postgres.CopyDocuments: %w", err)
+	}
+	if pgEngine.pool() == nil {
+		return 0, errors.New("postgres.CopyDocuments: a pgx pool is required")
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+	ds, err := newEngineDocStore(ctx, *pgEngine, cfg)
+	if err != nil {
+		return 0, fmt.Errorf("postgres.CopyDocuments: %w", err)
+	}
+	start := time.Now()
+	ctx, cancel := ds.engine.withFallbackTimeout(ctx)
+	defer cancel()
+	ctx, span := ds.startSpan(ctx, "postgresql.copy",
+		attribute.Int("postgresql.document_count", len(docs)))
+	defer func() {
+		endSpan(span, err)
+		ds.recordRequest(ctx, "index", int(n), err)
+		ds.logSlowRequest(ctx, "copy", start, err, "documents", len(docs))
+	}()
+
+	if docs, err = ds.limitContent(docs); err != nil {
+		return 0, fmt.Errorf("postgres.CopyDocuments: %w", err)
+	}
+	if err := ds.checkMetadata(docs); err != nil {
+		return 0, fmt.Errorf("postgres.CopyDocuments: %w", err)
+	}
+	dim, err := ds.embeddingDimension(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("postgres.CopyDocuments: %w", err)
+	}
+	src := &copySource{ctx: ctx, ds: ds, docs: docs, dim: dim}
+	err = pgEngine.withPool(ctx, func(pool *pgxpool.Pool) error {
+		conn, err := pgEngine.acquire(ctx, pool)
+		if err != nil {
+			return err
+		}
+		defer conn.Release()
+		n, err = conn.CopyFrom(ctx, pgx.Identifier{ds.config.SchemaName, ds.config.TableName}, ds.insertColumns(), src)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("postgres.CopyDocuments: %w", describeQueryError(err, ds.config))
+	}
+	pgEngine.autoAnalyze(ctx, ds.config.SchemaName, ds.config.TableName)
+	return n, nil
+}
+
+// copySource is a [pgx.CopyFromSource] over documents, embedding them a
+// chunk at a time.
+type copySource struct {
+	ctx  context.Context
+	ds   *docStore
+	docs []*ai.Document
+	dim  int
+
+	next  int        // position of the first document not yet embedded
+	rows  []indexRow // rows of the current chunk
+	row   int        // position of the current row in rows
+	value []any
+	err   error
+}
+
+func (s *copySource) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	if s.row+1 >= len(s.rows) {
+		if s.next >= len(s.docs) {
+			return false
+		}
+		if s.err = s.embedChunk(); s.err != nil {
+			return false
+		}
+	} else {
+		s.row++
+	}
+	s.value, s.err = s.ds.copyValues(s.rows[s.row])
+	return s.err == nil
+}
+
+// embedChunk embeds the next chunk of documents and makes its first row current.
+func (s *copySource) embedChunk() error {
+	size := s.ds.config.IndexBatchSize * max(s.ds.config.EmbedConcurrency, 1)
+	end := min(s.next+size, len(s.docs))
+	embeddings, err := s.ds.embedDocuments(s.ctx, s.docs[s.next:end])
+	if err != nil {
+		return err
+	}
+	if s.rows, err = s.ds.newIndexRows(s.docs[s.next:end], embeddings, s.dim, s.next); err != nil {
+		return err
+	}
+	if err := s.ds.embedColumns(s.ctx, s.docs[s.next:end], s.rows, s.next); err != nil {
+		return err
+	}
+	if err := s.ds.storeContent(s.ctx, s.docs[s.next:end], s.rows, s.next); err != nil {
+		return err
+	}
+	s.next, s.row = end, 0
+	return nil
+}
+
+func (s *copySource) Values() ([]any, error) {
+	return s.value, s.err
+}
+
+func (s *copySource) Err() error {
+	return s.err
+}
+
+// copyValues returns the values copied for r, in the order of insertColumns.
+// The embedding is sent in the binary format of the vector type, which COPY
+// requires; as a byte slice, pgx passes it through verbatim.
+func (ds *docStore) copyValues(r indexRow) ([]any, error) {
+	embedding, err := encodeVectorBinary(r.embedding.Slice(), ds.engine.vectorType())
+	if err != nil {
+		return nil, fmt.Errorf("document %q: %w", r.id, err)
+	}
+	values := []any{r.id, r.content, embedding}
+	if ds.config.MetadataJSONColumn != "" {
+		values = append(values, r.metadata)
+	}
+	values = append(values, r.columns...)
+	if ds.config.ContentHashColumn != "" {
+		values = append(values, r.contentHash)
+	}
+	for i, vec := range r.columnEmbeddings {
+		embedding, err := encodeVectorBinary(vec.Slice(), ds.engine.vectorType())
+		if err != nil {
+			return nil, fmt.Errorf("document %q: column %q: %w", r.id, ds.config.ColumnEmbedders[i].Column, err)
+		}
+		values = append(values, embedding)
+	}
+	return values, nil
+}
+
+// encodeVectorBinary returns the binary representation of vec, whose
+// elements must be finite, as a pgvector value of type t: the dimension and a
+// reserved field as 16-bit integers, followed by the elements as big-endian
+// 32-bit floats, or as 16-bit floats for halfvec.
+func encodeVectorBinary(vec []float32, t VectorType) ([]byte, error) {
+	if len(vec) > math.MaxUint16 {
+		return nil, fmt.Errorf("embedding has %d dimensions, more than a vector can hold", len(vec))
+	}
+	size := 4
+	if t == HalfVec {
+		size = 2
+	}
+	buf := make([]byte, 4, 4+size*len(vec))
+	binary.BigEndian.PutUint16(buf, uint16(len(vec)))
+	for i, f := range vec {
+		if t == HalfVec {
+			h, ok := float32ToHalf(f)
+			if !ok {
+				return nil, fmt.Errorf("embedding element %d (%v) is out of range for halfvec", i, f)
+			}
+			buf = binary.BigEndian.AppendUint16(buf, h)
+		} else {
+			buf = binary.BigEndian.AppendUint32(buf, math.Float32bits(f))
+		}
+	}
+	return buf, nil
+}
+
+// float32ToHalf converts a finite f to an IEEE 754 half-precision float,
+// rounding to nearest even. It reports false if f overflows.
+func float32ToHalf(f float32) (uint16, bool) {
+	b := math.Float32bits(f)
+	sign := uint16(b>>16) & 0x8000
+	exp := int(b>>23&0xff) - 127 + 15
+	mant := b & 0x7fffff
+	if exp >= 0x1f {
+		return 0, false
+	}
+	if exp <= 0 {
+		// Subnormal or zero in half precision.
+		if exp < -10 {
+			return sign, true
+		}
+		mant |= 0x800000
+		shift := uint(14 - exp)
+		half := mant >> shift
+		rem := mant & (1<<shift - 1)
+		halfway := uint32(1) << (shift - 1)
+		if rem > halfway || (rem == halfway && half&1 == 1) {
+			half++
+		}
+		return sign | uint16(half), true
+	}
+	half := uint32(exp)<<10 | mant>>13
+	rem := mant & 0x1fff
+	if rem > 0x1000 || (rem == 0x1000 && half&1 == 1) {
+		half++ // may carry into the exponent
+	}
+	if half >= 0x7c00 {
+		return 0, false
+	}
+	return sign | uint16(half), true
+}
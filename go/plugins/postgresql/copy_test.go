@@ -0,0 +1,72 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeVectorBinary(t *testing.T) {
+	b, err := encodeVectorBinary([]float32{1, -2}, Vector)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 2, 0, 0, 0x3f, 0x80, 0, 0, 0xc0, 0, 0, 0}, b)
+
+	b, err = encodeVectorBinary([]float32{1, -2}, HalfVec)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 2, 0, 0, 0x3c, 0, 0xc0, 0}, b)
+
+	b, err = encodeVectorBinary(nil, Vector)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 0}, b)
+
+	_, err = encodeVectorBinary([]float32{1e6}, HalfVec)
+	assert.Error(t, err)
+}
+
+func TestFloat32ToHalf(t *testing.T) {
+	for _, tc := range []struct {
+		f    float32
+		want uint16
+		ok   bool
+	}{
+		{0, 0x0000, true},
+		{1, 0x3c00, true},
+		{-2, 0xc000, true},
+		{0.1, 0x2e66, true},
+		{65504, 0x7bff, true},
+		{65520, 0, false},
+		{5.9604645e-8, 0x0001, true},
+		{1e-10, 0x0000, true},
+	} {
+		got, ok := float32ToHalf(tc.f)
+		assert.Equal(t, tc.ok, ok, "%v", tc.f)
+		if tc.ok {
+			assert.Equal(t, tc.want, got, "%v", tc.f)
+		}
+	}
+}
+
+func TestCopySource(t *testing.T) {
+	emb := &fakeEmbedder{}
+	ds := testDocStore()
+	ds.config.Embedder = emb
+	ds.config.IndexBatchSize = 2
+
+	src := &copySource{ctx: context.Background(), ds: ds, docs: testDocuments("1", "2", "3", "4", "5"), dim: 1}
+	var ids []any
+	for src.Next() {
+		values, err := src.Values()
+		assert.NoError(t, err)
+		assert.Len(t, values, len(ds.insertColumns()))
+		assert.Equal(t, []byte{0, 1, 0, 0}, values[2].([]byte)[:4])
+		ids = append(ids, values[0])
+	}
+	assert.NoError(t, src.Err())
+	assert.Len(t, ids, 5)
+	assert.Equal(t, 3, emb.calls)
+
+	src = &copySource{ctx: context.Background(), ds: ds, docs: testDocuments("1"), dim: 3}
+	assert.False(t, src.Next())
+	assert.ErrorContains(t, src.Err(), "expects 3")
+}
@@ -0,0 +1,53 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// CountDocuments returns the number of documents in a table whose metadata
+// matches all of the filters, or of all documents if there are none. The
+// filters have the same semantics as [RetrieverOptions.Filters]. Documents
+// deleted with [WithSoftDelete] or expired by [WithExpiryColumn] are not
+// counted, nor are documents excluded by the filters of [WithDefaultFilter].
+// The settings of [WithRequestSettings] apply to the count.
+func (pgEngine *PostgresEngine) CountDocuments(ctx context.Context, tableName string, filters ...Filter) (int64, error) {
+	filters = append(slices.Clip(pgEngine.config.defaultFilters), filters...)
+	return pgEngine.countRows(ctx, pgEngine.schemaName(), pgEngine.tableName(tableName), true, filters...)
+}
+
+// countRows returns the number of rows of a table matching filters. Unless
+// live is false, rows deleted with [WithSoftDelete] are skipped.
+func (pgEngine *PostgresEngine) countRows(ctx context.Context, schemaName, tableName string, live bool, filters ...Filter) (int64, error) {
+	args := &queryArgs{}
+	where, _, err := pgEngine.compileTableFilters(ctx, schemaName, tableName, filters, args)
+	if err != nil {
+		return 0, err
+	}
+	if live {
+		var conds []string
+		if col := pgEngine.config.softDeleteColumn; col != "" {
+			conds = append(conds, fmt.Sprintf(`"%s" IS NULL`, col))
+		}
+		if col := pgEngine.config.expiryColumn; col != "" {
+			conds = append(conds, notExpired(col))
+		}
+		if where != "" {
+			conds = append(conds, where)
+		}
+		where = strings.Join(conds, " AND ")
+	}
+	query := fmt.Sprintf(`SELECT count(*) FROM %s`, qualifiedName(schemaName, tableName))
+	if where != "" {
+		query += " WHERE " + where
+	}
+	qctx, cancel := pgEngine.withQueryTimeout(ctx)
+	defer cancel()
+	var n int64
+	if err := pgEngine.queryRowLocal(qctx, query, args.args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count rows: %w", describeTableError(queryTimeoutError(qctx, err), tableName))
+	}
+	return n, nil
+}
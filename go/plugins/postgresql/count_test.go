@@ -0,0 +1,38 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountDocumentsInvalidFilter(t *testing.T) {
+	pgEngine := &PostgresEngine{}
+	_, err := pgEngine.CountDocuments(context.Background(), "documents", Filter{Key: "", Value: "x"})
+	assert.Error(t, err)
+	_, err = pgEngine.CountDocuments(context.Background(), "documents", Filter{Key: "year", Op: "LIKE", Value: "x"})
+	assert.Error(t, err)
+}
+
+func TestCountDocumentsTypedColumn(t *testing.T) {
+	db := &fakeDB{results: map[string]fakeResult{
+		"pg_attribute": catalogResult("id", "text", "content", "text", "embedding", "vector", "metadata", "jsonb", "tenant_id", "text"),
+		"count(*)":     {columns: []string{"count"}, rows: [][]driver.Value{{int64(3)}}},
+	}}
+	pgEngine := &PostgresEngine{config: engineConfig{db: db.open(t)}}
+
+	n, err := pgEngine.CountDocuments(context.Background(), "documents", Filter{Key: "tenant_id", Value: "acme"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	query, args := db.statement("SELECT count(*)")
+	assert.Equal(t, `SELECT count(*) FROM "public"."documents" WHERE "tenant_id" = $1`, query)
+	assert.Equal(t, []any{"acme"}, args)
+
+	// Without filters, the table is not looked up.
+	db.stmts = nil
+	_, err = pgEngine.CountDocuments(context.Background(), "documents")
+	assert.NoError(t, err)
+	assert.Len(t, db.stmts, 1)
+}
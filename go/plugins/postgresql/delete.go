@@ -0,0 +1,183 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DeleteDocuments deletes the documents with the given IDs from a table and
+// returns the number of deleted rows. It is a no-op if ids is empty. With
+// [WithSoftDelete], the documents are marked deleted instead, and documents
+// already marked are not counted; this applies to the other delete methods
+// too.
+func (pgEngine *PostgresEngine) DeleteDocuments(ctx context.Context, tableName string, ids []string) (int, error) {
+	if err := pgEngine.checkWrite("delete documents"); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	tableName = pgEngine.tableName(tableName)
+	if err := pgEngine.checkSoftDeleteColumn(ctx, tableName, nil); err != nil {
+		return 0, err
+	}
+	query := pgEngine.deleteStatement(tableName, fmt.Sprintf(`"%s" = ANY($1)`, pgEngine.idColumn()))
+	return pgEngine.execDelete(ctx, tableName, query, ids)
+}
+
+// DeleteDocumentsByFilter deletes the documents whose metadata matches all of
+// the filters and returns the number of deleted rows. The filters have the
+// same semantics as [RetrieverOptions.Filters]. At least one filter is
+// required, so that a missing filter cannot delete the whole table.
+func (pgEngine *PostgresEngine) DeleteDocumentsByFilter(ctx context.Context, tableName string, filters []Filter) (int, error) {
+	if err := pgEngine.checkWrite("delete documents"); err != nil {
+		return 0, err
+	}
+	if len(filters) == 0 {
+		return 0, errors.New("at least one filter is required")
+	}
+	tableName = pgEngine.tableName(tableName)
+	args := &queryArgs{}
+	where, cols, err := pgEngine.compileTableFilters(ctx, pgEngine.schemaName(), tableName, filters, args)
+	if err != nil {
+		return 0, err
+	}
+	if err := pgEngine.checkSoftDeleteColumn(ctx, tableName, cols); err != nil {
+		return 0, err
+	}
+	query := pgEngine.deleteStatement(tableName, where)
+	return pgEngine.execDelete(ctx, tableName, query, args.args...)
+}
+
+// DeleteExpired deletes the documents whose timestampColumn is older than
+// olderThan and returns the number of deleted rows. timestampColumn must be
+// a timestamp or date column of the table, such as one declared with
+// [VectorstoreTableOptions.MetadataColumns]; keys of the metadata JSON column
+// are not accepted. Rows whose timestamp is NULL are kept.
+func (pgEngine *PostgresEngine) DeleteExpired(ctx context.Context, tableName string, olderThan time.Time, timestampColumn string) (int64, error) {
+	if err := pgEngine.checkWrite("delete documents"); err != nil {
+		return 0, err
+	}
+	if err := validateIdentifier("timestamp column", timestampColumn); err != nil {
+		return 0, err
+	}
+	if olderThan.IsZero() {
+		return 0, errors.New("a cutoff time is required")
+	}
+	tableName = pgEngine.tableName(tableName)
+	schemaName := pgEngine.schemaName()
+	qctx, cancel := pgEngine.withQueryTimeout(ctx)
+	cols, err := pgEngine.tableColumns(qctx, schemaName, tableName)
+	cancel()
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up table %q: %w", tableName, queryTimeoutError(qctx, err))
+	}
+	if len(cols) == 0 {
+		return 0, fmt.Errorf("%w: %q", ErrTableNotFound, tableName)
+	}
+	if err := checkTimestampColumn(cols, timestampColumn); err != nil {
+		return 0, err
+	}
+	if err := pgEngine.checkSoftDeleteColumn(ctx, tableName, cols); err != nil {
+		return 0, err
+	}
+	query := pgEngine.deleteStatement(tableName, fmt.Sprintf(`"%s" < $1`, timestampColumn))
+	n, err := pgEngine.execDelete(ctx, tableName, query, olderThan)
+	return int64(n), err
+}
+
+// PurgeDeleted removes the documents of a table marked deleted with
+// [WithSoftDelete] before olderThan, or all of them if olderThan is zero,
+// and returns the number of removed rows. Space is reclaimed by the next
+// vacuum of the table. It requires the engine to use soft deletes.
+func (pgEngine *PostgresEngine) PurgeDeleted(ctx context.Context, tableName string, olderThan time.Time) (int64, error) {
+	if err := pgEngine.checkWrite("purge deleted documents"); err != nil {
+		return 0, err
+	}
+	col := pgEngine.config.softDeleteColumn
+	if col == "" {
+		return 0, errors.New("soft delete is not enabled; see WithSoftDelete")
+	}
+	tableName = pgEngine.tableName(tableName)
+	if err := pgEngine.checkSoftDeleteColumn(ctx, tableName, nil); err != nil {
+		return 0, err
+	}
+	query, args := purgeStatement(qualifiedName(pgEngine.schemaName(), tableName), col, olderThan)
+	n, err := pgEngine.execDelete(ctx, tableName, query, args...)
+	return int64(n), err
+}
+
+// purgeStatement returns the statement removing the rows of table whose soft
+// delete column is set, before olderThan unless it is zero, and its
+// arguments.
+func purgeStatement(table, column string, olderThan time.Time) (string, []any) {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE "%s" IS NOT NULL`, table, column)
+	if olderThan.IsZero() {
+		return query, nil
+	}
+	return query + fmt.Sprintf(` AND "%s" < $1`, column), []any{olderThan}
+}
+
+// deleteStatement returns the statement deleting the rows of a table that
+// match where: a DELETE, or with [WithSoftDelete] an UPDATE setting the soft
+// delete column of the rows not yet marked.
+func (pgEngine *PostgresEngine) deleteStatement(tableName, where string) string {
+	table := qualifiedName(pgEngine.schemaName(), tableName)
+	col := pgEngine.config.softDeleteColumn
+	if col == "" {
+		return fmt.Sprintf(`DELETE FROM %s WHERE %s`, table, where)
+	}
+	return fmt.Sprintf(`UPDATE %s SET "%s" = now() WHERE "%s" IS NULL AND %s`, table, col, col, where)
+}
+
+// checkSoftDeleteColumn returns an error if soft deletes are enabled and the
+// table has no timestamp column to mark deleted rows. cols are the columns
+// of the table, looked up if nil.
+func (pgEngine *PostgresEngine) checkSoftDeleteColumn(ctx context.Context, tableName string, cols map[string]tableColumn) error {
+	col := pgEngine.config.softDeleteColumn
+	if col == "" {
+		return nil
+	}
+	if cols == nil {
+		qctx, cancel := pgEngine.withQueryTimeout(ctx)
+		var err error
+		cols, err = pgEngine.tableColumns(qctx, pgEngine.schemaName(), tableName)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to look up table %q: %w", tableName, queryTimeoutError(qctx, err))
+		}
+		if len(cols) == 0 {
+			return fmt.Errorf("%w: %q", ErrTableNotFound, tableName)
+		}
+	}
+	if err := checkTimestampColumn(cols, col); err != nil {
+		return fmt.Errorf("soft delete %w", err)
+	}
+	return nil
+}
+
+// checkTimestampColumn returns an error unless name is a timestamp or date
+// column in cols.
+func checkTimestampColumn(cols map[string]tableColumn, name string) error {
+	col, ok := cols[name]
+	if !ok {
+		return fmt.Errorf("timestamp column %q does not exist", name)
+	}
+	switch col.typeName {
+	case "timestamptz", "timestamp", "date":
+		return nil
+	}
+	return fmt.Errorf("column %q has type %s, want a timestamp or date", name, col.typeName)
+}
+
+func (pgEngine *PostgresEngine) execDelete(ctx context.Context, tableName, query string, args ...any) (int, error) {
+	qctx, cancel := pgEngine.withQueryTimeout(ctx)
+	defer cancel()
+	n, err := pgEngine.querier().Exec(qctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete documents: %w", describeTableError(queryTimeoutError(qctx, err), tableName))
+	}
+	return int(n), nil
+}
@@ -0,0 +1,74 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteDocumentsByTypedColumn(t *testing.T) {
+	db := &fakeDB{results: map[string]fakeResult{
+		"pg_attribute": catalogResult("id", "text", "content", "text", "embedding", "vector", "metadata", "jsonb", "tenant_id", "text"),
+	}, affected: 2}
+	pgEngine := &PostgresEngine{config: engineConfig{db: db.open(t)}}
+
+	// The indexer moves typed columns out of the JSON metadata, so filters
+	// on them compare against the columns, as in retrieval.
+	n, err := pgEngine.DeleteDocumentsByFilter(context.Background(), "documents", []Filter{{Key: "tenant_id", Value: "acme"}, {Key: "lang", Value: "en"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	query, args := db.statement("DELETE")
+	assert.Equal(t, `DELETE FROM "public"."documents" WHERE "tenant_id" = $1 AND "metadata"->>$2 = $3`, query)
+	assert.Equal(t, []any{"acme", "lang", "en"}, args)
+
+	db.results["pg_attribute"] = catalogResult()
+	_, err = pgEngine.DeleteDocumentsByFilter(context.Background(), "documents", []Filter{{Key: "tenant_id", Value: "acme"}})
+	assert.ErrorIs(t, err, ErrTableNotFound)
+}
+
+func TestCheckTimestampColumn(t *testing.T) {
+	cols := map[string]tableColumn{
+		"created_at": {typeName: "timestamptz"},
+		"day":        {typeName: "date"},
+		"content":    {typeName: "text"},
+	}
+	assert.NoError(t, checkTimestampColumn(cols, "created_at"))
+	assert.NoError(t, checkTimestampColumn(cols, "day"))
+	assert.Error(t, checkTimestampColumn(cols, "content"))
+	assert.Error(t, checkTimestampColumn(cols, "expires_at"))
+}
+
+func TestDeleteStatement(t *testing.T) {
+	pgEngine := &PostgresEngine{}
+	assert.Equal(t, `DELETE FROM "public"."docs" WHERE "id" = ANY($1)`, pgEngine.deleteStatement("docs", `"id" = ANY($1)`))
+
+	cfg, err := applyEngineOptions([]Option{WithPool(&pgxpool.Pool{}), WithDatabase("testdb"), WithSoftDelete("deleted_at")})
+	assert.NoError(t, err)
+	pgEngine = &PostgresEngine{config: cfg}
+	assert.Equal(t, `UPDATE "public"."docs" SET "deleted_at" = now() WHERE "deleted_at" IS NULL AND "id" = ANY($1)`,
+		pgEngine.deleteStatement("docs", `"id" = ANY($1)`))
+
+	err = pgEngine.checkSoftDeleteColumn(context.Background(), "docs", map[string]tableColumn{"id": {typeName: "text"}})
+	assert.ErrorContains(t, err, `soft delete timestamp column "deleted_at" does not exist`)
+	assert.NoError(t, pgEngine.checkSoftDeleteColumn(context.Background(), "docs", map[string]tableColumn{"deleted_at": {typeName: "timestamptz"}}))
+
+	_, err = applyEngineOptions([]Option{WithPool(&pgxpool.Pool{}), WithDatabase("testdb"), WithSoftDelete(`deleted_at"; --`)})
+	assert.Error(t, err)
+}
+
+func TestPurgeStatement(t *testing.T) {
+	query, args := purgeStatement(`"public"."docs"`, "deleted_at", time.Time{})
+	assert.Equal(t, `DELETE FROM "public"."docs" WHERE "deleted_at" IS NOT NULL`, query)
+	assert.Empty(t, args)
+
+	cutoff := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	query, args = purgeStatement(`"public"."docs"`, "deleted_at", cutoff)
+	assert.Equal(t, `DELETE FROM "public"."docs" WHERE "deleted_at" IS NOT NULL AND "deleted_at" < $1`, query)
+	assert.Equal(t, []any{cutoff}, args)
+
+	_, err := (&PostgresEngine{}).PurgeDeleted(context.Background(), "docs", time.Time{})
+	assert.ErrorContains(t, err, "soft delete is not enabled")
+}
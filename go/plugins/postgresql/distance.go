@@ -0,0 +1,132 @@
+package postgresql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DistanceStrategy is the pgvector distance function used to compare embeddings.
+type DistanceStrategy string
+
+const (
+	// CosineDistance orders by cosine distance (the <=> operator).
+	CosineDistance DistanceStrategy = "cosine"
+	// EuclideanDistance orders by L2 distance (the <-> operator).
+	EuclideanDistance DistanceStrategy = "euclidean"
+	// InnerProduct orders by negative inner product (the <#> operator).
+	InnerProduct DistanceStrategy = "inner_product"
+)
+
+// distanceBounds returns the condition selecting the rows whose distance,
+// the expression distance, is within the bounds of
+// [RetrieverOptions.MinDistance] and [RetrieverOptions.MaxDistance], adding
+// them to args, or the empty string if opts has no bounds. The distance
+// alias of the select list cannot be referenced in a WHERE clause, so the
+// condition repeats the expression, like afterPredicate.
+func distanceBounds(distance string, opts *RetrieverOptions, args *queryArgs) (string, error) {
+	if opts.MinDistance != nil && opts.MaxDistance != nil && *opts.MinDistance > *opts.MaxDistance {
+		return "", fmt.Errorf("min distance (%v) must not be greater than max distance (%v)", *opts.MinDistance, *opts.MaxDistance)
+	}
+	var conds []string
+	if opts.MinDistance != nil {
+		conds = append(conds, fmt.Sprintf("%s >= %s::float8", distance, args.add(*opts.MinDistance)))
+	}
+	if opts.MaxDistance != nil {
+		conds = append(conds, fmt.Sprintf("%s <= %s::float8", distance, args.add(*opts.MaxDistance)))
+	}
+	return strings.Join(conds, " AND "), nil
+}
+
+// validate reports an error if d is not a known distance strategy.
+func (d DistanceStrategy) validate() error {
+	switch d {
+	case CosineDistance, EuclideanDistance, InnerProduct:
+		return nil
+	}
+	return fmt.Errorf("unknown distance strategy %q", d)
+}
+
+// operator returns the pgvector operator used in the ORDER BY clause.
+func (d DistanceStrategy) operator() string {
+	switch d {
+	case EuclideanDistance:
+		return "<->"
+	case InnerProduct:
+		return "<#>"
+	default:
+		return "<=>"
+	}
+}
+
+// operatorClass returns the pgvector operator class an index on a column of
+// type t must use for queries with this strategy to be served by the index.
+func (d DistanceStrategy) operatorClass(t VectorType) string {
+	switch d {
+	case EuclideanDistance:
+		return string(t) + "_l2_ops"
+	case InnerProduct:
+		return string(t) + "_ip_ops"
+	default:
+		return string(t) + "_cosine_ops"
+	}
+}
+
+// Score converts a distance computed with this strategy into a similarity
+// score where higher is more similar. Cosine distances map to the cosine
+// similarity 1-d, Euclidean distances to 1/(1+d) in (0, 1], and the negated
+// inner product returned by pgvector back to the inner product.
+func (d DistanceStrategy) Score(distance float64) float64 {
+	switch d {
+	case EuclideanDistance:
+		return 1 / (1 + distance)
+	case InnerProduct:
+		return -distance
+	default:
+		return 1 - distance
+	}
+}
+
+var vectorIndexMethodRe = regexp.MustCompile(`(?i)\bUSING\s+(hnsw|ivfflat)\s*\(([^)]*)\)`)
+
+// parseVectorIndex returns the indexed columns of an index definition, as
+// reported by pg_indexes, if it is an HNSW or IVFFlat index. Columns without
+// an explicit operator class are skipped.
+func parseVectorIndex(def string) []VectorIndex {
+	m := vectorIndexMethodRe.FindStringSubmatch(def)
+	if m == nil {
+		return nil
+	}
+	var indexes []VectorIndex
+	for _, item := range strings.Split(m[2], ",") {
+		fields := strings.Fields(strings.ReplaceAll(item, `"`, ""))
+		if len(fields) < 2 {
+			continue
+		}
+		indexes = append(indexes, VectorIndex{Method: strings.ToLower(m[1]), Column: fields[0], OperatorClass: fields[1]})
+	}
+	return indexes
+}
+
+// checkIndexOperatorClass inspects the definitions of the indexes of a table,
+// as reported by pg_indexes, and returns an error if the embedding column has
+// vector indexes but none of them can serve queries using strategy.
+func checkIndexOperatorClass(indexDefs []string, embeddingColumn string, vectorType VectorType, strategy DistanceStrategy) error {
+	var found []string
+	for _, def := range indexDefs {
+		for _, idx := range parseVectorIndex(def) {
+			if idx.Column != embeddingColumn {
+				continue
+			}
+			if idx.OperatorClass == strategy.operatorClass(vectorType) {
+				return nil
+			}
+			found = append(found, idx.OperatorClass)
+		}
+	}
+	if len(found) == 0 {
+		return nil
+	}
+	return fmt.Errorf("embedding column %q is indexed with operator class %s, which cannot serve %s queries (requires %s); queries would fall back to a sequential scan",
+		embeddingColumn, strings.Join(found, ", "), strategy, strategy.operatorClass(vectorType))
+}
@@ -0,0 +1,76 @@
+package postgresql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckIndexOperatorClass(t *testing.T) {
+	defs := []string{
+		`CREATE UNIQUE INDEX documents_pkey ON public.documents USING btree (id)`,
+		`CREATE INDEX documents_hnsw ON public.documents USING hnsw (embedding vector_cosine_ops) WITH (m='16')`,
+	}
+	assert.NoError(t, checkIndexOperatorClass(defs, "embedding", Vector, CosineDistance))
+	assert.Error(t, checkIndexOperatorClass(defs, "embedding", Vector, EuclideanDistance))
+	assert.NoError(t, checkIndexOperatorClass(defs, "other", Vector, EuclideanDistance))
+	assert.NoError(t, checkIndexOperatorClass(defs[:1], "embedding", Vector, InnerProduct))
+
+	quoted := []string{`CREATE INDEX i ON public.documents USING ivfflat ("Embedding" vector_ip_ops) WITH (lists='100')`}
+	assert.NoError(t, checkIndexOperatorClass(quoted, "Embedding", Vector, InnerProduct))
+	assert.Error(t, checkIndexOperatorClass(quoted, "Embedding", Vector, CosineDistance))
+
+	half := []string{`CREATE INDEX i ON public.documents USING hnsw (embedding halfvec_cosine_ops)`}
+	assert.NoError(t, checkIndexOperatorClass(half, "embedding", HalfVec, CosineDistance))
+	assert.Error(t, checkIndexOperatorClass(half, "embedding", Vector, CosineDistance))
+}
+
+func TestParseVectorIndex(t *testing.T) {
+	assert.Nil(t, parseVectorIndex(`CREATE UNIQUE INDEX documents_pkey ON public.documents USING btree (id)`))
+	assert.Equal(t, []VectorIndex{{Method: "hnsw", Column: "embedding", OperatorClass: "vector_cosine_ops"}},
+		parseVectorIndex(`CREATE INDEX documents_hnsw ON public.documents USING hnsw (embedding vector_cosine_ops) WITH (m='16')`))
+	assert.Equal(t, []VectorIndex{{Method: "ivfflat", Column: "Embedding", OperatorClass: "vector_ip_ops"}},
+		parseVectorIndex(`CREATE INDEX i ON public.documents USING IVFFLAT ("Embedding" vector_ip_ops) WITH (lists='100')`))
+}
+
+func TestDistanceStrategyValidate(t *testing.T) {
+	assert.NoError(t, CosineDistance.validate())
+	assert.NoError(t, EuclideanDistance.validate())
+	assert.NoError(t, InnerProduct.validate())
+	assert.Error(t, DistanceStrategy("manhattan").validate())
+}
+
+func TestDistanceStrategyScore(t *testing.T) {
+	assert.InDelta(t, 0.75, CosineDistance.Score(0.25), 1e-9)
+	assert.InDelta(t, 0.5, EuclideanDistance.Score(1), 1e-9)
+	assert.InDelta(t, 1.0, EuclideanDistance.Score(0), 1e-9)
+	assert.InDelta(t, 3.5, InnerProduct.Score(-3.5), 1e-9)
+}
+
+func TestBuildRetrieveQueryDistanceBounds(t *testing.T) {
+	ds := testDocStore()
+	minDistance, maxDistance := 0.05, 0.3
+	query, args, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{
+		Filters:     []Filter{{Key: "lang", Value: "en"}},
+		MinDistance: &minDistance,
+		MaxDistance: &maxDistance,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", "embedding" <=> $1 AS distance FROM "public"."documents"`+
+		` WHERE "metadata"->>$2 = $3 AND "embedding" <=> $1 >= $4::float8 AND "embedding" <=> $1 <= $5::float8 ORDER BY distance, "id" LIMIT 4`, query)
+	assert.Equal(t, []any{"lang", "en", 0.05, 0.3}, args[1:])
+
+	// A single bound is allowed, and equal bounds select an exact distance.
+	query, _, err = ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{MinDistance: &maxDistance})
+	assert.NoError(t, err)
+	assert.Contains(t, query, `WHERE "embedding" <=> $1 >= $2::float8 ORDER BY`)
+	_, _, err = ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{MinDistance: &maxDistance, MaxDistance: &maxDistance})
+	assert.NoError(t, err)
+
+	_, _, err = ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{MinDistance: &maxDistance, MaxDistance: &minDistance})
+	assert.ErrorContains(t, err, "must not be greater")
+	_, _, err = ds.buildHybridQuery([]float32{1, 2}, 4, &RetrieverOptions{MaxDistance: &maxDistance}, HybridOptions{})
+	assert.Error(t, err)
+	_, _, err = ds.buildLookupQuery(4, &RetrieverOptions{Filters: []Filter{{Key: "lang", Value: "en"}}, MaxDistance: &maxDistance})
+	assert.Error(t, err)
+}
@@ -1,14 +1,34 @@
 package postgresql
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"slices"
 	"strings"
+	"sync"
 )
 
 type docStore struct {
 	engine PostgresEngine
 	config *Config
+	// vectorColumns holds the embedding columns of the table, which
+	// retrieval can search.
+	vectorColumns map[string]bool
+	// columnTypes holds the data types of the metadata columns of the
+	// table.
+	columnTypes map[string]string
+	// contentType is the type of the content column.
+	contentType ContentType
+
+	mu        sync.Mutex
+	dimension int // declared dimension of the embedding column; 0 if not yet known
+	// columnDimensions holds the declared dimensions of the columns of
+	// [Config.ColumnEmbedders] read so far.
+	columnDimensions map[string]int
+	// embedderDimension is the dimension of the embeddings of
+	// [Config.Embedder], if already checked; 0 otherwise.
+	embedderDimension int
 }
 
 // newDocStore instantiate a docStore
@@ -18,61 +38,237 @@ func newDocStore(ctx context.Context, p *Postgres, cfg *Config) (*docStore, erro
 	if !p.initted {
 		panic("postgres.Init not called")
 	}
+	ds, err := newEngineDocStore(ctx, *p.Engine, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := ds.checkEmbedderDimensions(ctx); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
 
+// newEngineDocStore instantiates a docStore for cfg backed by engine. The
+// docStore has its own copy of cfg, with the defaults of engine applied.
+func newEngineDocStore(ctx context.Context, engine PostgresEngine, cfg *Config) (*docStore, error) {
+	config := *cfg
 	ds := &docStore{
-		engine: p.engine,
-		config: cfg,
+		engine: engine,
+		config: &config,
 	}
 
 	if strings.TrimSpace(ds.config.TableName) == "" {
 		return nil, fmt.Errorf("table name must be defined")
 	}
+	ds.config.TableName = engine.tableName(ds.config.TableName)
 
 	if ds.config.SchemaName == "" {
-		ds.config.SchemaName = defaultSchemaName
+		ds.config.SchemaName = engine.schemaName()
 	}
-	if ds.config.SchemaName == "" {
-		ds.config.SchemaName = defaultSchemaName
+	if err := validateIdentifier("schema name", ds.config.SchemaName); err != nil {
+		return nil, err
 	}
 	if ds.config.IDColumn == "" {
-		ds.config.IDColumn = defaultIDColumn
+		ds.config.IDColumn = engine.idColumn()
 	}
 	if ds.config.MetadataJSONColumn == "" {
-		ds.config.MetadataJSONColumn = defaultMetadataJsonColumn
+		ds.config.MetadataJSONColumn = engine.metadataJSONColumn()
 	}
 	if ds.config.ContentColumn == "" {
-		ds.config.ContentColumn = defaultContentColumn
+		ds.config.ContentColumn = engine.contentColumn()
 	}
 	if ds.config.EmbeddingColumn == "" {
-		ds.config.EmbeddingColumn = defaultEmbeddingColumn
+		ds.config.EmbeddingColumn = engine.embeddingColumn()
+	}
+	if ds.config.TiebreakerColumn == "" {
+		ds.config.TiebreakerColumn = ds.config.IDColumn
+	}
+
+	if ds.config.DistanceStrategy == "" {
+		ds.config.DistanceStrategy = engine.distanceStrategy()
+	}
+	if err := ds.config.DistanceStrategy.validate(); err != nil {
+		return nil, err
+	}
+
+	if ds.config.K < 0 {
+		return nil, fmt.Errorf("k must be positive, got %d", ds.config.K)
+	}
+	if ds.config.K == 0 {
+		ds.config.K = engine.defaultK()
+	}
+
+	if ds.config.IndexBatchSize < 0 {
+		return nil, fmt.Errorf("index batch size must not be negative")
+	}
+	if ds.config.IndexBatchSize == 0 {
+		ds.config.IndexBatchSize = engine.indexBatchSize()
+	}
+	ds.config.Overwrite = ds.config.Overwrite || engine.config.overwrite
+
+	if ds.config.Normalization == "" {
+		ds.config.Normalization = NormalizeOff
+	}
+	if err := ds.config.Normalization.validate(); err != nil {
+		return nil, err
+	}
+	if ds.config.NormalizeTolerance < 0 {
+		return nil, fmt.Errorf("normalize tolerance must not be negative")
+	}
+	if ds.config.NormalizeTolerance == 0 {
+		ds.config.NormalizeTolerance = defaultNormalizeTolerance
+	}
+
+	if ds.config.NonFiniteEmbeddings == "" {
+		ds.config.NonFiniteEmbeddings = NonFiniteReject
+	}
+	if err := ds.config.NonFiniteEmbeddings.validate(); err != nil {
+		return nil, err
+	}
+
+	if ds.config.IndexErrors == "" {
+		ds.config.IndexErrors = IndexFailFast
+	}
+	if err := ds.config.IndexErrors.validate(); err != nil {
+		return nil, err
+	}
+
+	if ds.config.MissingMetadata == "" {
+		ds.config.MissingMetadata = MetadataEmpty
+	}
+	if err := ds.config.MissingMetadata.validate(); err != nil {
+		return nil, err
+	}
+
+	if ds.config.EmbedConcurrency < 0 {
+		return nil, fmt.Errorf("embed concurrency must not be negative")
+	}
+	if ds.config.EmbedConcurrency == 0 {
+		ds.config.EmbedConcurrency = engine.embedConcurrency()
 	}
 
-	if ds.config.Embedder == nil {
+	if ds.config.Embedder == nil && ds.config.TextSearch == nil {
 		return nil, fmt.Errorf("embedder is required")
 	}
+	if ts := ds.config.TextSearch; ts != nil {
+		if ds.config.QueryTemplate != "" {
+			return nil, fmt.Errorf("text search cannot be combined with a query template")
+		}
+		withDefaults := ts.withDefaults(ds.config.ContentColumn)
+		ds.config.TextSearch = &withDefaults
+	}
+	if err := validateQueryTemplate(ds.config.QueryTemplate); err != nil {
+		return nil, err
+	}
 
+	if err := ds.validateNames(); err != nil {
+		return nil, err
+	}
+	if err := ds.validateParents(); err != nil {
+		return nil, err
+	}
 	if err := ds.validateConfiguration(ctx); err != nil {
 		return nil, err
 	}
+	if err := ds.validateRetrievedColumns(); err != nil {
+		return nil, err
+	}
+	if err := ds.validateExternalContent(); err != nil {
+		return nil, err
+	}
+	if err := ds.validateColumnEmbedders(); err != nil {
+		return nil, err
+	}
+	if err := ds.validateIndexes(ctx); err != nil {
+		return nil, err
+	}
+	if err := ds.validateConflictColumns(ctx); err != nil {
+		return nil, err
+	}
+	if err := ds.validateContentHash(); err != nil {
+		return nil, err
+	}
+	if _, err := compileFilters(ds.filters(&RetrieverOptions{}), ds.config.MetadataJSONColumn, ds.config.MetadataColumns, &queryArgs{}); err != nil {
+		return nil, fmt.Errorf("invalid default filter: %w", err)
+	}
 
 	return ds, nil
 }
 
+// validateNames checks that the names of the table and of the columns of
+// the configuration can be quoted as identifiers.
+func (ds *docStore) validateNames() error {
+	type identifier struct{ kind, name string }
+	names := []identifier{
+		{"table name", ds.config.TableName},
+		{"id column", ds.config.IDColumn},
+		{"content column", ds.config.ContentColumn},
+		{"embedding column", ds.config.EmbeddingColumn},
+		{"tiebreaker column", ds.config.TiebreakerColumn},
+	}
+	// The JSON metadata column is optional.
+	if ds.config.MetadataJSONColumn != "" {
+		names = append(names, identifier{"metadata JSON column", ds.config.MetadataJSONColumn})
+	}
+	for _, col := range ds.config.MetadataColumns {
+		names = append(names, identifier{"metadata column", col})
+	}
+	for _, col := range ds.config.ConflictColumns {
+		names = append(names, identifier{"conflict column", col})
+	}
+	if ds.config.ContentHashColumn != "" {
+		names = append(names, identifier{"content hash column", ds.config.ContentHashColumn})
+	}
+	for _, col := range ds.retrievedColumns() {
+		names = append(names, identifier{"retrieved column", col})
+	}
+	for _, ce := range ds.config.ColumnEmbedders {
+		names = append(names, identifier{"column embedder column", ce.Column})
+	}
+	if ts := ds.config.TextSearch; ts != nil {
+		for _, col := range []string{ts.TSVectorColumn, ts.TextColumn} {
+			if col != "" {
+				names = append(names, identifier{"text search column", col})
+			}
+		}
+	}
+	for _, n := range names {
+		if err := validateQuotedIdentifier(n.kind, n.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (ds *docStore) validateConfiguration(ctx context.Context) error {
-	stmt := fmt.Sprintf("SELECT column_name, data_type FROM information_schema.columns WHERE table_name = '%s' AND table_schema = '%s'", ds.config.TableName, ds.config.SchemaName)
-	rows, err := ds.engine.Pool.Query(ctx, stmt)
+	const stmt = "SELECT column_name, data_type, udt_name FROM information_schema.columns WHERE table_name = $1 AND table_schema = $2"
+	rows, err := ds.engine.querier().Query(ctx, stmt, ds.config.TableName, ds.config.SchemaName)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 
 	mapColumnNameDataType := make(map[string]string)
+	ds.vectorColumns = make(map[string]bool)
 
 	for rows.Next() {
-		var columnName, dataType string
-		if err := rows.Scan(&columnName, &dataType); err != nil {
+		var columnName, dataType, udtName string
+		if err := rows.Scan(&columnName, &dataType, &udtName); err != nil {
 			return err
 		}
 		mapColumnNameDataType[columnName] = dataType
+		if udtName == string(Vector) || udtName == string(HalfVec) {
+			ds.vectorColumns[columnName] = true
+		}
+	}
+	// A lookup failing while its rows are read must not pass for a
+	// missing table.
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(mapColumnNameDataType) == 0 {
+		return fmt.Errorf("%w: %q.%q", ErrTableNotFound, ds.config.SchemaName, ds.config.TableName)
 	}
 
 	if _, ok := mapColumnNameDataType[ds.config.IDColumn]; !ok {
@@ -84,17 +280,22 @@ func (ds *docStore) validateConfiguration(ctx context.Context) error {
 		return fmt.Errorf("content column '%s' does not exist", ds.config.ContentColumn)
 	}
 
-	if ccdt != "text" && strings.Contains(ccdt, "char") {
-		return fmt.Errorf("content column '%s' is type '%s'. must be a type of character string", ds.config.ContentColumn, ccdt)
+	if ds.contentType, ok = contentTypeOf(ccdt); !ok {
+		return fmt.Errorf("content column '%s' is type '%s'. must be a type of character string, jsonb or bytea", ds.config.ContentColumn, ccdt)
 	}
 
 	ecdt, ok := mapColumnNameDataType[ds.config.EmbeddingColumn]
-	if !ok {
-		return fmt.Errorf("content column '%s' does not exist", ds.config.ContentColumn)
+	if !ok && ds.config.TextSearch == nil {
+		return fmt.Errorf("embedding column '%s' does not exist", ds.config.EmbeddingColumn)
+	}
+
+	if ok && ecdt != "USER-DEFINED" {
+		return fmt.Errorf("embedding column '%s' must be of type %s", ds.config.EmbeddingColumn, ds.engine.vectorType())
 	}
 
-	if ecdt != "USER-DEFINED" {
-		return fmt.Errorf("content column '%s' must be a type vector", ds.config.ContentColumn)
+	// The JSON metadata column is optional.
+	if _, ok := mapColumnNameDataType[ds.config.MetadataJSONColumn]; !ok {
+		ds.config.MetadataJSONColumn = ""
 	}
 
 	for _, mc := range ds.config.MetadataColumns {
@@ -103,23 +304,229 @@ func (ds *docStore) validateConfiguration(ctx context.Context) error {
 		}
 	}
 
+	for _, rc := range ds.retrievedColumns() {
+		if _, ok = mapColumnNameDataType[rc]; !ok {
+			return fmt.Errorf("retrieved column '%s' does not exist", rc)
+		}
+	}
+
+	if p := ds.config.Parents; p != nil {
+		if _, ok := mapColumnNameDataType[p.Column]; !ok {
+			return fmt.Errorf("parent column '%s' does not exist", p.Column)
+		}
+	}
+
+	if _, ok := mapColumnNameDataType[ds.config.TiebreakerColumn]; !ok {
+		return fmt.Errorf("tiebreaker column '%s' does not exist", ds.config.TiebreakerColumn)
+	}
+
+	if ts := ds.config.TextSearch; ts != nil {
+		col := cmp.Or(ts.TSVectorColumn, ts.TextColumn)
+		if _, ok := mapColumnNameDataType[col]; !ok {
+			return fmt.Errorf("text search column '%s' does not exist", col)
+		}
+	}
+
+	if col := ds.engine.config.softDeleteColumn; col != "" {
+		sddt, ok := mapColumnNameDataType[col]
+		if !ok {
+			return fmt.Errorf("soft delete column '%s' does not exist", col)
+		}
+		if !strings.HasPrefix(sddt, "timestamp") && sddt != "date" {
+			return fmt.Errorf("soft delete column '%s' is type '%s'. must be a timestamp or date", col, sddt)
+		}
+	}
+
+	if col := ds.engine.config.expiryColumn; col != "" {
+		exdt, ok := mapColumnNameDataType[col]
+		if !ok {
+			return fmt.Errorf("expiry column '%s' does not exist", col)
+		}
+		if !strings.HasPrefix(exdt, "timestamp") && exdt != "date" {
+			return fmt.Errorf("expiry column '%s' is type '%s'. must be a timestamp or date", col, exdt)
+		}
+	}
+
+	for _, col := range []string{ds.engine.config.createdAtColumn, ds.engine.config.updatedAtColumn} {
+		if col == "" {
+			continue
+		}
+		tsdt, ok := mapColumnNameDataType[col]
+		if !ok {
+			return fmt.Errorf("timestamp column '%s' does not exist", col)
+		}
+		if !strings.HasPrefix(tsdt, "timestamp") {
+			return fmt.Errorf("timestamp column '%s' is type '%s'. must be a timestamp", col, tsdt)
+		}
+		if slices.Contains(ds.insertColumns(), col) {
+			return fmt.Errorf("timestamp column '%s' is written by the indexer and cannot be a metadata column", col)
+		}
+	}
+
+	if col := ds.config.ContentHashColumn; col != "" {
+		chdt, ok := mapColumnNameDataType[col]
+		if !ok {
+			return fmt.Errorf("content hash column '%s' does not exist", col)
+		}
+		if chdt != "text" && chdt != "character varying" {
+			return fmt.Errorf("content hash column '%s' is type '%s'. must be a text column", col, chdt)
+		}
+	}
+
 	// If using IgnoreMetadataColumns, filter out known columns and set known metadata columns
 	if len(ds.config.IgnoreMetadataColumns) > 0 {
 		delete(mapColumnNameDataType, ds.config.IDColumn)
 		delete(mapColumnNameDataType, ds.config.ContentColumn)
 		delete(mapColumnNameDataType, ds.config.EmbeddingColumn)
+		delete(mapColumnNameDataType, ds.config.MetadataJSONColumn)
+		delete(mapColumnNameDataType, ds.engine.config.softDeleteColumn)
+		delete(mapColumnNameDataType, ds.engine.config.createdAtColumn)
+		delete(mapColumnNameDataType, ds.engine.config.updatedAtColumn)
+		delete(mapColumnNameDataType, ds.config.ContentHashColumn)
+		if ts := ds.config.TextSearch; ts != nil {
+			delete(mapColumnNameDataType, ts.TSVectorColumn)
+		}
 
 		for _, col := range ds.config.IgnoreMetadataColumns {
 			delete(mapColumnNameDataType, col)
 		}
+		for col := range ds.config.RetrievedColumns {
+			delete(mapColumnNameDataType, col)
+		}
+		for col := range ds.vectorColumns {
+			delete(mapColumnNameDataType, col)
+		}
 
 		var filteredColumns []string
-		for _, col := range mapColumnNameDataType {
+		for col := range mapColumnNameDataType {
 			filteredColumns = append(filteredColumns, col)
 		}
+		// Sort the columns so that the queries of the store are stable.
+		slices.Sort(filteredColumns)
 		ds.config.MetadataColumns = filteredColumns
 	}
 
+	// The types are those of the final metadata columns, including those
+	// derived with IgnoreMetadataColumns.
+	ds.columnTypes = make(map[string]string)
+	for _, mc := range ds.config.MetadataColumns {
+		ds.columnTypes[mc] = mapColumnNameDataType[mc]
+	}
+
+	return nil
+}
+
+// validateColumnEmbedders checks that the columns of [Config.ColumnEmbedders]
+// are distinct additional embedding columns of the table, with embedders.
+func (ds *docStore) validateColumnEmbedders() error {
+	seen := make(map[string]bool)
+	for _, ce := range ds.config.ColumnEmbedders {
+		if ce.Column == ds.config.EmbeddingColumn {
+			return fmt.Errorf("column embedder column '%s' is the embedding column, which Embedder populates", ce.Column)
+		}
+		if !ds.vectorColumns[ce.Column] {
+			return fmt.Errorf("column embedder column '%s' is not an embedding column of the table", ce.Column)
+		}
+		if seen[ce.Column] {
+			return fmt.Errorf("column embedder column '%s' is listed more than once", ce.Column)
+		}
+		seen[ce.Column] = true
+		if ce.Embedder == nil {
+			return fmt.Errorf("column embedder of column '%s' has no embedder", ce.Column)
+		}
+	}
+	return nil
+}
+
+// validateIndexes checks that the vector indexes on the embedding column, if
+// any, can serve queries with the configured distance strategy.
+func (ds *docStore) validateIndexes(ctx context.Context) error {
+	rows, err := ds.engine.querier().Query(ctx, "SELECT indexdef FROM pg_indexes WHERE schemaname = $1 AND tablename = $2", ds.config.SchemaName, ds.config.TableName)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var defs []string
+	for rows.Next() {
+		var def string
+		if err := rows.Scan(&def); err != nil {
+			return err
+		}
+		defs = append(defs, def)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return checkIndexOperatorClass(defs, ds.config.EmbeddingColumn, ds.engine.vectorType(), ds.config.DistanceStrategy)
+}
+
+// customConflict reports whether the indexer detects existing rows by
+// [Config.ConflictColumns] rather than by the id column.
+func (ds *docStore) customConflict() bool {
+	cols := ds.config.ConflictColumns
+	return len(cols) > 0 && !(len(cols) == 1 && cols[0] == ds.config.IDColumn)
+}
+
+// conflictColumns returns the columns of the conflict target of the insert
+// statement.
+func (ds *docStore) conflictColumns() []string {
+	if len(ds.config.ConflictColumns) == 0 {
+		return []string{ds.config.IDColumn}
+	}
+	return ds.config.ConflictColumns
+}
+
+// validateConflictColumns checks that the conflict columns are written by
+// the indexer and covered by a unique index.
+func (ds *docStore) validateConflictColumns(ctx context.Context) error {
+	if !ds.customConflict() {
+		return nil
+	}
+	for _, col := range ds.config.ConflictColumns {
+		if col != ds.config.IDColumn && !slices.Contains(ds.config.MetadataColumns, col) {
+			return fmt.Errorf("conflict column %q must be the id column or one of the metadata columns", col)
+		}
+	}
+	const query = `SELECT string_agg(a.attname, ',' ORDER BY a.attname) FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = ANY(i.indkey)
+		WHERE n.nspname = $1 AND c.relname = $2 AND i.indisunique AND i.indpred IS NULL AND i.indexprs IS NULL
+		GROUP BY i.indexrelid`
+	rows, err := ds.engine.querier().Query(ctx, query, ds.config.SchemaName, ds.config.TableName)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var indexes [][]string
+	for rows.Next() {
+		var cols string
+		if err := rows.Scan(&cols); err != nil {
+			return err
+		}
+		indexes = append(indexes, strings.Split(cols, ","))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if !hasUniqueIndex(indexes, ds.config.ConflictColumns) {
+		return fmt.Errorf("conflict columns %q of table %q are not covered by a unique index or constraint; create one on exactly these columns",
+			ds.config.ConflictColumns, ds.config.TableName)
+	}
 	return nil
+}
 
+// hasUniqueIndex reports whether one of the unique indexes, given by their
+// columns, is on exactly cols, in any order. It has to be exact for ON
+// CONFLICT to infer it.
+func hasUniqueIndex(indexes [][]string, cols []string) bool {
+	want := slices.Sorted(slices.Values(cols))
+	want = slices.Compact(want)
+	for _, idx := range indexes {
+		if slices.Equal(slices.Sorted(slices.Values(idx)), want) {
+			return true
+		}
+	}
+	return false
 }
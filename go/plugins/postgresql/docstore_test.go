@@ -0,0 +1,66 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// informationSchemaResult answers the column lookup of validateConfiguration
+// with the columns of a table, given as pairs of names and data types.
+func informationSchemaResult(columns ...string) fakeResult {
+	r := fakeResult{columns: []string{"column_name", "data_type", "udt_name"}}
+	for i := 0; i+1 < len(columns); i += 2 {
+		udt := columns[i+1]
+		if udt == "USER-DEFINED" {
+			udt = "vector"
+		}
+		r.rows = append(r.rows, []driver.Value{columns[i], columns[i+1], udt})
+	}
+	return r
+}
+
+func TestValidateConfigurationIgnoreMetadataColumns(t *testing.T) {
+	db := &fakeDB{results: map[string]fakeResult{
+		"information_schema.columns": informationSchemaResult("id", "text", "content", "text", "embedding", "USER-DEFINED",
+			"metadata", "jsonb", "price", "numeric", "attrs", "jsonb", "internal", "text"),
+	}}
+	ds := testDocStore()
+	ds.engine = PostgresEngine{config: engineConfig{db: db.open(t)}}
+	ds.config.MetadataColumns = nil
+	ds.config.IgnoreMetadataColumns = []string{"internal"}
+	require.NoError(t, ds.validateConfiguration(context.Background()))
+	assert.Equal(t, []string{"attrs", "price"}, ds.config.MetadataColumns)
+	assert.Equal(t, map[string]string{"attrs": "jsonb", "price": "numeric"}, ds.columnTypes)
+
+	// The derived columns are decoded by type, as listed ones are.
+	doc, err := ds.rowToDocument([]any{"a", "text", nil, []byte(`{"color":"red"}`), "9.5", 0.25})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"color": "red"}, doc.Metadata["attrs"])
+	assert.Equal(t, 9.5, doc.Metadata["price"])
+}
+
+func TestValidateConfigurationLookupErrors(t *testing.T) {
+	// A lookup failing while its rows are read is not a missing table.
+	failed := informationSchemaResult()
+	failed.readErr = errors.New("connection reset")
+	db := &fakeDB{results: map[string]fakeResult{"information_schema.columns": failed}}
+	ds := testDocStore()
+	ds.engine = PostgresEngine{config: engineConfig{db: db.open(t)}}
+	err := ds.validateConfiguration(context.Background())
+	assert.ErrorContains(t, err, "connection reset")
+	assert.NotErrorIs(t, err, ErrTableNotFound)
+
+	db.results["information_schema.columns"] = informationSchemaResult()
+	assert.ErrorIs(t, ds.validateConfiguration(context.Background()), ErrTableNotFound)
+
+	// A row that cannot be scanned releases the connection.
+	db.results["information_schema.columns"] = fakeResult{columns: []string{"column_name"}, rows: [][]driver.Value{{"id"}}}
+	h := ds.engine.config.db
+	assert.Error(t, ds.validateConfiguration(context.Background()))
+	assert.Zero(t, h.Stats().InUse)
+}
@@ -0,0 +1,198 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/pgvector/pgvector-go"
+	"golang.org/x/sync/errgroup"
+)
+
+// embedDocuments returns the embeddings of docs, in order. With an
+// [Config.EmbedConcurrency] above 1, the documents are embedded in chunks of
+// [Config.IndexBatchSize], up to EmbedConcurrency chunks at a time; the
+// first failure cancels the remaining chunks.
+func (ds *docStore) embedDocuments(ctx context.Context, docs []*ai.Document) ([][]float32, error) {
+	return ds.embedDocumentsReusing(ctx, docs, nil)
+}
+
+// embedDocumentsReusing is like embedDocuments, but returns the embedding of
+// stored, if any, for the documents whose embedding in stored is not nil,
+// without embedding them.
+func (ds *docStore) embedDocumentsReusing(ctx context.Context, docs []*ai.Document, stored [][]float32) ([][]float32, error) {
+	return ds.embedConcurrently(ctx, docs, func(ctx context.Context, chunk []*ai.Document, offset int) ([][]float32, error) {
+		var reused [][]float32
+		if stored != nil {
+			reused = stored[offset : offset+len(chunk)]
+		}
+		return ds.embedChunk(ctx, chunk, offset, reused)
+	})
+}
+
+// embedConcurrently embeds docs with embed, in chunks as described for
+// embedDocuments. embed is passed the position of the first document of
+// its chunk in docs.
+func (ds *docStore) embedConcurrently(ctx context.Context, docs []*ai.Document, embed func(ctx context.Context, docs []*ai.Document, offset int) ([][]float32, error)) ([][]float32, error) {
+	if ds.config.EmbedConcurrency <= 1 {
+		return embed(ctx, docs, 0)
+	}
+	embeddings := make([][]float32, len(docs))
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(ds.config.EmbedConcurrency)
+	for start := 0; start < len(docs); start += ds.config.IndexBatchSize {
+		end := min(start+ds.config.IndexBatchSize, len(docs))
+		g.Go(func() error {
+			chunk, err := embed(ctx, docs[start:end], start)
+			if err != nil {
+				return err
+			}
+			copy(embeddings[start:end], chunk)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return embeddings, nil
+}
+
+// embedChunk embeds docs in a single request, apart from those that carry
+// their embedding and those whose embedding in stored, which may be nil, is
+// not nil. offset is the position of the first document in the indexer
+// request, used for error reporting.
+func (ds *docStore) embedChunk(ctx context.Context, docs []*ai.Document, offset int, stored [][]float32) ([][]float32, error) {
+	embeddings := make([][]float32, len(docs))
+	var pending []*ai.Document
+	var positions []int
+	for i, doc := range docs {
+		if stored != nil && stored[i] != nil {
+			embeddings[i] = stored[i]
+			continue
+		}
+		emb, ok, err := ds.precomputedEmbedding(doc)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", offset+i, err)
+		}
+		if ok {
+			embeddings[i] = emb
+			continue
+		}
+		pending = append(pending, doc)
+		positions = append(positions, i)
+	}
+	if len(pending) == 0 {
+		return embeddings, nil
+	}
+
+	computed, err := embedWith(ctx, ds.config.Embedder, ds.config.EmbedderOptions, pending)
+	if err != nil {
+		return nil, fmt.Errorf("embedding documents %d to %d failed: %w", offset, offset+len(docs)-1, err)
+	}
+	for i, emb := range computed {
+		embeddings[positions[i]] = emb
+	}
+	return embeddings, nil
+}
+
+// embedWith embeds docs with embedder in a single request.
+func embedWith(ctx context.Context, embedder ai.Embedder, opts any, docs []*ai.Document) ([][]float32, error) {
+	if embedder == nil {
+		return nil, errors.New("no embedder is configured")
+	}
+	eres, err := embedder.Embed(ctx, &ai.EmbedRequest{
+		Documents: docs,
+		Options:   opts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(eres.Embeddings) != len(docs) {
+		return nil, fmt.Errorf("embedder returned %d embeddings for %d documents", len(eres.Embeddings), len(docs))
+	}
+	embeddings := make([][]float32, len(docs))
+	for i, e := range eres.Embeddings {
+		embeddings[i] = e.Embedding
+	}
+	return embeddings, nil
+}
+
+// embedColumns embeds docs with each of [Config.ColumnEmbedders], in chunks
+// like embedDocuments, and sets the embeddings of the additional columns of
+// rows, the rows of docs, checking them against the dimension of their
+// column. Precomputed embeddings only apply to the embedding column. offset
+// is the position of the first document in the indexer request, used for
+// error reporting.
+func (ds *docStore) embedColumns(ctx context.Context, docs []*ai.Document, rows []indexRow, offset int) error {
+	if len(ds.config.ColumnEmbedders) == 0 {
+		return nil
+	}
+	for i := range rows {
+		rows[i].columnEmbeddings = make([]pgvector.Vector, len(ds.config.ColumnEmbedders))
+	}
+	for j, ce := range ds.config.ColumnEmbedders {
+		dim, err := ds.columnDimension(ctx, ce.Column)
+		if err != nil {
+			return err
+		}
+		embeddings, err := ds.embedConcurrently(ctx, docs, func(ctx context.Context, docs []*ai.Document, start int) ([][]float32, error) {
+			embeddings, err := embedWith(ctx, ce.Embedder, ce.EmbedderOptions, docs)
+			if err != nil {
+				return nil, fmt.Errorf("embedding documents %d to %d for column %q failed: %w", offset+start, offset+start+len(docs)-1, ce.Column, err)
+			}
+			return embeddings, nil
+		})
+		if err != nil {
+			return err
+		}
+		for i, emb := range embeddings {
+			emb, err := ds.sanitize(rows[i].id, emb)
+			if err == nil {
+				emb, err = ds.normalize(emb)
+			}
+			if err == nil {
+				rows[i].columnEmbeddings[j], err = newVector(emb)
+			}
+			if err != nil {
+				return fmt.Errorf("document %d (id %q): column %q: %w", offset+i, rows[i].id, ce.Column, err)
+			}
+			if dim > 0 && len(emb) != dim {
+				return fmt.Errorf("document %d (id %q): %w: embedding has %d dimensions, but column %q expects %d",
+					offset+i, rows[i].id, ErrDimensionMismatch, len(emb), ce.Column, dim)
+			}
+		}
+	}
+	return nil
+}
+
+// precomputedEmbedding returns the embedding carried by doc under
+// [EmbeddingMetadataKey], if any: a []float32 as is, a []byte or base64
+// string in the format of [EncodeEmbedding] with [WithBinaryEmbeddingFormat],
+// or any other value converted by the decoder set with [WithEmbeddingDecoder].
+func (ds *docStore) precomputedEmbedding(doc *ai.Document) ([]float32, bool, error) {
+	v, ok := doc.Metadata[EmbeddingMetadataKey]
+	if !ok {
+		return nil, false, nil
+	}
+	if emb, ok := v.([]float32); ok {
+		return emb, true, nil
+	}
+	if ds.engine.config.binaryEmbeddings {
+		if emb, ok, err := decodeBinaryEmbedding(v); ok {
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to decode the embedding in metadata key %q: %w", EmbeddingMetadataKey, err)
+			}
+			return emb, true, nil
+		}
+	}
+	decode := ds.engine.config.embeddingDecoder
+	if decode == nil {
+		return nil, false, fmt.Errorf("embedding in metadata key %q has type %T; set a decoder with WithEmbeddingDecoder to convert it", EmbeddingMetadataKey, v)
+	}
+	emb, err := decode(v)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decode the embedding in metadata key %q: %w", EmbeddingMetadataKey, err)
+	}
+	return emb, true, nil
+}
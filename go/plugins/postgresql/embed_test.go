@@ -0,0 +1,167 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeEmbedder embeds each document as a vector holding its text parsed as
+// a number, and fails for documents whose text is "fail".
+type fakeEmbedder struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (e *fakeEmbedder) Name() string { return "fake" }
+
+func (e *fakeEmbedder) Embed(ctx context.Context, req *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+	e.mu.Lock()
+	e.calls++
+	e.mu.Unlock()
+	res := &ai.EmbedResponse{}
+	for _, doc := range req.Documents {
+		text := documentText(doc)
+		if text == "fail" {
+			return nil, errors.New("embedding failed")
+		}
+		n, _ := strconv.Atoi(text)
+		res.Embeddings = append(res.Embeddings, &ai.DocumentEmbedding{Embedding: []float32{float32(n)}})
+	}
+	return res, nil
+}
+
+func testDocuments(texts ...string) []*ai.Document {
+	docs := make([]*ai.Document, len(texts))
+	for i, text := range texts {
+		docs[i] = ai.DocumentFromText(text, nil)
+	}
+	return docs
+}
+
+func TestEmbedDocumentsConcurrently(t *testing.T) {
+	emb := &fakeEmbedder{}
+	ds := testDocStore()
+	ds.config.Embedder = emb
+	ds.config.IndexBatchSize = 2
+	ds.config.EmbedConcurrency = 3
+
+	embeddings, err := ds.embedDocuments(context.Background(), testDocuments("0", "1", "2", "3", "4"))
+	assert.NoError(t, err)
+	assert.Equal(t, [][]float32{{0}, {1}, {2}, {3}, {4}}, embeddings)
+	assert.Equal(t, 3, emb.calls)
+
+	_, err = ds.embedDocuments(context.Background(), testDocuments("0", "1", "fail", "3"))
+	assert.Error(t, err)
+}
+
+func TestEmbedDocumentsSingleRequest(t *testing.T) {
+	emb := &fakeEmbedder{}
+	ds := testDocStore()
+	ds.config.Embedder = emb
+	ds.config.IndexBatchSize = 2
+
+	embeddings, err := ds.embedDocuments(context.Background(), testDocuments("0", "1", "2"))
+	assert.NoError(t, err)
+	assert.Equal(t, [][]float32{{0}, {1}, {2}}, embeddings)
+	assert.Equal(t, 1, emb.calls)
+}
+
+func TestEmbedDocumentsPrecomputed(t *testing.T) {
+	emb := &fakeEmbedder{}
+	ds := testDocStore()
+	ds.config.Embedder = emb
+
+	docs := testDocuments("0", "1", "2")
+	docs[0].Metadata = map[string]any{EmbeddingMetadataKey: []float32{7}}
+	docs[2].Metadata = map[string]any{EmbeddingMetadataKey: []any{8.0}}
+	_, err := ds.embedDocuments(context.Background(), docs)
+	assert.ErrorContains(t, err, "document 2: embedding in metadata key")
+	assert.Zero(t, emb.calls)
+
+	ds.engine.config.embeddingDecoder = func(v any) ([]float32, error) {
+		values, ok := v.([]any)
+		if !ok {
+			return nil, errors.New("not an array")
+		}
+		vec := make([]float32, len(values))
+		for i, x := range values {
+			vec[i] = float32(x.(float64))
+		}
+		return vec, nil
+	}
+	embeddings, err := ds.embedDocuments(context.Background(), docs)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]float32{{7}, {1}, {8}}, embeddings)
+	assert.Equal(t, 1, emb.calls)
+
+	docs[1].Metadata = map[string]any{EmbeddingMetadataKey: "AAAA"}
+	_, err = ds.embedDocuments(context.Background(), docs)
+	assert.ErrorContains(t, err, "document 1: failed to decode the embedding")
+	assert.Equal(t, 1, emb.calls)
+
+	// The embedding is not stored with the metadata.
+	row, err := ds.newIndexRow(docs[0], embeddings[0])
+	assert.NoError(t, err)
+	assert.NotContains(t, row.metadata, EmbeddingMetadataKey)
+}
+
+// namedEmbedder is a fakeEmbedder registered under another name, whose
+// embeddings have a second element, 1.
+type namedEmbedder struct {
+	fakeEmbedder
+	name string
+}
+
+func (e *namedEmbedder) Name() string { return e.name }
+
+func (e *namedEmbedder) Embed(ctx context.Context, req *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+	res, err := e.fakeEmbedder.Embed(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	for _, emb := range res.Embeddings {
+		emb.Embedding = append(emb.Embedding, 1)
+	}
+	return res, nil
+}
+
+func TestEmbedColumns(t *testing.T) {
+	ds := testDocStore()
+	ds.config.Embedder = &fakeEmbedder{}
+	other := &namedEmbedder{name: "other"}
+	ds.config.ColumnEmbedders = []ColumnEmbedder{{Column: "embedding_b", Embedder: other}}
+	ds.config.IndexBatchSize = 2
+	ds.config.EmbedConcurrency = 2
+	ds.columnDimensions = map[string]int{"embedding_b": 2}
+
+	docs := testDocuments("1", "2", "3")
+	rows := make([]indexRow, len(docs))
+	for i := range rows {
+		rows[i].id = documentText(docs[i])
+	}
+	assert.NoError(t, ds.embedColumns(context.Background(), docs, rows, 0))
+	for i, r := range rows {
+		if assert.Len(t, r.columnEmbeddings, 1) {
+			assert.Equal(t, []float32{float32(i + 1), 1}, r.columnEmbeddings[0].Slice())
+		}
+	}
+	assert.Equal(t, 2, other.calls)
+
+	// Embeddings are checked against the dimension of their column.
+	ds.columnDimensions["embedding_b"] = 3
+	err := ds.embedColumns(context.Background(), docs, rows, 5)
+	assert.ErrorIs(t, err, ErrDimensionMismatch)
+	assert.ErrorContains(t, err, `document 5 (id "1")`)
+	assert.ErrorContains(t, err, `column "embedding_b" expects 3`)
+
+	_, err = ds.embedDocuments(context.Background(), testDocuments("fail"))
+	assert.Error(t, err)
+	err = ds.embedColumns(context.Background(), testDocuments("1", "fail"), rows[:2], 0)
+	assert.ErrorContains(t, err, `for column "embedding_b" failed`)
+}
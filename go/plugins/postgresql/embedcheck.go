@@ -0,0 +1,78 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// embedderCheckText is the text embedded to check the dimension of the
+// embeddings of an embedder.
+const embedderCheckText = "dimension check"
+
+// checkEmbedderDimensions embeds a short text once with each embedder of the
+// table, [Config.Embedder], [Config.QueryEmbedder] and the embedders of
+// [Config.ColumnEmbedders], and returns an error wrapping
+// [ErrDimensionMismatch] if the dimension of an embedding differs from that
+// of the column it is written to or searched in, so that a misconfigured
+// embedder fails at setup rather than at the first request. Columns without
+// a declared dimension are not checked. It does nothing with
+// [Config.SkipEmbedderCheck].
+func (ds *docStore) checkEmbedderDimensions(ctx context.Context) error {
+	if ds.config.SkipEmbedderCheck {
+		return nil
+	}
+	type check struct {
+		column   string
+		embedder ai.Embedder
+		opts     any
+		dim      int // dimension of the embeddings, if already known
+	}
+	var checks []check
+	if ds.config.Embedder != nil {
+		checks = append(checks, check{ds.config.EmbeddingColumn, ds.config.Embedder, ds.config.EmbedderOptions, ds.embedderDimension})
+	}
+	if ds.config.QueryEmbedder != nil {
+		checks = append(checks, check{ds.config.EmbeddingColumn, ds.config.QueryEmbedder, ds.config.QueryEmbedderOptions, 0})
+	}
+	for _, ce := range ds.config.ColumnEmbedders {
+		checks = append(checks, check{ce.Column, ce.Embedder, ce.EmbedderOptions, 0})
+	}
+	for _, c := range checks {
+		dim, err := ds.columnDimension(ctx, c.column)
+		if err != nil {
+			return err
+		}
+		if dim <= 0 {
+			continue
+		}
+		n := c.dim
+		if n == 0 {
+			if n, err = embedderDimension(ctx, c.embedder, c.opts); err != nil {
+				return err
+			}
+		}
+		if n != dim {
+			return fmt.Errorf("%w: embedder %q returns embeddings of %d dimensions, but column %q expects %d",
+				ErrDimensionMismatch, c.embedder.Name(), n, c.column, dim)
+		}
+	}
+	return nil
+}
+
+// embedderDimension returns the dimension of the embeddings of embedder,
+// which embeds a short text once.
+func embedderDimension(ctx context.Context, embedder ai.Embedder, opts any) (int, error) {
+	eres, err := embedder.Embed(ctx, &ai.EmbedRequest{
+		Documents: []*ai.Document{ai.DocumentFromText(embedderCheckText, nil)},
+		Options:   opts,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to check the dimension of embedder %q: %w; see Config.SkipEmbedderCheck", embedder.Name(), err)
+	}
+	if len(eres.Embeddings) == 0 {
+		return 0, fmt.Errorf("failed to check the dimension of embedder %q: it returned no embeddings", embedder.Name())
+	}
+	return len(eres.Embeddings[0].Embedding), nil
+}
@@ -0,0 +1,46 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckEmbedderDimensions(t *testing.T) {
+	ctx := context.Background()
+	ds := testDocStore()
+	embedder := &fakeEmbedder{}
+	ds.config.Embedder = embedder
+	ds.dimension = 1
+	assert.NoError(t, ds.checkEmbedderDimensions(ctx))
+	assert.Equal(t, 1, embedder.calls)
+
+	ds.dimension = 3
+	err := ds.checkEmbedderDimensions(ctx)
+	assert.ErrorIs(t, err, ErrDimensionMismatch)
+	assert.ErrorContains(t, err, `embedder "fake" returns embeddings of 1 dimensions, but column "embedding" expects 3`)
+
+	// Query and column embedders are checked too.
+	ds.dimension = 1
+	ds.config.QueryEmbedder = &fakeEmbedder{}
+	ds.config.ColumnEmbedders = []ColumnEmbedder{{Column: "embedding_b", Embedder: &fakeEmbedder{}}}
+	ds.columnDimensions = map[string]int{"embedding_b": 8}
+	assert.ErrorContains(t, ds.checkEmbedderDimensions(ctx), `column "embedding_b" expects 8`)
+
+	// Columns without a declared dimension are not checked.
+	ds.columnDimensions["embedding_b"] = -1
+	assert.NoError(t, ds.checkEmbedderDimensions(ctx))
+
+	// A known dimension of the embedder is not checked again.
+	calls := embedder.calls
+	ds.embedderDimension = 1
+	ds.config.QueryEmbedder, ds.config.ColumnEmbedders = nil, nil
+	assert.NoError(t, ds.checkEmbedderDimensions(ctx))
+	assert.Equal(t, calls, embedder.calls)
+
+	ds.dimension = 3
+	ds.config.SkipEmbedderCheck = true
+	assert.NoError(t, ds.checkEmbedderDimensions(ctx))
+	assert.Equal(t, calls, embedder.calls)
+}
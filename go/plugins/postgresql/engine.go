@@ -1,39 +1,95 @@
 package postgresql
 
 import (
+	"cmp"
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"sync"
 
+	"cloud.google.com/go/alloydbconn"
 	"cloud.google.com/go/cloudsqlconn"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/puddle/v2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/oauth2/v2"
 	"google.golang.org/api/option"
 )
 
-// IpType type of IP address, public or private
+// IpType type of IP address, public or private, or Private Service Connect
 type IpType string
 
 const (
 	PUBLIC  IpType = "PUBLIC"
 	PRIVATE IpType = "PRIVATE"
+	// PSC connects through the Private Service Connect endpoint of the
+	// instance, which must have PSC enabled.
+	PSC IpType = "PSC"
 )
 
 // PostgresEngine postgres engine
 type PostgresEngine struct {
+	// Pool is the connection pool used by the engine, or nil when the engine
+	// was created with WithDB or WithConn. It can be used to run custom queries; callers
+	// must not close it, use [PostgresEngine.Close] instead. If a pool built
+	// by the engine is closed anyway, the engine replaces it, and
+	// [PostgresEngine.GetClient] returns the replacement.
 	Pool *pgxpool.Pool
+
+	config engineConfig
+	dialer io.Closer // connector dialer opened by the engine, if any
+	closer *closeState
+	pools  *poolState // current pool, if the engine uses a pgx pool
+}
+
+// closeState records whether an engine has been closed. It is shared by
+// the copies of an engine.
+type closeState struct {
+	mu     sync.Mutex
+	closed bool
 }
 
 // NewPostgresEngine creates a new Postgres Engine.
 func NewPostgresEngine(ctx context.Context, opts ...Option) (*PostgresEngine, error) {
-	pgEngine := new(PostgresEngine)
+	pgEngine := &PostgresEngine{closer: &closeState{}}
 	cfg, err := applyEngineOptions(opts)
 	if err != nil {
 		return nil, err
 	}
-	if cfg.connPool == nil {
+	injectedPool := cfg.connPool != nil
+	if cfg.connStringConfig != nil {
+		if cfg.tokenProvider != nil {
+			if cfg.user != "" {
+				cfg.connStringConfig.ConnConfig.User = cfg.user
+			}
+			cfg.connStringConfig.BeforeConnect = iamAuthBeforeConnect(cfg.tokenProvider)
+		} else if cfg.iamAccountEmail != "" {
+			// Without a connector, IAM tokens are sent as passwords. They
+			// expire after an hour, so fetch one for every new connection.
+			provider, err := NewGoogleTokenProvider(ctx, cfg.credentials)
+			if err != nil {
+				return nil, err
+			}
+			if cfg.connStringConfig.ConnConfig.User == "" {
+				cfg.connStringConfig.ConnConfig.User = iamDatabaseUser(cfg.iamAccountEmail)
+			}
+			cfg.connStringConfig.BeforeConnect = iamAuthBeforeConnect(provider)
+		}
+		cfg.connPool, err = createPoolFromConfig(ctx, cfg.connStringConfig, cfg)
+		if err != nil {
+			return nil, err
+		}
+	} else if cfg.connPool == nil && cfg.db == nil && cfg.conn == nil {
 		user, usingIAMAuth, err := getUser(ctx, cfg)
 		if err != nil {
 			// If no user can be determined, return an error.
@@ -42,22 +98,102 @@ func NewPostgresEngine(ctx context.Context, opts ...Option) (*PostgresEngine, er
 		if usingIAMAuth {
 			cfg.user = user
 		}
-		cfg.connPool, err = createPool(ctx, cfg, usingIAMAuth)
+		cfg.connPool, pgEngine.dialer, err = createPool(ctx, cfg, usingIAMAuth)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	if err := cfg.connPool.Ping(ctx); err != nil {
-		return nil, fmt.Errorf("failed to connect with database %v", err)
-	}
-
 	pgEngine.Pool = cfg.connPool
+	if cfg.connPool != nil {
+		pgEngine.pools = &poolState{pool: cfg.connPool, owned: !injectedPool}
+	}
+	pgEngine.config = cfg
+	if cfg.preparedShapes != nil && !pgEngine.cachesStatements() {
+		cfg.preparedShapes.uncached = true
+	}
+	if err := pgEngine.Ping(ctx); err != nil {
+		pgEngine.Close(ctx)
+		return nil, fmt.Errorf("failed to connect with database: %w", err)
+	}
+	if !injectedPool && cfg.minConns > 0 {
+		// pgx only opens the minimum connections on its first health
+		// check, a minute after the pool is created.
+		if err := pgEngine.WarmUp(ctx, int(cfg.minConns)); err != nil {
+			pgEngine.Close(ctx)
+			return nil, err
+		}
+	}
 	return pgEngine, nil
 }
 
+// Ping acquires a connection from the pool and runs a trivial query on it,
+// honoring the deadline of ctx. It can be used as a readiness check.
+func (pgEngine *PostgresEngine) Ping(ctx context.Context) error {
+	if pgEngine.config.conn != nil {
+		if err := pgEngine.config.conn.Ping(ctx); err != nil {
+			return fmt.Errorf("%s: %w", describeConnError(err), err)
+		}
+		return nil
+	}
+	if pgEngine.config.db != nil {
+		if _, err := pgEngine.config.db.ExecContext(ctx, "SELECT 1"); err != nil {
+			return fmt.Errorf("%s: %w", describeConnError(err), err)
+		}
+		return nil
+	}
+	return pgEngine.withPool(ctx, func(pool *pgxpool.Pool) error {
+		return pingPool(ctx, pool)
+	})
+}
+
+func pingPool(ctx context.Context, pool *pgxpool.Pool) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		if errors.Is(err, puddle.ErrClosedPool) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", describeConnError(err), err)
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "SELECT 1"); err != nil {
+		return fmt.Errorf("%s: %w", describeConnError(err), err)
+	}
+	return nil
+}
+
+// describeConnError returns a short description of the kind of failure
+// behind a connection error.
+func describeConnError(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return "ping failed: unable to resolve database host"
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "28000", "28P01":
+			return "ping failed: authentication rejected"
+		case "3D000":
+			return "ping failed: database does not exist"
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "ping failed: deadline exceeded"
+	}
+	return "ping failed"
+}
+
+// GetClient returns the connection pool used by the engine, or nil when the
+// engine was created with WithDB or WithConn. Callers must not close it.
 func (pgEngine *PostgresEngine) GetClient() *pgxpool.Pool {
-	return pgEngine.Pool
+	return pgEngine.pool()
+}
+
+// DB returns the database/sql handle passed to WithDB, or nil when the engine
+// uses a connection pool. It is owned by the caller that provided it.
+func (pgEngine *PostgresEngine) DB() *sql.DB {
+	return pgEngine.config.db
 }
 
 func applyEngineOptions(opts []Option) (engineConfig, error) {
@@ -69,18 +205,338 @@ func applyEngineOptions(opts []Option) (engineConfig, error) {
 		opt(cfg)
 	}
 
-	if cfg.connPool == nil && (cfg.projectID == "" || cfg.region == "" || cfg.instance == "") {
-		return engineConfig{}, errors.New("missing connection: provide a connection pool or db instance fields")
+	hasCloudSQL := cfg.projectID != "" || cfg.region != "" || cfg.instance != ""
+	hasAlloyDB := cfg.alloyDBInstance != ""
+	if cfg.unixSocket != "" {
+		if hasCloudSQL || hasAlloyDB || cfg.connString != "" || cfg.connPool != nil || cfg.db != nil || cfg.conn != nil {
+			return engineConfig{}, errors.New("conflicting connection: a Unix socket cannot be combined with a connection pool, a connection string or db instance fields")
+		}
+		if !filepath.IsAbs(cfg.unixSocket) {
+			return engineConfig{}, fmt.Errorf("unix socket directory %q must be an absolute path", cfg.unixSocket)
+		}
+	}
+	if hasCloudSQL && hasAlloyDB {
+		return engineConfig{}, errors.New("conflicting connection: provide either a Cloud SQL or an AlloyDB instance, not both")
+	}
+	switch cfg.ipType {
+	case PUBLIC, PRIVATE:
+	case PSC:
+		if !hasCloudSQL && !hasAlloyDB {
+			return engineConfig{}, errors.New("ip type PSC requires a Cloud SQL or AlloyDB instance")
+		}
+	default:
+		return engineConfig{}, fmt.Errorf("invalid ip type %q: must be PUBLIC, PRIVATE or PSC", cfg.ipType)
+	}
+	if cfg.conn != nil {
+		if cfg.connString != "" || hasCloudSQL || hasAlloyDB || cfg.connPool != nil || cfg.db != nil {
+			return engineConfig{}, errors.New("conflicting connection: a pgx connection cannot be combined with a connection pool, a database/sql handle, a connection string or db instance fields")
+		}
+		if cfg.hasPoolSizing() {
+			return engineConfig{}, errors.New("pool sizing options cannot be used with a connection provided by WithConn")
+		}
+		if cfg.database == "" {
+			cfg.database = cfg.conn.Config().Database
+		}
+	} else if cfg.db != nil {
+		if cfg.connString != "" || hasCloudSQL || hasAlloyDB || cfg.connPool != nil {
+			return engineConfig{}, errors.New("conflicting connection: a database/sql handle cannot be combined with a connection pool, a connection string or db instance fields")
+		}
+		if _, ok := cfg.db.Driver().(*stdlib.Driver); !ok {
+			return engineConfig{}, fmt.Errorf("database/sql handle uses driver %T, want the pgx stdlib driver", cfg.db.Driver())
+		}
+		if cfg.hasPoolSizing() {
+			return engineConfig{}, errors.New("pool sizing options cannot be used with a database/sql handle provided by WithDB")
+		}
+	} else if cfg.connString != "" {
+		if hasCloudSQL || hasAlloyDB || cfg.connPool != nil {
+			return engineConfig{}, errors.New("conflicting connection: a connection string cannot be combined with a connection pool or db instance fields")
+		}
+		poolConfig, err := pgxpool.ParseConfig(cfg.connString)
+		if err != nil {
+			return engineConfig{}, fmt.Errorf("failed to parse connection string: %w", err)
+		}
+		if dsnDatabase := poolConfig.ConnConfig.Database; dsnDatabase != "" {
+			if cfg.database != "" && cfg.database != dsnDatabase {
+				slog.Default().Warn("database set by WithDatabase is overridden by the connection string",
+					"database", cfg.database, "connStringDatabase", dsnDatabase)
+			}
+			cfg.database = dsnDatabase
+		} else {
+			poolConfig.ConnConfig.Database = cfg.database
+		}
+		cfg.connStringConfig = poolConfig
+	} else if cfg.connPool == nil && cfg.unixSocket == "" {
+		switch cfg.connector {
+		case cloudSQLConnector:
+			if cfg.projectID == "" || cfg.region == "" || cfg.instance == "" {
+				return engineConfig{}, ErrNoConnectionConfig
+			}
+		case alloyDBConnector:
+			if !hasAlloyDB {
+				return engineConfig{}, ErrNoConnectionConfig
+			}
+		default:
+			return engineConfig{}, ErrNoConnectionConfig
+		}
 	}
 	if cfg.database == "" {
 		return engineConfig{}, errors.New("missing database field")
 	}
+	if err := validateAuth(cfg); err != nil {
+		return engineConfig{}, err
+	}
+	if err := loadCredentials(cfg); err != nil {
+		return engineConfig{}, err
+	}
+	if cfg.vectorType != "" {
+		if err := cfg.vectorType.validate(); err != nil {
+			return engineConfig{}, err
+		}
+	}
+	if cfg.schemaNameSet {
+		if err := validateIdentifier("schema name", cfg.schemaName); err != nil {
+			return engineConfig{}, err
+		}
+	}
+	if cfg.tablePrefix != "" {
+		if err := validateIdentifier("table prefix", cfg.tablePrefix); err != nil {
+			return engineConfig{}, err
+		}
+	}
+	if cfg.maxContentLength < 0 {
+		return engineConfig{}, fmt.Errorf("max content length must not be negative, got %d", cfg.maxContentLength)
+	}
+	if cfg.contentOverflow != "" {
+		if err := cfg.contentOverflow.validate(); err != nil {
+			return engineConfig{}, err
+		}
+	}
+	if cfg.softDeleteColumn != "" {
+		if err := validateIdentifier("soft delete column", cfg.softDeleteColumn); err != nil {
+			return engineConfig{}, err
+		}
+	}
+	if cfg.expiryColumn != "" {
+		if err := validateIdentifier("expiry column", cfg.expiryColumn); err != nil {
+			return engineConfig{}, err
+		}
+		if cfg.expiryColumn == cfg.softDeleteColumn {
+			return engineConfig{}, errors.New("the expiry column must differ from the soft delete column")
+		}
+	}
+	if cfg.createdAtColumn != "" {
+		if err := validateIdentifier("created at column", cfg.createdAtColumn); err != nil {
+			return engineConfig{}, err
+		}
+	}
+	if cfg.updatedAtColumn != "" {
+		if err := validateIdentifier("updated at column", cfg.updatedAtColumn); err != nil {
+			return engineConfig{}, err
+		}
+		if cfg.updatedAtColumn == cfg.createdAtColumn {
+			return engineConfig{}, errors.New("the updated at column must differ from the created at column")
+		}
+	}
+	for _, col := range []string{cfg.createdAtColumn, cfg.updatedAtColumn} {
+		if col != "" && (col == cfg.softDeleteColumn || col == cfg.expiryColumn) {
+			return engineConfig{}, fmt.Errorf("the timestamp column %q must differ from the soft delete and expiry columns", col)
+		}
+	}
+	if cfg.metadataSchema != nil {
+		if err := cfg.metadataSchema.validate(); err != nil {
+			return engineConfig{}, err
+		}
+	}
+	if cfg.extensionSchema != "" {
+		if err := validateIdentifier("vector extension schema", cfg.extensionSchema); err != nil {
+			return engineConfig{}, err
+		}
+	}
+	if cfg.connPool != nil && cfg.hasPoolSizing() {
+		return engineConfig{}, errors.New("pool sizing options cannot be used with a connection pool provided by WithPool")
+	}
+	if cfg.hasSSL() {
+		if cfg.connString == "" {
+			return engineConfig{}, errors.New("ssl options can only be used with WithConnectionString; connectors encrypt their own connections and caller-provided pools are configured by their owner")
+		}
+		ssl, err := loadSSLSettings(cfg)
+		if err != nil {
+			return engineConfig{}, err
+		}
+		ssl.apply(&cfg.connStringConfig.ConnConfig.Config)
+	}
+	if cfg.statementCache != "" {
+		if cfg.connPool != nil || cfg.db != nil || cfg.conn != nil {
+			return engineConfig{}, errors.New("a statement cache mode cannot be used with a connection, a connection pool or a database/sql handle provided by the caller")
+		}
+		if _, err := cfg.statementCache.queryExecMode(); err != nil {
+			return engineConfig{}, err
+		}
+	}
+	if cfg.preparedRetrieval < 0 {
+		return engineConfig{}, fmt.Errorf("prepared retrieval shapes must not be negative, got %d", cfg.preparedRetrieval)
+	}
+	if cfg.preparedRetrieval > 0 {
+		if cfg.db != nil || cfg.sqlCommenter {
+			return engineConfig{}, errors.New("prepared retrieval cannot be used with a database/sql handle provided by WithDB or with the SQL commenter")
+		}
+		cfg.preparedShapes = newPreparedShapes(cfg.preparedRetrieval)
+	}
+	if cfg.tracer != nil && (cfg.connPool != nil || cfg.db != nil || cfg.conn != nil) {
+		return engineConfig{}, errors.New("a tracer cannot be used with a connection, a connection pool or a database/sql handle provided by the caller")
+	}
+	if cfg.afterConnect != nil && (cfg.connPool != nil || cfg.db != nil || cfg.conn != nil) {
+		return engineConfig{}, errors.New("an after connect hook cannot be used with a connection, a connection pool or a database/sql handle provided by the caller")
+	}
+	if cfg.tokenBudget < 0 {
+		return engineConfig{}, fmt.Errorf("token budget must not be negative, got %d", cfg.tokenBudget)
+	}
+	if cfg.retryAttempts < 0 || cfg.retryBaseDelay < 0 {
+		return engineConfig{}, errors.New("retry attempts and delay must not be negative")
+	}
+	if cfg.retryableCodes == nil {
+		cfg.retryableCodes = defaultRetryableCodes
+	}
+	cfg.retry = newRetryPolicy(cfg.retryAttempts, cfg.retryBaseDelay, cfg.retryableCodes)
+	if cfg.queryTimeout < 0 {
+		return engineConfig{}, errors.New("query timeout must not be negative")
+	}
+	if cfg.lockTimeout < 0 {
+		return engineConfig{}, errors.New("lock timeout must not be negative")
+	}
+	if cfg.fallbackTimeout < 0 {
+		return engineConfig{}, errors.New("fallback timeout must not be negative")
+	}
+	if cfg.acquireTimeout < 0 {
+		return engineConfig{}, errors.New("acquire timeout must not be negative")
+	}
+	if cfg.acquireTimeout == 0 {
+		cfg.acquireTimeout = defaultAcquireTimeout
+	}
+	if cfg.vectorDigits < 0 || cfg.vectorDigits > 9 {
+		return engineConfig{}, fmt.Errorf("vector precision must be between 1 and 9 digits, got %d", cfg.vectorDigits)
+	}
+	if cfg.slowThreshold < 0 {
+		return engineConfig{}, errors.New("slow query threshold must not be negative")
+	}
+	if cfg.defaultK < 0 {
+		return engineConfig{}, fmt.Errorf("default k must be positive, got %d", cfg.defaultK)
+	}
+	if cfg.indexBatchSize < 0 {
+		return engineConfig{}, fmt.Errorf("index batch size must not be negative, got %d", cfg.indexBatchSize)
+	}
+	if cfg.rescoreMultiplier < 0 {
+		return engineConfig{}, fmt.Errorf("rescore candidate multiplier must not be negative, got %d", cfg.rescoreMultiplier)
+	}
+	if cfg.rescorePrecision != "" {
+		if err := cfg.rescorePrecision.validate(); err != nil {
+			return engineConfig{}, err
+		}
+		if cfg.rescorePrecision != RescoreFull && cfg.rescoreMultiplier <= 1 {
+			return engineConfig{}, errors.New("a rescore precision requires WithExactRescore")
+		}
+	}
+	if cfg.distanceStrategy != "" {
+		if err := cfg.distanceStrategy.validate(); err != nil {
+			return engineConfig{}, err
+		}
+	}
+	if cfg.fetchSize < 0 {
+		return engineConfig{}, errors.New("fetch size must not be negative")
+	}
+	if cfg.maxConns < 0 || cfg.minConns < 0 {
+		return engineConfig{}, errors.New("pool connection limits must not be negative")
+	}
+	if cfg.maxConns > 0 && cfg.minConns > cfg.maxConns {
+		return engineConfig{}, fmt.Errorf("min conns (%d) must not be greater than max conns (%d)", cfg.minConns, cfg.maxConns)
+	}
 
 	return *cfg, nil
 }
 
+// validateAuth checks that cfg selects at most one way to authenticate:
+// password authentication with a user and password, or IAM authentication
+// with a valid account email.
+func validateAuth(cfg *engineConfig) error {
+	passwordAuth := cfg.password != "" || cfg.user != "" && cfg.tokenProvider == nil
+	iamAuth := cfg.iamAccountEmail != "" || cfg.emailRetriever != nil
+	if passwordAuth && iamAuth {
+		return errors.New("conflicting authentication: provide either a user and password or an IAM account, not both")
+	}
+	if cfg.tokenProvider != nil {
+		if passwordAuth || iamAuth {
+			return errors.New("conflicting authentication: an IAM token provider cannot be combined with a password or an IAM account")
+		}
+		if cfg.connString == "" && cfg.unixSocket == "" {
+			return errors.New("an IAM token provider requires a connection string or a Unix socket; the Cloud SQL and AlloyDB connectors authenticate with WithIAMAccountEmail")
+		}
+		if cfg.unixSocket != "" && cfg.user == "" {
+			return errors.New("an IAM token provider with a Unix socket requires a user set with WithUser")
+		}
+	}
+	if passwordAuth && (cfg.user == "" || cfg.password == "") {
+		return errors.New("password authentication requires both a user and a password")
+	}
+	if cfg.iamAccountEmail != "" {
+		if addr, err := mail.ParseAddress(cfg.iamAccountEmail); err != nil || addr.Address != cfg.iamAccountEmail {
+			return fmt.Errorf("invalid IAM account email %q: must be an address such as sa@project.iam.gserviceaccount.com", cfg.iamAccountEmail)
+		}
+	}
+	return nil
+}
+
+// hasPoolSizing reports whether any of the pool sizing options were set.
+func (cfg *engineConfig) hasPoolSizing() bool {
+	return cfg.maxConns != 0 || cfg.minConns != 0 || cfg.maxConnIdleTime != 0 || cfg.maxConnLifetime != 0
+}
+
+// applyPoolSizing copies the pool sizing options onto config, leaving the pgx
+// defaults in place for the ones that were not set.
+func applyPoolSizing(config *pgxpool.Config, cfg engineConfig) {
+	if cfg.maxConns > 0 {
+		config.MaxConns = cfg.maxConns
+	}
+	if cfg.minConns > 0 {
+		config.MinConns = cfg.minConns
+	}
+	if cfg.maxConnIdleTime > 0 {
+		config.MaxConnIdleTime = cfg.maxConnIdleTime
+	}
+	if cfg.maxConnLifetime > 0 {
+		config.MaxConnLifetime = cfg.maxConnLifetime
+	}
+}
+
+// applyApplicationName sets the application_name runtime parameter of config
+// from cfg, keeping the one of a connection string unless it was overridden.
+func applyApplicationName(config *pgxpool.Config, cfg engineConfig) {
+	params := config.ConnConfig.RuntimeParams
+	if params == nil {
+		params = make(map[string]string)
+		config.ConnConfig.RuntimeParams = params
+	}
+	if cfg.applicationName != "" {
+		params["application_name"] = cfg.applicationName
+	} else if params["application_name"] == "" {
+		params["application_name"] = defaultApplicationName
+	}
+}
+
+// applyReadOnlySessions sets the default_transaction_read_only runtime
+// parameter of config with [WithReadOnlySessions]. It must follow
+// applyApplicationName, which ensures config has runtime parameters.
+func applyReadOnlySessions(config *pgxpool.Config, cfg engineConfig) {
+	if cfg.readOnlySessions {
+		config.ConnConfig.RuntimeParams["default_transaction_read_only"] = "on"
+	}
+}
+
 // getUser retrieves the username, a flag indicating if IAM authentication will be used and an error.
 func getUser(ctx context.Context, config engineConfig) (string, bool, error) {
+	if config.tokenProvider != nil {
+		// The tokens of the provider authenticate the user as is.
+		return config.user, true, nil
+	}
 	if config.user != "" && config.password != "" {
 		// If both username and password are provided use provided username.
 		return config.user, false, nil
@@ -91,21 +547,33 @@ func getUser(ctx context.Context, config engineConfig) (string, bool, error) {
 	}
 	// If neither user and password nor iamAccountEmail are provided,
 	// retrieve IAM email from the environment.
-	serviceAccountEmail, err := getServiceAccountEmail(ctx)
+	emailRetriever := config.emailRetriever
+	if emailRetriever == nil {
+		emailRetriever = func(ctx context.Context) (string, error) {
+			return getServiceAccountEmail(ctx, config.credentials)
+		}
+	}
+	serviceAccountEmail, err := emailRetriever(ctx)
 	if err != nil {
 		return "", false, fmt.Errorf("unable to retrieve service account email: %w", err)
 	}
+	if serviceAccountEmail == "" {
+		return "", false, errors.New("unable to retrieve service account email: empty email")
+	}
 	return serviceAccountEmail, true, nil
 
 }
 
-// getServiceAccountEmail retrieves the IAM principal email with users account.
-func getServiceAccountEmail(ctx context.Context) (string, error) {
-	scopes := []string{"https://www.googleapis.com/auth/userinfo.email"}
-	// Get credentials using email scope
-	credentials, err := google.FindDefaultCredentials(ctx, scopes...)
-	if err != nil {
-		return "", fmt.Errorf("unable to get default credentials: %w", err)
+// getServiceAccountEmail retrieves the IAM principal email of credentials,
+// or of the application default credentials if nil.
+func getServiceAccountEmail(ctx context.Context, credentials *google.Credentials) (string, error) {
+	if credentials == nil {
+		// Get credentials using email scope
+		var err error
+		credentials, err = google.FindDefaultCredentials(ctx, userInfoEmailScope)
+		if err != nil {
+			return "", fmt.Errorf("unable to get default credentials: %w", err)
+		}
 	}
 
 	// Verify valid TokenSource.
@@ -126,29 +594,73 @@ func getServiceAccountEmail(ctx context.Context) (string, error) {
 	return userInfo.Email, nil
 }
 
-// createPool creates a connection pool to the PostgreSQL database.
-func createPool(ctx context.Context, cfg engineConfig, usingIAMAuth bool) (*pgxpool.Pool, error) {
-	var dialeropts []cloudsqlconn.Option
+// createPool creates a connection pool to the PostgreSQL database. It also
+// returns the connector dialer used by the pool, which must be closed after it.
+func createPool(ctx context.Context, cfg engineConfig, usingIAMAuth bool) (*pgxpool.Pool, io.Closer, error) {
 	dsn := fmt.Sprintf("user=%s password=%s dbname=%s sslmode=disable", cfg.user, cfg.password, cfg.database)
 	if usingIAMAuth {
-		dialeropts = append(dialeropts, cloudsqlconn.WithIAMAuthN())
 		dsn = fmt.Sprintf("user=%s dbname=%s sslmode=disable", cfg.user, cfg.database)
 	}
-	d, err := cloudsqlconn.NewDialer(ctx, dialeropts...)
+	config, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize connection: %w", err)
+		return nil, nil, fmt.Errorf("failed to parse connection config: %w", err)
 	}
-
-	config, err := pgxpool.ParseConfig(dsn)
+	if cfg.unixSocket != "" {
+		config.ConnConfig.Host = cfg.unixSocket
+		config.ConnConfig.Fallbacks = nil
+		if usingIAMAuth {
+			provider := cfg.tokenProvider
+			if provider == nil {
+				var err error
+				if provider, err = NewGoogleTokenProvider(ctx, cfg.credentials); err != nil {
+					return nil, nil, err
+				}
+				config.ConnConfig.User = iamDatabaseUser(cfg.user)
+			}
+			config.BeforeConnect = iamAuthBeforeConnect(provider)
+		}
+		pool, err := createPoolFromConfig(ctx, config, cfg)
+		return pool, nil, err
+	}
+	dial, dialer, err := newDialFunc(ctx, cfg, usingIAMAuth)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse connection config: %w", err)
+		return nil, nil, fmt.Errorf("failed to initialize connection: %w", err)
 	}
-	instanceURI := fmt.Sprintf("%s:%s:%s", cfg.projectID, cfg.region, cfg.instance)
-	config.ConnConfig.DialFunc = func(ctx context.Context, _ string, _ string) (net.Conn, error) {
-		if cfg.ipType == PRIVATE {
-			return d.Dial(ctx, instanceURI, cloudsqlconn.WithPrivateIP())
+	config.ConnConfig.DialFunc = dial
+	pool, err := createPoolFromConfig(ctx, config, cfg)
+	if err != nil {
+		dialer.Close()
+		return nil, nil, err
+	}
+	return pool, dialer, nil
+}
+
+// createPoolFromConfig applies the engine pool options to config and creates
+// the pool.
+func createPoolFromConfig(ctx context.Context, config *pgxpool.Config, cfg engineConfig) (*pgxpool.Pool, error) {
+	applyPoolSizing(config, cfg)
+	applyApplicationName(config, cfg)
+	applyReadOnlySessions(config, cfg)
+	afterConnect := config.AfterConnect
+	config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		if afterConnect != nil {
+			if err := afterConnect(ctx, conn); err != nil {
+				return err
+			}
+		}
+		if cfg.afterConnect != nil {
+			if err := cfg.afterConnect(ctx, conn); err != nil {
+				return fmt.Errorf("after connect hook failed: %w", err)
+			}
 		}
-		return d.Dial(ctx, instanceURI, cloudsqlconn.WithPublicIP())
+		return registerVectorTypes(ctx, conn)
+	}
+	if cfg.tracer != nil {
+		config.ConnConfig.Tracer = redactingTracer{cfg.tracer}
+	}
+	if cfg.statementCache != "" {
+		// Validated by applyEngineOptions.
+		config.ConnConfig.DefaultQueryExecMode, _ = cfg.statementCache.queryExecMode()
 	}
 	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
@@ -157,10 +669,103 @@ func createPool(ctx context.Context, cfg engineConfig, usingIAMAuth bool) (*pgxp
 	return pool, nil
 }
 
-// Close closes the pool connection.
-func (pgEngine *PostgresEngine) Close() {
-	if pgEngine.Pool != nil {
-		pgEngine.Pool.Close()
+// newDialFunc returns a pgx dial function that connects through the
+// Cloud SQL or AlloyDB connector selected in cfg, and the underlying dialer.
+func newDialFunc(ctx context.Context, cfg engineConfig, usingIAMAuth bool) (pgconn.DialFunc, io.Closer, error) {
+	switch cfg.connector {
+	case alloyDBConnector:
+		var dialeropts []alloydbconn.Option
+		if usingIAMAuth {
+			dialeropts = append(dialeropts, alloydbconn.WithIAMAuthN())
+		}
+		if cfg.credentials != nil {
+			dialeropts = append(dialeropts, alloydbconn.WithTokenSource(cfg.credentials.TokenSource))
+		}
+		d, err := alloydbconn.NewDialer(ctx, dialeropts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		ipOpt := alloydbconn.WithPublicIP()
+		switch cfg.ipType {
+		case PRIVATE:
+			ipOpt = alloydbconn.WithPrivateIP()
+		case PSC:
+			ipOpt = alloydbconn.WithPSC()
+		}
+		return func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+			return d.Dial(ctx, cfg.alloyDBInstance, ipOpt)
+		}, d, nil
+	default:
+		var dialeropts []cloudsqlconn.Option
+		if usingIAMAuth {
+			dialeropts = append(dialeropts, cloudsqlconn.WithIAMAuthN())
+		}
+		if cfg.credentials != nil {
+			ts := cfg.credentials.TokenSource
+			if usingIAMAuth {
+				dialeropts = append(dialeropts, cloudsqlconn.WithIAMAuthNTokenSources(ts, ts))
+			} else {
+				dialeropts = append(dialeropts, cloudsqlconn.WithTokenSource(ts))
+			}
+		}
+		d, err := cloudsqlconn.NewDialer(ctx, dialeropts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		instanceURI := fmt.Sprintf("%s:%s:%s", cfg.projectID, cfg.region, cfg.instance)
+		ipOpt := cloudsqlconn.WithPublicIP()
+		switch cfg.ipType {
+		case PRIVATE:
+			ipOpt = cloudsqlconn.WithPrivateIP()
+		case PSC:
+			ipOpt = cloudsqlconn.WithPSC()
+		}
+		return func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+			return d.Dial(ctx, instanceURI, ipOpt)
+		}, d, nil
+	}
+}
+
+// Close stops the pool from handing out new connections, waits for the
+// connections in use to be returned and closes the pool, then closes the
+// Cloud SQL or AlloyDB dialer opened by the engine, if any.
+//
+// If ctx is done before the connections are returned, Close returns the
+// context error; the pool and the dialer are closed once the connections
+// are returned. Calling Close again returns nil.
+func (pgEngine *PostgresEngine) Close(ctx context.Context) error {
+	if pgEngine.closer != nil {
+		pgEngine.closer.mu.Lock()
+		defer pgEngine.closer.mu.Unlock()
+		if pgEngine.closer.closed {
+			return nil
+		}
+		pgEngine.closer.closed = true
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		if pgEngine.pools != nil {
+			pgEngine.pools.close()
+		} else if pgEngine.Pool != nil {
+			pgEngine.Pool.Close()
+		}
+		if pgEngine.config.readPool != nil {
+			pgEngine.config.readPool.Close()
+		}
+		var err error
+		if pgEngine.dialer != nil {
+			if err = pgEngine.dialer.Close(); err != nil {
+				err = fmt.Errorf("failed to close dialer: %w", err)
+			}
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("failed to drain connections: %w", ctx.Err())
 	}
 }
 
@@ -170,82 +775,331 @@ type Column struct {
 	Nullable bool
 }
 
+// EmbeddingColumn describes an additional embedding column of a table.
+type EmbeddingColumn struct {
+	Name string
+	// VectorSize is the dimension of the column. The default is the
+	// VectorSize of the table.
+	VectorSize int
+}
+
 type VectorstoreTableOptions struct {
-	TableName          string
-	VectorSize         int
-	SchemaName         string
-	ContentColumnName  string
+	TableName string
+	// VectorSize is the dimension of the embedding column. It must be
+	// positive and at most the number of dimensions pgvector can index in a
+	// column of the vector type of the engine, 2000 for vector.
+	VectorSize        int
+	SchemaName        string
+	ContentColumnName string
+	// ContentColumnType is the type of the content column. The default is
+	// [TextContent].
+	ContentColumnType  ContentType
 	EmbeddingColumn    string
 	MetadataJSONColumn string
 	IDColumn           Column
-	MetadataColumns    []Column
-	OverwriteExisting  bool
-	StoreMetadata      bool
+	// MetadataColumns are typed columns, such as a tenant id, that hold the
+	// metadata keys of the same name instead of the JSON metadata column.
+	// When listed in [Config.MetadataColumns], the indexer writes them and
+	// retrieval filters on those keys compare against the columns.
+	MetadataColumns   []Column
+	OverwriteExisting bool
+	StoreMetadata     bool
+	// AdditionalEmbeddingColumns are nullable embedding columns created
+	// alongside EmbeddingColumn, for example to also store an embedding of
+	// the title of each document. Retrieval can search them with
+	// [RetrieverOptions.EmbeddingColumn].
+	AdditionalEmbeddingColumns []EmbeddingColumn
+	// ContentHashColumn, if set, adds a nullable text column of that name
+	// for [Config.ContentHashColumn].
+	ContentHashColumn string
+	// Partitioning, if set, creates a partitioned table, such as one
+	// partitioned by month for a large corpus. See [TablePartitioning].
+	Partitioning *TablePartitioning
+}
+
+// schemaName returns the schema of the tables of this engine.
+func (pgEngine *PostgresEngine) schemaName() string {
+	return cmp.Or(pgEngine.config.schemaName, defaultSchemaName)
+}
+
+// tableName returns the name of the table called name through this engine,
+// with the prefix set by [WithTablePrefix]. An empty name stays empty, so
+// that it is reported as missing.
+func (pgEngine *PostgresEngine) tableName(name string) string {
+	if name == "" {
+		return ""
+	}
+	return pgEngine.config.tablePrefix + name
+}
+
+// vectorType returns the type of the embedding columns of this engine.
+func (pgEngine *PostgresEngine) vectorType() VectorType {
+	return cmp.Or(pgEngine.config.vectorType, Vector)
+}
+
+// idColumn returns the name of the ID column of the tables of this engine.
+func (pgEngine *PostgresEngine) idColumn() string {
+	return cmp.Or(pgEngine.config.idColumn, defaultIDColumn)
+}
+
+// contentColumn returns the name of the content column of the tables of this engine.
+func (pgEngine *PostgresEngine) contentColumn() string {
+	return cmp.Or(pgEngine.config.contentColumn, defaultContentColumn)
+}
+
+// embeddingColumn returns the name of the embedding column of the tables of this engine.
+func (pgEngine *PostgresEngine) embeddingColumn() string {
+	return cmp.Or(pgEngine.config.embeddingColumn, defaultEmbeddingColumn)
+}
+
+// metadataJSONColumn returns the name of the JSON metadata column of the tables of this engine.
+func (pgEngine *PostgresEngine) metadataJSONColumn() string {
+	return cmp.Or(pgEngine.config.metadataJSONColumn, defaultMetadataJsonColumn)
+}
+
+// distanceStrategy returns the distance strategy of the tables of this engine.
+func (pgEngine *PostgresEngine) distanceStrategy() DistanceStrategy {
+	return cmp.Or(pgEngine.config.distanceStrategy, CosineDistance)
+}
+
+// defaultK returns the number of documents retrieved from the tables of this
+// engine.
+func (pgEngine *PostgresEngine) defaultK() int {
+	return cmp.Or(pgEngine.config.defaultK, defaultCount)
+}
+
+// embedConcurrency returns the number of embedding requests run in parallel
+// to index documents into the tables of this engine, 0 to run one.
+func (pgEngine *PostgresEngine) embedConcurrency() int {
+	return max(pgEngine.config.embedConcurrency, 0)
+}
+
+// indexBatchSize returns the number of documents written per round trip to
+// the tables of this engine.
+func (pgEngine *PostgresEngine) indexBatchSize() int {
+	return cmp.Or(pgEngine.config.indexBatchSize, defaultIndexBatchSize)
 }
 
 // validateVectorstoreTableOptions initializes the options struct with the default values for
 // the InitVectorstoreTable function.
-func validateVectorstoreTableOptions(opts *VectorstoreTableOptions) error {
+func (pgEngine *PostgresEngine) validateVectorstoreTableOptions(opts *VectorstoreTableOptions) error {
 	if opts.TableName == "" {
 		return fmt.Errorf("missing table name in options")
 	}
+	opts.TableName = pgEngine.tableName(opts.TableName)
 	if opts.VectorSize == 0 {
-		return fmt.Errorf("missing vector size in options")
+		return fmt.Errorf("missing vector size in options: a fixed dimension, that of the embedder, is required for indexed similarity search")
+	}
+	if opts.VectorSize < 0 {
+		return fmt.Errorf("vector size must be positive, got %d", opts.VectorSize)
+	}
+	if maxDims := pgEngine.vectorType().maxIndexableDimensions(); opts.VectorSize > maxDims {
+		return fmt.Errorf("vector size %d exceeds the %d dimensions pgvector can index in a %s column", opts.VectorSize, maxDims, pgEngine.vectorType())
 	}
 
 	if opts.SchemaName == "" {
-		opts.SchemaName = "public"
+		opts.SchemaName = pgEngine.schemaName()
+	}
+	if err := validateIdentifier("schema name", opts.SchemaName); err != nil {
+		return err
 	}
 
 	if opts.ContentColumnName == "" {
-		opts.ContentColumnName = "content"
+		opts.ContentColumnName = pgEngine.contentColumn()
+	}
+	if opts.ContentColumnType == "" {
+		opts.ContentColumnType = TextContent
+	}
+	if err := opts.ContentColumnType.validate(); err != nil {
+		return err
 	}
 
 	if opts.EmbeddingColumn == "" {
-		opts.EmbeddingColumn = "embedding"
+		opts.EmbeddingColumn = pgEngine.embeddingColumn()
 	}
 
 	if opts.MetadataJSONColumn == "" {
-		opts.MetadataJSONColumn = "langchain_metadata"
+		opts.MetadataJSONColumn = pgEngine.metadataJSONColumn()
 	}
 
 	if opts.IDColumn.Name == "" {
-		opts.IDColumn.Name = "langchain_id"
+		opts.IDColumn.Name = pgEngine.idColumn()
 	}
 
 	if opts.IDColumn.DataType == "" {
 		opts.IDColumn.DataType = "UUID"
 	}
 
+	type identifier struct{ kind, name string }
+	names := []identifier{
+		{"table name", opts.TableName},
+		{"content column", opts.ContentColumnName},
+		{"embedding column", opts.EmbeddingColumn},
+		{"metadata JSON column", opts.MetadataJSONColumn},
+		{"id column", opts.IDColumn.Name},
+	}
+	for _, col := range opts.MetadataColumns {
+		names = append(names, identifier{"metadata column", col.Name})
+	}
+	if opts.ContentHashColumn != "" {
+		names = append(names, identifier{"content hash column", opts.ContentHashColumn})
+	}
+	for _, n := range names {
+		if err := validateQuotedIdentifier(n.kind, n.name); err != nil {
+			return err
+		}
+	}
+
+	seen := map[string]bool{opts.EmbeddingColumn: true}
+	for i := range opts.AdditionalEmbeddingColumns {
+		col := &opts.AdditionalEmbeddingColumns[i]
+		if err := validateIdentifier("embedding column name", col.Name); err != nil {
+			return err
+		}
+		if seen[col.Name] {
+			return fmt.Errorf("duplicate embedding column %q", col.Name)
+		}
+		seen[col.Name] = true
+		if col.VectorSize == 0 {
+			col.VectorSize = opts.VectorSize
+		}
+		if maxDims := pgEngine.vectorType().maxIndexableDimensions(); col.VectorSize < 0 || col.VectorSize > maxDims {
+			return fmt.Errorf("vector size of embedding column %q must be between 1 and %d, got %d", col.Name, maxDims, col.VectorSize)
+		}
+	}
+
+	return validatePartitioning(opts)
+}
+
+// EnsureVectorExtension installs the pgvector extension, which defines the
+// vector types, if it is not installed yet, in the schema set by
+// [WithVectorExtensionSchema]. Installing it requires the CREATE privilege on
+// the database, which a database administrator may have to grant, or use to
+// install the extension beforehand; once installed, EnsureVectorExtension
+// succeeds for any role. [PostgresEngine.InitVectorstoreTable] calls it.
+func (pgEngine *PostgresEngine) EnsureVectorExtension(ctx context.Context) error {
+	query := vectorExtensionQuery(pgEngine.config.extensionSchema)
+	if pgEngine.config.noDDL {
+		var installed bool
+		if err := pgEngine.querier().QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'vector')").Scan(&installed); err != nil {
+			return fmt.Errorf("failed to look up the vector extension: %w", err)
+		}
+		if !installed {
+			return fmt.Errorf("the vector extension is not installed; it must be installed beforehand, such as with %q: %w", query, ErrDDLDisabled)
+		}
+		return nil
+	}
+	if err := pgEngine.execDDL(ctx, query); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "42501" {
+			return fmt.Errorf("failed to create extension: the database role lacks the privilege to install pgvector; ask an administrator to run %q: %w", query, err)
+		}
+		return fmt.Errorf("failed to create extension: %w", err)
+	}
+	return nil
+}
+
+// checkDDL returns an error wrapping [ErrDDLDisabled] if the engine was
+// created with [WithNoDDL] and an operation needs to run DDL to do action, or
+// wrapping [ErrReadOnly] with [WithReadOnly].
+func (pgEngine *PostgresEngine) checkDDL(action string, needed bool) error {
+	if needed && pgEngine.config.readOnly {
+		return fmt.Errorf("cannot %s: %w", action, ErrReadOnly)
+	}
+	if needed && pgEngine.config.noDDL {
+		return fmt.Errorf("cannot %s: %w", action, ErrDDLDisabled)
+	}
 	return nil
 }
 
-// initVectorstoreTable creates a table for saving of vectors to be used with PostgresVectorStore.
+// checkWrite returns an error wrapping [ErrReadOnly] if the engine was
+// created with [WithReadOnly], for an operation that would write to do
+// action.
+func (pgEngine *PostgresEngine) checkWrite(action string) error {
+	if pgEngine.config.readOnly {
+		return fmt.Errorf("cannot %s: %w", action, ErrReadOnly)
+	}
+	return nil
+}
+
+// vectorExtensionQuery returns the statement that installs the vector
+// extension, in schema if it is not empty.
+func vectorExtensionQuery(schema string) string {
+	if schema == "" {
+		return "CREATE EXTENSION IF NOT EXISTS vector"
+	}
+	return fmt.Sprintf(`CREATE EXTENSION IF NOT EXISTS vector SCHEMA "%s"`, schema)
+}
+
+// InitVectorstoreTable creates the vector store table described by opts, or
+// leaves an existing one unchanged if its columns match opts and returns an
+// error describing the mismatch otherwise, so it is safe to call on every
+// start. With OverwriteExisting, the table is dropped and recreated.
 func (pgEngine *PostgresEngine) InitVectorstoreTable(ctx context.Context, opts VectorstoreTableOptions) error {
-	err := validateVectorstoreTableOptions(&opts)
+	err := pgEngine.validateVectorstoreTableOptions(&opts)
 	if err != nil {
 		return fmt.Errorf("failed to validate vectorstore table options: %w", err)
 	}
+	if err := pgEngine.checkDDL("drop and recreate the table", opts.OverwriteExisting); err != nil {
+		return err
+	}
 
-	// Ensure the vector extension exists
-	_, err = pgEngine.Pool.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS vector")
-	if err != nil {
-		return fmt.Errorf("failed to create extension: %w", err)
+	if err := pgEngine.EnsureVectorExtension(ctx); err != nil {
+		return err
+	}
+	if pgEngine.vectorType() == HalfVec {
+		if err := pgEngine.requireVectorVersion(ctx, 0, 7, "halfvec columns"); err != nil {
+			return err
+		}
 	}
 
 	// Drop table if exists and overwrite flag is true
 	if opts.OverwriteExisting {
-		_, err = pgEngine.Pool.Exec(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS "%s"."%s"`, opts.SchemaName, opts.TableName))
+		err = pgEngine.execDDL(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s`, qualifiedName(opts.SchemaName, opts.TableName)))
 		if err != nil {
 			return fmt.Errorf("failed to drop table: %w", err)
 		}
+	} else {
+		// Keep an existing table that matches opts, and report one that
+		// does not, such as a table created for another embedding model,
+		// rather than letting inserts fail later.
+		cols, err := pgEngine.tableColumns(ctx, opts.SchemaName, opts.TableName)
+		if err != nil {
+			return fmt.Errorf("failed to inspect existing table: %w", err)
+		}
+		if len(cols) > 0 {
+			return checkExistingTable(opts, pgEngine.vectorType(), cols)
+		}
+		if pgEngine.config.noDDL {
+			return fmt.Errorf("%w: %q.%q; it must be created beforehand: %w", ErrTableNotFound, opts.SchemaName, opts.TableName, ErrDDLDisabled)
+		}
 	}
 
-	// Build the SQL query that creates the table
-	query := fmt.Sprintf(`CREATE TABLE "%s"."%s" (
-		"%s" %s PRIMARY KEY,
-		"%s" TEXT NOT NULL,
-		"%s" vector(%d) NOT NULL`, opts.SchemaName, opts.TableName, opts.IDColumn.Name, opts.IDColumn.DataType, opts.ContentColumnName, opts.EmbeddingColumn, opts.VectorSize)
+	// Execute the query to create the table
+	err = pgEngine.execDDL(ctx, pgEngine.createTableQuery(opts))
+	if err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	return nil
+}
+
+// createTableQuery returns the statement creating the table of opts, whose
+// defaults are applied. IF NOT EXISTS covers a table created concurrently
+// since it was inspected.
+func (pgEngine *PostgresEngine) createTableQuery(opts VectorstoreTableOptions) string {
+	primaryKey := " PRIMARY KEY"
+	if opts.Partitioning != nil {
+		primaryKey = ""
+	}
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		"%s" %s%s,
+		"%s" %s NOT NULL,
+		"%s" %s(%d) NOT NULL`, qualifiedName(opts.SchemaName, opts.TableName), opts.IDColumn.Name, opts.IDColumn.DataType, primaryKey, opts.ContentColumnName, strings.ToUpper(string(opts.ContentColumnType)), opts.EmbeddingColumn, pgEngine.vectorType(), opts.VectorSize)
+
+	for _, col := range opts.AdditionalEmbeddingColumns {
+		query += fmt.Sprintf(`, "%s" %s(%d)`, col.Name, pgEngine.vectorType(), col.VectorSize)
+	}
 
 	// Add metadata columns  to the query string if provided
 	for _, column := range opts.MetadataColumns {
@@ -260,14 +1114,31 @@ func (pgEngine *PostgresEngine) InitVectorstoreTable(ctx context.Context, opts V
 	if opts.StoreMetadata {
 		query += fmt.Sprintf(`, "%s" JSON`, opts.MetadataJSONColumn)
 	}
+	if opts.ContentHashColumn != "" {
+		query += fmt.Sprintf(`, "%s" TEXT`, opts.ContentHashColumn)
+	}
 	// Close the query string
-	query += ");"
+	if opts.Partitioning != nil {
+		return query + partitionClause(opts.IDColumn.Name, opts.Partitioning) + ";"
+	}
+	return query + ");"
+}
 
-	// Execute the query to create the table
-	_, err = pgEngine.Pool.Exec(ctx, query)
+// columnDimension returns the declared dimension of a vector column. It
+// reports false if the table or the column does not exist.
+func (pgEngine *PostgresEngine) columnDimension(ctx context.Context, schemaName, tableName, column string) (int, bool, error) {
+	const query = `SELECT a.atttypmod FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2 AND a.attname = $3 AND NOT a.attisdropped`
+	var typmod int32
+	err := pgEngine.querier().QueryRow(ctx, query, schemaName, tableName, column).Scan(&typmod)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create table: %w", err)
+		return 0, false, err
 	}
-
-	return nil
+	// pgvector stores the dimension as the type modifier; -1 means unspecified.
+	return int(typmod), true, nil
 }
@@ -0,0 +1,111 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Errors wrapped by the errors of the plugin, to be tested with [errors.Is].
+// The underlying cause, such as a [*pgconn.PgError], remains available to
+// [errors.As].
+var (
+	// ErrNoConnectionConfig is returned by [NewPostgresEngine] when no way of
+	// connecting to the database was configured.
+	ErrNoConnectionConfig = errors.New("missing connection: provide a connection pool or db instance fields")
+	// ErrTableNotFound is wrapped by the errors of operations on a table
+	// that does not exist.
+	ErrTableNotFound = errors.New("table not found")
+	// ErrDimensionMismatch is wrapped by the errors caused by an embedding
+	// whose dimension differs from that of its column.
+	ErrDimensionMismatch = errors.New("embedding dimension mismatch")
+	// ErrNonFiniteEmbedding is wrapped by the errors caused by an embedding
+	// with NaN or infinite elements. See [Config.NonFiniteEmbeddings].
+	ErrNonFiniteEmbedding = errors.New("embedding is not finite")
+	// ErrDuplicateID is wrapped by the errors of writes of a document whose
+	// id already exists, or that appears twice in the same write.
+	ErrDuplicateID = errors.New("duplicate document id")
+	// ErrPoolClosed is wrapped by the errors of operations on a connection
+	// pool that was closed while the engine still used it, when the pool
+	// was provided with [WithPool] or the engine was closed. Pools built by
+	// the engine are reopened instead.
+	ErrPoolClosed = errors.New("connection pool is closed")
+	// ErrDDLDisabled is wrapped by the errors of operations that would
+	// create, alter or drop database objects on an engine created with
+	// [WithNoDDL].
+	ErrDDLDisabled = errors.New("DDL statements are disabled")
+	// ErrReadOnly is wrapped by the errors of operations that would write
+	// to the database on an engine created with [WithReadOnly].
+	ErrReadOnly = errors.New("engine is read-only")
+	// ErrIAMTokenFetch is wrapped by the errors of connections that could
+	// not get a token for IAM database authentication, after retries.
+	ErrIAMTokenFetch = errors.New("failed to get IAM authentication token")
+	// ErrIndexNotFound is wrapped by the errors of [PostgresEngine.DropIndex]
+	// for an index that does not exist.
+	ErrIndexNotFound = errors.New("index not found")
+	// ErrInvalidQueryVector is wrapped by the errors of retrievals whose
+	// query embedding is empty or, with [CosineDistance], has only zero
+	// elements. See [Config.AllowZeroQueryVector].
+	ErrInvalidQueryVector = errors.New("invalid query vector")
+	// ErrInvalidCursorToken is wrapped by the errors of [ParseCursorToken]
+	// and of retrievals whose [RetrieverOptions.AfterToken] is malformed or
+	// of another version.
+	ErrInvalidCursorToken = errors.New("invalid cursor token")
+)
+
+// describeQueryError classifies an error returned by a query on the table
+// described by cfg, wrapping the matching sentinel error. An undefined column
+// error, which typically means the table no longer matches cfg, is also given
+// the configured column names.
+func describeQueryError(err error, cfg *Config) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch {
+	case pgErr.Code == "42703":
+		return fmt.Errorf("table %q.%q does not have a configured column (id %q, content %q, embedding %q, metadata %q, metadata columns %q): %w",
+			cfg.SchemaName, cfg.TableName, cfg.IDColumn, cfg.ContentColumn, cfg.EmbeddingColumn, cfg.MetadataJSONColumn, cfg.MetadataColumns, err)
+	case pgErr.Code == "42P01":
+		return fmt.Errorf("%w: %q.%q: %w", ErrTableNotFound, cfg.SchemaName, cfg.TableName, err)
+	case isDuplicateIDError(pgErr, cfg.IDColumn):
+		return fmt.Errorf("%w: %w", ErrDuplicateID, err)
+	case isDimensionError(pgErr):
+		return fmt.Errorf("%w: %w", ErrDimensionMismatch, err)
+	}
+	return err
+}
+
+// isDuplicateIDError reports whether pgErr is a unique violation on the id
+// column, or the error of an upsert on the id column that meets the same id
+// twice.
+func isDuplicateIDError(pgErr *pgconn.PgError, idColumn string) bool {
+	switch pgErr.Code {
+	case "23505":
+		// The detail names the key, as in: Key (id)=(42) already exists.
+		return strings.HasPrefix(pgErr.Detail, "Key ("+idColumn+")=") ||
+			strings.HasPrefix(pgErr.Detail, `Key ("`+idColumn+`")=`)
+	case "21000":
+		return strings.HasPrefix(pgErr.Message, "ON CONFLICT DO UPDATE command cannot affect row a second time")
+	}
+	return false
+}
+
+// isDimensionError reports whether pgErr is the error pgvector raises for a
+// vector of the wrong dimension, such as "expected 768 dimensions, not 3" or
+// "different vector dimensions 768 and 3".
+func isDimensionError(pgErr *pgconn.PgError) bool {
+	return pgErr.Code == "22000" && strings.Contains(pgErr.Message, "dimensions")
+}
+
+// describeTableError wraps err with [ErrTableNotFound] if it is the error of
+// a query on a table that does not exist.
+func describeTableError(err error, tableName string) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "42P01" {
+		return fmt.Errorf("%w: %q: %w", ErrTableNotFound, tableName, err)
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package postgresql
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribeQueryError(t *testing.T) {
+	cfg := &Config{SchemaName: "public", TableName: "documents", IDColumn: "id"}
+
+	testCases := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "undefined table", err: &pgconn.PgError{Code: "42P01"}, want: ErrTableNotFound},
+		{name: "duplicate id", err: &pgconn.PgError{Code: "23505", Detail: "Key (id)=(42) already exists."}, want: ErrDuplicateID},
+		{name: "duplicate quoted id", err: &pgconn.PgError{Code: "23505", Detail: `Key ("id")=(42) already exists.`}, want: ErrDuplicateID},
+		{name: "duplicate id in batch", err: &pgconn.PgError{Code: "21000", Message: "ON CONFLICT DO UPDATE command cannot affect row a second time"}, want: ErrDuplicateID},
+		{name: "unique violation on another column", err: &pgconn.PgError{Code: "23505", Detail: "Key (slug)=(a) already exists."}},
+		{name: "expected dimensions", err: &pgconn.PgError{Code: "22000", Message: "expected 768 dimensions, not 3"}, want: ErrDimensionMismatch},
+		{name: "different dimensions", err: &pgconn.PgError{Code: "22000", Message: "different vector dimensions 768 and 3"}, want: ErrDimensionMismatch},
+		{name: "other", err: errors.New("boom")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := describeQueryError(tc.err, cfg)
+			assert.ErrorIs(t, err, tc.err)
+			for _, sentinel := range []error{ErrTableNotFound, ErrDuplicateID, ErrDimensionMismatch} {
+				assert.Equal(t, sentinel == tc.want, errors.Is(err, sentinel), "errors.Is(err, %v)", sentinel)
+			}
+		})
+	}
+}
+
+func TestDescribeTableError(t *testing.T) {
+	err := describeTableError(&pgconn.PgError{Code: "42P01"}, "documents")
+	assert.ErrorIs(t, err, ErrTableNotFound)
+	assert.NotErrorIs(t, describeTableError(&pgconn.PgError{Code: "42703"}, "documents"), ErrTableNotFound)
+}
+
+func TestApplyEngineOptionsNoConnection(t *testing.T) {
+	_, err := applyEngineOptions([]Option{WithDatabase("testdb")})
+	assert.ErrorIs(t, err, ErrNoConnectionConfig)
+}
@@ -0,0 +1,51 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// notExpired returns the condition of the rows whose expiry column, set with
+// [WithExpiryColumn], is unset or in the future.
+func notExpired(column string) string {
+	return fmt.Sprintf(`("%s" IS NULL OR "%s" > now())`, column, column)
+}
+
+// PurgeExpired removes the documents of a table whose expiry column, set with
+// [WithExpiryColumn], is past, and returns the number of removed rows. It
+// uses the clock of the database, like the exclusion of expired documents
+// from retrievals, so that the documents it removes are those retrievers
+// already skip. Expired documents are removed even with [WithSoftDelete],
+// since marking them would not change what retrievers return. Space is
+// reclaimed by the next vacuum of the table.
+func (pgEngine *PostgresEngine) PurgeExpired(ctx context.Context, tableName string) (int64, error) {
+	if err := pgEngine.checkWrite("purge expired documents"); err != nil {
+		return 0, err
+	}
+	col := pgEngine.config.expiryColumn
+	if col == "" {
+		return 0, errors.New("no expiry column is set; see WithExpiryColumn")
+	}
+	tableName = pgEngine.tableName(tableName)
+	qctx, cancel := pgEngine.withQueryTimeout(ctx)
+	cols, err := pgEngine.tableColumns(qctx, pgEngine.schemaName(), tableName)
+	cancel()
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up table %q: %w", tableName, queryTimeoutError(qctx, err))
+	}
+	if len(cols) == 0 {
+		return 0, fmt.Errorf("%w: %q", ErrTableNotFound, tableName)
+	}
+	if err := checkTimestampColumn(cols, col); err != nil {
+		return 0, fmt.Errorf("expiry %w", err)
+	}
+	n, err := pgEngine.execDelete(ctx, tableName, purgeExpiredStatement(qualifiedName(pgEngine.schemaName(), tableName), col))
+	return int64(n), err
+}
+
+// purgeExpiredStatement returns the statement removing the rows of table
+// whose expiry column is past.
+func purgeExpiredStatement(table, column string) string {
+	return fmt.Sprintf(`DELETE FROM %s WHERE "%s" <= now()`, table, column)
+}
@@ -0,0 +1,38 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildRetrieveQueryExpiry(t *testing.T) {
+	ds := testDocStore()
+	ds.engine.config.softDeleteColumn = "deleted_at"
+	ds.engine.config.expiryColumn = "expires_at"
+	query, _, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{Filters: []Filter{{Key: "tenant_id", Value: "acme"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", "embedding" <=> $1 AS distance FROM "public"."documents"`+
+		` WHERE "deleted_at" IS NULL AND ("expires_at" IS NULL OR "expires_at" > now()) AND "metadata"->>$2 = $3 ORDER BY distance, "id" LIMIT 4`, query)
+}
+
+func TestExpiryColumn(t *testing.T) {
+	pool := WithPool(&pgxpool.Pool{})
+	cfg, err := applyEngineOptions([]Option{pool, WithDatabase("testdb"), WithExpiryColumn("expires_at")})
+	assert.NoError(t, err)
+	assert.Equal(t, "expires_at", cfg.expiryColumn)
+
+	for _, opts := range [][]Option{
+		{pool, WithDatabase("testdb"), WithExpiryColumn(`expires_at"; --`)},
+		{pool, WithDatabase("testdb"), WithExpiryColumn("deleted_at"), WithSoftDelete("deleted_at")},
+	} {
+		_, err := applyEngineOptions(opts)
+		assert.Error(t, err)
+	}
+
+	assert.Equal(t, `DELETE FROM "public"."docs" WHERE "expires_at" <= now()`, purgeExpiredStatement(`"public"."docs"`, "expires_at"))
+	_, err = (&PostgresEngine{}).PurgeExpired(context.Background(), "docs")
+	assert.ErrorContains(t, err, "no expiry column is set")
+}
@@ -0,0 +1,121 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/jackc/pgx/v5"
+)
+
+// ExplainSQL returns the query that the retriever defined with cfg would run
+// for req, and its arguments, without running it. The arguments are never
+// interpolated into the query, which holds placeholders such as $1 instead;
+// the first argument is the embedding of the query document, computed with
+// the embedder of cfg. Index search settings, such as
+// [RetrieverOptions.HNSWEfSearch], are applied to the transaction of the
+// query and are not part of it.
+func (pgEngine *PostgresEngine) ExplainSQL(ctx context.Context, cfg *Config, req *ai.RetrieverRequest) (string, []any, error) {
+	ds, err := newEngineDocStore(ctx, *pgEngine, cfg)
+	if err != nil {
+		return "", nil, fmt.Errorf("postgres.ExplainSQL: %w", err)
+	}
+	r, err := ds.prepareRetrieval(ctx, req, true)
+	if err != nil {
+		return "", nil, err
+	}
+	return r.query, r.args, nil
+}
+
+// RetrievePlan is the query plan of a retrieval, returned by
+// [PostgresEngine.ExplainRetrieve].
+type RetrievePlan struct {
+	// Plan is the plan of the query, as returned by EXPLAIN (FORMAT JSON).
+	Plan string
+	// UsedIndex reports whether the plan scans an index in the order of the
+	// distance to the query vector, such as an HNSW or IVFFlat index. It is
+	// false when the table is scanned sequentially and sorted, such as when
+	// no index matches the distance operator of the query, or when
+	// Postgres estimates a sequential scan to be cheaper.
+	UsedIndex bool
+	// Indexes are the names of the indexes scanned in distance order.
+	Indexes []string
+}
+
+// ExplainRetrieve returns the plan of the query that the retriever defined
+// with cfg would run for req, obtained with EXPLAIN (FORMAT JSON), such as to
+// check in tests that a vector index serves the retrieval. The query is
+// planned, not run, with the index search settings and the request settings
+// of [WithRequestSettings] applied. The query embedding is computed with the
+// embedder of cfg. Plans depend on the statistics of the table: run ANALYZE
+// after loading test data.
+func (pgEngine *PostgresEngine) ExplainRetrieve(ctx context.Context, cfg *Config, req *ai.RetrieverRequest) (*RetrievePlan, error) {
+	ds, err := newEngineDocStore(ctx, *pgEngine, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.ExplainRetrieve: %w", err)
+	}
+	r, err := ds.prepareRetrieval(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := pgEngine.requestSettings(ctx, r.settings)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.ExplainRetrieve: %w", err)
+	}
+	query := "EXPLAIN (FORMAT JSON) " + r.query
+	q := pgEngine.readQuerier(ctx)
+	var row pgx.Row
+	if len(settings) > 0 {
+		rows, err := q.QueryLocal(ctx, settings, query, r.args...)
+		if err != nil {
+			return nil, fmt.Errorf("postgres.ExplainRetrieve: %w", describeQueryError(err, ds.config))
+		}
+		row = localRow{rows}
+	} else {
+		row = q.QueryRow(ctx, query, r.args...)
+	}
+	var plan string
+	if err := row.Scan(&plan); err != nil {
+		return nil, fmt.Errorf("postgres.ExplainRetrieve: %w", describeQueryError(err, ds.config))
+	}
+	res, err := parsePlan(plan)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.ExplainRetrieve: %w", err)
+	}
+	return res, nil
+}
+
+// planNode is a node of a plan in the JSON format of EXPLAIN.
+type planNode struct {
+	IndexName string     `json:"Index Name"`
+	OrderBy   string     `json:"Order By"`
+	Plans     []planNode `json:"Plans"`
+}
+
+// parsePlan returns the retrieval plan of plan, the output of EXPLAIN
+// (FORMAT JSON). Index scans ordered by an operator, which EXPLAIN shows as
+// Order By, are those of the distance order.
+func parsePlan(plan string) (*RetrievePlan, error) {
+	var out []struct {
+		Plan planNode `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(plan), &out); err != nil {
+		return nil, fmt.Errorf("invalid plan: %w", err)
+	}
+	res := &RetrievePlan{Plan: plan}
+	var walk func(n planNode)
+	walk = func(n planNode) {
+		if n.IndexName != "" && n.OrderBy != "" {
+			res.UsedIndex = true
+			res.Indexes = append(res.Indexes, n.IndexName)
+		}
+		for _, child := range n.Plans {
+			walk(child)
+		}
+	}
+	for _, p := range out {
+		walk(p.Plan)
+	}
+	return res, nil
+}
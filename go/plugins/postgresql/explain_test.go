@@ -0,0 +1,109 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/pgvector/pgvector-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrepareRetrievalQuery(t *testing.T) {
+	ds := testDocStore()
+	ds.config.Embedder = &fakeEmbedder{}
+	ds.config.K = 4
+	r, err := ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{
+		Query:   ai.DocumentFromText("3", nil),
+		Options: &RetrieverOptions{Filters: []Filter{{Key: "lang", Value: "en"}}},
+	}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", "embedding" <=> $1 AS distance FROM "public"."documents"`+
+		` WHERE "metadata"->>$2 = $3 ORDER BY distance, "id" LIMIT 4`, r.query)
+	if assert.Len(t, r.args, 3) {
+		assert.Equal(t, []float32{3}, r.args[0].(pgvector.Vector).Slice())
+		assert.Equal(t, []any{"lang", "en"}, r.args[1:])
+	}
+
+	_, err = ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{
+		Query:   ai.DocumentFromText("3", nil),
+		Options: &RetrieverOptions{After: &Cursor{Distance: 0.5, Key: "a"}, MMR: &MMROptions{}},
+	}, true)
+	assert.Error(t, err)
+}
+
+func TestPrepareRetrievalQueryEmbedding(t *testing.T) {
+	ds := testDocStore()
+	ds.config.Embedder = &fakeEmbedder{}
+	ds.config.K = 4
+	ds.dimension = 2
+
+	// A precomputed embedding needs no query document.
+	r, err := ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{
+		Options: &RetrieverOptions{QueryEmbedding: []float32{0.5, 0.25}},
+	}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{0.5, 0.25}, r.queryVec)
+
+	// The query embedder embeds the query in place of the embedder.
+	queryEmbedder := &fakeEmbedder{}
+	ds.config.QueryEmbedder = queryEmbedder
+	_, err = ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{Query: ai.DocumentFromText("3", nil)}, true)
+	assert.ErrorIs(t, err, ErrDimensionMismatch)
+	assert.Equal(t, 1, queryEmbedder.calls)
+	assert.Equal(t, 0, ds.config.Embedder.(*fakeEmbedder).calls)
+
+	_, err = ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{}, true)
+	assert.Error(t, err)
+}
+
+func TestPrepareRetrievalRequestQueryEmbedder(t *testing.T) {
+	ds := testDocStore()
+	ds.config.Embedder = &fakeEmbedder{}
+	ds.config.K = 4
+	ds.dimension = 1
+
+	// The embedder of the request embeds the query for that call only.
+	requestEmbedder := &fakeEmbedder{}
+	r, err := ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{
+		Query:   ai.DocumentFromText("3", nil),
+		Options: &RetrieverOptions{QueryEmbedder: requestEmbedder},
+	}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{3}, r.queryVec)
+	assert.Equal(t, 1, requestEmbedder.calls)
+	assert.Equal(t, 0, ds.config.Embedder.(*fakeEmbedder).calls)
+
+	ds.dimension = 2
+	_, err = ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{
+		Query:   ai.DocumentFromText("3", nil),
+		Options: &RetrieverOptions{QueryEmbedder: requestEmbedder},
+	}, true)
+	assert.ErrorIs(t, err, ErrDimensionMismatch)
+
+	_, err = ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{
+		Options: &RetrieverOptions{QueryEmbedder: requestEmbedder, QueryEmbedding: []float32{0.5, 0.25}},
+	}, true)
+	assert.Error(t, err)
+}
+
+func TestParsePlan(t *testing.T) {
+	indexed := `[{"Plan": {"Node Type": "Limit", "Plans": [{"Node Type": "Incremental Sort", "Plans": [` +
+		`{"Node Type": "Index Scan", "Index Name": "documents_embedding_idx", "Order By": "(embedding <=> $1)"}]}]}}]`
+	plan, err := parsePlan(indexed)
+	assert.NoError(t, err)
+	assert.True(t, plan.UsedIndex)
+	assert.Equal(t, []string{"documents_embedding_idx"}, plan.Indexes)
+	assert.Equal(t, indexed, plan.Plan)
+
+	// A filter served by a B-tree index does not serve the distance order.
+	sorted := `[{"Plan": {"Node Type": "Limit", "Plans": [{"Node Type": "Sort", "Plans": [` +
+		`{"Node Type": "Index Scan", "Index Name": "documents_source_idx", "Index Cond": "(source = $2)"}]}]}}]`
+	plan, err = parsePlan(sorted)
+	assert.NoError(t, err)
+	assert.False(t, plan.UsedIndex)
+	assert.Empty(t, plan.Indexes)
+
+	_, err = parsePlan("Seq Scan on documents")
+	assert.Error(t, err)
+}
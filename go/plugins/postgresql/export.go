@@ -0,0 +1,228 @@
+package postgresql
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// exportFormat identifies the format written by [PostgresEngine.Export].
+const exportFormat = "genkit-postgresql-export/1"
+
+// exportHeader is the first line of an export, describing its columns.
+type exportHeader struct {
+	Format  string   `json:"format"`
+	Columns []string `json:"columns"`
+	// Dimensions holds the declared dimension of each vector column, or -1
+	// for those without one.
+	Dimensions map[string]int `json:"dimensions,omitempty"`
+}
+
+// Export writes the rows of a table of the engine to w, including their
+// embeddings, so that they can be loaded into another table or database
+// with [PostgresEngine.Import] without embedding them again. It returns the
+// number of rows written. Rows deleted with [WithSoftDelete] are included,
+// and generated columns are not.
+//
+// The first line of the export is a JSON object with the format
+// "genkit-postgresql-export/1", the names of the exported columns under
+// "columns", in table order, and the declared dimension of each vector
+// column under "dimensions", or -1 for undeclared dimensions. The rows
+// follow, as written by COPY ... TO STDOUT WITH (FORMAT csv): one line per
+// row, in the order of the columns, with embeddings in the text format of
+// pgvector, such as "[0.1,0.2]", and NULL as an unquoted empty field.
+// Records may span lines when values contain newlines.
+//
+// The query timeout set by [WithQueryTimeout] does not apply. Export
+// requires a pgx pool and cannot be used with [WithDB].
+func (pgEngine *PostgresEngine) Export(ctx context.Context, tableName string, w io.Writer) (int64, error) {
+	if pgEngine.pool() == nil {
+		return 0, errors.New("postgres.Export: a pgx pool is required")
+	}
+	schemaName, tableName := pgEngine.schemaName(), pgEngine.tableName(tableName)
+	header, err := pgEngine.describeExport(ctx, schemaName, tableName)
+	if err != nil {
+		return 0, fmt.Errorf("postgres.Export: %w", err)
+	}
+	line, err := json.Marshal(header)
+	if err != nil {
+		return 0, fmt.Errorf("postgres.Export: %w", err)
+	}
+	if _, err := w.Write(append(line, '\n')); err != nil {
+		return 0, fmt.Errorf("postgres.Export: %w", err)
+	}
+	query := fmt.Sprintf("COPY (SELECT %s FROM %s) TO STDOUT WITH (FORMAT csv)",
+		quoteColumns(header.Columns), qualifiedName(schemaName, tableName))
+	var n int64
+	err = pgEngine.withPool(ctx, func(pool *pgxpool.Pool) error {
+		conn, err := pgEngine.acquire(ctx, pool)
+		if err != nil {
+			return err
+		}
+		defer conn.Release()
+		tag, err := conn.Conn().PgConn().CopyTo(ctx, w, query)
+		n = tag.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return n, fmt.Errorf("postgres.Export: %w", describeTableError(err, tableName))
+	}
+	return n, nil
+}
+
+// Import loads rows written by [PostgresEngine.Export] into a table of the
+// engine, which may be in another database, and returns the number of rows
+// written. Every exported column must exist in the table, and exported
+// vector columns must be vector columns of the same declared dimension,
+// which is checked before any row is read; columns of the table missing from
+// the export get their default value.
+//
+// Like [PostgresEngine.CopyDocuments], Import appends the rows with COPY: a
+// row whose id already exists fails the whole import, and nothing is
+// written. The query timeout set by [WithQueryTimeout] does not apply.
+// Import requires a pgx pool and cannot be used with [WithDB].
+func (pgEngine *PostgresEngine) Import(ctx context.Context, tableName string, r io.Reader) (int64, error) {
+	if err := pgEngine.checkWrite("import documents"); err != nil {
+		return 0, fmt.Errorf("postgres.Import: %w", err)
+	}
+	if pgEngine.pool() == nil {
+		return 0, errors.New("postgres.Import: a pgx pool is required")
+	}
+	br := bufio.NewReader(r)
+	header, err := readExportHeader(br)
+	if err != nil {
+		return 0, fmt.Errorf("postgres.Import: %w", err)
+	}
+	schemaName, tableName := pgEngine.schemaName(), pgEngine.tableName(tableName)
+	target, err := pgEngine.describeExport(ctx, schemaName, tableName)
+	if err != nil {
+		return 0, fmt.Errorf("postgres.Import: %w", err)
+	}
+	if err := header.checkImport(target, tableName); err != nil {
+		return 0, fmt.Errorf("postgres.Import: %w", err)
+	}
+	query := fmt.Sprintf("COPY %s (%s) FROM STDIN WITH (FORMAT csv)",
+		qualifiedName(schemaName, tableName), quoteColumns(header.Columns))
+	var n int64
+	err = pgEngine.withPool(ctx, func(pool *pgxpool.Pool) error {
+		conn, err := pgEngine.acquire(ctx, pool)
+		if err != nil {
+			return err
+		}
+		defer conn.Release()
+		tag, err := conn.Conn().PgConn().CopyFrom(ctx, br, query)
+		n = tag.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("postgres.Import: %w", describeTableError(err, tableName))
+	}
+	pgEngine.autoAnalyze(ctx, schemaName, tableName)
+	return n, nil
+}
+
+// describeExport returns the header of an export of a table: its columns
+// other than generated ones, and the dimensions of its vector columns.
+func (pgEngine *PostgresEngine) describeExport(ctx context.Context, schemaName, tableName string) (*exportHeader, error) {
+	const query = `SELECT column_name, udt_name FROM information_schema.columns
+		WHERE table_schema = $1 AND table_name = $2 AND is_generated = 'NEVER' ORDER BY ordinal_position`
+	qctx, cancel := pgEngine.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := pgEngine.querier().Query(qctx, query, schemaName, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe table %q: %w", tableName, queryTimeoutError(qctx, err))
+	}
+	header := &exportHeader{Format: exportFormat, Dimensions: make(map[string]int)}
+	var vectors []string
+	for rows.Next() {
+		var col, udt string
+		if err := rows.Scan(&col, &udt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to describe table %q: %w", tableName, queryTimeoutError(qctx, err))
+		}
+		header.Columns = append(header.Columns, col)
+		if udt == string(Vector) || udt == string(HalfVec) {
+			vectors = append(vectors, col)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to describe table %q: %w", tableName, queryTimeoutError(qctx, err))
+	}
+	if len(header.Columns) == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrTableNotFound, tableName)
+	}
+	for _, col := range vectors {
+		dim, _, err := pgEngine.columnDimension(qctx, schemaName, tableName, col)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the dimension of column %q: %w", col, queryTimeoutError(qctx, err))
+		}
+		if dim <= 0 {
+			dim = -1
+		}
+		header.Dimensions[col] = dim
+	}
+	return header, nil
+}
+
+// readExportHeader reads the header line of an export from r.
+func readExportHeader(r *bufio.Reader) (*exportHeader, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && len(line) > 0) {
+		return nil, fmt.Errorf("failed to read the export header: %w", err)
+	}
+	var header exportHeader
+	if err := json.Unmarshal(line, &header); err != nil {
+		return nil, fmt.Errorf("invalid export header: %w", err)
+	}
+	if header.Format != exportFormat {
+		return nil, fmt.Errorf("unsupported export format %q, expected %q", header.Format, exportFormat)
+	}
+	if len(header.Columns) == 0 {
+		return nil, errors.New("invalid export header: no columns")
+	}
+	return &header, nil
+}
+
+// checkImport checks that the columns of an export described by h can be
+// loaded into the table described by target.
+func (h *exportHeader) checkImport(target *exportHeader, tableName string) error {
+	columns := make(map[string]bool, len(target.Columns))
+	for _, col := range target.Columns {
+		columns[col] = true
+	}
+	for _, col := range h.Columns {
+		if !columns[col] {
+			return fmt.Errorf("column %q of the export does not exist in table %q", col, tableName)
+		}
+		dim, ok := h.Dimensions[col]
+		if !ok {
+			continue
+		}
+		targetDim, ok := target.Dimensions[col]
+		if !ok {
+			return fmt.Errorf("column %q of the export is a vector column, but that of table %q is not", col, tableName)
+		}
+		if dim > 0 && targetDim > 0 && dim != targetDim {
+			return fmt.Errorf("%w: column %q of the export has %d dimensions, but that of table %q has %d",
+				ErrDimensionMismatch, col, dim, tableName, targetDim)
+		}
+	}
+	return nil
+}
+
+// quoteColumns returns the comma-separated quoted names of columns.
+func quoteColumns(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = pgx.Identifier{col}.Sanitize()
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,70 @@
+package postgresql
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadExportHeader(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader(`{"format":"genkit-postgresql-export/1","columns":["id","content","embedding"],"dimensions":{"embedding":3}}` + "\n" +
+		`1,hello,"[1,2,3]"` + "\n"))
+	header, err := readExportHeader(r)
+	require.NoError(t, err)
+	assert.Equal(t, &exportHeader{
+		Format:     exportFormat,
+		Columns:    []string{"id", "content", "embedding"},
+		Dimensions: map[string]int{"embedding": 3},
+	}, header)
+	rest, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, `1,hello,"[1,2,3]"`+"\n", string(rest))
+
+	for _, bad := range []string{
+		"",
+		"id,content\n",
+		`{"format":"other/1","columns":["id"]}` + "\n",
+		`{"format":"genkit-postgresql-export/1","columns":[]}` + "\n",
+	} {
+		_, err := readExportHeader(bufio.NewReader(strings.NewReader(bad)))
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestExportHeaderCheckImport(t *testing.T) {
+	target := &exportHeader{
+		Columns:    []string{"id", "content", "metadata", "embedding", "created_at"},
+		Dimensions: map[string]int{"embedding": 3},
+	}
+	h := &exportHeader{Columns: []string{"id", "content", "embedding"}, Dimensions: map[string]int{"embedding": 3}}
+	assert.NoError(t, h.checkImport(target, "documents"))
+
+	h.Dimensions["embedding"] = -1
+	assert.NoError(t, h.checkImport(target, "documents"))
+
+	h.Dimensions["embedding"] = 4
+	assert.ErrorIs(t, h.checkImport(target, "documents"), ErrDimensionMismatch)
+
+	h = &exportHeader{Columns: []string{"id", "title"}}
+	assert.ErrorContains(t, h.checkImport(target, "documents"), `column "title"`)
+
+	h = &exportHeader{Columns: []string{"id", "content"}, Dimensions: map[string]int{"content": 3}}
+	assert.ErrorContains(t, h.checkImport(target, "documents"), "is not")
+}
+
+func TestQuoteColumns(t *testing.T) {
+	assert.Equal(t, `"id", "Content", "a""b"`, quoteColumns([]string{"id", "Content", `a"b`}))
+}
+
+func TestExportRequiresPool(t *testing.T) {
+	engine := &PostgresEngine{}
+	_, err := engine.Export(context.Background(), "documents", io.Discard)
+	assert.ErrorContains(t, err, "pgx pool is required")
+	_, err = engine.Import(context.Background(), "documents", strings.NewReader(""))
+	assert.ErrorContains(t, err, "pgx pool is required")
+}
@@ -0,0 +1,117 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/firebase/genkit/go/ai"
+	"golang.org/x/sync/errgroup"
+)
+
+// ExternalContentOptions configures the storage of the content of the
+// documents of a table outside of it, such as in object storage or in large
+// objects, so that large documents do not bloat the table. The content
+// column, which must be a text column, then holds a reference to the
+// content, such as a URI, which retrieved documents carry in their metadata
+// under [ContentRefMetadataKey].
+//
+// Full-text search, with [Config.TextSearch] or [RetrieverOptions.Hybrid],
+// and lookups by content see the references rather than the content, so
+// that they need a tsvector or text column of their own.
+type ExternalContentOptions struct {
+	// Store saves the content of a document being indexed and returns the
+	// reference written to the content column. Documents are embedded from
+	// their content before it is stored. It is called concurrently for up to
+	// [Config.EmbedConcurrency] documents. Required to index documents.
+	Store func(ctx context.Context, doc *ai.Document) (string, error)
+	// Load returns the content of the documents whose references are refs,
+	// in the same order. It is called once per retrieval, for the documents
+	// retrieved, and once per document when streaming. Required unless
+	// Deferred is set.
+	Load func(ctx context.Context, refs []string) ([][]*ai.Part, error)
+	// Deferred returns retrieved documents without loading their content:
+	// their content is then a text part holding the reference, for the
+	// caller to load the content of the documents it uses. Rerankers set
+	// with [WithReranker] are then given these documents.
+	Deferred bool
+}
+
+// validateExternalContent checks the external content configuration of the
+// table, once its content type is known.
+func (ds *docStore) validateExternalContent() error {
+	ec := ds.config.ExternalContent
+	if ec == nil {
+		return nil
+	}
+	if ec.Load == nil && !ec.Deferred {
+		return errors.New("external content requires a loader unless deferred")
+	}
+	if ds.contentType != TextContent {
+		return fmt.Errorf("external content requires a text content column, but column %q is %s", ds.config.ContentColumn, ds.contentType)
+	}
+	return nil
+}
+
+// storeContent stores the content of docs with [ExternalContentOptions.Store]
+// and sets the content of rows, the rows of docs, to the references. offset
+// is the position of the first document in the indexer request, used for
+// error reporting.
+func (ds *docStore) storeContent(ctx context.Context, docs []*ai.Document, rows []indexRow, offset int) error {
+	ec := ds.config.ExternalContent
+	if ec == nil {
+		return nil
+	}
+	if ec.Store == nil {
+		return errors.New("indexing documents with external content requires a store function")
+	}
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(ds.config.EmbedConcurrency, 1))
+	for i, doc := range docs {
+		g.Go(func() error {
+			ref, err := ec.Store(ctx, doc)
+			if err != nil {
+				return fmt.Errorf("document %d (id %q): storing content failed: %w", offset+i, rows[i].id, err)
+			}
+			rows[i].content = ref
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// resolveContent loads the content of docs, retrieved from a table with
+// external content, unless it is deferred.
+func (ds *docStore) resolveContent(ctx context.Context, docs []*ai.Document) error {
+	if ec := ds.config.ExternalContent; ec == nil || ec.Deferred {
+		return nil
+	}
+	return ds.loadContent(ctx, docs)
+}
+
+// loadContent replaces the content of docs by that loaded from their
+// references with [ExternalContentOptions.Load].
+func (ds *docStore) loadContent(ctx context.Context, docs []*ai.Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	refs := make([]string, len(docs))
+	for i, doc := range docs {
+		ref, ok := doc.Metadata[ContentRefMetadataKey].(string)
+		if !ok {
+			return fmt.Errorf("document %d has no content reference", i)
+		}
+		refs[i] = ref
+	}
+	contents, err := ds.config.ExternalContent.Load(ctx, refs)
+	if err != nil {
+		return fmt.Errorf("loading content failed: %w", err)
+	}
+	if len(contents) != len(docs) {
+		return fmt.Errorf("loading content returned %d contents for %d documents", len(contents), len(docs))
+	}
+	for i, doc := range docs {
+		doc.Content = contents[i]
+	}
+	return nil
+}
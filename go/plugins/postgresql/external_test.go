@@ -0,0 +1,95 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testExternalContent() *ExternalContentOptions {
+	return &ExternalContentOptions{
+		Store: func(ctx context.Context, doc *ai.Document) (string, error) {
+			text := doc.Content[0].Text
+			if text == "fail" {
+				return "", errors.New("store failed")
+			}
+			return "mem://" + text, nil
+		},
+		Load: func(ctx context.Context, refs []string) ([][]*ai.Part, error) {
+			contents := make([][]*ai.Part, len(refs))
+			for i, ref := range refs {
+				contents[i] = []*ai.Part{ai.NewTextPart("content of " + ref)}
+			}
+			return contents, nil
+		},
+	}
+}
+
+func TestValidateExternalContent(t *testing.T) {
+	ds := testDocStore()
+	ds.contentType = TextContent
+	assert.NoError(t, ds.validateExternalContent())
+
+	ds.config.ExternalContent = testExternalContent()
+	assert.NoError(t, ds.validateExternalContent())
+
+	ds.config.ExternalContent.Load = nil
+	assert.Error(t, ds.validateExternalContent())
+	ds.config.ExternalContent.Deferred = true
+	assert.NoError(t, ds.validateExternalContent())
+
+	ds.contentType = JSONBContent
+	assert.ErrorContains(t, ds.validateExternalContent(), "text content column")
+}
+
+func TestStoreContent(t *testing.T) {
+	ds := testDocStore()
+	ds.contentType = TextContent
+	ds.config.ExternalContent = testExternalContent()
+	docs := testDocuments("a", "b")
+	docs[1].Content = append(docs[1].Content, ai.NewMediaPart("image/png", "data:image/png;base64,AA=="))
+	require.NoError(t, ds.checkContentParts(docs[1]))
+
+	rows := make([]indexRow, len(docs))
+	for i, doc := range docs {
+		var err error
+		rows[i], err = ds.newIndexRow(doc, []float32{1})
+		require.NoError(t, err)
+		assert.Nil(t, rows[i].content)
+	}
+	require.NoError(t, ds.storeContent(context.Background(), docs, rows, 0))
+	assert.Equal(t, "mem://a", rows[0].content)
+	assert.Equal(t, "mem://b", rows[1].content)
+
+	err := ds.storeContent(context.Background(), testDocuments("fail"), rows[:1], 3)
+	assert.ErrorContains(t, err, "document 3")
+
+	ds.config.ExternalContent.Store = nil
+	assert.Error(t, ds.storeContent(context.Background(), docs, rows, 0))
+}
+
+func TestResolveContent(t *testing.T) {
+	ds := testDocStore()
+	ds.contentType = TextContent
+	ds.config.ExternalContent = testExternalContent()
+	doc, err := ds.rowToDocument([]any{"1", "mem://a", nil, "wiki", 0.25})
+	require.NoError(t, err)
+	assert.Equal(t, "mem://a", doc.Metadata[ContentRefMetadataKey])
+
+	ds.config.ExternalContent.Deferred = true
+	require.NoError(t, ds.resolveContent(context.Background(), []*ai.Document{doc}))
+	assert.Equal(t, "mem://a", documentText(doc))
+
+	ds.config.ExternalContent.Deferred = false
+	require.NoError(t, ds.resolveContent(context.Background(), []*ai.Document{doc}))
+	assert.Equal(t, "content of mem://a", documentText(doc))
+
+	ds.config.ExternalContent.Load = func(ctx context.Context, refs []string) ([][]*ai.Part, error) {
+		return nil, nil
+	}
+	assert.ErrorContains(t, ds.resolveContent(context.Background(), []*ai.Document{doc}), "0 contents for 1 documents")
+}
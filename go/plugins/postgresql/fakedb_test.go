@@ -0,0 +1,123 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDB is a database/sql connector whose connections answer queries with
+// the rows of the first of results whose key the query contains, and
+// statements with affected rows, recording the statements they run.
+type fakeDB struct {
+	results  map[string]fakeResult
+	affected int64
+
+	mu    sync.Mutex
+	stmts []string
+	args  [][]any
+}
+
+// fakeResult holds the columns and rows answered to a query, or its error,
+// and the error reading the rows fails with after them, if any.
+type fakeResult struct {
+	columns []string
+	rows    [][]driver.Value
+	err     error
+	readErr error
+}
+
+// open returns a database/sql handle on db, closed at the end of the test.
+func (db *fakeDB) open(t *testing.T) *sql.DB {
+	h := sql.OpenDB(db)
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{db}, nil }
+func (db *fakeDB) Driver() driver.Driver                        { return nil }
+
+// record records a statement and its arguments.
+func (db *fakeDB) record(query string, args []driver.NamedValue) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	values := make([]any, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	db.stmts = append(db.stmts, query)
+	db.args = append(db.args, values)
+}
+
+// statement returns the last recorded statement starting with prefix and its
+// arguments.
+func (db *fakeDB) statement(prefix string) (string, []any) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for i := len(db.stmts) - 1; i >= 0; i-- {
+		if strings.HasPrefix(db.stmts[i], prefix) {
+			return db.stmts[i], db.args[i]
+		}
+	}
+	return "", nil
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not implemented") }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not implemented") }
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.record(query, args)
+	for key, r := range c.db.results {
+		if strings.Contains(query, key) {
+			if r.err != nil {
+				return nil, r.err
+			}
+			return &fakeRows{columns: r.columns, rows: r.rows, err: r.readErr}, nil
+		}
+	}
+	return &fakeRows{}, nil
+}
+
+func (c fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.record(query, args)
+	return driver.RowsAffected(c.db.affected), nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	err     error
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		if r.err != nil {
+			return r.err
+		}
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// catalogResult answers the column lookups of tableColumns with the columns
+// of a table, given as pairs of names and type names such as "text".
+func catalogResult(columns ...string) fakeResult {
+	r := fakeResult{columns: []string{"attname", "typname", "atttypmod"}}
+	for i := 0; i+1 < len(columns); i += 2 {
+		r.rows = append(r.rows, []driver.Value{columns[i], columns[i+1], int64(-1)})
+	}
+	return r
+}
@@ -0,0 +1,227 @@
+package postgresql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FilterOp is a comparison operator used in a [Filter].
+type FilterOp string
+
+const (
+	Eq FilterOp = "="
+	Ne FilterOp = "!="
+	Gt FilterOp = ">"
+	Ge FilterOp = ">="
+	Lt FilterOp = "<"
+	Le FilterOp = "<="
+	// In and NotIn compare against each element of a slice Value.
+	In    FilterOp = "IN"
+	NotIn FilterOp = "NOT IN"
+	// Between matches values within the inclusive range given by a Value
+	// slice of two elements, the lower bound first.
+	Between FilterOp = "BETWEEN"
+	// Contains matches JSON values that contain the JSON fragment given
+	// as Value, with the jsonb @> operator: the metadata column itself if
+	// Key is empty, or else the value of Key. Value is either JSON text, as
+	// a string or []byte, or a value encoded to JSON, such as
+	// map[string]any{"tags": []string{"urgent"}}.
+	Contains FilterOp = "@>"
+	// JSONPath matches JSON values for which a SQL/JSON path, such as
+	// `$.acl.groups[*] ? (@ == "admins")`, returns any item, to reach into
+	// nested objects and arrays: the metadata column itself if Key is empty,
+	// or else the value of Key. Value is the path as a string, or a
+	// [JSONPathQuery] for a path with variables, such as
+	// `$.acl.groups[*] ? (@ == $group)`, whose values are bound as
+	// parameters. The syntax of the path is checked before the query runs.
+	JSONPath FilterOp = "@?"
+)
+
+// Filter restricts retrieval to documents whose metadata satisfies a
+// condition. Multiple filters are combined with AND.
+//
+// Values are always sent as query parameters. A key naming one of the
+// metadata columns of the table, such as those declared in
+// [VectorstoreTableOptions.MetadataColumns], is compared against that column,
+// which can be indexed. Other keys are looked up in the JSON metadata column,
+// and their value is cast according to the Go type of Value: strings compare
+// as text, booleans as boolean, numbers as numeric and [time.Time] as
+// timestamptz. The elements of the slice Value of [In], [NotIn] and [Between]
+// filters are sent as separate parameters, and must all have the same kind of
+// type.
+type Filter struct {
+	Key   string   // Metadata key to compare. Optional for [Contains] and [JSONPath].
+	Op    FilterOp // Comparison operator. The default is [Eq].
+	Value any      // Value to compare against.
+}
+
+// queryArgs accumulates the positional arguments of a query.
+type queryArgs struct {
+	args []any
+}
+
+// add appends v to the arguments and returns its placeholder.
+func (a *queryArgs) add(v any) string {
+	a.args = append(a.args, v)
+	return fmt.Sprintf("$%d", len(a.args))
+}
+
+// compileFilters compiles filters into a SQL boolean expression against the
+// columns named by their keys, or else the JSON metadata column, adding their
+// values to args. It returns the empty string if there are no filters.
+func compileFilters(filters []Filter, metadataColumn string, columns []string, args *queryArgs) (string, error) {
+	if len(filters) == 0 {
+		return "", nil
+	}
+	var preds []string
+	for _, f := range filters {
+		p, err := compileFilter(f, metadataColumn, columns, args)
+		if err != nil {
+			return "", err
+		}
+		preds = append(preds, p)
+	}
+	return strings.Join(preds, " AND "), nil
+}
+
+func compileFilter(f Filter, metadataColumn string, columns []string, args *queryArgs) (string, error) {
+	switch f.Op {
+	case Contains:
+		return compileContains(f, metadataColumn, columns, args)
+	case JSONPath:
+		return compileJSONPath(f, metadataColumn, columns, args)
+	}
+	if f.Key == "" {
+		return "", errors.New("filter key must not be empty")
+	}
+	op := f.Op
+	if op == "" {
+		op = Eq
+	}
+	values, err := filterValues(op, f.Value)
+	if err != nil {
+		return "", fmt.Errorf("filter on key %q: %w", f.Key, err)
+	}
+	var cast string
+	for i, v := range values {
+		c, err := filterCast(v)
+		if err != nil {
+			return "", fmt.Errorf("filter on key %q: %w", f.Key, err)
+		}
+		if i > 0 && c != cast {
+			return "", fmt.Errorf("filter on key %q: values %v and %v have different types", f.Key, values[0], v)
+		}
+		cast = c
+	}
+
+	var lhs string
+	if slices.Contains(columns, f.Key) {
+		lhs = fmt.Sprintf(`"%s"`, f.Key)
+	} else {
+		if metadataColumn == "" {
+			return "", fmt.Errorf("filter on key %q requires a metadata JSON column", f.Key)
+		}
+		lhs = fmt.Sprintf(`"%s"->>%s`, metadataColumn, args.add(f.Key))
+		if cast != "" {
+			lhs = fmt.Sprintf("(%s)::%s", lhs, cast)
+		}
+	}
+	params := make([]string, len(values))
+	for i, v := range values {
+		params[i] = args.add(v)
+	}
+	switch op {
+	case In, NotIn:
+		return fmt.Sprintf("%s %s (%s)", lhs, op, strings.Join(params, ", ")), nil
+	case Between:
+		return fmt.Sprintf("%s BETWEEN %s AND %s", lhs, params[0], params[1]), nil
+	default:
+		return fmt.Sprintf("%s %s %s", lhs, op, params[0]), nil
+	}
+}
+
+// compileContains compiles a [Contains] filter, binding the fragment as a
+// single jsonb parameter.
+func compileContains(f Filter, metadataColumn string, columns []string, args *queryArgs) (string, error) {
+	var fragment []byte
+	switch v := f.Value.(type) {
+	case string:
+		fragment = []byte(v)
+	case []byte:
+		fragment = v
+	case nil:
+		return "", fmt.Errorf("containment filter on key %q: nil value is not supported", f.Key)
+	default:
+		var err error
+		if fragment, err = json.Marshal(v); err != nil {
+			return "", fmt.Errorf("containment filter on key %q: %w", f.Key, err)
+		}
+	}
+	if !json.Valid(fragment) {
+		return "", fmt.Errorf("containment filter on key %q: value is not valid JSON", f.Key)
+	}
+	var lhs string
+	switch {
+	case f.Key != "" && slices.Contains(columns, f.Key):
+		lhs = fmt.Sprintf(`"%s"::jsonb`, f.Key)
+	case metadataColumn == "":
+		return "", fmt.Errorf("containment filter on key %q requires a metadata JSON column", f.Key)
+	case f.Key == "":
+		lhs = fmt.Sprintf(`"%s"::jsonb`, metadataColumn)
+	default:
+		lhs = fmt.Sprintf(`("%s"::jsonb)->%s`, metadataColumn, args.add(f.Key))
+	}
+	return fmt.Sprintf("%s @> %s::jsonb", lhs, args.add(string(fragment))), nil
+}
+
+// filterValues returns the values compared by a filter with operator op: v
+// itself for the comparison operators, and the elements of the slice v for
+// the others.
+func filterValues(op FilterOp, v any) ([]any, error) {
+	switch op {
+	case Eq, Ne, Gt, Ge, Lt, Le:
+		return []any{v}, nil
+	case In, NotIn, Between:
+	default:
+		return nil, fmt.Errorf("unsupported filter operator %q", op)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("operator %s requires a slice value, got %T", op, v)
+	}
+	values := make([]any, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
+	}
+	switch {
+	case op == Between && len(values) != 2:
+		return nil, fmt.Errorf("operator BETWEEN requires two values, got %d", len(values))
+	case len(values) == 0:
+		return nil, fmt.Errorf("operator %s requires at least one value", op)
+	}
+	return values, nil
+}
+
+// filterCast returns the type the metadata text value must be cast to so
+// that it compares correctly with v.
+func filterCast(v any) (string, error) {
+	switch v.(type) {
+	case string:
+		return "", nil
+	case bool:
+		return "boolean", nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return "numeric", nil
+	case time.Time:
+		return "timestamptz", nil
+	case nil:
+		return "", errors.New("nil value is not supported")
+	default:
+		return "", fmt.Errorf("unsupported value type %T", v)
+	}
+}
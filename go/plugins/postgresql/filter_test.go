@@ -0,0 +1,165 @@
+package postgresql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileFilters(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filters  []Filter
+		want     string
+		wantArgs []any
+		wantErr  bool
+	}{
+		{
+			name: "no filters",
+		},
+		{
+			name:     "string equality",
+			filters:  []Filter{{Key: "tenant_id", Value: "acme"}},
+			want:     `"metadata"->>$1 = $2`,
+			wantArgs: []any{"tenant_id", "acme"},
+		},
+		{
+			name:     "numeric and boolean",
+			filters:  []Filter{{Key: "year", Op: Lt, Value: 2020.5}, {Key: "draft", Op: Ne, Value: true}},
+			want:     `("metadata"->>$1)::numeric < $2 AND ("metadata"->>$3)::boolean != $4`,
+			wantArgs: []any{"year", 2020.5, "draft", true},
+		},
+		{
+			name:     "timestamp",
+			filters:  []Filter{{Key: "created", Op: Gt, Value: time.Unix(0, 0)}},
+			want:     `("metadata"->>$1)::timestamptz > $2`,
+			wantArgs: []any{"created", time.Unix(0, 0)},
+		},
+		{
+			name:     "in",
+			filters:  []Filter{{Key: "status", Op: In, Value: []string{"active", "trial"}}},
+			want:     `"metadata"->>$1 IN ($2, $3)`,
+			wantArgs: []any{"status", "active", "trial"},
+		},
+		{
+			name:     "not in with mixed numbers",
+			filters:  []Filter{{Key: "year", Op: NotIn, Value: []any{2020, 2021.5}}},
+			want:     `("metadata"->>$1)::numeric NOT IN ($2, $3)`,
+			wantArgs: []any{"year", 2020, 2021.5},
+		},
+		{
+			name:     "between",
+			filters:  []Filter{{Key: "price", Op: Between, Value: []int{10, 50}}},
+			want:     `("metadata"->>$1)::numeric BETWEEN $2 AND $3`,
+			wantArgs: []any{"price", 10, 50},
+		},
+		{
+			name:    "in without values",
+			filters: []Filter{{Key: "status", Op: In, Value: []string{}}},
+			wantErr: true,
+		},
+		{
+			name:    "in with scalar value",
+			filters: []Filter{{Key: "status", Op: In, Value: "active"}},
+			wantErr: true,
+		},
+		{
+			name:    "in with mixed types",
+			filters: []Filter{{Key: "status", Op: In, Value: []any{"active", 1}}},
+			wantErr: true,
+		},
+		{
+			name:    "between with three values",
+			filters: []Filter{{Key: "price", Op: Between, Value: []int{1, 2, 3}}},
+			wantErr: true,
+		},
+		{
+			name:    "in with nil element",
+			filters: []Filter{{Key: "status", Op: In, Value: []any{"active", nil}}},
+			wantErr: true,
+		},
+		{
+			name:     "contains on metadata column",
+			filters:  []Filter{{Op: Contains, Value: `{"tags": ["urgent"]}`}},
+			want:     `"metadata"::jsonb @> $1::jsonb`,
+			wantArgs: []any{`{"tags": ["urgent"]}`},
+		},
+		{
+			name:     "contains on key",
+			filters:  []Filter{{Key: "tags", Op: Contains, Value: []string{"urgent"}}},
+			want:     `("metadata"::jsonb)->$1 @> $2::jsonb`,
+			wantArgs: []any{"tags", `["urgent"]`},
+		},
+		{
+			name:    "contains invalid json",
+			filters: []Filter{{Op: Contains, Value: `{"tags": [`}},
+			wantErr: true,
+		},
+		{
+			name:    "contains nil",
+			filters: []Filter{{Op: Contains}},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported operator",
+			filters: []Filter{{Key: "a", Op: "~", Value: "x"}},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported value",
+			filters: []Filter{{Key: "a", Value: []int{1}}},
+			wantErr: true,
+		},
+		{
+			name:    "empty key",
+			filters: []Filter{{Value: "x"}},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			args := &queryArgs{}
+			got, err := compileFilters(tc.filters, "metadata", nil, args)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, tc.wantArgs, args.args)
+		})
+	}
+}
+
+func TestCompileFiltersWithoutMetadataColumn(t *testing.T) {
+	_, err := compileFilters([]Filter{{Key: "a", Value: "b"}}, "", nil, &queryArgs{})
+	assert.Error(t, err)
+}
+
+func TestCompileFiltersMetadataColumns(t *testing.T) {
+	args := &queryArgs{}
+	got, err := compileFilters([]Filter{
+		{Key: "tenant_id", Value: "acme"},
+		{Key: "created_at", Op: Ge, Value: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Key: "lang", Value: "en"},
+	}, "metadata", []string{"tenant_id", "created_at"}, args)
+	assert.NoError(t, err)
+	assert.Equal(t, `"tenant_id" = $1 AND "created_at" >= $2 AND "metadata"->>$3 = $4`, got)
+	assert.Len(t, args.args, 4)
+
+	got, err = compileFilters([]Filter{{Key: "tenant_id", Value: "acme"}}, "", []string{"tenant_id"}, &queryArgs{})
+	assert.NoError(t, err)
+	assert.Equal(t, `"tenant_id" = $1`, got)
+
+	got, err = compileFilters([]Filter{
+		{Key: "tenant_id", Op: In, Value: []string{"acme", "globex"}},
+		{Key: "created_at", Op: Between, Value: []time.Time{time.Unix(0, 0), time.Unix(1, 0)}},
+	}, "", []string{"tenant_id", "created_at"}, &queryArgs{})
+	assert.NoError(t, err)
+	assert.Equal(t, `"tenant_id" IN ($1, $2) AND "created_at" BETWEEN $3 AND $4`, got)
+
+	got, err = compileFilters([]Filter{{Key: "labels", Op: Contains, Value: map[string]any{"team": "search"}}}, "", []string{"labels"}, &queryArgs{})
+	assert.NoError(t, err)
+	assert.Equal(t, `"labels"::jsonb @> $1::jsonb`, got)
+}
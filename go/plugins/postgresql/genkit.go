@@ -3,6 +3,7 @@ package postgresql
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
 
 	"github.com/firebase/genkit/go/ai"
@@ -12,11 +13,16 @@ import (
 // The provider used in the registry.
 const provider = "postgres"
 
-// Postgres holds the current plugin state.
+// Postgres is a Genkit plugin for PostgreSQL vector stores.
 type Postgres struct {
+	Engine *PostgresEngine // Engine used by the retrievers and indexers. Required.
+	// Tables are registered at Init as a retriever and an indexer each,
+	// named after their table, such as "postgres/my-docs". More can be
+	// defined later with [DefineRetriever] and [DefineIndexer].
+	Tables []*Config
+
 	mu      sync.Mutex
 	initted bool
-	engine  PostgresEngine
 }
 
 func (p *Postgres) Name() string {
@@ -31,10 +37,22 @@ func (p *Postgres) Init(ctx context.Context, g *genkit.Genkit) error {
 		panic("postgres.Init already initted")
 	}
 
-	if p.engine.Pool == nil {
+	if p.Engine == nil || (p.Engine.Pool == nil && p.Engine.config.db == nil && p.Engine.config.conn == nil) {
 		panic("postgres.Init engine has no pool")
 	}
 
+	for _, cfg := range p.Tables {
+		ds, err := newEngineDocStore(ctx, *p.Engine, cfg)
+		if err != nil {
+			return fmt.Errorf("postgres.Init: table %q: %w", cfg.TableName, err)
+		}
+		if err := ds.checkEmbedderDimensions(ctx); err != nil {
+			return fmt.Errorf("postgres.Init: table %q: %w", cfg.TableName, err)
+		}
+		genkit.DefineRetriever(g, provider, ds.config.TableName, ds.Retrieve)
+		genkit.DefineIndexer(g, provider, ds.config.TableName, ds.Index)
+	}
+
 	p.initted = true
 	return nil
 
@@ -50,9 +68,159 @@ type Config struct {
 	IDColumn              string
 	MetadataJSONColumn    string
 	IgnoreMetadataColumns []string
+	// DistanceStrategy is the distance function used to rank documents.
+	// The default is set with [WithDistanceStrategy], or [CosineDistance].
+	DistanceStrategy DistanceStrategy
+	// TiebreakerColumn orders documents at the same distance, so that
+	// retrieval returns them in a stable order. It should be unique. The
+	// default is IDColumn.
+	TiebreakerColumn string
+	// K is the number of documents the retriever returns, unless overridden
+	// by [RetrieverOptions.K]. The default is set with [WithDefaultK], or 4.
+	K int
+	// IndexBatchSize is the number of documents the indexer writes per
+	// round trip. The default is set with [WithIndexBatchSize], or 100.
+	IndexBatchSize int
+	// IndexErrors controls how the indexer handles the documents it cannot
+	// write. The default is [IndexFailFast].
+	IndexErrors IndexErrorMode
+	// EmbedConcurrency is the number of embedding requests the indexer runs
+	// in parallel, each for up to IndexBatchSize documents. The default is
+	// set with [WithEmbedConcurrency]; 0 or 1 embeds all the documents of an
+	// index request in one request.
+	EmbedConcurrency int
+	// Overwrite makes the indexer update documents whose ID already exists
+	// in the table. Otherwise such documents are skipped. It is set for
+	// every table of an engine with [WithOverwrite].
+	Overwrite bool
+	// ConflictColumns, if set, are the columns that identify an existing
+	// document in place of IDColumn, such as a tenant id and an external id.
+	// They must be IDColumn or MetadataColumns, and be covered together by
+	// a unique index or constraint. Updated rows keep their id, which the
+	// indexing results report. On a partitioned table, whose unique
+	// constraints include the partition key, they are required.
+	ConflictColumns []string
+	// ContentHashColumn, if set, is a text column, such as one created with
+	// [VectorstoreTableOptions.ContentHashColumn], in which the indexer
+	// writes a hash of the content and metadata of each document. A document
+	// whose row already holds its hash is neither embedded nor written, and
+	// is reported with [IndexUnchanged], which spares the embedder when
+	// the same documents are indexed again; other documents whose row holds
+	// their hash reuse its embedding. It cannot be combined with
+	// ConflictColumns, ColumnEmbedders or ExternalContent.
+	ContentHashColumn string
+	// IDGenerator, if set, computes the id of documents that have no id in
+	// their metadata, such as from a natural key; with Overwrite, indexing
+	// them again then updates the same rows. An error aborts the index
+	// request before any document of its batch is written. The default
+	// derives a UUID from the content and metadata of the document, or from
+	// its content alone with [WithDeterministicIDs].
+	IDGenerator func(doc *ai.Document) (string, error)
+	// Normalization checks or scales the length of the embeddings of
+	// indexed documents and queries, such as to guard [InnerProduct]
+	// against embeddings that are not normalized. The default is
+	// [NormalizeOff].
+	Normalization Normalization
+	// NormalizeTolerance is the largest difference from 1 of the length of
+	// an embedding accepted by [NormalizeCheck]. The default is 1e-3.
+	NormalizeTolerance float64
+	// NonFiniteEmbeddings controls how the indexer handles embeddings with
+	// NaN or infinite elements. The default is [NonFiniteReject].
+	NonFiniteEmbeddings NonFinite
+	// MissingMetadata controls what the indexer writes to the JSON metadata
+	// column for documents that have no metadata besides their id. The
+	// default is [MetadataEmpty].
+	MissingMetadata MissingMetadata
+	// AllowZeroQueryVector makes the retriever accept query embeddings with
+	// only zero elements with [CosineDistance], which otherwise rejects them
+	// with an error wrapping [ErrInvalidQueryVector]: their cosine distance
+	// to any document is undefined, and ranks documents arbitrarily. Empty
+	// query embeddings are always rejected.
+	AllowZeroQueryVector bool
+	// SkipEmbedderCheck skips the check of the dimension of the embeddings of
+	// the embedders of the table when its retriever and indexer are defined,
+	// by [Postgres.Init], [DefineRetriever], [DefineIndexer] or
+	// [NewVectorStore], such as for deployments that cannot reach the
+	// embedder at startup. The check embeds a short text once with each
+	// embedder, and fails with an error wrapping [ErrDimensionMismatch] if
+	// the dimension differs from that of the column, rather than at the
+	// first request.
+	SkipEmbedderCheck bool
 
-	Embedder        ai.Embedder // Embedder to use. Required.
+	Embedder        ai.Embedder // Embedder to use. Required, unless TextSearch is set.
 	EmbedderOptions any         // Options to pass to the embedder.
+	// QueryEmbedder, if set, embeds the query documents of the retriever in
+	// place of Embedder, with QueryEmbedderOptions, for models that embed
+	// queries and documents differently. Its embeddings must have the
+	// dimension of the table.
+	QueryEmbedder        ai.Embedder
+	QueryEmbedderOptions any
+	// ColumnEmbedders populate additional embedding columns of the table,
+	// such as [VectorstoreTableOptions.AdditionalEmbeddingColumns], with
+	// other embedders, such as to compare embedding models: the indexer
+	// embeds each document with each of them too, and writes all the
+	// embeddings in the same row. Retrievers embed the query with the
+	// embedder of the column they search, selected with
+	// [RetrieverOptions.EmbeddingColumn] or by the name of its embedder
+	// with [RetrieverOptions.Embedder].
+	ColumnEmbedders []ColumnEmbedder
+	// QueryTemplate, if set, is the SQL query the retriever runs in place
+	// of the built-in similarity search, such as to join a permissions
+	// table. It must contain the {vector}, {k} and {filter} placeholders,
+	// replaced with the query vector parameter, the number of rows to fetch
+	// and the condition of the filters, which is TRUE without filters. The
+	// optional {columns} and {table} placeholders are replaced with the
+	// columns the retriever reads and the qualified name of the table. The
+	// query must select these columns, in this order, followed by the
+	// distance, as in SELECT {columns}, "embedding" <=> {vector} AS distance
+	// FROM {table} WHERE {filter} ORDER BY distance LIMIT {k}. The filter
+	// references the columns of the table unqualified. Retrievals with a
+	// template require a query, and cannot use MMR, hybrid retrieval,
+	// pagination, grouping, [RetrieverOptions.ReturnEmbedding] or
+	// [PostgresEngine.RetrieveBatch].
+	QueryTemplate string
+	// TextSearch, if set, makes the retriever rank documents by full-text
+	// relevance rather than by vector similarity, so that tables without
+	// embeddings can be searched. Embedder is then optional, and the
+	// embedding column need not exist; the indexer still requires Embedder
+	// for documents without a precomputed embedding.
+	TextSearch *TextSearchOptions
+	// DefaultFilters are added to every retrieval from the table, after
+	// those of [WithDefaultFilter], and combined with the filters of the
+	// request like them.
+	DefaultFilters []Filter
+	// ObservabilityName identifies the retriever and indexer of the table in
+	// their spans, as the postgresql.name attribute, metrics and slow request
+	// logs, to tell apart those sharing an engine, such as "product-search"
+	// from "support-docs". The default is the qualified table name, such as
+	// "public.documents".
+	ObservabilityName string
+	// ExternalContent, if set, stores the content of the documents outside
+	// of the table, which holds references to it in the content column.
+	ExternalContent *ExternalContentOptions
+	// RetrievedColumns maps additional columns of the table, such as
+	// columns maintained by other writers or generated columns, to the
+	// metadata keys under which retrieved documents carry their values; an
+	// empty key is the name of the column. Unlike MetadataColumns, they are
+	// read in the same query as the documents but never written by the
+	// indexer, and cannot be filtered on.
+	RetrievedColumns map[string]string
+	// Parents configures a parent/child layout, in which the documents of
+	// the table are chunks of parent documents of another table, for
+	// retrievals with [RetrieverOptions.RollUp].
+	Parents *ParentOptions
+}
+
+// ColumnEmbedder is an embedder populating an additional embedding column.
+// See [Config.ColumnEmbedders].
+type ColumnEmbedder struct {
+	// Column is the embedding column, which must not be
+	// [Config.EmbeddingColumn].
+	Column string
+	// Embedder embeds the documents and queries of the column. Required.
+	Embedder ai.Embedder
+	// EmbedderOptions are passed to the embedder.
+	EmbedderOptions any
 }
 
 // DefineRetriever defines a Retriever with the given configuration.
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/firebase/genkit/go/genkit"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func TestInit_AlreadyCalled(t *testing.T) {
@@ -16,8 +17,18 @@ func TestInit_AlreadyCalled(t *testing.T) {
 			t.Error("panic not called")
 		}
 	}()
-	gcsp := &Postgres{engine: engine}
+	gcsp := &Postgres{Engine: &engine}
 	_ = gcsp.Init(ctx, &genkit.Genkit{})
 	_ = gcsp.Init(ctx, &genkit.Genkit{})
 
 }
+
+func TestInitInvalidTable(t *testing.T) {
+	p := &Postgres{
+		Engine: &PostgresEngine{Pool: &pgxpool.Pool{}},
+		Tables: []*Config{{TableName: " "}},
+	}
+	if err := p.Init(context.Background(), &genkit.Genkit{}); err == nil {
+		t.Error("Init succeeded with an invalid table config")
+	}
+}
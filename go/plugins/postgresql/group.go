@@ -0,0 +1,75 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// GroupOptions limits the number of documents returned per distinct value of
+// a metadata key, such as the source of chunked documents, so that the
+// chunks of one source do not crowd out the others.
+type GroupOptions struct {
+	// Key is the metadata key whose values define the groups: a metadata
+	// column or a key of the JSON metadata column. Documents without the
+	// key form a single group.
+	Key string `json:"key"`
+	// PerGroup is the number of documents kept per group, the nearest
+	// ones. The default is 1.
+	PerGroup int `json:"perGroup,omitempty"`
+	// FetchK is the number of nearest neighbors fetched as candidates
+	// before grouping, so that the vector index can serve the search. It
+	// must be at least the K of the retrieval. The default is 5*K. Fewer
+	// than K documents are returned if the candidates have too few groups.
+	FetchK int `json:"fetchK,omitempty"`
+}
+
+// withDefaults returns a copy of o with the defaults applied for a retrieval
+// of k documents, or an error if o is invalid.
+func (o GroupOptions) withDefaults(k int) (GroupOptions, error) {
+	if o.Key == "" {
+		return GroupOptions{}, errors.New("group key must not be empty")
+	}
+	if o.PerGroup == 0 {
+		o.PerGroup = 1
+	}
+	if o.FetchK == 0 {
+		o.FetchK = 5 * k
+	}
+	if o.PerGroup < 0 {
+		return GroupOptions{}, fmt.Errorf("group perGroup must be positive, got %d", o.PerGroup)
+	}
+	if o.FetchK < k {
+		return GroupOptions{}, fmt.Errorf("group fetchK (%d) must be at least k (%d)", o.FetchK, k)
+	}
+	return o, nil
+}
+
+// groupKey returns the expression of the group key of o.
+func (ds *docStore) groupKey(o GroupOptions, args *queryArgs) (string, error) {
+	return ds.metadataKeyExpr("group key", o.Key, args)
+}
+
+// metadataKeyExpr returns the expression of a metadata key: a metadata
+// column, or else a key of the JSON metadata column, bound in args. kind
+// names the key in errors.
+func (ds *docStore) metadataKeyExpr(kind, key string, args *queryArgs) (string, error) {
+	if slices.Contains(ds.config.MetadataColumns, key) {
+		return fmt.Sprintf(`"%s"`, key), nil
+	}
+	if ds.config.MetadataJSONColumn == "" {
+		return "", fmt.Errorf("%s %q requires a metadata JSON column", kind, key)
+	}
+	return fmt.Sprintf(`"%s"->>%s`, ds.config.MetadataJSONColumn, args.add(key)), nil
+}
+
+// groupQuery wraps candidates, a similarity search that also selects the
+// group key as group_key and the tiebreaker as group_tiebreaker, to keep the
+// nearest o.PerGroup rows of each group among them. columns are the output
+// columns of candidates, apart from those two, and are selected in order.
+func groupQuery(candidates string, columns []string, o GroupOptions, k int) string {
+	return fmt.Sprintf(`SELECT %s FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY group_key ORDER BY distance, group_tiebreaker) AS group_rank FROM (%s) AS candidates) AS grouped`+
+		` WHERE group_rank <= %d ORDER BY distance, group_tiebreaker LIMIT %d`,
+		strings.Join(columns, ", "), candidates, o.PerGroup, k)
+}
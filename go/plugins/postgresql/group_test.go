@@ -0,0 +1,66 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupOptionsWithDefaults(t *testing.T) {
+	o, err := GroupOptions{Key: "source_id"}.withDefaults(4)
+	assert.NoError(t, err)
+	assert.Equal(t, GroupOptions{Key: "source_id", PerGroup: 1, FetchK: 20}, o)
+
+	for _, o := range []GroupOptions{
+		{},
+		{Key: "source_id", PerGroup: -1},
+		{Key: "source_id", FetchK: 3},
+	} {
+		_, err := o.withDefaults(4)
+		assert.Error(t, err, "%+v", o)
+	}
+}
+
+func TestBuildRetrieveQueryGroupBy(t *testing.T) {
+	ds := testDocStore()
+	query, args, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{
+		GroupBy: &GroupOptions{Key: "source", PerGroup: 2},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", distance FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY group_key ORDER BY distance, group_tiebreaker) AS group_rank FROM (`+
+		`SELECT "id", "content", "metadata", "source", "embedding" <=> $1 AS distance, "source" AS group_key, "id" AS group_tiebreaker FROM "public"."documents" ORDER BY distance, "id" LIMIT 20`+
+		`) AS candidates) AS grouped WHERE group_rank <= 2 ORDER BY distance, group_tiebreaker LIMIT 4`, query)
+	assert.Len(t, args, 1)
+
+	// JSON metadata keys are bound as parameters, after those of the filters.
+	query, args, err = ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{
+		Filters:         []Filter{{Key: "tenant_id", Value: "acme"}},
+		GroupBy:         &GroupOptions{Key: "source_id"},
+		ReturnEmbedding: true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", distance, "embedding" FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY group_key ORDER BY distance, group_tiebreaker) AS group_rank FROM (`+
+		`SELECT "id", "content", "metadata", "source", "embedding" <=> $1 AS distance, "embedding"::text AS "embedding", "metadata"->>$4 AS group_key, "id" AS group_tiebreaker FROM "public"."documents"`+
+		` WHERE "metadata"->>$2 = $3 ORDER BY distance, "id" LIMIT 20) AS candidates) AS grouped WHERE group_rank <= 1 ORDER BY distance, group_tiebreaker LIMIT 4`, query)
+	assert.Equal(t, []any{"tenant_id", "acme", "source_id"}, args[1:])
+
+	ds.config.MetadataJSONColumn = ""
+	_, _, err = ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{GroupBy: &GroupOptions{Key: "source_id"}})
+	assert.Error(t, err)
+}
+
+func TestGroupByCombinations(t *testing.T) {
+	ds := testDocStore()
+	for _, opts := range []*RetrieverOptions{
+		{MMR: &MMROptions{Lambda: 0.5}},
+		{Hybrid: &HybridOptions{Query: "chunks"}},
+		{After: &Cursor{Key: "doc-1"}},
+	} {
+		opts.GroupBy = &GroupOptions{Key: "source"}
+		opts.QueryEmbedding = []float32{1, 2}
+		_, err := ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{Options: opts}, true)
+		assert.ErrorContains(t, err, "grouping cannot be combined", "%+v", opts)
+	}
+}
@@ -0,0 +1,125 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// rrfK is the rank constant of Reciprocal Rank Fusion. It dampens the
+// influence of the top ranks of either ranking.
+const rrfK = 60
+
+// HybridOptions configures hybrid retrieval, which combines a full-text
+// search with the vector similarity search. The two rankings are fused with
+// weighted Reciprocal Rank Fusion and deduplicated by document ID.
+type HybridOptions struct {
+	// Query is the full-text query, parsed with websearch_to_tsquery. The
+	// default is the text of the query document.
+	Query string `json:"query,omitempty"`
+	// TSVectorColumn is a tsvector column holding the lexemes of each
+	// document. If empty, they are computed on the fly from TextColumn.
+	TSVectorColumn string `json:"tsvectorColumn,omitempty"`
+	// TextColumn is the column the lexemes are computed from when
+	// TSVectorColumn is empty. The default is the content column.
+	TextColumn string `json:"textColumn,omitempty"`
+	// Language is the text search configuration. The default is "english".
+	Language string `json:"language,omitempty"`
+	// SemanticWeight weighs the vector ranking against the full-text
+	// ranking, between 0 and 1: 1 ranks by vector similarity only and 0 by
+	// full-text relevance only.
+	SemanticWeight float32 `json:"semanticWeight"`
+	// FetchK is the number of candidates taken from each ranking before
+	// fusion. It must be at least the number of documents returned. The
+	// default is 5 times that number.
+	FetchK int `json:"fetchK,omitempty"`
+}
+
+// withDefaults returns a copy of o with the defaults applied for a query
+// returning k documents, or an error if o is invalid.
+func (o HybridOptions) withDefaults(ds *docStore, queryText string, k int) (HybridOptions, error) {
+	if o.Query == "" {
+		o.Query = queryText
+	}
+	if o.TSVectorColumn == "" && o.TextColumn == "" {
+		o.TextColumn = ds.config.ContentColumn
+	}
+	if o.Language == "" {
+		o.Language = "english"
+	}
+	if o.FetchK == 0 {
+		o.FetchK = 5 * k
+	}
+	if strings.TrimSpace(o.Query) == "" {
+		return HybridOptions{}, errors.New("hybrid retrieval requires a full-text query")
+	}
+	if o.SemanticWeight < 0 || o.SemanticWeight > 1 {
+		return HybridOptions{}, fmt.Errorf("hybrid semantic weight must be between 0 and 1, got %v", o.SemanticWeight)
+	}
+	if o.FetchK < k {
+		return HybridOptions{}, fmt.Errorf("hybrid fetchK (%d) must be at least k (%d)", o.FetchK, k)
+	}
+	return o, nil
+}
+
+// buildHybridQuery returns the hybrid search query for vec and its
+// arguments. The rows have the same shape as those of buildRetrieveQuery and
+// are ordered by fused score, then by the tiebreaker column. Ties within each
+// ranking are broken by id, which the fusion joins on.
+func (ds *docStore) buildHybridQuery(vec []float32, k int, opts *RetrieverOptions, hybrid HybridOptions) (string, []any, error) {
+	if opts.MinDistance != nil || opts.MaxDistance != nil {
+		return "", nil, errors.New("hybrid retrieval cannot be combined with distance bounds")
+	}
+	queryVec, err := newVector(vec)
+	if err != nil {
+		return "", nil, fmt.Errorf("query %w", err)
+	}
+	args := &queryArgs{}
+	vecParam := ds.engine.vectorType().cast(args.add(ds.engine.vectorArg(queryVec)))
+	column, err := ds.searchColumn(opts)
+	if err != nil {
+		return "", nil, err
+	}
+	where, err := ds.retrieveWhere(column, opts, args)
+	if err != nil {
+		return "", nil, err
+	}
+	langParam := args.add(hybrid.Language)
+	queryParam := args.add(hybrid.Query)
+	weightParam := args.add(float64(hybrid.SemanticWeight))
+
+	table := qualifiedName(ds.config.SchemaName, ds.config.TableName)
+	distance := fmt.Sprintf(`"%s" %s %s`, column, ds.config.DistanceStrategy.operator(), vecParam)
+	tsvector := fmt.Sprintf(`"%s"`, hybrid.TSVectorColumn)
+	if hybrid.TSVectorColumn == "" {
+		tsvector = fmt.Sprintf(`to_tsvector(%s::regconfig, "%s")`, langParam, hybrid.TextColumn)
+	}
+	semanticWhere, lexicalWhere := "", ""
+	if where != "" {
+		semanticWhere = " WHERE " + where
+		lexicalWhere = " AND " + where
+	}
+
+	cols, err := ds.selectList("t.", opts, args)
+	if err != nil {
+		return "", nil, err
+	}
+	cols = append(cols, fmt.Sprintf(`t.%s AS distance`, distance))
+	if opts.ReturnEmbedding {
+		cols = append(cols, fmt.Sprintf(`t."%s"::text`, column))
+	}
+
+	id := ds.config.IDColumn
+	query := fmt.Sprintf(`WITH semantic AS (`+
+		`SELECT "%[1]s", row_number() OVER (ORDER BY d, "%[1]s") AS rank FROM (SELECT "%[1]s", %[2]s AS d FROM %[3]s%[4]s ORDER BY d, "%[1]s" LIMIT %[5]d) s`+
+		`), lexical AS (`+
+		`SELECT "%[1]s", row_number() OVER (ORDER BY r DESC, "%[1]s") AS rank FROM (SELECT "%[1]s", ts_rank_cd(%[6]s, q) AS r FROM %[3]s, websearch_to_tsquery(%[7]s::regconfig, %[8]s) q WHERE %[6]s @@ q%[9]s ORDER BY r DESC, "%[1]s" LIMIT %[5]d) l`+
+		`), fused AS (`+
+		`SELECT COALESCE(s."%[1]s", l."%[1]s") AS fused_id, COALESCE(%[10]s::float8 / (%[11]d + s.rank), 0) + COALESCE((1 - %[10]s::float8) / (%[11]d + l.rank), 0) AS score `+
+		`FROM semantic s FULL OUTER JOIN lexical l ON s."%[1]s" = l."%[1]s"`+
+		`) SELECT %[12]s FROM %[3]s t JOIN fused f ON t."%[1]s" = f.fused_id ORDER BY f.score DESC, t."%[14]s" LIMIT %[13]d`,
+		id, distance, table, semanticWhere, hybrid.FetchK,
+		tsvector, langParam, queryParam, lexicalWhere,
+		weightParam, rrfK, strings.Join(cols, ", "), k, ds.config.TiebreakerColumn)
+	return query, args.args, nil
+}
@@ -0,0 +1,93 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHybridOptionsWithDefaults(t *testing.T) {
+	ds := testDocStore()
+	o, err := HybridOptions{SemanticWeight: 0.7}.withDefaults(ds, "error E1234", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, HybridOptions{
+		Query:          "error E1234",
+		TextColumn:     "content",
+		Language:       "english",
+		SemanticWeight: 0.7,
+		FetchK:         20,
+	}, o)
+
+	o, err = HybridOptions{TSVectorColumn: "tsv", Query: "sku-42"}.withDefaults(ds, "ignored", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, "", o.TextColumn)
+	assert.Equal(t, "sku-42", o.Query)
+
+	for _, o := range []HybridOptions{
+		{SemanticWeight: 1.5},
+		{SemanticWeight: -0.5},
+		{FetchK: 2},
+	} {
+		_, err := o.withDefaults(ds, "query", 4)
+		assert.Error(t, err, "%+v", o)
+	}
+	_, err = HybridOptions{}.withDefaults(ds, "  ", 4)
+	assert.Error(t, err)
+}
+
+func TestBuildHybridQuery(t *testing.T) {
+	ds := testDocStore()
+	hybrid := HybridOptions{Query: "E1234", TSVectorColumn: "tsv", Language: "english", SemanticWeight: 0.5, FetchK: 20}
+	query, args, err := ds.buildHybridQuery([]float32{1, 2}, 4, &RetrieverOptions{
+		Filters: []Filter{{Key: "tenant_id", Value: "acme"}},
+	}, hybrid)
+	assert.NoError(t, err)
+	assert.Equal(t, `WITH semantic AS (`+
+		`SELECT "id", row_number() OVER (ORDER BY d, "id") AS rank FROM (SELECT "id", "embedding" <=> $1 AS d FROM "public"."documents" WHERE "metadata"->>$2 = $3 ORDER BY d, "id" LIMIT 20) s`+
+		`), lexical AS (`+
+		`SELECT "id", row_number() OVER (ORDER BY r DESC, "id") AS rank FROM (SELECT "id", ts_rank_cd("tsv", q) AS r FROM "public"."documents", websearch_to_tsquery($4::regconfig, $5) q WHERE "tsv" @@ q AND "metadata"->>$2 = $3 ORDER BY r DESC, "id" LIMIT 20) l`+
+		`), fused AS (`+
+		`SELECT COALESCE(s."id", l."id") AS fused_id, COALESCE($6::float8 / (60 + s.rank), 0) + COALESCE((1 - $6::float8) / (60 + l.rank), 0) AS score `+
+		`FROM semantic s FULL OUTER JOIN lexical l ON s."id" = l."id"`+
+		`) SELECT t."id", t."content", t."metadata", t."source", t."embedding" <=> $1 AS distance FROM "public"."documents" t JOIN fused f ON t."id" = f.fused_id ORDER BY f.score DESC, t."id" LIMIT 4`,
+		query)
+	assert.Equal(t, []any{"tenant_id", "acme", "english", "E1234", 0.5}, args[1:])
+
+	hybrid.TSVectorColumn = ""
+	hybrid.TextColumn = "content"
+	query, _, err = ds.buildHybridQuery([]float32{1, 2}, 4, &RetrieverOptions{}, hybrid)
+	assert.NoError(t, err)
+	assert.Contains(t, query, `ts_rank_cd(to_tsvector($2::regconfig, "content"), q)`)
+}
+
+func TestPrepareRetrievalHybridErrors(t *testing.T) {
+	ds := testDocStore()
+	ds.config.K = 4
+	ds.dimension = 2
+	maxDistance := 0.5
+	for _, opts := range []*RetrieverOptions{
+		{MaxDistance: &maxDistance},
+		{Filters: []Filter{{Key: "tenant_id", Op: "~~", Value: "acme"}}},
+	} {
+		opts.QueryEmbedding = []float32{1, 2}
+		opts.Hybrid = &HybridOptions{Query: "E1234"}
+		r, err := ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{Options: opts}, false)
+		assert.Error(t, err, "%+v", opts)
+		assert.Nil(t, r)
+	}
+}
+
+func TestRetrieveHybridDistanceBounds(t *testing.T) {
+	ds := testDocStore()
+	ds.dimension = 2
+	minDistance := 0.1
+	_, err := ds.Retrieve(context.Background(), &ai.RetrieverRequest{Options: &RetrieverOptions{
+		QueryEmbedding: []float32{1, 2},
+		Hybrid:         &HybridOptions{Query: "E1234"},
+		MinDistance:    &minDistance,
+	}})
+	assert.ErrorContains(t, err, "hybrid retrieval cannot be combined with distance bounds")
+}
@@ -0,0 +1,163 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// iamLoginScope is the OAuth2 scope of the access tokens used as database
+// passwords with IAM database authentication.
+const iamLoginScope = "https://www.googleapis.com/auth/sqlservice.login"
+
+// userInfoEmailScope is the OAuth2 scope used to look up the email of the
+// IAM principal of credentials.
+const userInfoEmailScope = "https://www.googleapis.com/auth/userinfo.email"
+
+// credentialScopes are the scopes requested for the credentials set with
+// WithCredentialsJSON, covering the connectors, IAM database authentication
+// and the lookup of the IAM principal.
+var credentialScopes = []string{
+	"https://www.googleapis.com/auth/cloud-platform",
+	iamLoginScope,
+	userInfoEmailScope,
+}
+
+// loadCredentials validates the credentials set with WithCredentials or
+// WithCredentialsJSON, parsing the latter into cfg.credentials.
+func loadCredentials(cfg *engineConfig) error {
+	if cfg.credentialsJSON == nil && !cfg.credentialsSet {
+		return nil
+	}
+	if cfg.credentialsJSON != nil && cfg.credentialsSet {
+		return errors.New("conflicting credentials: provide either WithCredentials or WithCredentialsJSON, not both")
+	}
+	if cfg.connPool != nil || cfg.db != nil || cfg.conn != nil {
+		return errors.New("credentials cannot be used with a connection, a connection pool or a database/sql handle provided by the caller")
+	}
+	if cfg.credentialsJSON != nil {
+		creds, err := google.CredentialsFromJSON(context.Background(), cfg.credentialsJSON, credentialScopes...)
+		if err != nil {
+			return fmt.Errorf("invalid credentials JSON: %w", err)
+		}
+		cfg.credentials = creds
+	}
+	if cfg.credentials == nil || cfg.credentials.TokenSource == nil {
+		return errors.New("credentials must have a token source")
+	}
+	return nil
+}
+
+// newIAMTokenSource returns a source of IAM login tokens for credentials, or
+// the application default credentials if nil. It caches tokens and
+// refreshes them once expired.
+func newIAMTokenSource(ctx context.Context, credentials *google.Credentials) (oauth2.TokenSource, error) {
+	if credentials != nil {
+		return oauth2.ReuseTokenSource(nil, credentials.TokenSource), nil
+	}
+	ts, err := google.DefaultTokenSource(ctx, iamLoginScope)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get default credentials: %w", err)
+	}
+	return oauth2.ReuseTokenSource(nil, ts), nil
+}
+
+// TokenProvider supplies the passwords of IAM database authentication:
+// short-lived tokens fetched for every new connection, so that long-running
+// processes keep authenticating after the first token expires. The engine
+// uses [NewGoogleTokenProvider] for the IAM principal of
+// [WithIAMAccountEmail]; set another provider with [WithIAMTokenProvider],
+// such as for Amazon RDS IAM authentication.
+type TokenProvider interface {
+	// Token returns the password of a new connection of the database user
+	// to host and port. It is called concurrently by the connections of
+	// the pool, and should cache tokens while they are valid if fetching
+	// them is costly.
+	Token(ctx context.Context, host string, port uint16, user string) (string, error)
+}
+
+// TokenProviderFunc adapts a function to a [TokenProvider].
+type TokenProviderFunc func(ctx context.Context, host string, port uint16, user string) (string, error)
+
+// Token returns f(ctx, host, port, user).
+func (f TokenProviderFunc) Token(ctx context.Context, host string, port uint16, user string) (string, error) {
+	return f(ctx, host, port, user)
+}
+
+// NewGoogleTokenProvider returns a provider of the Google Cloud access tokens
+// of credentials, or of the application default credentials if nil, as used
+// for IAM database authentication with Cloud SQL and AlloyDB. Tokens are
+// cached until they expire.
+func NewGoogleTokenProvider(ctx context.Context, credentials *google.Credentials) (TokenProvider, error) {
+	ts, err := newIAMTokenSource(ctx, credentials)
+	if err != nil {
+		return nil, err
+	}
+	return googleTokenProvider{ts}, nil
+}
+
+// googleTokenProvider provides the access tokens of a Google token source.
+type googleTokenProvider struct {
+	ts oauth2.TokenSource
+}
+
+func (p googleTokenProvider) Token(context.Context, string, uint16, string) (string, error) {
+	tok, err := p.ts.Token()
+	if err != nil {
+		return "", err
+	}
+	return tok.AccessToken, nil
+}
+
+// iamTokenRetry is the policy of the retries of failed token fetches, which
+// ride out brief outages of the metadata server or of the token endpoint.
+var iamTokenRetry = retryPolicy{maxAttempts: 3, baseDelay: 200 * time.Millisecond}
+
+// iamAuthBeforeConnect returns a pgxpool BeforeConnect hook that sets the
+// password of each new connection to a token from p. p must refresh expired
+// tokens, as the sources returned by [oauth2.ReuseTokenSource] do, so that
+// connections opened after the first token expires still authenticate.
+// Failed fetches are retried per iamTokenRetry; the error of the last one
+// wraps [ErrIAMTokenFetch].
+func iamAuthBeforeConnect(p TokenProvider) func(context.Context, *pgx.ConnConfig) error {
+	return func(ctx context.Context, cc *pgx.ConnConfig) error {
+		var tok string
+		err := iamTokenRetry.doIf(ctx, retryableTokenError, func() (err error) {
+			tok, err = p.Token(ctx, cc.Host, cc.Port, cc.User)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrIAMTokenFetch, err)
+		}
+		cc.Password = tok
+		return nil
+	}
+}
+
+// retryableTokenError reports whether a token fetch failing with err may
+// succeed if retried. Rejections of the credentials by the token endpoint,
+// such as a revoked refresh token, are not retried.
+func retryableTokenError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var re *oauth2.RetrieveError
+	if errors.As(err, &re) && re.Response != nil {
+		code := re.Response.StatusCode
+		return code == http.StatusTooManyRequests || code >= 500
+	}
+	return true
+}
+
+// iamDatabaseUser returns the database user name of an IAM principal.
+// Service accounts log in without the ".gserviceaccount.com" suffix.
+func iamDatabaseUser(email string) string {
+	return strings.TrimSuffix(email, ".gserviceaccount.com")
+}
@@ -0,0 +1,171 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// countingTokenSource issues a new token, valid for an hour, on every call.
+type countingTokenSource struct {
+	calls int
+}
+
+func (ts *countingTokenSource) Token() (*oauth2.Token, error) {
+	ts.calls++
+	return &oauth2.Token{
+		AccessToken: fmt.Sprintf("token-%d", ts.calls),
+		Expiry:      time.Now().Add(time.Hour),
+	}, nil
+}
+
+func TestIAMAuthBeforeConnectRefreshesExpiredToken(t *testing.T) {
+	src := &countingTokenSource{}
+	expired := &oauth2.Token{AccessToken: "expired", Expiry: time.Now().Add(-time.Minute)}
+	hook := iamAuthBeforeConnect(googleTokenProvider{oauth2.ReuseTokenSource(expired, src)})
+
+	cc := &pgx.ConnConfig{}
+	assert.NoError(t, hook(context.Background(), cc))
+	assert.Equal(t, "token-1", cc.Password)
+	assert.Equal(t, 1, src.calls)
+
+	// A still valid token is reused for the next connection.
+	cc = &pgx.ConnConfig{}
+	assert.NoError(t, hook(context.Background(), cc))
+	assert.Equal(t, "token-1", cc.Password)
+	assert.Equal(t, 1, src.calls)
+}
+
+type failingTokenSource struct{}
+
+func (failingTokenSource) Token() (*oauth2.Token, error) {
+	return nil, errors.New("metadata server unavailable")
+}
+
+func TestIAMAuthBeforeConnectError(t *testing.T) {
+	defer func(p retryPolicy) { iamTokenRetry = p }(iamTokenRetry)
+	iamTokenRetry.baseDelay = time.Millisecond
+	hook := iamAuthBeforeConnect(googleTokenProvider{failingTokenSource{}})
+	err := hook(context.Background(), &pgx.ConnConfig{})
+	assert.ErrorIs(t, err, ErrIAMTokenFetch)
+	assert.ErrorContains(t, err, "metadata server unavailable")
+}
+
+func TestIAMAuthBeforeConnectRetriesTransientFailures(t *testing.T) {
+	defer func(p retryPolicy) { iamTokenRetry = p }(iamTokenRetry)
+	iamTokenRetry.baseDelay = time.Millisecond
+	calls := 0
+	hook := iamAuthBeforeConnect(TokenProviderFunc(func(context.Context, string, uint16, string) (string, error) {
+		calls++
+		if calls < iamTokenRetry.maxAttempts {
+			return "", errors.New("metadata server unavailable")
+		}
+		return "token", nil
+	}))
+	cc := &pgx.ConnConfig{}
+	assert.NoError(t, hook(context.Background(), cc))
+	assert.Equal(t, "token", cc.Password)
+	assert.Equal(t, iamTokenRetry.maxAttempts, calls)
+
+	// Rejected credentials are not retried.
+	calls = 0
+	hook = iamAuthBeforeConnect(TokenProviderFunc(func(context.Context, string, uint16, string) (string, error) {
+		calls++
+		return "", &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusBadRequest}, ErrorCode: "invalid_grant"}
+	}))
+	assert.ErrorIs(t, hook(context.Background(), &pgx.ConnConfig{}), ErrIAMTokenFetch)
+	assert.Equal(t, 1, calls)
+
+	assert.True(t, retryableTokenError(&oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusServiceUnavailable}}))
+	assert.False(t, retryableTokenError(context.Canceled))
+}
+
+func TestIAMDatabaseUser(t *testing.T) {
+	assert.Equal(t, "worker@my-project.iam", iamDatabaseUser("worker@my-project.iam.gserviceaccount.com"))
+	assert.Equal(t, "alice@example.com", iamDatabaseUser("alice@example.com"))
+}
+
+func TestLoadCredentials(t *testing.T) {
+	authorizedUser := []byte(`{"type": "authorized_user", "client_id": "id", "client_secret": "secret", "refresh_token": "token"}`)
+	creds := &google.Credentials{TokenSource: &countingTokenSource{}}
+	instance := WithCloudSQLInstance("testproject", "testregion", "testinstance")
+
+	testCases := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{name: "credentials", opts: []Option{instance, WithDatabase("testdb"), WithCredentials(creds)}},
+		{name: "credentials json", opts: []Option{instance, WithDatabase("testdb"), WithCredentialsJSON(authorizedUser)}},
+		{name: "invalid json", opts: []Option{instance, WithDatabase("testdb"), WithCredentialsJSON([]byte(`{"type": "service_account"`))}, wantErr: true},
+		{name: "both", opts: []Option{instance, WithDatabase("testdb"), WithCredentials(creds), WithCredentialsJSON(authorizedUser)}, wantErr: true},
+		{name: "nil credentials", opts: []Option{instance, WithDatabase("testdb"), WithCredentials(nil)}, wantErr: true},
+		{name: "injected pool", opts: []Option{WithPool(&pgxpool.Pool{}), WithDatabase("testdb"), WithCredentials(creds)}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := applyEngineOptions(tc.opts)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, cfg.credentials)
+		})
+	}
+}
+
+func TestNewIAMTokenSourceCredentials(t *testing.T) {
+	src := &countingTokenSource{}
+	ts, err := newIAMTokenSource(context.Background(), &google.Credentials{TokenSource: src})
+	assert.NoError(t, err)
+	tok, err := ts.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", tok.AccessToken)
+	// Tokens are cached until they expire.
+	_, err = ts.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, src.calls)
+}
+
+func TestTokenProvider(t *testing.T) {
+	var got []any
+	provider := TokenProviderFunc(func(ctx context.Context, host string, port uint16, user string) (string, error) {
+		got = []any{host, port, user}
+		return "rds-token", nil
+	})
+	cc := &pgx.ConnConfig{}
+	cc.Host, cc.Port, cc.User = "mydb.rds.amazonaws.com", 5432, "app_user"
+	assert.NoError(t, iamAuthBeforeConnect(provider)(context.Background(), cc))
+	assert.Equal(t, "rds-token", cc.Password)
+	assert.Equal(t, []any{"mydb.rds.amazonaws.com", uint16(5432), "app_user"}, got)
+
+	user, usingIAMAuth, err := getUser(context.Background(), engineConfig{user: "app_user", tokenProvider: provider})
+	assert.NoError(t, err)
+	assert.True(t, usingIAMAuth)
+	assert.Equal(t, "app_user", user)
+
+	dsn := WithConnectionString("postgres://app_user@mydb.rds.amazonaws.com:5432/mydb")
+	_, err = applyEngineOptions([]Option{dsn, WithIAMTokenProvider(provider)})
+	assert.NoError(t, err)
+	_, err = applyEngineOptions([]Option{WithUnixSocket("/var/run/postgresql"), WithDatabase("mydb"), WithUser("app_user"), WithIAMTokenProvider(provider)})
+	assert.NoError(t, err)
+	for _, opts := range [][]Option{
+		{dsn, WithIAMTokenProvider(provider), WithPassword("secret")},
+		{dsn, WithIAMTokenProvider(provider), WithIAMAccountEmail("sa@project.iam.gserviceaccount.com")},
+		{WithCloudSQLInstance("testproject", "testregion", "testinstance"), WithDatabase("mydb"), WithIAMTokenProvider(provider)},
+		{WithUnixSocket("/var/run/postgresql"), WithDatabase("mydb"), WithIAMTokenProvider(provider)},
+	} {
+		_, err := applyEngineOptions(opts)
+		assert.Error(t, err)
+	}
+}
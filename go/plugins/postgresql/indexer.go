@@ -1,12 +1,629 @@
 package postgresql
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/firebase/genkit/go/ai"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pgvector/pgvector-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func (ds *docStore) Index(context.Context, *ai.IndexerRequest) error {
-	// TODO: implement
+// IndexError reports a failure to write a document during indexing.
+// Documents in batches before the failing one have already been written;
+// the batch containing the failing document is rolled back as a whole.
+type IndexError struct {
+	Index     int   // Position of the offending document in the request.
+	Committed int   // Number of documents written before the failing batch.
+	Err       error // The underlying error.
+}
+
+func (e *IndexError) Error() string {
+	return fmt.Sprintf("postgres.Index: failed to write document %d (%d documents committed): %v", e.Index, e.Committed, e.Err)
+}
+
+func (e *IndexError) Unwrap() error {
+	return e.Err
+}
+
+// IndexStatus describes what indexing did with the row of a document.
+type IndexStatus string
+
+const (
+	// IndexInserted means that a new row was written.
+	IndexInserted IndexStatus = "inserted"
+	// IndexUpdated means that an existing row with the same ID was updated,
+	// with [Config.Overwrite].
+	IndexUpdated IndexStatus = "updated"
+	// IndexSkipped means that a row with the same ID already existed and was
+	// left untouched, without [Config.Overwrite].
+	IndexSkipped IndexStatus = "skipped"
+	// IndexFailed means that the document was not written by a request with
+	// [IndexBestEffort]. See [IndexFailures].
+	IndexFailed IndexStatus = "failed"
+	// IndexUnchanged means that the row of the document already held its
+	// content hash, with [Config.ContentHashColumn], so the document was
+	// neither embedded nor written.
+	IndexUnchanged IndexStatus = "unchanged"
+)
+
+// IndexResult reports the ID assigned to a document and what was written.
+type IndexResult struct {
+	ID     string
+	Status IndexStatus
+}
+
+// MissingMetadata is the handling of documents without metadata by the
+// indexer. See [Config.MissingMetadata].
+//
+// Filters on the JSON metadata column never match a NULL column, as any
+// comparison with NULL is NULL in SQL: even a [Ne] or [NotIn] filter
+// excludes such documents, as it excludes documents of [MetadataEmpty]
+// whose key is missing. To match documents without a key, retrieve without
+// the filter.
+type MissingMetadata string
+
+const (
+	// MetadataEmpty writes an empty JSON object.
+	MetadataEmpty MissingMetadata = "empty"
+	// MetadataNull writes SQL NULL.
+	MetadataNull MissingMetadata = "null"
+	// MetadataRequired rejects the index request.
+	MetadataRequired MissingMetadata = "required"
+)
+
+func (m MissingMetadata) validate() error {
+	switch m {
+	case MetadataEmpty, MetadataNull, MetadataRequired:
+		return nil
+	}
+	return fmt.Errorf("unsupported missing metadata handling %q", m)
+}
+
+// indexRow holds the values written for a single document.
+type indexRow struct {
+	id        string
+	content   any // text, JSON text or bytes, depending on the content type
+	embedding pgvector.Vector
+	metadata  map[string]any // nil to write NULL
+	columns   []any          // values of the metadata columns, in config order
+	// contentHash is the value of [Config.ContentHashColumn], if set.
+	contentHash string
+	// columnEmbeddings are the embeddings of the columns of
+	// [Config.ColumnEmbedders], in config order.
+	columnEmbeddings []pgvector.Vector
+}
+
+// Index embeds the documents and writes them to the table in batches of
+// [Config.IndexBatchSize].
+func (ds *docStore) Index(ctx context.Context, req *ai.IndexerRequest) (err error) {
+	if len(req.Documents) == 0 {
+		return nil
+	}
+	ctx, span := ds.startSpan(ctx, "postgresql.index",
+		attribute.Int("postgresql.document_count", len(req.Documents)),
+		attribute.Int("postgresql.batch_size", ds.config.IndexBatchSize))
+	defer func() { endSpan(span, err) }()
+	_, err = ds.index(ctx, req.Documents, ds.engine.querier())
+	return err
+}
+
+// IndexDocuments embeds docs and writes them to the table described by cfg,
+// like the indexer defined with cfg, and returns the ID and status of each
+// document, in the order of docs. On failure, it returns the results of the
+// documents committed before the failing batch along with the error. With
+// [IndexBestEffort], an [*IndexFailures] error comes with the results of
+// all the documents, those not written having the status [IndexFailed].
+func (pgEngine *PostgresEngine) IndexDocuments(ctx context.Context, cfg *Config, docs []*ai.Document) (results []IndexResult, err error) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+	ds, err := newEngineDocStore(ctx, *pgEngine, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.IndexDocuments: %w", err)
+	}
+	ctx, span := ds.startSpan(ctx, "postgresql.index",
+		attribute.Int("postgresql.document_count", len(docs)),
+		attribute.Int("postgresql.batch_size", ds.config.IndexBatchSize))
+	defer func() { endSpan(span, err) }()
+	return ds.index(ctx, docs, pgEngine.querier())
+}
+
+// IndexTx embeds docs and writes them to the table described by cfg, like the
+// indexer defined with cfg, within tx, and returns the results as
+// [PostgresEngine.IndexDocuments] does. This lets the caller write other rows
+// in the same transaction. IndexTx neither commits nor rolls back tx; if it
+// fails, tx is usually aborted and must be rolled back. The
+// [IndexError.Committed] count of its errors refers to statements run in tx.
+func (pgEngine *PostgresEngine) IndexTx(ctx context.Context, tx pgx.Tx, cfg *Config, docs []*ai.Document) (results []IndexResult, err error) {
+	if tx == nil {
+		return nil, errors.New("postgres.IndexTx: transaction is required")
+	}
+	if len(docs) == 0 {
+		return nil, nil
+	}
+	ds, err := newEngineDocStore(ctx, *pgEngine, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.IndexTx: %w", err)
+	}
+	if ds.config.IndexErrors == IndexBestEffort {
+		return nil, errors.New("postgres.IndexTx: best-effort indexing is not supported in a transaction")
+	}
+	ctx, span := ds.startSpan(ctx, "postgresql.index",
+		attribute.Int("postgresql.document_count", len(docs)),
+		attribute.Int("postgresql.batch_size", ds.config.IndexBatchSize))
+	defer func() { endSpan(span, err) }()
+	return ds.index(ctx, docs, pgEngine.commented(poolQuerier{tx}))
+}
+
+// index embeds docs and writes them in batches with q. It returns the
+// results of the documents written, which on failure are those of the
+// batches before the failing one, or with [IndexBestEffort] those
+// described by writeBestEffort.
+func (ds *docStore) index(ctx context.Context, docs []*ai.Document, q querier) ([]IndexResult, error) {
+	return ds.indexTimed(ctx, docs, q, nil)
+}
+
+// indexTiming accumulates the time an index request spends embedding and
+// writing documents.
+type indexTiming struct {
+	embed, write time.Duration
+}
+
+// indexTimed is like index, and adds its embedding and writing time to
+// timing, if not nil.
+func (ds *docStore) indexTimed(ctx context.Context, docs []*ai.Document, q querier, timing *indexTiming) (results []IndexResult, err error) {
+	if timing == nil {
+		timing = &indexTiming{}
+	}
+	if err := ds.engine.checkWrite("index documents"); err != nil {
+		return nil, fmt.Errorf("postgres.Index: %w", err)
+	}
+	start := time.Now()
+	ctx, cancel := ds.engine.withFallbackTimeout(ctx)
+	defer cancel()
+	defer func() {
+		ds.recordRequest(ctx, "index", writtenCount(results), err)
+		ds.logSlowRequest(ctx, "index", start, err, "documents", len(docs))
+	}()
+	// Reject invalid metadata and content the table cannot store before
+	// paying for embeddings.
+	var b *bestEffortIndex
+	if ds.config.IndexErrors == IndexBestEffort {
+		b = &bestEffortIndex{total: len(docs)}
+		if docs = ds.checkDocuments(docs, b); len(docs) == 0 {
+			return ds.writeBestEffort(ctx, q, "", nil, b)
+		}
+	} else {
+		if docs, err = ds.limitContent(docs); err != nil {
+			return nil, fmt.Errorf("postgres.Index: %w", err)
+		}
+		if err := ds.checkMetadata(docs); err != nil {
+			return nil, fmt.Errorf("postgres.Index: %w", err)
+		}
+		for i, doc := range docs {
+			if err := ds.checkContentParts(doc); err != nil {
+				return nil, fmt.Errorf("postgres.Index: document %d: %w", i, err)
+			}
+		}
+	}
+	var stored [][]float32
+	if ds.config.ContentHashColumn != "" {
+		var same []bool
+		if stored, same, err = ds.unchangedRows(ctx, q, docs); err != nil {
+			return nil, fmt.Errorf("postgres.Index: %w", err)
+		}
+		unchanged := make(map[int]bool)
+		for i, ok := range same {
+			if !ok {
+				continue
+			}
+			if b != nil {
+				unchanged[b.pos[i]] = true
+			} else {
+				unchanged[i] = true
+			}
+		}
+		defer func() {
+			markUnchanged(results, unchanged)
+			trace.SpanFromContext(ctx).SetAttributes(attribute.Int("postgresql.unchanged_count", len(unchanged)))
+		}()
+	}
+	embedStart := time.Now()
+	embeddings, err := ds.embedDocumentsReusing(ctx, docs, stored)
+	timing.embed += time.Since(embedStart)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.Index: %w", err)
+	}
+
+	dim, err := ds.embeddingDimension(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.Index: %w", err)
+	}
+	var rows []indexRow
+	if b != nil {
+		docs, rows = ds.newIndexRowsBestEffort(docs, embeddings, dim, b)
+	} else if rows, err = ds.newIndexRows(docs, embeddings, dim, 0); err != nil {
+		return nil, fmt.Errorf("postgres.Index: %w", err)
+	}
+	embedStart = time.Now()
+	err = ds.embedColumns(ctx, docs, rows, 0)
+	timing.embed += time.Since(embedStart)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.Index: %w", err)
+	}
+	if err := ds.storeContent(ctx, docs, rows, 0); err != nil {
+		return nil, fmt.Errorf("postgres.Index: %w", err)
+	}
+
+	query := ds.buildInsertQuery()
+	writeStart := time.Now()
+	defer func() { timing.write += time.Since(writeStart) }()
+	if b != nil {
+		return ds.writeBestEffort(ctx, q, query, rows, b)
+	}
+	results = make([]IndexResult, len(rows))
+	for start := 0; start < len(rows); start += ds.config.IndexBatchSize {
+		end := min(start+ds.config.IndexBatchSize, len(rows))
+		if err := ds.writeBatch(ctx, q, query, rows[start:end], results[start:end], start); err != nil {
+			return results[:start], err
+		}
+	}
+	return results, nil
+}
+
+// writeBatch writes rows in a single round trip, recording the outcome of
+// each in results. offset is the position of the first row in the indexer
+// request, used for error reporting.
+func (ds *docStore) writeBatch(ctx context.Context, q querier, query string, rows []indexRow, results []IndexResult, offset int) error {
+	argLists := make([][]any, len(rows))
+	for i, r := range rows {
+		argLists[i] = ds.insertArgs(r)
+	}
+	scan := func(i int, row pgx.Row) error {
+		status, id, err := scanIndexStatus(row, ds.customConflict())
+		results[i] = IndexResult{ID: cmp.Or(id, rows[i].id), Status: status}
+		return err
+	}
+	qctx, cancel := ds.engine.withQueryTimeout(ctx)
+	defer cancel()
+	if i, err := q.QueryBatch(qctx, query, argLists, scan); err != nil {
+		if i == len(rows) {
+			i = 0
+		}
+		return &IndexError{Index: offset + i, Committed: offset, Err: queryTimeoutError(qctx, describeQueryError(err, ds.config))}
+	}
 	return nil
 }
+
+// writtenCount returns the number of results whose row was written.
+func writtenCount(results []IndexResult) int {
+	n := 0
+	for _, r := range results {
+		if r.Status == IndexInserted || r.Status == IndexUpdated {
+			n++
+		}
+	}
+	return n
+}
+
+// scanIndexStatus reads the status of a row from the RETURNING clause of the
+// insert statement, which returns no row for a skipped conflict. With
+// withID, the clause also returns the id of the row written.
+func scanIndexStatus(row pgx.Row, withID bool) (IndexStatus, string, error) {
+	var inserted bool
+	var id string
+	dest := []any{&inserted}
+	if withID {
+		dest = append(dest, &id)
+	}
+	switch err := row.Scan(dest...); {
+	case errors.Is(err, pgx.ErrNoRows):
+		return IndexSkipped, "", nil
+	case err != nil:
+		return "", "", err
+	case inserted:
+		return IndexInserted, id, nil
+	default:
+		return IndexUpdated, id, nil
+	}
+}
+
+// embeddingDimension returns the declared dimension of the embedding column,
+// or -1 if it has none. It is read from the database once per docStore.
+func (ds *docStore) embeddingDimension(ctx context.Context) (int, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if ds.dimension != 0 {
+		return ds.dimension, nil
+	}
+	dim, ok, err := ds.engine.columnDimension(ctx, ds.config.SchemaName, ds.config.TableName, ds.config.EmbeddingColumn)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the dimension of column %q: %w", ds.config.EmbeddingColumn, err)
+	}
+	if !ok || dim <= 0 {
+		dim = -1
+	}
+	ds.dimension = dim
+	return dim, nil
+}
+
+// columnDimension returns the declared dimension of an embedding column of
+// the table, or -1 if it has none, like embeddingDimension, which it calls
+// for the embedding column.
+func (ds *docStore) columnDimension(ctx context.Context, column string) (int, error) {
+	if column == ds.config.EmbeddingColumn {
+		return ds.embeddingDimension(ctx)
+	}
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if dim, ok := ds.columnDimensions[column]; ok {
+		return dim, nil
+	}
+	dim, ok, err := ds.engine.columnDimension(ctx, ds.config.SchemaName, ds.config.TableName, column)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the dimension of column %q: %w", column, err)
+	}
+	if !ok || dim <= 0 {
+		dim = -1
+	}
+	if ds.columnDimensions == nil {
+		ds.columnDimensions = make(map[string]int)
+	}
+	ds.columnDimensions[column] = dim
+	return dim, nil
+}
+
+// newIndexRows extracts the values to write for docs, checking that their
+// embeddings have dimension dim if it is positive. offset is the position of
+// the first document in the request, used for error reporting.
+func (ds *docStore) newIndexRows(docs []*ai.Document, embeddings [][]float32, dim, offset int) ([]indexRow, error) {
+	rows := make([]indexRow, len(docs))
+	for i, doc := range docs {
+		var err error
+		rows[i], err = ds.newIndexRow(doc, embeddings[i])
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", offset+i, err)
+		}
+		if n := len(rows[i].embedding.Slice()); dim > 0 && n != dim {
+			return nil, fmt.Errorf("document %d (id %q): %w: embedding has %d dimensions, but column %q expects %d",
+				offset+i, rows[i].id, ErrDimensionMismatch, n, ds.config.EmbeddingColumn, dim)
+		}
+	}
+	return rows, nil
+}
+
+// newIndexRow extracts the values to write for doc.
+func (ds *docStore) newIndexRow(doc *ai.Document, embedding []float32) (indexRow, error) {
+	metadata := maps.Clone(doc.Metadata)
+	if metadata == nil {
+		metadata = make(map[string]any)
+	}
+	// A precomputed embedding is written to the embedding column only.
+	delete(metadata, EmbeddingMetadataKey)
+	id, err := ds.rowID(doc)
+	if err != nil {
+		return indexRow{}, err
+	}
+	_, hasID := metadata[ds.config.IDColumn]
+	missing := len(metadata) == 0 || len(metadata) == 1 && hasID
+	delete(metadata, ds.config.IDColumn)
+	if missing {
+		switch ds.config.MissingMetadata {
+		case MetadataRequired:
+			return indexRow{}, fmt.Errorf("id %q: document has no metadata", id)
+		case MetadataNull:
+			metadata = nil
+		}
+	}
+
+	embedding, err = ds.sanitize(id, embedding)
+	if err == nil {
+		embedding, err = ds.normalize(embedding)
+	}
+	if err != nil {
+		return indexRow{}, fmt.Errorf("id %q: %w", id, err)
+	}
+	vec, err := newVector(embedding)
+	if err != nil {
+		return indexRow{}, fmt.Errorf("id %q: %w", id, err)
+	}
+
+	content, err := ds.contentValue(doc)
+	if err != nil {
+		return indexRow{}, fmt.Errorf("id %q: %w", id, err)
+	}
+
+	columns := make([]any, len(ds.config.MetadataColumns))
+	for i, col := range ds.config.MetadataColumns {
+		columns[i] = metadata[col]
+		delete(metadata, col)
+	}
+
+	var hash string
+	if ds.config.ContentHashColumn != "" {
+		if hash, err = contentHash(doc); err != nil {
+			return indexRow{}, fmt.Errorf("id %q: %w", id, err)
+		}
+	}
+
+	return indexRow{
+		id:          id,
+		content:     content,
+		embedding:   vec,
+		metadata:    metadata,
+		columns:     columns,
+		contentHash: hash,
+	}, nil
+}
+
+// rowID returns the id of the row of doc: the id in its metadata, or else
+// the id generated for it.
+func (ds *docStore) rowID(doc *ai.Document) (string, error) {
+	if id, _ := doc.Metadata[ds.config.IDColumn].(string); id != "" {
+		return id, nil
+	}
+	return ds.generateID(doc)
+}
+
+// documentText returns the concatenated text of the parts of doc.
+func documentText(doc *ai.Document) string {
+	var sb strings.Builder
+	for _, p := range doc.Content {
+		sb.WriteString(p.Text)
+	}
+	return sb.String()
+}
+
+// generateID returns the id of a document that has no explicit ID, computed
+// by [Config.IDGenerator] if set, or else from its content alone with
+// [WithDeterministicIDs].
+func (ds *docStore) generateID(doc *ai.Document) (string, error) {
+	if ds.config.IDGenerator == nil {
+		if ds.engine.config.contentIDs {
+			return contentID(doc)
+		}
+		return docID(doc)
+	}
+	id, err := ds.config.IDGenerator(doc)
+	if err != nil {
+		return "", fmt.Errorf("id generator: %w", err)
+	}
+	if id == "" {
+		return "", errors.New("id generator returned an empty id")
+	}
+	return id, nil
+}
+
+// docID returns a deterministic UUID for a document that has no explicit
+// ID, derived from its content and metadata, so that indexing the same
+// document twice targets the same row.
+func docID(doc *ai.Document) (string, error) {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling document: %w", err)
+	}
+	return uuid.NewSHA1(uuid.NameSpaceOID, b).String(), nil
+}
+
+// contentID returns a deterministic UUID for a document that has no
+// explicit ID, derived from its content only.
+func contentID(doc *ai.Document) (string, error) {
+	b, err := json.Marshal(doc.Content)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling document content: %w", err)
+	}
+	return uuid.NewSHA1(uuid.NameSpaceOID, b).String(), nil
+}
+
+// insertColumns returns the columns written for each row, in the order of
+// the arguments returned by insertArgs. The columns of
+// [Config.ColumnEmbedders] come last.
+func (ds *docStore) insertColumns() []string {
+	cols := []string{ds.config.IDColumn, ds.config.ContentColumn, ds.config.EmbeddingColumn}
+	if ds.config.MetadataJSONColumn != "" {
+		cols = append(cols, ds.config.MetadataJSONColumn)
+	}
+	cols = append(cols, ds.config.MetadataColumns...)
+	if ds.config.ContentHashColumn != "" {
+		cols = append(cols, ds.config.ContentHashColumn)
+	}
+	for _, ce := range ds.config.ColumnEmbedders {
+		cols = append(cols, ce.Column)
+	}
+	return cols
+}
+
+// buildInsertQuery returns the statement used to write a single row.
+// Rows whose ID, or [Config.ConflictColumns], already exist are updated if
+// [Config.Overwrite] is set, which also restores them if soft-deleted, and
+// left untouched otherwise. The statement
+// returns whether the row was inserted, as xmax is zero only for a row
+// version that no other transaction has locked or updated, and no row when
+// it was left untouched. With conflict columns, it also returns the id of
+// the row, which an update keeps. The columns of [WithCreatedAtColumn] and
+// [WithUpdatedAtColumn] are set to now() on insert and update respectively.
+func (ds *docStore) buildInsertQuery() string {
+	cols := ds.insertColumns()
+	quoted := make([]string, len(cols))
+	params := make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = fmt.Sprintf(`"%s"`, col)
+		params[i] = fmt.Sprintf("$%d", i+1)
+	}
+	params[2] = ds.engine.vectorType().cast(params[2])
+	for i := len(cols) - len(ds.config.ColumnEmbedders); i < len(cols); i++ {
+		params[i] = ds.engine.vectorType().cast(params[i])
+	}
+	if col := ds.engine.config.createdAtColumn; col != "" {
+		quoted = append(quoted, fmt.Sprintf(`"%s"`, col))
+		params = append(params, "now()")
+	}
+	conflict := ds.conflictColumns()
+	target := make([]string, len(conflict))
+	for i, col := range conflict {
+		target[i] = fmt.Sprintf(`"%s"`, col)
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s)`,
+		qualifiedName(ds.config.SchemaName, ds.config.TableName), strings.Join(quoted, ", "), strings.Join(params, ", "), strings.Join(target, ", "))
+	returning := " RETURNING (xmax = 0)"
+	if ds.customConflict() {
+		returning += fmt.Sprintf(`, "%s"::text`, ds.config.IDColumn)
+	}
+	if !ds.config.Overwrite {
+		return query + " DO NOTHING" + returning
+	}
+	updates := make([]string, 0, len(cols)-1)
+	for i, col := range cols {
+		if col == ds.config.IDColumn || slices.Contains(conflict, col) {
+			continue
+		}
+		updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", quoted[i], quoted[i]))
+	}
+	if col := ds.engine.config.softDeleteColumn; col != "" {
+		updates = append(updates, fmt.Sprintf(`"%s" = NULL`, col))
+	}
+	if col := ds.engine.config.updatedAtColumn; col != "" {
+		updates = append(updates, fmt.Sprintf(`"%s" = now()`, col))
+	}
+	query += " DO UPDATE SET " + strings.Join(updates, ", ")
+	if col := ds.config.ContentHashColumn; col != "" {
+		// Rows that hold the document already are left untouched.
+		table := qualifiedName(ds.config.SchemaName, ds.config.TableName)
+		query += fmt.Sprintf(` WHERE %s."%s" IS DISTINCT FROM EXCLUDED."%s"`, table, col, col)
+		if sd := ds.engine.config.softDeleteColumn; sd != "" {
+			query += fmt.Sprintf(` OR %s."%s" IS NOT NULL`, table, sd)
+		}
+	}
+	return query + returning
+}
+
+// insertArgs returns the arguments of the insert statement for r.
+func (ds *docStore) insertArgs(r indexRow) []any {
+	args := []any{r.id, r.content, ds.engine.vectorArg(r.embedding)}
+	if ds.config.MetadataJSONColumn != "" {
+		if r.metadata == nil {
+			args = append(args, nil)
+		} else {
+			args = append(args, r.metadata)
+		}
+	}
+	args = append(args, r.columns...)
+	if ds.config.ContentHashColumn != "" {
+		args = append(args, r.contentHash)
+	}
+	for _, vec := range r.columnEmbeddings {
+		args = append(args, ds.engine.vectorArg(vec))
+	}
+	return args
+}
@@ -0,0 +1,360 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pgvector/pgvector-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildInsertQuery(t *testing.T) {
+	ds := testDocStore()
+	assert.Equal(t, `INSERT INTO "public"."documents" ("id", "content", "embedding", "metadata", "source") VALUES ($1, $2, $3, $4, $5)`+
+		` ON CONFLICT ("id") DO NOTHING RETURNING (xmax = 0)`,
+		ds.buildInsertQuery())
+
+	ds.config.Overwrite = true
+	assert.Equal(t, `INSERT INTO "public"."documents" ("id", "content", "embedding", "metadata", "source") VALUES ($1, $2, $3, $4, $5)`+
+		` ON CONFLICT ("id") DO UPDATE SET "content" = EXCLUDED."content", "embedding" = EXCLUDED."embedding",`+
+		` "metadata" = EXCLUDED."metadata", "source" = EXCLUDED."source" RETURNING (xmax = 0)`,
+		ds.buildInsertQuery())
+
+	// Overwriting a soft-deleted document restores it.
+	ds.engine.config.softDeleteColumn = "deleted_at"
+	assert.Equal(t, `INSERT INTO "public"."documents" ("id", "content", "embedding", "metadata", "source") VALUES ($1, $2, $3, $4, $5)`+
+		` ON CONFLICT ("id") DO UPDATE SET "content" = EXCLUDED."content", "embedding" = EXCLUDED."embedding",`+
+		` "metadata" = EXCLUDED."metadata", "source" = EXCLUDED."source", "deleted_at" = NULL RETURNING (xmax = 0)`,
+		ds.buildInsertQuery())
+}
+
+func TestBuildInsertQueryTimestamps(t *testing.T) {
+	ds := testDocStore()
+	ds.engine.config.createdAtColumn = "created_at"
+	ds.engine.config.updatedAtColumn = "updated_at"
+	assert.Equal(t, `INSERT INTO "public"."documents" ("id", "content", "embedding", "metadata", "source", "created_at") VALUES ($1, $2, $3, $4, $5, now())`+
+		` ON CONFLICT ("id") DO NOTHING RETURNING (xmax = 0)`,
+		ds.buildInsertQuery())
+
+	// Updates keep the creation time.
+	ds.config.Overwrite = true
+	assert.Equal(t, `INSERT INTO "public"."documents" ("id", "content", "embedding", "metadata", "source", "created_at") VALUES ($1, $2, $3, $4, $5, now())`+
+		` ON CONFLICT ("id") DO UPDATE SET "content" = EXCLUDED."content", "embedding" = EXCLUDED."embedding",`+
+		` "metadata" = EXCLUDED."metadata", "source" = EXCLUDED."source", "updated_at" = now() RETURNING (xmax = 0)`,
+		ds.buildInsertQuery())
+	assert.Len(t, ds.insertColumns(), 5)
+}
+
+func TestTimestampColumns(t *testing.T) {
+	pool := WithPool(&pgxpool.Pool{})
+	cfg, err := applyEngineOptions([]Option{pool, WithDatabase("testdb"), WithCreatedAtColumn("created_at"), WithUpdatedAtColumn("updated_at")})
+	assert.NoError(t, err)
+	assert.Equal(t, "created_at", cfg.createdAtColumn)
+	assert.Equal(t, "updated_at", cfg.updatedAtColumn)
+
+	for _, opts := range [][]Option{
+		{pool, WithDatabase("testdb"), WithCreatedAtColumn(`created_at"; --`)},
+		{pool, WithDatabase("testdb"), WithCreatedAtColumn("ts"), WithUpdatedAtColumn("ts")},
+		{pool, WithDatabase("testdb"), WithCreatedAtColumn("deleted_at"), WithSoftDelete("deleted_at")},
+		{pool, WithDatabase("testdb"), WithUpdatedAtColumn("expires_at"), WithExpiryColumn("expires_at")},
+	} {
+		_, err := applyEngineOptions(opts)
+		assert.Error(t, err)
+	}
+}
+
+func TestBuildInsertQueryColumnEmbedders(t *testing.T) {
+	ds := testDocStore()
+	ds.engine.config.vectorType = HalfVec
+	ds.config.ColumnEmbedders = []ColumnEmbedder{{Column: "embedding_b", Embedder: &fakeEmbedder{}}}
+	assert.Equal(t, `INSERT INTO "public"."documents" ("id", "content", "embedding", "metadata", "source", "embedding_b") VALUES ($1, $2, $3::halfvec, $4, $5, $6::halfvec)`+
+		` ON CONFLICT ("id") DO NOTHING RETURNING (xmax = 0)`,
+		ds.buildInsertQuery())
+
+	vec := pgvector.NewVector([]float32{1, 2})
+	args := ds.insertArgs(indexRow{id: "a", content: "text", embedding: vec, metadata: map[string]any{}, columns: []any{"web"},
+		columnEmbeddings: []pgvector.Vector{pgvector.NewVector([]float32{3})}})
+	assert.Equal(t, []any{"a", "text", vec, map[string]any{}, "web", pgvector.NewVector([]float32{3})}, args)
+}
+
+func TestValidateColumnEmbedders(t *testing.T) {
+	ds := testDocStore()
+	ds.vectorColumns = map[string]bool{"embedding": true, "embedding_b": true}
+	ds.config.ColumnEmbedders = []ColumnEmbedder{{Column: "embedding_b", Embedder: &fakeEmbedder{}}}
+	assert.NoError(t, ds.validateColumnEmbedders())
+
+	for _, ces := range [][]ColumnEmbedder{
+		{{Column: "embedding", Embedder: &fakeEmbedder{}}},
+		{{Column: "source", Embedder: &fakeEmbedder{}}},
+		{{Column: "embedding_b"}},
+		{{Column: "embedding_b", Embedder: &fakeEmbedder{}}, {Column: "embedding_b", Embedder: &fakeEmbedder{}}},
+	} {
+		ds.config.ColumnEmbedders = ces
+		assert.Error(t, ds.validateColumnEmbedders(), "%+v", ces)
+	}
+}
+
+func TestNewIndexRow(t *testing.T) {
+	ds := testDocStore()
+	doc := &ai.Document{
+		Content: []*ai.Part{ai.NewTextPart("hello "), ai.NewTextPart("world")},
+		Metadata: map[string]any{
+			"id":     "doc-1",
+			"source": "wiki",
+			"year":   2024,
+		},
+	}
+	r, err := ds.newIndexRow(doc, []float32{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, "doc-1", r.id)
+	assert.Equal(t, "hello world", r.content)
+	assert.Equal(t, map[string]any{"year": 2024}, r.metadata)
+	assert.Equal(t, []any{"wiki"}, r.columns)
+	// The document metadata is not modified.
+	assert.Len(t, doc.Metadata, 3)
+
+	r, err = ds.newIndexRow(ai.DocumentFromText("no id", nil), []float32{1, 2})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, r.id)
+	assert.Len(t, ds.insertArgs(r), 5)
+
+	// Generated IDs are deterministic.
+	again, err := ds.newIndexRow(ai.DocumentFromText("no id", nil), []float32{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, r.id, again.id)
+	other, err := ds.newIndexRow(ai.DocumentFromText("other", nil), []float32{1, 2})
+	assert.NoError(t, err)
+	assert.NotEqual(t, r.id, other.id)
+}
+
+func TestNewIndexRowIDGenerator(t *testing.T) {
+	ds := testDocStore()
+	ds.config.IDGenerator = func(doc *ai.Document) (string, error) {
+		tenant, _ := doc.Metadata["tenant"].(string)
+		uri, _ := doc.Metadata["uri"].(string)
+		if tenant == "" {
+			return "", errors.New("missing tenant")
+		}
+		if uri == "" {
+			return "", nil
+		}
+		return tenant + "/" + uri, nil
+	}
+
+	r, err := ds.newIndexRow(ai.DocumentFromText("a", map[string]any{"tenant": "acme", "uri": "gs://b/a.txt"}), []float32{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, "acme/gs://b/a.txt", r.id)
+
+	// An explicit ID takes precedence.
+	r, err = ds.newIndexRow(ai.DocumentFromText("a", map[string]any{"id": "doc-1"}), []float32{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, "doc-1", r.id)
+
+	_, err = ds.newIndexRows([]*ai.Document{ai.DocumentFromText("a", nil)}, [][]float32{{1, 2}}, 2, 0)
+	assert.ErrorContains(t, err, "missing tenant")
+	_, err = ds.newIndexRow(ai.DocumentFromText("a", map[string]any{"tenant": "acme"}), []float32{1, 2})
+	assert.Error(t, err)
+}
+
+func TestNewIndexRowDeterministicIDs(t *testing.T) {
+	ds := testDocStore()
+	withMetadata := ai.DocumentFromText("same content", map[string]any{"delivered_at": "2024-05-01T10:00:00Z"})
+	retried := ai.DocumentFromText("same content", map[string]any{"delivered_at": "2024-05-01T10:05:00Z"})
+
+	// By default, the metadata are part of the generated id.
+	r, err := ds.newIndexRow(withMetadata, []float32{1, 2})
+	assert.NoError(t, err)
+	again, err := ds.newIndexRow(retried, []float32{1, 2})
+	assert.NoError(t, err)
+	assert.NotEqual(t, r.id, again.id)
+
+	ds.engine.config.contentIDs = true
+	r, err = ds.newIndexRow(withMetadata, []float32{1, 2})
+	assert.NoError(t, err)
+	again, err = ds.newIndexRow(retried, []float32{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, r.id, again.id)
+	other, err := ds.newIndexRow(ai.DocumentFromText("other content", nil), []float32{1, 2})
+	assert.NoError(t, err)
+	assert.NotEqual(t, r.id, other.id)
+
+	// The id generator takes precedence.
+	ds.config.IDGenerator = func(doc *ai.Document) (string, error) { return "generated", nil }
+	r, err = ds.newIndexRow(withMetadata, []float32{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, "generated", r.id)
+}
+
+func TestIndexError(t *testing.T) {
+	cause := errors.New("duplicate key")
+	var err error = &IndexError{Index: 120, Committed: 100, Err: cause}
+	assert.ErrorIs(t, err, cause)
+	var ie *IndexError
+	assert.True(t, errors.As(err, &ie))
+	assert.Equal(t, 120, ie.Index)
+}
+
+func TestIndexDimensionMismatch(t *testing.T) {
+	ds := testDocStore()
+	ds.config.Embedder = &fakeEmbedder{}
+	ds.config.IndexBatchSize = 100
+	ds.dimension = 3 // as read from vector(3)
+
+	docs := testDocuments("1", "2")
+	docs[0].Metadata = map[string]any{"id": "doc-1"}
+	err := ds.Index(context.Background(), &ai.IndexerRequest{Documents: docs})
+	assert.ErrorContains(t, err, `document 0 (id "doc-1")`)
+	assert.ErrorContains(t, err, `embedding has 1 dimensions, but column "embedding" expects 3`)
+}
+
+func TestIndexRejectsMediaInTextContent(t *testing.T) {
+	ds := testDocStore()
+	embedder := &fakeEmbedder{}
+	ds.config.Embedder = embedder
+	ds.contentType = TextContent
+
+	docs := testDocuments("1")
+	docs[0].Content = append(docs[0].Content, ai.NewMediaPart("image/png", "https://example.com/a.png"))
+	err := ds.Index(context.Background(), &ai.IndexerRequest{Documents: docs})
+	assert.ErrorContains(t, err, "document 0: content part 1 is a media part")
+	assert.Zero(t, embedder.calls)
+}
+
+// fakeTx is a transaction that records the batches sent on it.
+type fakeTx struct {
+	pgx.Tx
+	batches []*pgx.Batch
+}
+
+func (tx *fakeTx) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	tx.batches = append(tx.batches, b)
+	return fakeBatchResults{}
+}
+
+type fakeBatchResults struct {
+	pgx.BatchResults
+}
+
+func (fakeBatchResults) QueryRow() pgx.Row {
+	return fakeRow{value: true}
+}
+func (fakeBatchResults) Close() error { return nil }
+
+func TestIndexInTransaction(t *testing.T) {
+	ds := testDocStore()
+	ds.config.Embedder = &fakeEmbedder{}
+	ds.config.IndexBatchSize = 2
+	ds.dimension = 1
+
+	tx := &fakeTx{}
+	results, err := ds.index(context.Background(), testDocuments("1", "2", "3"), poolQuerier{tx})
+	assert.NoError(t, err)
+	if assert.Len(t, tx.batches, 2) {
+		assert.Equal(t, 2, tx.batches[0].Len())
+		assert.Equal(t, 1, tx.batches[1].Len())
+	}
+	if assert.Len(t, results, 3) {
+		for _, r := range results {
+			assert.NotEmpty(t, r.ID)
+			assert.Equal(t, IndexInserted, r.Status)
+		}
+	}
+
+	pgEngine := &PostgresEngine{}
+	_, err = pgEngine.IndexTx(context.Background(), nil, ds.config, testDocuments("1"))
+	assert.Error(t, err)
+}
+
+// fakeRow scans an insert status and, if id is set, an id, or returns err.
+type fakeRow struct {
+	value any
+	id    string
+	err   error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*bool) = r.value.(bool)
+	if len(dest) > 1 {
+		*dest[1].(*string) = r.id
+	}
+	return nil
+}
+
+func TestScanIndexStatus(t *testing.T) {
+	status, _, err := scanIndexStatus(fakeRow{value: true}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, IndexInserted, status)
+
+	status, id, err := scanIndexStatus(fakeRow{value: false, id: "existing"}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, IndexUpdated, status)
+	assert.Equal(t, "existing", id)
+
+	status, _, err = scanIndexStatus(fakeRow{err: pgx.ErrNoRows}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, IndexSkipped, status)
+
+	_, _, err = scanIndexStatus(fakeRow{err: errors.New("boom")}, false)
+	assert.Error(t, err)
+}
+
+func TestBuildInsertQueryConflictColumns(t *testing.T) {
+	ds := testDocStore()
+	ds.config.MetadataColumns = []string{"tenant_id", "external_id"}
+	ds.config.ConflictColumns = []string{"tenant_id", "external_id"}
+	ds.config.Overwrite = true
+	assert.Equal(t, `INSERT INTO "public"."documents" ("id", "content", "embedding", "metadata", "tenant_id", "external_id") VALUES ($1, $2, $3, $4, $5, $6)`+
+		` ON CONFLICT ("tenant_id", "external_id") DO UPDATE SET "content" = EXCLUDED."content", "embedding" = EXCLUDED."embedding",`+
+		` "metadata" = EXCLUDED."metadata" RETURNING (xmax = 0), "id"::text`,
+		ds.buildInsertQuery())
+
+	ds.config.ConflictColumns = []string{"id"}
+	assert.False(t, ds.customConflict())
+}
+
+func TestValidateConflictColumns(t *testing.T) {
+	ds := testDocStore()
+	ds.config.ConflictColumns = []string{"tenant_id", "external_id"}
+	assert.ErrorContains(t, ds.validateConflictColumns(context.Background()), "must be the id column or one of the metadata columns")
+
+	indexes := [][]string{{"id"}, {"external_id", "tenant_id"}}
+	assert.True(t, hasUniqueIndex(indexes, []string{"tenant_id", "external_id"}))
+	assert.False(t, hasUniqueIndex(indexes, []string{"tenant_id"}))
+	assert.False(t, hasUniqueIndex(indexes, []string{"tenant_id", "external_id", "id"}))
+}
+
+func TestNewIndexRowMissingMetadata(t *testing.T) {
+	ds := testDocStore()
+	doc := &ai.Document{
+		Content:  []*ai.Part{ai.NewTextPart("hello")},
+		Metadata: map[string]any{"id": "doc-1"},
+	}
+
+	r, err := ds.newIndexRow(doc, []float32{1})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{}, r.metadata)
+
+	ds.config.MissingMetadata = MetadataNull
+	r, err = ds.newIndexRow(doc, []float32{1})
+	assert.NoError(t, err)
+	assert.Nil(t, r.metadata)
+	assert.Nil(t, ds.insertArgs(r)[3])
+
+	ds.config.MissingMetadata = MetadataRequired
+	_, err = ds.newIndexRow(doc, []float32{1})
+	assert.Error(t, err)
+
+	doc.Metadata["source"] = "wiki"
+	r, err = ds.newIndexRow(doc, []float32{1})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{}, r.metadata)
+
+	assert.Error(t, MissingMetadata("drop").validate())
+}
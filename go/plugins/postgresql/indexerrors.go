@@ -0,0 +1,201 @@
+package postgresql
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// IndexErrorMode is the handling by the indexer of the documents it cannot
+// write. See [Config.IndexErrors].
+type IndexErrorMode string
+
+const (
+	// IndexFailFast fails the index request at the first document that
+	// cannot be written, with an [*IndexError] if its batch was rejected by
+	// the database. Documents are checked before any is embedded, so that
+	// an invalid document fails the request before any is written; batches
+	// written before a rejected one stay committed.
+	IndexFailFast IndexErrorMode = "fail-fast"
+	// IndexBestEffort writes the documents that can be, and fails the index
+	// request with an [*IndexFailures] listing the others. Documents that
+	// fail the checks of the indexer, such as against the schema of
+	// [WithMetadataSchema] or the dimension of the embedding column, are
+	// left out, and the documents of a batch rejected by the database are
+	// written again one by one, so that only those at fault are not
+	// written. Failures of the embedder, or of another step applying to the
+	// whole request, still fail it. It is not supported by
+	// [PostgresEngine.IndexTx], whose transaction a rejected batch aborts.
+	IndexBestEffort IndexErrorMode = "best-effort"
+)
+
+func (m IndexErrorMode) validate() error {
+	switch m {
+	case IndexFailFast, IndexBestEffort:
+		return nil
+	}
+	return fmt.Errorf("unsupported index error handling %q", m)
+}
+
+// IndexFailure is a document of a best-effort index request that was not
+// written.
+type IndexFailure struct {
+	Index int    // Position of the document in the request.
+	ID    string // ID of the document, if known.
+	Err   error  // The cause, which names the document.
+}
+
+// IndexFailures is the error of a best-effort index request of which some
+// documents were not written. The other documents were written.
+type IndexFailures struct {
+	Failures []IndexFailure // The documents not written, in request order.
+	Total    int            // Number of documents in the request.
+}
+
+// maxListedFailures is the number of failures listed in the message of an
+// [IndexFailures].
+const maxListedFailures = 3
+
+func (e *IndexFailures) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "postgres.Index: failed to write %d of %d documents: ", len(e.Failures), e.Total)
+	for i, f := range e.Failures[:min(len(e.Failures), maxListedFailures)] {
+		if i > 0 {
+			sb.WriteString("; ")
+		}
+		sb.WriteString(f.Err.Error())
+	}
+	if n := len(e.Failures) - maxListedFailures; n > 0 {
+		fmt.Fprintf(&sb, "; and %d more", n)
+	}
+	return sb.String()
+}
+
+// Unwrap returns the causes of the failures, so that [errors.Is] reports
+// whether any failure has a given cause, such as [ErrDuplicateID].
+func (e *IndexFailures) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, f := range e.Failures {
+		errs[i] = f.Err
+	}
+	return errs
+}
+
+// bestEffortIndex holds the progress of a best-effort index request.
+type bestEffortIndex struct {
+	total    int            // number of documents in the request
+	pos      []int          // positions in the request of the documents still written
+	failures []IndexFailure // documents left out so far
+}
+
+// checkDocuments applies the checks of the indexer that precede embedding to
+// docs, the documents of the request, and returns those that pass them.
+func (ds *docStore) checkDocuments(docs []*ai.Document, b *bestEffortIndex) []*ai.Document {
+	kept := make([]*ai.Document, 0, len(docs))
+	for i, doc := range docs {
+		doc, err := ds.checkDocument(doc)
+		if err != nil {
+			id, _ := docs[i].Metadata[ds.config.IDColumn].(string)
+			b.failures = append(b.failures, IndexFailure{Index: i, ID: id, Err: fmt.Errorf("document %d: %w", i, err)})
+			continue
+		}
+		kept = append(kept, doc)
+		b.pos = append(b.pos, i)
+	}
+	return kept
+}
+
+// checkDocument applies the content length limit and checks the metadata and
+// content of doc, like index.
+func (ds *docStore) checkDocument(doc *ai.Document) (*ai.Document, error) {
+	doc, err := ds.limitDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	if schema := ds.engine.config.metadataSchema; schema != nil {
+		if err := schema.check(doc.Metadata, ds.config.IDColumn); err != nil {
+			return nil, err
+		}
+	}
+	if err := ds.checkContentParts(doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// newIndexRowsBestEffort is like newIndexRows for the documents of b, and
+// returns the documents and rows of those that pass its checks.
+func (ds *docStore) newIndexRowsBestEffort(docs []*ai.Document, embeddings [][]float32, dim int, b *bestEffortIndex) ([]*ai.Document, []indexRow) {
+	keptDocs := make([]*ai.Document, 0, len(docs))
+	rows := make([]indexRow, 0, len(docs))
+	pos := make([]int, 0, len(docs))
+	for i, doc := range docs {
+		row, err := ds.newIndexRows(docs[i:i+1], embeddings[i:i+1], dim, b.pos[i])
+		if err != nil {
+			id, _ := doc.Metadata[ds.config.IDColumn].(string)
+			b.failures = append(b.failures, IndexFailure{Index: b.pos[i], ID: id, Err: err})
+			continue
+		}
+		keptDocs = append(keptDocs, doc)
+		rows = append(rows, row[0])
+		pos = append(pos, b.pos[i])
+	}
+	b.pos = pos
+	return keptDocs, rows
+}
+
+// writeBestEffort writes rows, the rows of the documents of b, in batches
+// with q. The rows of a batch the database rejects are written again one by
+// one, and those rejected again are added to the failures of b. It returns
+// the results of all the documents of the request, with [IndexFailed] for
+// those not written, and an [*IndexFailures] if there are any. If the
+// request is canceled, it returns the error, and the results of the
+// documents not yet written are zero.
+func (ds *docStore) writeBestEffort(ctx context.Context, q querier, query string, rows []indexRow, b *bestEffortIndex) ([]IndexResult, error) {
+	written := make([]IndexResult, len(rows))
+	results := func() []IndexResult {
+		results := make([]IndexResult, b.total)
+		for i, p := range b.pos {
+			results[p] = written[i]
+		}
+		for _, f := range b.failures {
+			results[f.Index] = IndexResult{ID: f.ID, Status: IndexFailed}
+		}
+		return results
+	}
+	for start := 0; start < len(rows); start += ds.config.IndexBatchSize {
+		end := min(start+ds.config.IndexBatchSize, len(rows))
+		err := ds.writeBatch(ctx, q, query, rows[start:end], written[start:end], start)
+		if err == nil {
+			continue
+		}
+		// The batch was rolled back as a whole.
+		clear(written[start:end])
+		for i := start; i < end; i++ {
+			if ctx.Err() != nil {
+				return results(), err
+			}
+			err := ds.writeBatch(ctx, q, query, rows[i:i+1], written[i:i+1], i)
+			var ie *IndexError
+			if !errors.As(err, &ie) {
+				continue
+			}
+			written[i] = IndexResult{}
+			b.failures = append(b.failures, IndexFailure{
+				Index: b.pos[i],
+				ID:    rows[i].id,
+				Err:   fmt.Errorf("document %d (id %q): %w", b.pos[i], rows[i].id, ie.Err),
+			})
+		}
+	}
+	if len(b.failures) == 0 {
+		return results(), nil
+	}
+	slices.SortFunc(b.failures, func(a, b IndexFailure) int { return cmp.Compare(a.Index, b.Index) })
+	return results(), &IndexFailures{Failures: b.failures, Total: b.total}
+}
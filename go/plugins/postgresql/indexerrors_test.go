@@ -0,0 +1,93 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+// rejectingQuerier fails the batches with an argument equal to reject as a
+// duplicate id, and writes the others.
+type rejectingQuerier struct {
+	querier
+	reject  string
+	batches []int
+}
+
+func (q *rejectingQuerier) QueryBatch(ctx context.Context, query string, argLists [][]any, scan func(i int, row pgx.Row) error) (int, error) {
+	q.batches = append(q.batches, len(argLists))
+	for i, args := range argLists {
+		if slices.Contains(args, any(q.reject)) {
+			return i, &pgconn.PgError{Code: "23505", Detail: fmt.Sprintf("Key (id)=(%s) already exists.", q.reject)}
+		}
+	}
+	for i := range argLists {
+		if err := scan(i, fakeRow{value: true}); err != nil {
+			return i, err
+		}
+	}
+	return len(argLists), nil
+}
+
+func TestIndexBestEffort(t *testing.T) {
+	ds := testDocStore()
+	ds.config.Embedder = &fakeEmbedder{}
+	ds.config.IndexBatchSize = 2
+	ds.config.IndexErrors = IndexBestEffort
+	ds.contentType = TextContent
+	ds.dimension = 1
+
+	docs := testDocuments("1", "2", "3", "4")
+	docs[1].Metadata = map[string]any{"id": "dup"}
+	docs[3].Content = append(docs[3].Content, ai.NewMediaPart("image/png", "https://example.com/a.png"))
+	q := &rejectingQuerier{reject: "dup"}
+	results, err := ds.index(context.Background(), docs, q)
+
+	var failures *IndexFailures
+	if assert.ErrorAs(t, err, &failures) {
+		assert.Equal(t, 4, failures.Total)
+		if assert.Len(t, failures.Failures, 2) {
+			assert.Equal(t, 1, failures.Failures[0].Index)
+			assert.Equal(t, "dup", failures.Failures[0].ID)
+			assert.Equal(t, 3, failures.Failures[1].Index)
+		}
+	}
+	assert.ErrorIs(t, err, ErrDuplicateID)
+	assert.ErrorContains(t, err, `failed to write 2 of 4 documents: document 1 (id "dup"):`)
+	assert.ErrorContains(t, err, "document 3: content part 1 is a media part")
+	// The rejected batch is written again one document at a time, and the
+	// invalid document is left out of the last batch.
+	assert.Equal(t, []int{2, 1, 1, 1}, q.batches)
+	var statuses []IndexStatus
+	for _, r := range results {
+		statuses = append(statuses, r.Status)
+	}
+	assert.Equal(t, []IndexStatus{IndexInserted, IndexFailed, IndexInserted, IndexFailed}, statuses)
+	assert.Equal(t, "dup", results[1].ID)
+	assert.Equal(t, 2, writtenCount(results))
+
+	// Without best effort, the first failure fails the request.
+	ds.config.IndexErrors = IndexFailFast
+	_, err = ds.index(context.Background(), docs, &rejectingQuerier{reject: "dup"})
+	assert.ErrorContains(t, err, "document 3: content part 1 is a media part")
+}
+
+func TestIndexFailuresError(t *testing.T) {
+	var failures []IndexFailure
+	for i := range 5 {
+		failures = append(failures, IndexFailure{Index: i, Err: fmt.Errorf("document %d: invalid", i)})
+	}
+	err := &IndexFailures{Failures: failures, Total: 10}
+	assert.Equal(t, "postgres.Index: failed to write 5 of 10 documents: document 0: invalid; document 1: invalid; document 2: invalid; and 2 more", err.Error())
+	assert.False(t, errors.Is(err, ErrDuplicateID))
+
+	assert.NoError(t, IndexBestEffort.validate())
+	assert.Error(t, IndexErrorMode("skip").validate())
+}
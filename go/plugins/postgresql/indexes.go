@@ -0,0 +1,457 @@
+package postgresql
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/firebase/genkit/go/core/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	defaultHNSWM              = 16
+	defaultHNSWEfConstruction = 64
+)
+
+// IndexOptions holds the options shared by the vector index helpers.
+type IndexOptions struct {
+	// Name of the index. The default is derived from the table and column names.
+	Name string
+	// SchemaName of the table. The default is the engine's schema.
+	SchemaName string
+	// EmbeddingColumn to index. The default is the engine's embedding column.
+	EmbeddingColumn string
+	// DistanceStrategy the index must serve. It determines the operator
+	// class of the index. The default is set with [WithDistanceStrategy],
+	// or [CosineDistance].
+	DistanceStrategy DistanceStrategy
+	// OperatorClass, if set, is the operator class of the index in place of
+	// the one DistanceStrategy determines, such as vector_ip_ops for a table
+	// of normalized embeddings, or a custom class, optionally qualified by
+	// its schema. A warning is logged if it differs from the class of
+	// DistanceStrategy, as retrievers with that strategy reject tables whose
+	// embedding column is only indexed with other classes.
+	OperatorClass string
+	// Concurrently builds the index without locking out writes. Such an
+	// index cannot be built inside a transaction. On a partitioned table,
+	// the index is built concurrently on each partition in turn, and
+	// attached to an index of the parent table.
+	Concurrently bool
+	// Where, if set, makes a partial index of the rows matching all of the
+	// filters, such as one index per tenant of a shared table. The keys of
+	// the filters must be columns of the table, and a Name is required.
+	// Queries use the index when their [RetrieverOptions.Filters] include
+	// the same filters. As an index definition cannot have parameters, the
+	// values are written as escaped SQL literals.
+	Where []Filter
+}
+
+// HNSWOptions configures [PostgresEngine.CreateHNSWIndex].
+type HNSWOptions struct {
+	IndexOptions
+	// M is the maximum number of connections per layer. The default is 16.
+	M int
+	// EfConstruction is the size of the candidate list used to build the
+	// graph. The default is 64.
+	EfConstruction int
+}
+
+// CreateHNSWIndex creates an HNSW index on the embedding column of a table.
+// HNSW indexes require pgvector 0.5.0 or later.
+func (pgEngine *PostgresEngine) CreateHNSWIndex(ctx context.Context, tableName string, opts HNSWOptions) error {
+	if err := pgEngine.checkDDL("create an index", true); err != nil {
+		return err
+	}
+	tableName = pgEngine.tableName(tableName)
+	if opts.M == 0 {
+		opts.M = defaultHNSWM
+	}
+	if opts.EfConstruction == 0 {
+		opts.EfConstruction = defaultHNSWEfConstruction
+	}
+	if opts.M < 2 || opts.M > 100 {
+		return fmt.Errorf("hnsw m must be between 2 and 100, got %d", opts.M)
+	}
+	if opts.EfConstruction < 2*opts.M || opts.EfConstruction > 1000 {
+		return fmt.Errorf("hnsw ef_construction must be between 2*m (%d) and 1000, got %d", 2*opts.M, opts.EfConstruction)
+	}
+	if err := pgEngine.requireVectorVersion(ctx, 0, 5, "HNSW indexes"); err != nil {
+		return err
+	}
+	where, err := pgEngine.indexWhere(ctx, tableName, &opts.IndexOptions)
+	if err != nil {
+		return err
+	}
+	with := fmt.Sprintf("m = %d, ef_construction = %d", opts.M, opts.EfConstruction)
+	query, err := pgEngine.buildIndexQuery(tableName, "hnsw", &opts.IndexOptions, with, where)
+	if err != nil {
+		return err
+	}
+	pgEngine.warnOperatorClass(ctx, tableName, &opts.IndexOptions)
+	if err := pgEngine.execIndexQuery(ctx, tableName, "hnsw", &opts.IndexOptions, query, with, where); err != nil {
+		return fmt.Errorf("failed to create hnsw index: %w", err)
+	}
+	return nil
+}
+
+// CreateIVFFlatIndex creates an IVFFlat index with the given number of lists
+// on the embedding column of a table. If lists is zero, it is derived from
+// the current number of rows with [SuggestIVFFlatLists].
+//
+// IVFFlat builds its centroids from the rows present when the index is
+// created, so the index should be created after the table has been loaded.
+func (pgEngine *PostgresEngine) CreateIVFFlatIndex(ctx context.Context, tableName string, lists int, opts IndexOptions) error {
+	if err := pgEngine.checkDDL("create an index", true); err != nil {
+		return err
+	}
+	if lists < 0 || lists > 32768 {
+		return fmt.Errorf("ivfflat lists must be between 1 and 32768, got %d", lists)
+	}
+	tableName = pgEngine.tableName(tableName)
+	schemaName := cmp.Or(opts.SchemaName, pgEngine.schemaName())
+	where, err := pgEngine.indexWhere(ctx, tableName, &opts)
+	if err != nil {
+		return err
+	}
+	rows, err := pgEngine.countRows(ctx, schemaName, tableName, false)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		logger.FromContext(ctx).Warn("creating an ivfflat index on an empty table; recreate it once the table is loaded for useful centroids",
+			"schema", schemaName, "table", tableName)
+	}
+	if lists == 0 {
+		// Each partition of a partitioned table gets its own centroids.
+		tree, err := pgEngine.partitionTree(ctx, schemaName, tableName)
+		if err != nil {
+			return err
+		}
+		lists = SuggestIVFFlatLists(rows / int64(leafPartitions(tree)))
+	}
+	with := fmt.Sprintf("lists = %d", lists)
+	query, err := pgEngine.buildIndexQuery(tableName, "ivfflat", &opts, with, where)
+	if err != nil {
+		return err
+	}
+	pgEngine.warnOperatorClass(ctx, tableName, &opts)
+	if err := pgEngine.execIndexQuery(ctx, tableName, "ivfflat", &opts, query, with, where); err != nil {
+		return fmt.Errorf("failed to create ivfflat index: %w", err)
+	}
+	return nil
+}
+
+// SuggestIVFFlatLists returns a number of IVFFlat lists suited to a table
+// with the given number of rows, following the pgvector recommendation of
+// rows/1000 up to a million rows and sqrt(rows) beyond that.
+func SuggestIVFFlatLists(rows int64) int {
+	if rows > 1_000_000 {
+		return int(math.Sqrt(float64(rows)))
+	}
+	return max(1, int(rows/1000))
+}
+
+// indexWhere returns the predicate of the partial index described by opts,
+// or the empty string if opts has no Where filters. The filter keys are
+// checked against the columns of the table.
+func (pgEngine *PostgresEngine) indexWhere(ctx context.Context, tableName string, opts *IndexOptions) (string, error) {
+	if len(opts.Where) == 0 {
+		return "", nil
+	}
+	if opts.Name == "" {
+		return "", errors.New("a partial index requires a name")
+	}
+	schemaName := cmp.Or(opts.SchemaName, pgEngine.schemaName())
+	qctx, cancel := pgEngine.withQueryTimeout(ctx)
+	defer cancel()
+	cols, err := pgEngine.tableColumns(qctx, schemaName, tableName)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up table %q: %w", tableName, queryTimeoutError(qctx, err))
+	}
+	if len(cols) == 0 {
+		return "", fmt.Errorf("%w: %q", ErrTableNotFound, tableName)
+	}
+	return indexPredicate(opts.Where, cols)
+}
+
+// indexPredicate compiles the filters of a partial index over the columns
+// cols, with their values inlined as literals.
+func indexPredicate(filters []Filter, cols map[string]tableColumn) (string, error) {
+	names := make([]string, 0, len(filters))
+	for _, f := range filters {
+		if _, ok := cols[f.Key]; !ok {
+			return "", fmt.Errorf("partial index filter key %q is not a column of the table", f.Key)
+		}
+		if err := validateIdentifier("partial index filter key", f.Key); err != nil {
+			return "", err
+		}
+		names = append(names, f.Key)
+	}
+	args := &queryArgs{}
+	where, err := compileFilters(filters, "", names, args)
+	if err != nil {
+		return "", err
+	}
+	return inlineArgs(where, args.args)
+}
+
+// buildIndexQuery applies the defaults to opts and returns the statement
+// creating an index of the given method with the given storage parameters,
+// restricted to the rows matching where if it is not empty.
+func (pgEngine *PostgresEngine) buildIndexQuery(tableName, method string, opts *IndexOptions, with, where string) (string, error) {
+	if tableName == "" {
+		return "", errors.New("missing table name")
+	}
+	if err := validateQuotedIdentifier("table name", tableName); err != nil {
+		return "", err
+	}
+	if opts.SchemaName == "" {
+		opts.SchemaName = pgEngine.schemaName()
+	}
+	if err := validateIdentifier("schema name", opts.SchemaName); err != nil {
+		return "", err
+	}
+	if opts.EmbeddingColumn == "" {
+		opts.EmbeddingColumn = pgEngine.embeddingColumn()
+	}
+	if opts.DistanceStrategy == "" {
+		opts.DistanceStrategy = pgEngine.distanceStrategy()
+	}
+	if err := opts.DistanceStrategy.validate(); err != nil {
+		return "", err
+	}
+	if err := validateQuotedIdentifier("embedding column", opts.EmbeddingColumn); err != nil {
+		return "", err
+	}
+	if opts.Name != "" {
+		if err := validateQuotedIdentifier("index name", opts.Name); err != nil {
+			return "", err
+		}
+	} else {
+		// Postgres truncates names longer than 63 characters.
+		opts.Name = fmt.Sprintf("%s_%s_%s_idx", tableName, opts.EmbeddingColumn, method)
+	}
+	if opts.OperatorClass != "" {
+		for _, part := range strings.Split(opts.OperatorClass, ".") {
+			if err := validateIdentifier("operator class", part); err != nil {
+				return "", err
+			}
+		}
+	}
+	concurrently := ""
+	if opts.Concurrently {
+		concurrently = " CONCURRENTLY"
+	}
+	return fmt.Sprintf(`CREATE INDEX%s "%s" ON %s %s`, concurrently, opts.Name,
+		qualifiedName(opts.SchemaName, tableName), pgEngine.indexUsing(method, opts, with, where)), nil
+}
+
+// indexUsing returns the part of the statement creating the index of opts,
+// whose defaults are applied, that follows the table name.
+func (pgEngine *PostgresEngine) indexUsing(method string, opts *IndexOptions, with, where string) string {
+	opclass := cmp.Or(opts.OperatorClass, opts.DistanceStrategy.operatorClass(pgEngine.vectorType()))
+	using := fmt.Sprintf(`USING %s ("%s" %s) WITH (%s)`, method, opts.EmbeddingColumn, opclass, with)
+	if where != "" {
+		using += " WHERE " + where
+	}
+	return using
+}
+
+// execIndexQuery runs query, built by buildIndexQuery from the other
+// arguments. Postgres cannot build an index of a partitioned table
+// concurrently, so a concurrent build on such a table runs the statements of
+// partitionIndexQueries instead.
+func (pgEngine *PostgresEngine) execIndexQuery(ctx context.Context, tableName, method string, opts *IndexOptions, query, with, where string) error {
+	queries := []string{query}
+	if opts.Concurrently {
+		tree, err := pgEngine.partitionTree(ctx, opts.SchemaName, tableName)
+		if err != nil {
+			return err
+		}
+		if len(tree) > 0 && !tree[0].leaf {
+			if queries, err = partitionIndexQueries(tree, opts.Name, pgEngine.indexUsing(method, opts, with, where)); err != nil {
+				return err
+			}
+		}
+	}
+	err := pgEngine.withDDLSession(ctx, func(q querier) error {
+		for _, query := range queries {
+			if _, err := q.Exec(ctx, query); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	pgEngine.autoAnalyze(ctx, opts.SchemaName, tableName)
+	return nil
+}
+
+// TableIndex describes an index of a table, as returned by
+// [PostgresEngine.ListIndexes].
+type TableIndex struct {
+	Name       string // Name of the index.
+	Method     string // Index method, such as hnsw, ivfflat or btree.
+	Definition string // CREATE INDEX statement of the index.
+	Unique     bool   // Whether the index is unique, as for a primary key.
+	// Valid is false for an index that queries cannot use, such as one
+	// whose concurrent build failed, which should be dropped.
+	Valid bool
+}
+
+// ListIndexes returns the indexes of a table in the schema of the engine,
+// vector indexes or not, in order of name. It returns an error wrapping
+// [ErrTableNotFound] if the table does not exist.
+func (pgEngine *PostgresEngine) ListIndexes(ctx context.Context, tableName string) ([]TableIndex, error) {
+	const query = `SELECT i.relname, am.amname, pg_get_indexdef(i.oid), x.indisunique, x.indisvalid
+		FROM pg_index x
+		JOIN pg_class i ON i.oid = x.indexrelid
+		JOIN pg_class t ON t.oid = x.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		JOIN pg_am am ON am.oid = i.relam
+		WHERE n.nspname = $1 AND t.relname = $2
+		ORDER BY i.relname`
+	name := pgEngine.tableName(tableName)
+	qctx, cancel := pgEngine.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := pgEngine.querier().Query(qctx, query, pgEngine.schemaName(), name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the indexes of table %q: %w", name, queryTimeoutError(qctx, err))
+	}
+	defer rows.Close()
+	indexes := []TableIndex{}
+	for rows.Next() {
+		var idx TableIndex
+		if err := rows.Scan(&idx.Name, &idx.Method, &idx.Definition, &idx.Unique, &idx.Valid); err != nil {
+			return nil, fmt.Errorf("failed to list the indexes of table %q: %w", name, err)
+		}
+		indexes = append(indexes, idx)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list the indexes of table %q: %w", name, queryTimeoutError(qctx, err))
+	}
+	if len(indexes) == 0 {
+		exists, err := pgEngine.TableExists(ctx, tableName)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("%w: %q", ErrTableNotFound, name)
+		}
+	}
+	return indexes, nil
+}
+
+// DropIndexOptions configures [PostgresEngine.DropIndex].
+type DropIndexOptions struct {
+	// SchemaName of the index. The default is the engine's schema.
+	SchemaName string
+	// IfExists makes dropping an index that does not exist succeed.
+	IfExists bool
+	// Concurrently drops the index without locking out queries and writes
+	// of its table. It cannot be run inside a transaction, nor drop the
+	// index of a partitioned table.
+	Concurrently bool
+}
+
+// DropIndex drops an index, such as one created by [PostgresEngine.CreateHNSWIndex]
+// or [PostgresEngine.CreateIVFFlatIndex], by its name, which is not
+// prefixed by [WithTablePrefix]. Unless [DropIndexOptions.IfExists] is set,
+// dropping an index that does not exist returns an error wrapping
+// [ErrIndexNotFound].
+func (pgEngine *PostgresEngine) DropIndex(ctx context.Context, indexName string, opts DropIndexOptions) error {
+	if err := pgEngine.checkDDL("drop an index", true); err != nil {
+		return err
+	}
+	query, err := pgEngine.dropIndexQuery(indexName, &opts)
+	if err != nil {
+		return err
+	}
+	if err := pgEngine.execDDL(ctx, query); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "42704" {
+			return fmt.Errorf("failed to drop index %q: %w: %w", indexName, ErrIndexNotFound, err)
+		}
+		return fmt.Errorf("failed to drop index %q: %w", indexName, err)
+	}
+	return nil
+}
+
+// dropIndexQuery applies the defaults to opts and returns the statement
+// dropping the index name.
+func (pgEngine *PostgresEngine) dropIndexQuery(name string, opts *DropIndexOptions) (string, error) {
+	if name == "" {
+		return "", errors.New("missing index name")
+	}
+	if err := validateQuotedIdentifier("index name", name); err != nil {
+		return "", err
+	}
+	if opts.SchemaName == "" {
+		opts.SchemaName = pgEngine.schemaName()
+	}
+	if err := validateIdentifier("schema name", opts.SchemaName); err != nil {
+		return "", err
+	}
+	query := "DROP INDEX"
+	if opts.Concurrently {
+		query += " CONCURRENTLY"
+	}
+	if opts.IfExists {
+		query += " IF EXISTS"
+	}
+	return query + " " + qualifiedName(opts.SchemaName, name), nil
+}
+
+// warnOperatorClass logs a warning if the operator class set by opts, whose
+// defaults are applied, cannot serve the queries of its distance strategy.
+func (pgEngine *PostgresEngine) warnOperatorClass(ctx context.Context, tableName string, opts *IndexOptions) {
+	inferred := opts.DistanceStrategy.operatorClass(pgEngine.vectorType())
+	if opts.OperatorClass == "" || opts.OperatorClass == inferred {
+		return
+	}
+	logger.FromContext(ctx).Warn("the operator class of the index differs from that of its distance strategy; retrievers with that strategy will reject the table",
+		"table", tableName, "operator_class", opts.OperatorClass, "distance_strategy", opts.DistanceStrategy, "expected", inferred)
+}
+
+// requireVectorVersion returns an error if the installed pgvector extension
+// is older than major.minor. feature names what needs that version.
+func (pgEngine *PostgresEngine) requireVectorVersion(ctx context.Context, major, minor int, feature string) error {
+	var version string
+	err := pgEngine.querier().QueryRow(ctx, "SELECT extversion FROM pg_extension WHERE extname = 'vector'").Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errors.New("the vector extension is not installed")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the vector extension version: %w", err)
+	}
+	if !versionAtLeast(version, major, minor) {
+		return fmt.Errorf("%s require pgvector %d.%d or later, found %s", feature, major, minor, version)
+	}
+	return nil
+}
+
+// versionAtLeast reports whether a "major.minor[.patch]" version is at least
+// major.minor. Unparsable versions are assumed to be recent enough.
+func versionAtLeast(version string, major, minor int) bool {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return true
+	}
+	gotMajor, err1 := strconv.Atoi(parts[0])
+	gotMinor, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		return true
+	}
+	if gotMajor != major {
+		return gotMajor > major
+	}
+	return gotMinor >= minor
+}
@@ -0,0 +1,146 @@
+package postgresql
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildIndexQuery(t *testing.T) {
+	pgEngine := &PostgresEngine{}
+
+	opts := IndexOptions{}
+	query, err := pgEngine.buildIndexQuery("documents", "hnsw", &opts, "m = 16, ef_construction = 64", "")
+	assert.NoError(t, err)
+	assert.Equal(t, `CREATE INDEX "documents_embedding_hnsw_idx" ON "public"."documents" USING hnsw ("embedding" vector_cosine_ops) WITH (m = 16, ef_construction = 64)`, query)
+
+	opts = IndexOptions{Name: "l2_idx", SchemaName: "tenant_a", EmbeddingColumn: "vec", DistanceStrategy: EuclideanDistance, Concurrently: true}
+	query, err = pgEngine.buildIndexQuery("documents", "hnsw", &opts, "m = 8, ef_construction = 32", "")
+	assert.NoError(t, err)
+	assert.Equal(t, `CREATE INDEX CONCURRENTLY "l2_idx" ON "tenant_a"."documents" USING hnsw ("vec" vector_l2_ops) WITH (m = 8, ef_construction = 32)`, query)
+
+	opts = IndexOptions{DistanceStrategy: InnerProduct}
+	query, err = pgEngine.buildIndexQuery("documents", "ivfflat", &opts, "lists = 100", "")
+	assert.NoError(t, err)
+	assert.Equal(t, `CREATE INDEX "documents_embedding_ivfflat_idx" ON "public"."documents" USING ivfflat ("embedding" vector_ip_ops) WITH (lists = 100)`, query)
+
+	_, err = pgEngine.buildIndexQuery("documents", "hnsw", &IndexOptions{DistanceStrategy: "hamming"}, "", "")
+	assert.Error(t, err)
+
+	opts = IndexOptions{EmbeddingColumn: "Embedding"}
+	query, err = pgEngine.buildIndexQuery("MyDocs", "hnsw", &opts, "m = 16, ef_construction = 64", "")
+	assert.NoError(t, err)
+	assert.Equal(t, `CREATE INDEX "MyDocs_Embedding_hnsw_idx" ON "public"."MyDocs" USING hnsw ("Embedding" vector_cosine_ops) WITH (m = 16, ef_construction = 64)`, query)
+	_, err = pgEngine.buildIndexQuery(`My"Docs`, "hnsw", &IndexOptions{}, "", "")
+	assert.Error(t, err)
+	_, err = pgEngine.buildIndexQuery("documents", "hnsw", &IndexOptions{Name: `bad"idx`}, "", "")
+	assert.Error(t, err)
+}
+
+func TestBuildIndexQueryOperatorClass(t *testing.T) {
+	pgEngine := &PostgresEngine{}
+	opts := IndexOptions{OperatorClass: "vector_ip_ops"}
+	query, err := pgEngine.buildIndexQuery("documents", "hnsw", &opts, "m = 16, ef_construction = 64", "")
+	assert.NoError(t, err)
+	assert.Equal(t, `CREATE INDEX "documents_embedding_hnsw_idx" ON "public"."documents" USING hnsw ("embedding" vector_ip_ops) WITH (m = 16, ef_construction = 64)`, query)
+
+	opts = IndexOptions{OperatorClass: "ext.my_ops"}
+	query, err = pgEngine.buildIndexQuery("documents", "ivfflat", &opts, "lists = 100", "")
+	assert.NoError(t, err)
+	assert.Contains(t, query, `("embedding" ext.my_ops)`)
+
+	for _, bad := range []string{"vector_ip_ops) WITH (x", "a..b", `"ops"`} {
+		_, err = pgEngine.buildIndexQuery("documents", "hnsw", &IndexOptions{OperatorClass: bad}, "", "")
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestWarnOperatorClass(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	pgEngine := &PostgresEngine{}
+	pgEngine.warnOperatorClass(context.Background(), "documents", &IndexOptions{DistanceStrategy: CosineDistance})
+	pgEngine.warnOperatorClass(context.Background(), "documents", &IndexOptions{DistanceStrategy: InnerProduct, OperatorClass: "vector_ip_ops"})
+	assert.Empty(t, buf.String())
+
+	pgEngine.warnOperatorClass(context.Background(), "documents", &IndexOptions{DistanceStrategy: CosineDistance, OperatorClass: "vector_ip_ops"})
+	assert.Contains(t, buf.String(), "level=WARN")
+	assert.Contains(t, buf.String(), "operator_class=vector_ip_ops distance_strategy=cosine expected=vector_cosine_ops")
+}
+
+func TestIndexPredicate(t *testing.T) {
+	cols := map[string]tableColumn{
+		"tenant_id":  {typeName: "text"},
+		"year":       {typeName: "int4"},
+		"created_at": {typeName: "timestamptz"},
+		"a$1":        {typeName: "text"},
+	}
+	where, err := indexPredicate([]Filter{{Key: "tenant_id", Value: "o'brien"}}, cols)
+	assert.NoError(t, err)
+	assert.Equal(t, `"tenant_id" = 'o''brien'`, where)
+
+	where, err = indexPredicate([]Filter{
+		{Key: "year", Op: In, Value: []int{2024, 2025}},
+		{Key: "created_at", Op: Ge, Value: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Key: "a$1", Value: `back\slash`},
+	}, cols)
+	assert.NoError(t, err)
+	assert.Equal(t, `"year" IN (2024, 2025) AND "created_at" >= '2025-01-01T00:00:00Z'::timestamptz AND "a$1" = E'back\\slash'`, where)
+
+	_, err = indexPredicate([]Filter{{Key: "lang", Value: "en"}}, cols)
+	assert.Error(t, err)
+	_, err = indexPredicate([]Filter{{Key: "year", Value: math.NaN()}}, cols)
+	assert.Error(t, err)
+
+	pgEngine := &PostgresEngine{}
+	query, err := pgEngine.buildIndexQuery("documents", "hnsw", &IndexOptions{Name: "acme_idx"}, "m = 16", `"tenant_id" = 'acme'`)
+	assert.NoError(t, err)
+	assert.Equal(t, `CREATE INDEX "acme_idx" ON "public"."documents" USING hnsw ("embedding" vector_cosine_ops) WITH (m = 16) WHERE "tenant_id" = 'acme'`, query)
+
+	_, err = pgEngine.indexWhere(context.Background(), "documents", &IndexOptions{Where: []Filter{{Key: "tenant_id", Value: "acme"}}})
+	assert.Error(t, err)
+}
+
+func TestSuggestIVFFlatLists(t *testing.T) {
+	assert.Equal(t, 1, SuggestIVFFlatLists(0))
+	assert.Equal(t, 1, SuggestIVFFlatLists(999))
+	assert.Equal(t, 50, SuggestIVFFlatLists(50_000))
+	assert.Equal(t, 1000, SuggestIVFFlatLists(1_000_000))
+	assert.Equal(t, 2000, SuggestIVFFlatLists(4_000_000))
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	assert.True(t, versionAtLeast("0.5.0", 0, 5))
+	assert.True(t, versionAtLeast("0.7.4", 0, 5))
+	assert.True(t, versionAtLeast("1.0", 0, 7))
+	assert.False(t, versionAtLeast("0.4.4", 0, 5))
+	assert.False(t, versionAtLeast("0.6.2", 0, 7))
+}
+
+func TestDropIndexQuery(t *testing.T) {
+	pgEngine := &PostgresEngine{}
+	query, err := pgEngine.dropIndexQuery("documents_embedding_hnsw_idx", &DropIndexOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, `DROP INDEX "public"."documents_embedding_hnsw_idx"`, query)
+
+	query, err = pgEngine.dropIndexQuery("l2_idx", &DropIndexOptions{SchemaName: "tenant_a", IfExists: true, Concurrently: true})
+	assert.NoError(t, err)
+	assert.Equal(t, `DROP INDEX CONCURRENTLY IF EXISTS "tenant_a"."l2_idx"`, query)
+
+	_, err = pgEngine.dropIndexQuery("", &DropIndexOptions{})
+	assert.Error(t, err)
+	_, err = pgEngine.dropIndexQuery(`bad"idx`, &DropIndexOptions{})
+	assert.Error(t, err)
+	_, err = pgEngine.dropIndexQuery("idx", &DropIndexOptions{SchemaName: "bad schema"})
+	assert.Error(t, err)
+
+	pgEngine = &PostgresEngine{config: engineConfig{noDDL: true}}
+	assert.ErrorIs(t, pgEngine.DropIndex(context.Background(), "idx", DropIndexOptions{}), ErrDDLDisabled)
+}
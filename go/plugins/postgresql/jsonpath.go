@@ -0,0 +1,135 @@
+package postgresql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// JSONPathQuery is the Value of a [JSONPath] filter with variables.
+type JSONPathQuery struct {
+	// Path is a SQL/JSON path expression, such as
+	// `$.acl.groups[*] ? (@ == $group)`.
+	Path string
+	// Vars are the values of the variables of Path, such as "group", which
+	// are bound as a jsonb parameter rather than written in the path.
+	Vars map[string]any
+}
+
+// compileJSONPath compiles a [JSONPath] filter, binding the path and its
+// variables as parameters. Without variables it uses the jsonb @? operator,
+// which GIN indexes of the metadata column can serve.
+func compileJSONPath(f Filter, metadataColumn string, columns []string, args *queryArgs) (string, error) {
+	var q JSONPathQuery
+	switch v := f.Value.(type) {
+	case string:
+		q.Path = v
+	case JSONPathQuery:
+		q = v
+	case *JSONPathQuery:
+		if v == nil {
+			return "", errors.New("JSON path filter: nil value is not supported")
+		}
+		q = *v
+	default:
+		return "", fmt.Errorf("JSON path filter: value has type %T, want a string or a JSONPathQuery", f.Value)
+	}
+	if err := validateJSONPath(q.Path, q.Vars); err != nil {
+		return "", fmt.Errorf("JSON path filter %q: %w", q.Path, err)
+	}
+	var lhs string
+	switch {
+	case f.Key != "" && slices.Contains(columns, f.Key):
+		lhs = fmt.Sprintf(`"%s"::jsonb`, f.Key)
+	case metadataColumn == "":
+		return "", fmt.Errorf("JSON path filter %q requires a metadata JSON column", q.Path)
+	case f.Key == "":
+		lhs = fmt.Sprintf(`"%s"::jsonb`, metadataColumn)
+	default:
+		lhs = fmt.Sprintf(`("%s"::jsonb)->%s`, metadataColumn, args.add(f.Key))
+	}
+	path := args.add(q.Path)
+	if len(q.Vars) == 0 {
+		return fmt.Sprintf("%s @? %s::jsonpath", lhs, path), nil
+	}
+	vars, err := json.Marshal(q.Vars)
+	if err != nil {
+		return "", fmt.Errorf("JSON path filter %q: %w", q.Path, err)
+	}
+	return fmt.Sprintf("jsonb_path_exists(%s, %s::jsonpath, %s::jsonb)", lhs, path, args.add(string(vars))), nil
+}
+
+// validateJSONPath checks the syntax of path that Postgres would otherwise
+// only report when running the query: that it is a path from the root, $,
+// with an optional lax or strict mode, whose brackets, parentheses and
+// string literals are closed, and whose variables are defined in vars.
+func validateJSONPath(path string, vars map[string]any) error {
+	p := strings.TrimSpace(path)
+	for _, mode := range []string{"lax", "strict"} {
+		if rest, ok := strings.CutPrefix(p, mode); ok && rest != "" && (rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\n') {
+			p = strings.TrimSpace(rest)
+			break
+		}
+	}
+	if !strings.HasPrefix(p, "$") {
+		return errors.New("path must start with $")
+	}
+	var open []byte
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '"':
+			end := jsonPathStringEnd(p, i)
+			if end < 0 {
+				return errors.New("unterminated string literal")
+			}
+			i = end
+		case '[', '(':
+			open = append(open, c)
+		case ']', ')':
+			want := byte('[')
+			if c == ')' {
+				want = '('
+			}
+			if len(open) == 0 || open[len(open)-1] != want {
+				return fmt.Errorf("unbalanced %q at offset %d", c, i)
+			}
+			open = open[:len(open)-1]
+		case '$':
+			j := i + 1
+			for j < len(p) && isJSONPathNameByte(p[j]) {
+				j++
+			}
+			if name := p[i+1 : j]; name != "" {
+				if _, ok := vars[name]; !ok {
+					return fmt.Errorf("variable $%s is not defined", name)
+				}
+			}
+			i = j - 1
+		}
+	}
+	if len(open) > 0 {
+		return fmt.Errorf("unclosed %q", open[len(open)-1])
+	}
+	return nil
+}
+
+// jsonPathStringEnd returns the offset of the quote closing the string
+// literal of p that starts at offset start, or -1 if it is not closed.
+func jsonPathStringEnd(p string, start int) int {
+	for i := start + 1; i < len(p); i++ {
+		switch p[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// isJSONPathNameByte reports whether c may appear in the name of a variable.
+func isJSONPathNameByte(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
@@ -0,0 +1,62 @@
+package postgresql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileJSONPath(t *testing.T) {
+	args := &queryArgs{}
+	got, err := compileFilters([]Filter{{Op: JSONPath, Value: `$.acl.groups[*] ? (@ == "admins")`}}, "metadata", nil, args)
+	assert.NoError(t, err)
+	assert.Equal(t, `"metadata"::jsonb @? $1::jsonpath`, got)
+	assert.Equal(t, []any{`$.acl.groups[*] ? (@ == "admins")`}, args.args)
+
+	args = &queryArgs{}
+	got, err = compileFilters([]Filter{{Key: "acl", Op: JSONPath, Value: JSONPathQuery{
+		Path: "$.groups[*] ? (@ == $group)",
+		Vars: map[string]any{"group": "admins"},
+	}}}, "metadata", nil, args)
+	assert.NoError(t, err)
+	assert.Equal(t, `jsonb_path_exists(("metadata"::jsonb)->$1, $2::jsonpath, $3::jsonb)`, got)
+	assert.Equal(t, []any{"acl", "$.groups[*] ? (@ == $group)", `{"group":"admins"}`}, args.args)
+
+	got, err = compileFilters([]Filter{{Key: "acl", Op: JSONPath, Value: &JSONPathQuery{Path: "$.groups"}}}, "", []string{"acl"}, &queryArgs{})
+	assert.NoError(t, err)
+	assert.Equal(t, `"acl"::jsonb @? $1::jsonpath`, got)
+
+	for _, value := range []any{nil, 42, (*JSONPathQuery)(nil), "acl.groups", JSONPathQuery{Path: "$.groups[*] ? (@ == $group)"}} {
+		_, err := compileFilters([]Filter{{Op: JSONPath, Value: value}}, "metadata", nil, &queryArgs{})
+		assert.Error(t, err, "%v", value)
+	}
+	_, err = compileFilters([]Filter{{Op: JSONPath, Value: "$.a"}}, "", nil, &queryArgs{})
+	assert.Error(t, err)
+}
+
+func TestValidateJSONPath(t *testing.T) {
+	for _, path := range []string{
+		"$",
+		"$.acl.groups[*]",
+		"strict $.a[0 to 2]",
+		"lax $.a ? (@.b == 1 && exists(@.c))",
+		`$.a ? (@ == "[(\"")`,
+		"$.a ? (@ like_regex $re)",
+	} {
+		assert.NoError(t, validateJSONPath(path, map[string]any{"re": "^x"}), path)
+	}
+	for _, path := range []string{
+		"",
+		"acl.groups",
+		"strict",
+		"laxx $.a",
+		"$.a[*",
+		"$.a ? (@ == 1",
+		"$.a)",
+		"$.a[0)",
+		`$.a ? (@ == "x)`,
+		"$.a ? (@ == $missing)",
+	} {
+		assert.Error(t, validateJSONPath(path, map[string]any{"re": "^x"}), path)
+	}
+}
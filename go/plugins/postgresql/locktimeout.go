@@ -0,0 +1,70 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// lockTimeoutValue returns the value of the lock_timeout parameter for d,
+// in milliseconds, rounded up so that a positive d does not disable it.
+func lockTimeoutValue(d time.Duration) string {
+	return strconv.FormatInt(max(int64((d+time.Millisecond-1)/time.Millisecond), 1), 10)
+}
+
+// withDDLSession runs f, which runs DDL statements with q. With
+// [WithLockTimeout], q runs them on a single connection whose lock_timeout
+// is set, and reset once f returns; CREATE INDEX CONCURRENTLY cannot run in
+// a transaction, in which SET LOCAL would scope the setting.
+func (pgEngine *PostgresEngine) withDDLSession(ctx context.Context, f func(q querier) error) error {
+	timeout := pgEngine.config.lockTimeout
+	if timeout <= 0 {
+		return f(pgEngine.querier())
+	}
+	run := func(conn pgxExecutor) error {
+		q := pgEngine.commented(poolQuerier{conn})
+		if _, err := q.Exec(ctx, "SELECT set_config('lock_timeout', $1, false)", lockTimeoutValue(timeout)); err != nil {
+			return err
+		}
+		defer q.Exec(context.WithoutCancel(ctx), "RESET lock_timeout")
+		return f(q)
+	}
+	switch {
+	case pgEngine.config.db != nil:
+		conn, err := pgEngine.config.db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return conn.Raw(func(driverConn any) error {
+			c, ok := driverConn.(*stdlib.Conn)
+			if !ok {
+				return errors.New("lock timeouts require a database opened with the pgx stdlib driver")
+			}
+			return run(c.Conn())
+		})
+	case pgEngine.config.conn != nil:
+		return run(pgEngine.config.conn)
+	default:
+		return pgEngine.withPool(ctx, func(pool *pgxpool.Pool) error {
+			conn, err := pgEngine.acquire(ctx, pool)
+			if err != nil {
+				return err
+			}
+			defer conn.Release()
+			return run(conn)
+		})
+	}
+}
+
+// execDDL runs a DDL statement in a session of withDDLSession.
+func (pgEngine *PostgresEngine) execDDL(ctx context.Context, query string) error {
+	return pgEngine.withDDLSession(ctx, func(q querier) error {
+		_, err := q.Exec(ctx, query)
+		return err
+	})
+}
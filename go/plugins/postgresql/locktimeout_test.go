@@ -0,0 +1,24 @@
+package postgresql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockTimeoutValue(t *testing.T) {
+	assert.Equal(t, "5000", lockTimeoutValue(5*time.Second))
+	assert.Equal(t, "2", lockTimeoutValue(1500*time.Microsecond))
+	assert.Equal(t, "1", lockTimeoutValue(time.Nanosecond))
+}
+
+func TestWithLockTimeout(t *testing.T) {
+	config, err := applyEngineOptions([]Option{WithPool(&pgxpool.Pool{}), WithDatabase("testdb"), WithLockTimeout(3 * time.Second)})
+	assert.NoError(t, err)
+	assert.Equal(t, 3*time.Second, config.lockTimeout)
+
+	_, err = applyEngineOptions([]Option{WithPool(&pgxpool.Pool{}), WithDatabase("testdb"), WithLockTimeout(-time.Second)})
+	assert.Error(t, err)
+}
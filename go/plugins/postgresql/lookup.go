@@ -0,0 +1,64 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// isLookup reports whether req is a lookup by the filters of opts, without
+// a query to rank documents by similarity to.
+func isLookup(req *ai.RetrieverRequest, opts *RetrieverOptions) bool {
+	return req.Query == nil && opts.QueryEmbedding == nil && opts.MultiVector == nil && len(opts.Filters) > 0
+}
+
+// buildLookupQuery returns the query of a lookup of k documents by the
+// filters of opts and its arguments. Its rows have the layout of those of
+// buildRetrieveQuery, with a NULL distance, so that they are read alike.
+func (ds *docStore) buildLookupQuery(k int, opts *RetrieverOptions) (string, []any, error) {
+	if opts.MMR != nil || opts.Hybrid != nil || opts.After != nil || opts.GroupBy != nil || opts.ScoreThreshold != nil ||
+		opts.MinDistance != nil || opts.MaxDistance != nil {
+		return "", nil, errors.New("MMR, hybrid retrieval, pagination, grouping, score thresholds and distance bounds require a query")
+	}
+	column, err := ds.searchColumn(opts)
+	if err != nil {
+		return "", nil, err
+	}
+	args := &queryArgs{}
+	where, err := ds.retrieveWhere(column, opts, args)
+	if err != nil {
+		return "", nil, err
+	}
+	quoted, err := ds.selectList("", opts, args)
+	if err != nil {
+		return "", nil, err
+	}
+	quoted = append(quoted, "NULL::float8 AS distance")
+	if opts.ReturnEmbedding {
+		quoted = append(quoted, fmt.Sprintf(`"%s"::text`, column))
+	}
+	if opts.CountTotal {
+		quoted = append(quoted, totalColumn)
+	}
+
+	var order []string
+	key, err := ds.orderKey(opts, args)
+	if err != nil {
+		return "", nil, err
+	}
+	if key != "" {
+		order = append(order, key)
+	}
+	order = append(order, fmt.Sprintf(`"%s"`, ds.config.TiebreakerColumn))
+	if opts.OrderDesc {
+		for i := range order {
+			order[i] += " DESC"
+		}
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY %s LIMIT %d`, strings.Join(quoted, ", "),
+		qualifiedName(ds.config.SchemaName, ds.config.TableName), where, strings.Join(order, ", "), k)
+	return query, args.args, nil
+}
@@ -0,0 +1,72 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildLookupQuery(t *testing.T) {
+	ds := testDocStore()
+	filters := []Filter{{Key: "lang", Value: "en"}}
+	query, args, err := ds.buildLookupQuery(4, &RetrieverOptions{Filters: filters})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", NULL::float8 AS distance FROM "public"."documents"`+
+		` WHERE "metadata"->>$1 = $2 ORDER BY "id" LIMIT 4`, query)
+	assert.Equal(t, []any{"lang", "en"}, args)
+
+	query, _, err = ds.buildLookupQuery(4, &RetrieverOptions{Filters: filters, OrderBy: "source", OrderDesc: true, ReturnEmbedding: true})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", NULL::float8 AS distance, "embedding"::text FROM "public"."documents"`+
+		` WHERE "metadata"->>$1 = $2 ORDER BY "source" DESC, "id" DESC LIMIT 4`, query)
+
+	query, args, err = ds.buildLookupQuery(4, &RetrieverOptions{Filters: filters, OrderBy: "published"})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", NULL::float8 AS distance FROM "public"."documents"`+
+		` WHERE "metadata"->>$1 = $2 ORDER BY "metadata"->>$3, "id" LIMIT 4`, query)
+	assert.Equal(t, []any{"lang", "en", "published"}, args)
+
+	query, _, err = ds.buildLookupQuery(4, &RetrieverOptions{Filters: filters, CountTotal: true})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", NULL::float8 AS distance, count(*) OVER () AS total FROM "public"."documents"`+
+		` WHERE "metadata"->>$1 = $2 ORDER BY "id" LIMIT 4`, query)
+
+	for _, opts := range []*RetrieverOptions{
+		{MMR: &MMROptions{Lambda: 0.5}},
+		{Hybrid: &HybridOptions{Query: "chunks"}},
+		{After: &Cursor{Key: "doc-1"}},
+		{GroupBy: &GroupOptions{Key: "source"}},
+		{ScoreThreshold: new(float32)},
+	} {
+		opts.Filters = filters
+		_, _, err := ds.buildLookupQuery(4, opts)
+		assert.Error(t, err, "%+v", opts)
+	}
+}
+
+func TestPrepareRetrievalLookup(t *testing.T) {
+	ds := testDocStore()
+	ds.config.Embedder = &fakeEmbedder{}
+	ds.config.K = 4
+	r, err := ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{
+		Options: &RetrieverOptions{Filters: []Filter{{Key: "lang", Value: "en"}}},
+	}, true)
+	assert.NoError(t, err)
+	assert.Contains(t, r.query, "NULL::float8 AS distance")
+	assert.False(t, r.rerank)
+	assert.Equal(t, 0, ds.config.Embedder.(*fakeEmbedder).calls)
+
+	// Documents without a distance have no score.
+	doc, err := ds.rowToDocument([]any{"a", "text", nil, "web", nil})
+	assert.NoError(t, err)
+	assert.NotContains(t, doc.Metadata, ScoreMetadataKey)
+
+	// Ordering a similarity search cannot be combined with MMR.
+	_, err = ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{
+		Query:   ai.DocumentFromText("3", nil),
+		Options: &RetrieverOptions{OrderBy: "source", MMR: &MMROptions{}},
+	}, true)
+	assert.ErrorContains(t, err, "ordering cannot be combined with MMR")
+}
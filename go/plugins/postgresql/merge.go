@@ -0,0 +1,195 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// MergeOptions merges the retrieved chunks of a source document that are
+// adjacent or overlap, according to the character offsets stored in their
+// metadata, into single documents, for cleaner context windows. Only the
+// retrieved chunks are merged: chunks that lie between them but were not
+// retrieved leave them apart.
+//
+// A merged document takes the place, metadata, distance and score of its
+// highest ranked chunk, with the offsets of the merged range, and a single text
+// part: the text of its chunks in order of offset, without the characters
+// of the overlap of a chunk with the previous ones. Chunks without the
+// three keys, with offsets that are not integers, or with content other
+// than text, are returned as they are.
+type MergeOptions struct {
+	// SourceKey is the metadata key identifying the source document of a
+	// chunk. Only chunks with equal values are merged.
+	SourceKey string `json:"sourceKey"`
+	// StartKey and EndKey are the metadata keys of the offsets of the
+	// first character of a chunk in its source document and of the
+	// character that follows it.
+	StartKey string `json:"startKey"`
+	EndKey   string `json:"endKey"`
+	// MaxGap is the number of characters that may separate the end of a
+	// chunk from the start of the next one for them to be merged. The
+	// default, 0, only merges chunks that touch or overlap.
+	MaxGap int `json:"maxGap,omitempty"`
+	// Separator is inserted between merged chunks that do not overlap,
+	// such as "\n" or " [...] " for chunks separated by a gap.
+	Separator string `json:"separator,omitempty"`
+}
+
+// validate returns an error if o is invalid.
+func (o *MergeOptions) validate() error {
+	if o.SourceKey == "" || o.StartKey == "" || o.EndKey == "" {
+		return errors.New("merging chunks requires a source key, a start key and an end key")
+	}
+	if o.StartKey == o.EndKey || o.SourceKey == o.StartKey || o.SourceKey == o.EndKey {
+		return errors.New("the source, start and end keys of merged chunks must be different")
+	}
+	if o.MaxGap < 0 {
+		return fmt.Errorf("merge maxGap must not be negative, got %d", o.MaxGap)
+	}
+	return nil
+}
+
+// mergeChunk is a retrieved chunk that may be merged.
+type mergeChunk struct {
+	rank       int // position of the chunk in the retrieved documents
+	start, end int
+	text       string
+}
+
+// mergeChunks returns docs, in order, with the adjacent chunks of o merged
+// into the position of their highest ranked chunk. distances holds the
+// distances of docs, and is given those of the merged documents.
+func mergeChunks(docs []*ai.Document, distances map[*ai.Document]float64, o *MergeOptions) []*ai.Document {
+	sources := make(map[string][]mergeChunk)
+	var order []string
+	for i, doc := range docs {
+		source, c, ok := chunkOf(doc, o)
+		if !ok {
+			continue
+		}
+		c.rank = i
+		if _, seen := sources[source]; !seen {
+			order = append(order, source)
+		}
+		sources[source] = append(sources[source], c)
+	}
+
+	merged := make(map[int]*ai.Document) // by rank of the first chunk
+	dropped := make(map[int]bool)
+	for _, source := range order {
+		chunks := sources[source]
+		slices.SortStableFunc(chunks, func(a, b mergeChunk) int { return a.start - b.start })
+		for len(chunks) > 0 {
+			n := 1
+			end := chunks[0].end
+			for n < len(chunks) && chunks[n].start <= end+o.MaxGap {
+				end = max(end, chunks[n].end)
+				n++
+			}
+			if n > 1 {
+				first := slices.MinFunc(chunks[:n], func(a, b mergeChunk) int { return a.rank - b.rank })
+				for _, c := range chunks[:n] {
+					dropped[c.rank] = true
+				}
+				merged[first.rank] = mergedDocument(docs[first.rank], chunks[:n], o)
+				if distance, ok := distances[docs[first.rank]]; ok {
+					distances[merged[first.rank]] = distance
+				}
+			}
+			chunks = chunks[n:]
+		}
+	}
+	if len(merged) == 0 {
+		return docs
+	}
+	out := make([]*ai.Document, 0, len(docs))
+	for i, doc := range docs {
+		if m, ok := merged[i]; ok {
+			out = append(out, m)
+		} else if !dropped[i] {
+			out = append(out, doc)
+		}
+	}
+	return out
+}
+
+// mergedDocument returns the document merging run, chunks of doc's source
+// in order of offset, with the metadata of doc, the highest ranked of them.
+func mergedDocument(doc *ai.Document, run []mergeChunk, o *MergeOptions) *ai.Document {
+	var sb strings.Builder
+	start, end := run[0].start, run[0].end
+	sb.WriteString(run[0].text)
+	for _, c := range run[1:] {
+		text := c.text
+		if overlap := end - c.start; overlap > 0 {
+			text = skipRunes(text, overlap)
+		} else {
+			sb.WriteString(o.Separator)
+		}
+		sb.WriteString(text)
+		end = max(end, c.end)
+	}
+	metadata := maps.Clone(doc.Metadata)
+	metadata[o.StartKey] = start
+	metadata[o.EndKey] = end
+	return ai.DocumentFromText(sb.String(), metadata)
+}
+
+// chunkOf returns the source and the chunk of doc, and false if doc cannot
+// be merged.
+func chunkOf(doc *ai.Document, o *MergeOptions) (string, mergeChunk, bool) {
+	source, ok := doc.Metadata[o.SourceKey]
+	if !ok || source == nil {
+		return "", mergeChunk{}, false
+	}
+	start, ok := offsetValue(doc.Metadata[o.StartKey])
+	if !ok {
+		return "", mergeChunk{}, false
+	}
+	end, ok := offsetValue(doc.Metadata[o.EndKey])
+	if !ok || end < start {
+		return "", mergeChunk{}, false
+	}
+	for _, p := range doc.Content {
+		if p.Kind != ai.PartText {
+			return "", mergeChunk{}, false
+		}
+	}
+	return fmt.Sprint(source), mergeChunk{start: start, end: end, text: documentText(doc)}, true
+}
+
+// offsetValue returns the integer value of an offset in metadata, which is
+// a float64 when decoded from JSON.
+func offsetValue(v any) (int, bool) {
+	switch v := v.(type) {
+	case int:
+		return v, true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case float64:
+		if v != math.Trunc(v) || math.IsInf(v, 0) {
+			return 0, false
+		}
+		return int(v), true
+	}
+	return 0, false
+}
+
+// skipRunes returns s without its first n characters.
+func skipRunes(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[i:]
+		}
+		n--
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package postgresql
+
+import (
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chunk(text, source string, start, end any) *ai.Document {
+	return ai.DocumentFromText(text, map[string]any{"source": source, "start": start, "end": end})
+}
+
+func TestMergeChunks(t *testing.T) {
+	o := &MergeOptions{SourceKey: "source", StartKey: "start", EndKey: "end"}
+	a2 := chunk("fox jumps", "a", 10, 19) // overlaps a1 by "fox "
+	b := chunk("other", "b", 0, 5)        // another source
+	a1 := chunk("quick fox ", "a", 4, 14) // touches a0
+	a0 := chunk("The ", "a", 0, 4)        // JSON offsets
+	far := chunk("far away", "a", 100.0, 108.0)
+	plain := ai.DocumentFromText("no offsets", map[string]any{"source": "a"})
+	docs := []*ai.Document{a2, b, a1, plain, far, a0}
+	a0.Metadata["start"], a0.Metadata["end"] = 0.0, 4.0
+	distances := map[*ai.Document]float64{a2: 0.1, b: 0.2, a1: 0.3, far: 0.4, a0: 0.5}
+
+	got := mergeChunks(docs, distances, o)
+	require.Len(t, got, 4)
+	merged := got[0]
+	assert.Equal(t, "The quick fox jumps", documentText(merged))
+	assert.Equal(t, 0, merged.Metadata["start"])
+	assert.Equal(t, 19, merged.Metadata["end"])
+	assert.Equal(t, "a", merged.Metadata["source"])
+	assert.Equal(t, 0.1, distances[merged])
+	assert.Equal(t, []*ai.Document{b, plain, far}, got[1:])
+	assert.Equal(t, 10, a2.Metadata["start"], "chunks are not modified")
+
+	o.MaxGap = 1
+	o.Separator = " ... "
+	got = mergeChunks([]*ai.Document{chunk("one", "a", 0, 3), chunk("two", "a", 4, 7)}, map[*ai.Document]float64{}, o)
+	require.Len(t, got, 1)
+	assert.Equal(t, "one ... two", documentText(got[0]))
+
+	contained := []*ai.Document{chunk("abcdef", "a", 0, 6), chunk("cd", "a", 2, 4)}
+	got = mergeChunks(contained, map[*ai.Document]float64{}, o)
+	require.Len(t, got, 1)
+	assert.Equal(t, "abcdef", documentText(got[0]))
+	assert.Equal(t, 6, got[0].Metadata["end"])
+
+	unmerged := []*ai.Document{chunk("x", "a", 0, 1), chunk("y", "b", 1, 2), chunk("z", "a", 1.5, 2)}
+	assert.Equal(t, unmerged, mergeChunks(unmerged, map[*ai.Document]float64{}, o))
+}
+
+func TestMergeOptionsValidate(t *testing.T) {
+	assert.NoError(t, (&MergeOptions{SourceKey: "s", StartKey: "a", EndKey: "b"}).validate())
+	assert.Error(t, (&MergeOptions{StartKey: "a", EndKey: "b"}).validate())
+	assert.Error(t, (&MergeOptions{SourceKey: "s", StartKey: "a", EndKey: "a"}).validate())
+	assert.Error(t, (&MergeOptions{SourceKey: "s", StartKey: "a", EndKey: "b", MaxGap: -1}).validate())
+}
+
+func TestSkipRunes(t *testing.T) {
+	assert.Equal(t, "été", skipRunes("l'été", 2))
+	assert.Equal(t, "", skipRunes("abc", 5))
+	assert.Equal(t, "abc", skipRunes("abc", 0))
+}
@@ -0,0 +1,180 @@
+package postgresql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// ErrInvalidMetadata is wrapped by the errors of index requests rejected
+// because the metadata of a document does not match the schema set with
+// [WithMetadataSchema].
+var ErrInvalidMetadata = errors.New("invalid document metadata")
+
+// MetadataType is the type of a metadata value in a [MetadataSchema].
+type MetadataType string
+
+const (
+	// MetadataAny accepts any value.
+	MetadataAny MetadataType = "any"
+	// MetadataString accepts strings.
+	MetadataString MetadataType = "string"
+	// MetadataNumber accepts integers and floating-point numbers.
+	MetadataNumber MetadataType = "number"
+	// MetadataBool accepts booleans.
+	MetadataBool MetadataType = "bool"
+	// MetadataTime accepts [time.Time] values.
+	MetadataTime MetadataType = "time"
+	// MetadataArray accepts slices and arrays.
+	MetadataArray MetadataType = "array"
+	// MetadataObject accepts maps with string keys.
+	MetadataObject MetadataType = "object"
+)
+
+// MetadataSchema describes the metadata expected of indexed documents.
+type MetadataSchema struct {
+	// Fields are the expected metadata keys.
+	Fields []MetadataField
+	// RejectUnknown rejects documents with metadata keys that are not in
+	// Fields. The id key, [EmbeddingMetadataKey] and [TruncatedMetadataKey]
+	// are always accepted.
+	RejectUnknown bool
+}
+
+// MetadataField is a metadata key of a [MetadataSchema].
+type MetadataField struct {
+	Key  string
+	Type MetadataType
+	// Optional accepts documents without the key, or with a nil value.
+	Optional bool
+}
+
+// validate reports an error if s is not a valid schema.
+func (s *MetadataSchema) validate() error {
+	seen := make(map[string]bool, len(s.Fields))
+	for _, f := range s.Fields {
+		if f.Key == "" {
+			return errors.New("metadata schema key must not be empty")
+		}
+		if seen[f.Key] {
+			return fmt.Errorf("metadata schema key %q is repeated", f.Key)
+		}
+		seen[f.Key] = true
+		switch f.Type {
+		case MetadataAny, MetadataString, MetadataNumber, MetadataBool, MetadataTime, MetadataArray, MetadataObject:
+		default:
+			return fmt.Errorf("metadata schema key %q has invalid type %q", f.Key, f.Type)
+		}
+	}
+	return nil
+}
+
+// check returns an error wrapping [ErrInvalidMetadata] and naming the key at
+// fault if metadata does not match s. idKey is the metadata key of the id of
+// the documents.
+func (s *MetadataSchema) check(metadata map[string]any, idKey string) error {
+	for _, f := range s.Fields {
+		v, ok := metadata[f.Key]
+		if !ok || v == nil {
+			if f.Optional {
+				continue
+			}
+			if !ok {
+				return fmt.Errorf("%w: key %q is missing", ErrInvalidMetadata, f.Key)
+			}
+			return fmt.Errorf("%w: key %q is null", ErrInvalidMetadata, f.Key)
+		}
+		if !f.Type.matches(v) {
+			return fmt.Errorf("%w: key %q must be of type %s, got %T", ErrInvalidMetadata, f.Key, f.Type, v)
+		}
+	}
+	if !s.RejectUnknown {
+		return nil
+	}
+	for key := range metadata {
+		if key == idKey || key == EmbeddingMetadataKey || key == TruncatedMetadataKey {
+			continue
+		}
+		if !slices.ContainsFunc(s.Fields, func(f MetadataField) bool { return f.Key == key }) {
+			return fmt.Errorf("%w: key %q is not in the metadata schema", ErrInvalidMetadata, key)
+		}
+	}
+	return nil
+}
+
+// checkPatch is like check for patch, the keys merged into the metadata of
+// documents by [PostgresEngine.UpdateMetadata]: only the keys of patch are
+// checked, and a nil value is accepted for optional keys only.
+func (s *MetadataSchema) checkPatch(patch map[string]any) error {
+	for key, v := range patch {
+		i := slices.IndexFunc(s.Fields, func(f MetadataField) bool { return f.Key == key })
+		if i < 0 {
+			if s.RejectUnknown && key != EmbeddingMetadataKey && key != TruncatedMetadataKey {
+				return fmt.Errorf("%w: key %q is not in the metadata schema", ErrInvalidMetadata, key)
+			}
+			continue
+		}
+		f := s.Fields[i]
+		if v == nil {
+			if !f.Optional {
+				return fmt.Errorf("%w: key %q is null", ErrInvalidMetadata, key)
+			}
+			continue
+		}
+		if !f.Type.matches(v) {
+			return fmt.Errorf("%w: key %q must be of type %s, got %T", ErrInvalidMetadata, key, f.Type, v)
+		}
+	}
+	return nil
+}
+
+// checkMetadata checks docs, the documents of an index request, against the
+// metadata schema of the engine, if any.
+func (ds *docStore) checkMetadata(docs []*ai.Document) error {
+	schema := ds.engine.config.metadataSchema
+	if schema == nil {
+		return nil
+	}
+	for i, doc := range docs {
+		if err := schema.check(doc.Metadata, ds.config.IDColumn); err != nil {
+			return fmt.Errorf("document %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// matches reports whether v, a non-nil value, is of type t.
+func (t MetadataType) matches(v any) bool {
+	switch v.(type) {
+	case json.Number:
+		return t == MetadataAny || t == MetadataNumber
+	case time.Time:
+		return t == MetadataAny || t == MetadataTime
+	}
+	rv := reflect.ValueOf(v)
+	switch t {
+	case MetadataAny:
+		return true
+	case MetadataString:
+		return rv.Kind() == reflect.String
+	case MetadataNumber:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true
+		}
+	case MetadataBool:
+		return rv.Kind() == reflect.Bool
+	case MetadataArray:
+		return rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array
+	case MetadataObject:
+		return rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package postgresql
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadataSchemaCheck(t *testing.T) {
+	schema := &MetadataSchema{Fields: []MetadataField{
+		{Key: "tenant_id", Type: MetadataString},
+		{Key: "year", Type: MetadataNumber},
+		{Key: "draft", Type: MetadataBool, Optional: true},
+		{Key: "tags", Type: MetadataArray, Optional: true},
+		{Key: "labels", Type: MetadataObject, Optional: true},
+		{Key: "created", Type: MetadataTime, Optional: true},
+		{Key: "extra", Type: MetadataAny, Optional: true},
+	}}
+	assert.NoError(t, schema.validate())
+
+	valid := map[string]any{
+		"id":        "doc-1",
+		"tenant_id": "acme",
+		"year":      json.Number("2024"),
+		"draft":     nil,
+		"tags":      []string{"a"},
+		"labels":    map[string]any{"team": "search"},
+		"created":   time.Unix(0, 0),
+		"extra":     struct{}{},
+		"source":    "wiki",
+	}
+	assert.NoError(t, schema.check(valid, "id"))
+	assert.NoError(t, schema.check(map[string]any{"tenant_id": "acme", "year": uint8(3)}, "id"))
+
+	testCases := []struct {
+		name     string
+		metadata map[string]any
+		want     string
+	}{
+		{"missing", map[string]any{"year": 2024}, `key "tenant_id" is missing`},
+		{"null", map[string]any{"tenant_id": nil, "year": 2024}, `key "tenant_id" is null`},
+		{"wrong type", map[string]any{"tenant_id": "acme", "year": "2024"}, `key "year" must be of type number, got string`},
+		{"object keys", map[string]any{"tenant_id": "acme", "year": 1, "labels": map[int]any{1: "a"}}, `key "labels"`},
+		{"time as string", map[string]any{"tenant_id": "acme", "year": 1, "created": "2024-01-01"}, `key "created"`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := schema.check(tc.metadata, "id")
+			assert.ErrorIs(t, err, ErrInvalidMetadata)
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+
+	schema.RejectUnknown = true
+	err := schema.check(valid, "id")
+	assert.ErrorIs(t, err, ErrInvalidMetadata)
+	assert.ErrorContains(t, err, `key "source" is not in the metadata schema`)
+	delete(valid, "source")
+	valid[EmbeddingMetadataKey] = []float32{1}
+	assert.NoError(t, schema.check(valid, "id"))
+}
+
+func TestMetadataSchemaValidate(t *testing.T) {
+	assert.Error(t, (&MetadataSchema{Fields: []MetadataField{{Type: MetadataString}}}).validate())
+	assert.Error(t, (&MetadataSchema{Fields: []MetadataField{{Key: "a", Type: MetadataString}, {Key: "a", Type: MetadataBool}}}).validate())
+	assert.Error(t, (&MetadataSchema{Fields: []MetadataField{{Key: "a", Type: "date"}}}).validate())
+
+	_, err := applyEngineOptions([]Option{WithPool(&pgxpool.Pool{}), WithDatabase("testdb"),
+		WithMetadataSchema(MetadataSchema{Fields: []MetadataField{{Key: "a"}}})})
+	assert.Error(t, err)
+}
+
+func TestCheckMetadata(t *testing.T) {
+	ds := testDocStore()
+	docs := []*ai.Document{ai.DocumentFromText("a", map[string]any{"tenant_id": "acme"}), ai.DocumentFromText("b", nil)}
+	assert.NoError(t, ds.checkMetadata(docs))
+
+	ds.engine.config.metadataSchema = &MetadataSchema{Fields: []MetadataField{{Key: "tenant_id", Type: MetadataString}}}
+	err := ds.checkMetadata(docs)
+	assert.ErrorIs(t, err, ErrInvalidMetadata)
+	assert.ErrorContains(t, err, "document 1")
+}
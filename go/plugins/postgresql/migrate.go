@@ -0,0 +1,135 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migrationsTable is the table, in the schema of the engine, in which
+// [PostgresEngine.Migrate] records the applied migrations.
+const migrationsTable = "genkit_schema_migrations"
+
+// Migration is a schema change applied once by [PostgresEngine.Migrate], such
+// as adding a metadata column or an index to a vector store table.
+type Migration struct {
+	// Version identifies the migration. It must be positive, and migrations
+	// are applied in increasing version order.
+	Version int64
+	// Description is recorded with the version when the migration is
+	// applied.
+	Description string
+	// Statements are the statements of the migration, run in order in a
+	// single transaction. Statements that cannot run in a transaction, such
+	// as CREATE INDEX CONCURRENTLY, are not supported.
+	Statements []string
+}
+
+// Migrate applies the migrations that were not applied yet, in order, and
+// returns the versions it applied. The applied versions are recorded in the
+// genkit_schema_migrations table of the schema of the engine, created if
+// needed, whose name also takes the prefix set by [WithTablePrefix].
+//
+// Each migration runs in its own transaction, together with the record of
+// its version, so a failed migration leaves no trace and the migrations
+// before it stay applied. The transactions hold an advisory lock, so that
+// engines starting concurrently apply each migration once. Migrate requires
+// a pgx pool and cannot be used with [WithDB].
+func (pgEngine *PostgresEngine) Migrate(ctx context.Context, migrations []Migration) ([]int64, error) {
+	if err := pgEngine.checkDDL("run migrations", true); err != nil {
+		return nil, fmt.Errorf("postgres.Migrate: %w", err)
+	}
+	if pgEngine.pool() == nil {
+		return nil, errors.New("postgres.Migrate: a pgx pool is required")
+	}
+	if err := validateMigrations(migrations); err != nil {
+		return nil, fmt.Errorf("postgres.Migrate: %w", err)
+	}
+	table := qualifiedName(pgEngine.schemaName(), pgEngine.tableName(migrationsTable))
+	var applied []int64
+	for _, m := range migrations {
+		var ok bool
+		err := pgEngine.withPool(ctx, func(pool *pgxpool.Pool) error {
+			return pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+				if d := pgEngine.config.lockTimeout; d > 0 {
+					if _, err := tx.Exec(ctx, setLocalQuery, "lock_timeout", lockTimeoutValue(d)); err != nil {
+						return err
+					}
+				}
+				var err error
+				ok, err = applyMigration(ctx, poolQuerier{tx}, table, m)
+				return err
+			})
+		})
+		if err != nil {
+			return applied, fmt.Errorf("postgres.Migrate: migration %d: %w", m.Version, err)
+		}
+		if ok {
+			applied = append(applied, m.Version)
+		}
+	}
+	return applied, nil
+}
+
+// validateMigrations checks that migrations have increasing positive
+// versions and statements.
+func validateMigrations(migrations []Migration) error {
+	var last int64
+	for i, m := range migrations {
+		if m.Version <= last {
+			if m.Version <= 0 {
+				return fmt.Errorf("migration %d has version %d, which is not positive", i, m.Version)
+			}
+			return fmt.Errorf("migration %d has version %d, which does not follow version %d", i, m.Version, last)
+		}
+		if len(m.Statements) == 0 {
+			return fmt.Errorf("migration %d has no statements", m.Version)
+		}
+		for j, stmt := range m.Statements {
+			if strings.TrimSpace(stmt) == "" {
+				return fmt.Errorf("statement %d of migration %d is empty", j, m.Version)
+			}
+		}
+		last = m.Version
+	}
+	return nil
+}
+
+// applyMigration applies m in the transaction of q, unless it is recorded
+// in table, and reports whether it applied it. The advisory lock taken
+// first is held until the end of the transaction, so concurrent callers
+// wait for each other, and one that waited sees the version recorded.
+func applyMigration(ctx context.Context, q querier, table string, m Migration) (bool, error) {
+	if _, err := q.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", table); err != nil {
+		return false, fmt.Errorf("failed to lock the migrations table: %w", err)
+	}
+	create := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		version BIGINT PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now())`, table)
+	if _, err := q.Exec(ctx, create); err != nil {
+		return false, fmt.Errorf("failed to create the migrations table: %w", err)
+	}
+	var done bool
+	query := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE version = $1)", table)
+	if err := q.QueryRow(ctx, query, m.Version).Scan(&done); err != nil {
+		return false, fmt.Errorf("failed to read the applied migrations: %w", err)
+	}
+	if done {
+		return false, nil
+	}
+	for i, stmt := range m.Statements {
+		if _, err := q.Exec(ctx, stmt); err != nil {
+			return false, fmt.Errorf("statement %d: %w", i, err)
+		}
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (version, description) VALUES ($1, $2)", table)
+	if _, err := q.Exec(ctx, insert, m.Version, m.Description); err != nil {
+		return false, fmt.Errorf("failed to record the migration: %w", err)
+	}
+	return true, nil
+}
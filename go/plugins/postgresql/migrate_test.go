@@ -0,0 +1,85 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateMigrations(t *testing.T) {
+	stmts := []string{"ALTER TABLE docs ADD COLUMN source TEXT"}
+	assert.NoError(t, validateMigrations(nil))
+	assert.NoError(t, validateMigrations([]Migration{{Version: 1, Statements: stmts}, {Version: 3, Statements: stmts}}))
+
+	for name, migrations := range map[string][]Migration{
+		"zero version":    {{Version: 0, Statements: stmts}},
+		"out of order":    {{Version: 2, Statements: stmts}, {Version: 1, Statements: stmts}},
+		"duplicate":       {{Version: 1, Statements: stmts}, {Version: 1, Statements: stmts}},
+		"no statements":   {{Version: 1}},
+		"empty statement": {{Version: 1, Statements: []string{" "}}},
+	} {
+		assert.Error(t, validateMigrations(migrations), name)
+	}
+}
+
+// migrationTx is a transaction in which the version queried is recorded or
+// not, and which records the statements it runs.
+type migrationTx struct {
+	pgxExecutor
+	applied bool
+	execErr error
+	execs   []string
+}
+
+func (tx *migrationTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	tx.execs = append(tx.execs, sql)
+	if tx.execErr != nil && !strings.HasPrefix(sql, "SELECT") && !strings.HasPrefix(sql, "CREATE TABLE IF NOT EXISTS") {
+		return pgconn.CommandTag{}, tx.execErr
+	}
+	return pgconn.CommandTag{}, nil
+}
+
+func (tx *migrationTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return fakeRow{value: tx.applied}
+}
+
+func TestApplyMigration(t *testing.T) {
+	ctx := context.Background()
+	table := qualifiedName("public", migrationsTable)
+	m := Migration{Version: 2, Description: "add source", Statements: []string{
+		"ALTER TABLE docs ADD COLUMN source TEXT",
+		"CREATE INDEX docs_source ON docs (source)",
+	}}
+
+	tx := &migrationTx{}
+	ok, err := applyMigration(ctx, poolQuerier{tx}, table, m)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Len(t, tx.execs, 5)
+	assert.Contains(t, tx.execs[0], "pg_advisory_xact_lock")
+	assert.Contains(t, tx.execs[1], `CREATE TABLE IF NOT EXISTS "public"."genkit_schema_migrations"`)
+	assert.Equal(t, m.Statements, tx.execs[2:4])
+	assert.Contains(t, tx.execs[4], "INSERT INTO")
+
+	// An applied migration only takes the lock and checks the table.
+	tx = &migrationTx{applied: true}
+	ok, err = applyMigration(ctx, poolQuerier{tx}, table, m)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Len(t, tx.execs, 2)
+
+	tx = &migrationTx{execErr: errors.New("column already exists")}
+	_, err = applyMigration(ctx, poolQuerier{tx}, table, m)
+	assert.ErrorContains(t, err, "statement 0: column already exists")
+	assert.Len(t, tx.execs, 3)
+}
+
+func TestMigrateRequiresPool(t *testing.T) {
+	_, err := (&PostgresEngine{}).Migrate(context.Background(), nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,111 @@
+package postgresql
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/pgvector/pgvector-go"
+)
+
+// MMROptions configures Maximal Marginal Relevance retrieval, which trades
+// relevance to the query against diversity among the returned documents.
+type MMROptions struct {
+	// K is the number of documents to return. The default is the K of the
+	// retrieval.
+	K int `json:"k,omitempty"`
+	// FetchK is the number of nearest neighbors fetched as candidates
+	// before re-ranking. It must be at least K. The default is 5*K.
+	FetchK int `json:"fetchK,omitempty"`
+	// Lambda weighs relevance against diversity, between 0 and 1: 1 ranks
+	// by relevance only and 0 by diversity only.
+	Lambda float32 `json:"lambda"`
+}
+
+// withDefaults returns a copy of o with the defaults applied for a retrieval
+// of k documents, or an error if o is invalid.
+func (o MMROptions) withDefaults(k int) (MMROptions, error) {
+	if o.K == 0 {
+		o.K = k
+	}
+	if o.FetchK == 0 {
+		o.FetchK = 5 * o.K
+	}
+	if o.K < 0 {
+		return MMROptions{}, fmt.Errorf("mmr k must be positive, got %d", o.K)
+	}
+	if o.FetchK < o.K {
+		return MMROptions{}, fmt.Errorf("mmr fetchK (%d) must be at least k (%d)", o.FetchK, o.K)
+	}
+	if o.Lambda < 0 || o.Lambda > 1 {
+		return MMROptions{}, fmt.Errorf("mmr lambda must be between 0 and 1, got %v", o.Lambda)
+	}
+	return o, nil
+}
+
+// parseEmbedding converts an embedding selected as text into a slice.
+func parseEmbedding(v any) ([]float32, error) {
+	var vec pgvector.Vector
+	if err := vec.Scan(v); err != nil {
+		return nil, err
+	}
+	return vec.Slice(), nil
+}
+
+// selectMMR returns the indexes of up to k candidates, in selection order,
+// chosen greedily to maximize
+//
+//	lambda*sim(query, c) - (1-lambda)*max(sim(c, s) for s already selected)
+//
+// where sim is the cosine similarity.
+func selectMMR(query []float32, candidates [][]float32, k int, lambda float32) []int {
+	k = min(k, len(candidates))
+	relevance := make([]float64, len(candidates))
+	for i, c := range candidates {
+		relevance[i] = cosineSimilarity(query, c)
+	}
+	// redundancy[i] is the largest similarity of candidate i to a selected one.
+	redundancy := make([]float64, len(candidates))
+	for i := range redundancy {
+		redundancy[i] = math.Inf(-1)
+	}
+	selected := make([]int, 0, k)
+	used := make([]bool, len(candidates))
+	for len(selected) < k {
+		best, bestScore := -1, math.Inf(-1)
+		for i := range candidates {
+			if used[i] {
+				continue
+			}
+			score := float64(lambda) * relevance[i]
+			if len(selected) > 0 {
+				score -= float64(1-lambda) * redundancy[i]
+			}
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		used[best] = true
+		selected = append(selected, best)
+		for i, c := range candidates {
+			if !used[i] {
+				redundancy[i] = max(redundancy[i], cosineSimilarity(candidates[best], c))
+			}
+		}
+	}
+	return selected
+}
+
+// cosineSimilarity returns the cosine similarity of a and b, or 0 if either
+// is the zero vector.
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range min(len(a), len(b)) {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
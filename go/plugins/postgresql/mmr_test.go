@@ -0,0 +1,48 @@
+package postgresql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMMROptionsWithDefaults(t *testing.T) {
+	o, err := MMROptions{Lambda: 0.5}.withDefaults(4)
+	assert.NoError(t, err)
+	assert.Equal(t, MMROptions{K: 4, FetchK: 20, Lambda: 0.5}, o)
+	o, err = MMROptions{Lambda: 0.5}.withDefaults(10)
+	assert.NoError(t, err)
+	assert.Equal(t, MMROptions{K: 10, FetchK: 50, Lambda: 0.5}, o)
+
+	for _, o := range []MMROptions{
+		{K: 5, FetchK: 3, Lambda: 0.5},
+		{K: -1, FetchK: 3, Lambda: 0.5},
+		{K: 2, FetchK: 3, Lambda: -0.1},
+		{K: 2, FetchK: 3, Lambda: 1.1},
+	} {
+		_, err := o.withDefaults(4)
+		assert.Error(t, err, "%+v", o)
+	}
+}
+
+func TestSelectMMR(t *testing.T) {
+	query := []float32{1, 0}
+	candidates := [][]float32{
+		{1, 0},      // most relevant
+		{0.99, 0.1}, // near duplicate of the first
+		{0.6, 0.8},  // less relevant but different
+	}
+	assert.Equal(t, []int{0, 1}, selectMMR(query, candidates, 2, 1))
+	assert.Equal(t, []int{0, 2}, selectMMR(query, candidates, 2, 0.3))
+	assert.Equal(t, []int{0, 2, 1}, selectMMR(query, candidates, 5, 0.3))
+	assert.Empty(t, selectMMR(query, nil, 2, 0.5))
+}
+
+func TestParseEmbedding(t *testing.T) {
+	vec, err := parseEmbedding("[1,2.5,-3]")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{1, 2.5, -3}, vec)
+
+	_, err = parseEmbedding(42)
+	assert.Error(t, err)
+}
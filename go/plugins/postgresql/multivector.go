@@ -0,0 +1,157 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// MultiVectorOptions configures multi-vector retrieval, which ranks
+// documents by a weighted sum of their distances to the query in several
+// embedding columns, such as an embedding of their title and one of their
+// body. The combined distance is reported as [DistanceMetadataKey], and the
+// score derived from it with [DistanceStrategy.Score].
+//
+// Vector indexes cannot serve the combined order, so that the query scans
+// the rows matching the filters of the retrieval.
+type MultiVectorOptions struct {
+	// Columns are the embedding columns searched and their weights. At
+	// least two distinct columns are required. Rows whose embedding is NULL
+	// in any of them are skipped.
+	Columns []WeightedColumn `json:"columns"`
+}
+
+// WeightedColumn is an embedding column of a multi-vector retrieval.
+type WeightedColumn struct {
+	// Column is the embedding column, such as one of the
+	// [VectorstoreTableOptions.AdditionalEmbeddingColumns].
+	Column string `json:"column"`
+	// Weight multiplies the distance to the query in the column. Weights
+	// must not be negative, and at least one must be positive.
+	Weight float64 `json:"weight"`
+	// QueryEmbedding, if set, is the embedding searched for in the column.
+	// The default is the embedding of the query document by the embedder
+	// of the column, as for [RetrieverOptions.EmbeddingColumn].
+	QueryEmbedding []float32 `json:"queryEmbedding,omitempty"`
+}
+
+// validate reports an error if o cannot be used for a retrieval from ds.
+func (o *MultiVectorOptions) validate(ds *docStore) error {
+	if len(o.Columns) < 2 {
+		return fmt.Errorf("multi-vector retrieval requires at least two columns, got %d", len(o.Columns))
+	}
+	seen := make(map[string]bool, len(o.Columns))
+	positive := false
+	for _, c := range o.Columns {
+		if c.Column == "" {
+			return errors.New("multi-vector column is required")
+		}
+		if seen[c.Column] {
+			return fmt.Errorf("multi-vector column %q is repeated", c.Column)
+		}
+		seen[c.Column] = true
+		if ds.vectorColumns != nil && !ds.vectorColumns[c.Column] {
+			return fmt.Errorf("column %q is not an embedding column of table %q", c.Column, ds.config.TableName)
+		}
+		if c.Weight < 0 || math.IsNaN(c.Weight) || math.IsInf(c.Weight, 0) {
+			return fmt.Errorf("weight of multi-vector column %q must be a non-negative number, got %v", c.Column, c.Weight)
+		}
+		positive = positive || c.Weight > 0
+	}
+	if !positive {
+		return errors.New("multi-vector retrieval requires a positive weight")
+	}
+	return nil
+}
+
+// multiVectorEmbeddings returns the embeddings searched for in the columns
+// of the multi-vector retrieval of opts, in their order.
+func (ds *docStore) multiVectorEmbeddings(ctx context.Context, req *ai.RetrieverRequest, opts *RetrieverOptions) ([][]float32, error) {
+	vecs := make([][]float32, len(opts.MultiVector.Columns))
+	for i, c := range opts.MultiVector.Columns {
+		copts := *opts
+		copts.EmbeddingColumn = c.Column
+		copts.QueryEmbedding = c.QueryEmbedding
+		vec, err := ds.queryEmbedding(ctx, req, &copts)
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %w", c.Column, err)
+		}
+		vecs[i] = vec
+	}
+	return vecs, nil
+}
+
+// buildMultiVectorQuery returns the multi-vector search query for vecs, the
+// query embeddings of the columns of opts.MultiVector, and its arguments.
+// The rows have the same shape as those of buildRetrieveQuery, with the
+// weighted sum of distances as distance, and are ordered by it and then by
+// the tiebreaker column. The query vectors are bound to $1, $2, and so on,
+// in the order of the columns.
+func (ds *docStore) buildMultiVectorQuery(vecs [][]float32, k int, opts *RetrieverOptions) (string, []any, error) {
+	if opts.MMR != nil || opts.Hybrid != nil || opts.GroupBy != nil || opts.ReturnEmbedding {
+		return "", nil, errors.New("multi-vector retrieval cannot be combined with MMR, hybrid retrieval, grouping or returned embeddings")
+	}
+	if opts.EmbeddingColumn != "" || opts.Embedder != "" || opts.QueryEmbedding != nil {
+		return "", nil, errors.New("multi-vector retrieval takes its columns and query embeddings from its options")
+	}
+	if err := opts.MultiVector.validate(ds); err != nil {
+		return "", nil, err
+	}
+	if len(vecs) != len(opts.MultiVector.Columns) {
+		return "", nil, fmt.Errorf("expected %d query embeddings, got %d", len(opts.MultiVector.Columns), len(vecs))
+	}
+	args := &queryArgs{}
+	terms := make([]string, len(vecs))
+	for i, vec := range vecs {
+		queryVec, err := newVector(vec)
+		if err != nil {
+			return "", nil, fmt.Errorf("query %w", err)
+		}
+		terms[i] = fmt.Sprintf(`("%s" %s %s)`, opts.MultiVector.Columns[i].Column, ds.config.DistanceStrategy.operator(),
+			ds.engine.vectorType().cast(args.add(ds.engine.vectorArg(queryVec))))
+	}
+	for i, c := range opts.MultiVector.Columns {
+		terms[i] = fmt.Sprintf("%s::float8 * %s", args.add(c.Weight), terms[i])
+	}
+	distance := "(" + strings.Join(terms, " + ") + ")"
+
+	where, err := ds.retrieveWhere(ds.config.EmbeddingColumn, opts, args)
+	if err != nil {
+		return "", nil, err
+	}
+	conds := make([]string, 0, len(vecs)+3)
+	for _, c := range opts.MultiVector.Columns {
+		conds = append(conds, fmt.Sprintf(`"%s" IS NOT NULL`, c.Column))
+	}
+	if where != "" {
+		conds = append(conds, where)
+	}
+	if opts.After != nil {
+		after, err := ds.afterPredicate(distance, opts.After, args)
+		if err != nil {
+			return "", nil, err
+		}
+		conds = append(conds, after)
+	}
+	bounds, err := distanceBounds(distance, opts, args)
+	if err != nil {
+		return "", nil, err
+	}
+	if bounds != "" {
+		conds = append(conds, bounds)
+	}
+
+	quoted, err := ds.selectList("", opts, args)
+	if err != nil {
+		return "", nil, err
+	}
+	quoted = append(quoted, distance+" AS distance")
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY distance, "%s" LIMIT %d`,
+		strings.Join(quoted, ", "), qualifiedName(ds.config.SchemaName, ds.config.TableName),
+		strings.Join(conds, " AND "), ds.config.TiebreakerColumn, k)
+	return query, args.args, nil
+}
@@ -0,0 +1,85 @@
+package postgresql
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildMultiVectorQuery(t *testing.T) {
+	ds := testDocStore()
+	opts := &RetrieverOptions{
+		MultiVector: &MultiVectorOptions{Columns: []WeightedColumn{
+			{Column: "title_embedding", Weight: 0.3},
+			{Column: "embedding", Weight: 0.7},
+		}},
+		Filters: []Filter{{Key: "source", Value: "wiki"}},
+	}
+	query, args, err := ds.buildMultiVectorQuery([][]float32{{1, 2}, {3, 4}}, 4, opts)
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", ($3::float8 * ("title_embedding" <=> $1) + $4::float8 * ("embedding" <=> $2)) AS distance`+
+		` FROM "public"."documents" WHERE "title_embedding" IS NOT NULL AND "embedding" IS NOT NULL AND "source" = $5`+
+		` ORDER BY distance, "id" LIMIT 4`, query)
+	assert.Equal(t, []any{0.3, 0.7, "wiki"}, args[2:])
+
+	maxDistance := 0.5
+	opts.MaxDistance = &maxDistance
+	opts.After = &Cursor{Distance: 0.1, Key: "a"}
+	query, _, err = ds.buildMultiVectorQuery([][]float32{{1, 2}, {3, 4}}, 4, opts)
+	require.NoError(t, err)
+	distance := `($3::float8 * ("title_embedding" <=> $1) + $4::float8 * ("embedding" <=> $2))`
+	assert.Contains(t, query, `AND (`+distance+`, "id") > ($6::float8, $7) AND `+distance+` <= $8::float8 ORDER BY`)
+}
+
+func TestBuildMultiVectorQueryErrors(t *testing.T) {
+	ds := testDocStore()
+	ds.vectorColumns = map[string]bool{"embedding": true, "title_embedding": true}
+	columns := []WeightedColumn{{Column: "title_embedding", Weight: 1}, {Column: "embedding", Weight: 1}}
+	vecs := [][]float32{{1, 2}, {3, 4}}
+	testCases := []struct {
+		name string
+		opts *RetrieverOptions
+	}{
+		{"one column", &RetrieverOptions{MultiVector: &MultiVectorOptions{Columns: columns[:1]}}},
+		{"repeated column", &RetrieverOptions{MultiVector: &MultiVectorOptions{Columns: []WeightedColumn{columns[0], columns[0]}}}},
+		{"unknown column", &RetrieverOptions{MultiVector: &MultiVectorOptions{Columns: []WeightedColumn{columns[0], {Column: "body", Weight: 1}}}}},
+		{"negative weight", &RetrieverOptions{MultiVector: &MultiVectorOptions{Columns: []WeightedColumn{columns[0], {Column: "embedding", Weight: -1}}}}},
+		{"nan weight", &RetrieverOptions{MultiVector: &MultiVectorOptions{Columns: []WeightedColumn{columns[0], {Column: "embedding", Weight: math.NaN()}}}}},
+		{"zero weights", &RetrieverOptions{MultiVector: &MultiVectorOptions{Columns: []WeightedColumn{{Column: "title_embedding"}, {Column: "embedding"}}}}},
+		{"mmr", &RetrieverOptions{MultiVector: &MultiVectorOptions{Columns: columns}, MMR: &MMROptions{}}},
+		{"embedding column", &RetrieverOptions{MultiVector: &MultiVectorOptions{Columns: columns}, EmbeddingColumn: "embedding"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := ds.buildMultiVectorQuery(vecs, 4, tc.opts)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMultiVectorEmbeddings(t *testing.T) {
+	ds := testDocStore()
+	ds.config.Embedder = &fakeEmbedder{}
+	ds.columnDimensions = map[string]int{"title_embedding": -1}
+	opts := &RetrieverOptions{MultiVector: &MultiVectorOptions{Columns: []WeightedColumn{
+		{Column: "title_embedding", Weight: 1, QueryEmbedding: []float32{5}},
+		{Column: "embedding", Weight: 1},
+	}}}
+	vecs, err := ds.multiVectorEmbeddings(context.Background(), &ai.RetrieverRequest{Query: ai.DocumentFromText("3", nil)}, opts)
+	require.NoError(t, err)
+	assert.Equal(t, [][]float32{{5}, {3}}, vecs)
+
+	_, err = ds.multiVectorEmbeddings(context.Background(), &ai.RetrieverRequest{}, opts)
+	assert.ErrorContains(t, err, `column "embedding"`)
+}
+
+func TestIsLookupMultiVector(t *testing.T) {
+	opts := &RetrieverOptions{Filters: []Filter{{Key: "a", Value: "b"}}}
+	assert.True(t, isLookup(&ai.RetrieverRequest{}, opts))
+	opts.MultiVector = &MultiVectorOptions{}
+	assert.False(t, isLookup(&ai.RetrieverRequest{}, opts))
+}
@@ -0,0 +1,82 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+
+	"github.com/firebase/genkit/go/core/logger"
+)
+
+// NonFinite is the handling of the non-finite elements, NaN and infinities,
+// of the embeddings of indexed documents. See [Config.NonFiniteEmbeddings].
+//
+// pgvector does not store such elements, but they are the mark of a faulty
+// embedder, whose other embeddings may be wrong too.
+type NonFinite string
+
+const (
+	// NonFiniteReject rejects the index requests with documents whose
+	// embeddings have non-finite elements, with an error wrapping
+	// [ErrNonFiniteEmbedding] that names the document.
+	NonFiniteReject NonFinite = "reject"
+	// NonFiniteSanitize replaces the non-finite elements with zeros and logs
+	// a warning naming the document. Embeddings left with no non-zero
+	// element are still rejected with [CosineDistance], for which they are
+	// at no defined distance of any query.
+	NonFiniteSanitize NonFinite = "sanitize"
+)
+
+func (n NonFinite) validate() error {
+	switch n {
+	case NonFiniteReject, NonFiniteSanitize:
+		return nil
+	}
+	return fmt.Errorf("unsupported non-finite embedding handling %q", n)
+}
+
+// sanitize applies the handling of non-finite elements of ds to emb, the
+// embedding of the document id, returning a new slice if elements are
+// replaced. With [NonFiniteReject], emb is returned as is, to be rejected by
+// newVector.
+func (ds *docStore) sanitize(id string, emb []float32) ([]float32, error) {
+	if ds.config.NonFiniteEmbeddings != NonFiniteSanitize {
+		return emb, nil
+	}
+	var out []float32
+	zero := true
+	for i, f := range emb {
+		if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+			if out == nil {
+				out = make([]float32, len(emb))
+				copy(out, emb)
+			}
+			out[i] = 0
+			continue
+		}
+		zero = zero && f == 0
+	}
+	if out == nil {
+		return emb, nil
+	}
+	if zero && ds.config.DistanceStrategy == CosineDistance {
+		return nil, fmt.Errorf("%w: no element is finite and non-zero, so the embedding has no cosine distance", ErrNonFiniteEmbedding)
+	}
+	slog.Default().Warn("replaced the non-finite elements of an embedding with zeros",
+		"table", ds.config.TableName, "id", id)
+	return out, nil
+}
+
+// finiteDistance reports whether a row selected by a retrieval has a finite
+// distance, or none. A row at a NaN distance, such as a zero embedding with
+// [CosineDistance], has no rank, and is logged so that it can be fixed.
+func (ds *docStore) finiteDistance(ctx context.Context, values []any) bool {
+	distance, ok := ds.rowDistance(values)
+	if !ok || !math.IsNaN(distance) && !math.IsInf(distance, 0) {
+		return true
+	}
+	logger.FromContext(ctx).Warn("skipping a retrieved document at a non-finite distance; check its embedding",
+		"table", ds.config.TableName, "id", idToString(values[0]), "distance", distance)
+	return false
+}
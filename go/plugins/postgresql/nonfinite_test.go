@@ -0,0 +1,64 @@
+package postgresql
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewIndexRowNonFinite(t *testing.T) {
+	ds := testDocStore()
+	nan := float32(math.NaN())
+	doc := testDocuments("1")[0]
+	doc.Metadata = map[string]any{"id": "doc-1"}
+
+	_, err := ds.newIndexRow(doc, []float32{1, nan})
+	assert.ErrorIs(t, err, ErrNonFiniteEmbedding)
+	assert.ErrorContains(t, err, `id "doc-1"`)
+
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	ds.config.NonFiniteEmbeddings = NonFiniteSanitize
+	row, err := ds.newIndexRow(doc, []float32{1, nan, float32(math.Inf(-1))})
+	require.NoError(t, err)
+	assert.Equal(t, []float32{1, 0, 0}, row.embedding.Slice())
+	assert.Contains(t, buf.String(), "id=doc-1")
+
+	_, err = ds.newIndexRow(doc, []float32{nan, 0})
+	assert.ErrorIs(t, err, ErrNonFiniteEmbedding)
+	ds.config.DistanceStrategy = EuclideanDistance
+	_, err = ds.newIndexRow(doc, []float32{nan, 0})
+	assert.NoError(t, err)
+
+	assert.Error(t, NonFinite("drop").validate())
+}
+
+func TestSanitizeFinite(t *testing.T) {
+	ds := testDocStore()
+	ds.config.NonFiniteEmbeddings = NonFiniteSanitize
+	emb := []float32{0, 0}
+	got, err := ds.sanitize("a", emb)
+	require.NoError(t, err)
+	assert.Same(t, &emb[0], &got[0])
+}
+
+func TestFiniteDistance(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	ds := testDocStore()
+	ctx := context.Background()
+	assert.True(t, ds.finiteDistance(ctx, []any{"a", "text", nil, "wiki", 0.25}))
+	assert.True(t, ds.finiteDistance(ctx, []any{"a", "text", nil, "wiki", nil}))
+	assert.Empty(t, buf.String())
+	assert.False(t, ds.finiteDistance(ctx, []any{"b", "text", nil, "wiki", math.NaN()}))
+	assert.False(t, ds.finiteDistance(ctx, []any{"c", "text", nil, "wiki", math.Inf(1)}))
+	assert.Contains(t, buf.String(), "id=b")
+	assert.Contains(t, buf.String(), "id=c")
+}
@@ -0,0 +1,64 @@
+package postgresql
+
+import (
+	"fmt"
+	"math"
+)
+
+// defaultNormalizeTolerance is the default [Config.NormalizeTolerance].
+const defaultNormalizeTolerance = 1e-3
+
+// Normalization is the handling of embedding lengths by the retriever and
+// the indexer. See [Config.Normalization].
+//
+// [InnerProduct] only ranks like cosine similarity for embeddings of unit
+// length, so a model whose embeddings are not normalized silently gives
+// wrong rankings with it.
+type Normalization string
+
+const (
+	// NormalizeOff uses embeddings as they are.
+	NormalizeOff Normalization = "off"
+	// NormalizeCheck rejects embeddings whose length differs from 1 by more
+	// than [Config.NormalizeTolerance].
+	NormalizeCheck Normalization = "check"
+	// NormalizeEmbeddings scales embeddings to unit length.
+	NormalizeEmbeddings Normalization = "normalize"
+)
+
+func (n Normalization) validate() error {
+	switch n {
+	case NormalizeOff, NormalizeCheck, NormalizeEmbeddings:
+		return nil
+	}
+	return fmt.Errorf("unsupported normalization %q", n)
+}
+
+// normalize applies the normalization of ds to vec, returning a new slice
+// if vec is scaled.
+func (ds *docStore) normalize(vec []float32) ([]float32, error) {
+	if ds.config.Normalization == "" || ds.config.Normalization == NormalizeOff {
+		return vec, nil
+	}
+	var sum float64
+	for _, f := range vec {
+		sum += float64(f) * float64(f)
+	}
+	norm := math.Sqrt(sum)
+	switch ds.config.Normalization {
+	case NormalizeCheck:
+		if math.Abs(norm-1) > ds.config.NormalizeTolerance {
+			return nil, fmt.Errorf("embedding has length %g, but unit length is required (tolerance %g)", norm, ds.config.NormalizeTolerance)
+		}
+		return vec, nil
+	default:
+		if norm == 0 || math.IsNaN(norm) || math.IsInf(norm, 0) {
+			return nil, fmt.Errorf("embedding of length %g cannot be normalized", norm)
+		}
+		out := make([]float32, len(vec))
+		for i, f := range vec {
+			out[i] = float32(float64(f) / norm)
+		}
+		return out, nil
+	}
+}
@@ -0,0 +1,40 @@
+package postgresql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	ds := testDocStore()
+	vec, err := ds.normalize([]float32{3, 4})
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{3, 4}, vec)
+
+	ds.config.Normalization = NormalizeCheck
+	ds.config.NormalizeTolerance = defaultNormalizeTolerance
+	_, err = ds.normalize([]float32{3, 4})
+	assert.Error(t, err)
+	_, err = ds.normalize([]float32{0.6, 0.8})
+	assert.NoError(t, err)
+	_, err = ds.normalize([]float32{0.6, 0.8005})
+	assert.NoError(t, err)
+
+	ds.config.Normalization = NormalizeEmbeddings
+	vec, err = ds.normalize([]float32{3, 4})
+	assert.NoError(t, err)
+	assert.InDeltaSlice(t, []float32{0.6, 0.8}, vec, 1e-6)
+	_, err = ds.normalize([]float32{0, 0})
+	assert.Error(t, err)
+
+	assert.Error(t, Normalization("l1").validate())
+}
+
+func TestNewIndexRowNormalizes(t *testing.T) {
+	ds := testDocStore()
+	ds.config.Normalization = NormalizeCheck
+	ds.config.NormalizeTolerance = defaultNormalizeTolerance
+	_, err := ds.newIndexRow(testDocuments("1")[0], []float32{1, 1})
+	assert.ErrorContains(t, err, "unit length")
+}
@@ -0,0 +1,54 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ordered reports whether the documents of a retrieval with opts are ordered
+// by [RetrieverOptions.OrderBy] rather than by distance.
+func ordered(opts *RetrieverOptions) bool {
+	return opts.OrderBy != "" || opts.OrderDesc
+}
+
+// checkOrder returns an error if the order of opts cannot be applied to the
+// similarity search of opts, reranked with rerank.
+func (ds *docStore) checkOrder(opts *RetrieverOptions, rerank bool) error {
+	switch {
+	case ds.config.TextSearch != nil || ds.config.QueryTemplate != "":
+		return errors.New("ordering cannot be combined with text search or a query template")
+	case opts.MMR != nil || opts.Hybrid != nil || opts.GroupBy != nil || opts.MultiVector != nil || opts.After != nil || opts.RollUp != nil || opts.Boost != nil:
+		return errors.New("ordering cannot be combined with MMR, hybrid retrieval, grouping, multi-vector retrieval, pagination, roll-ups or boosts")
+	case rerank:
+		return errors.New("ordering cannot be combined with reranking")
+	}
+	return nil
+}
+
+// orderKey returns the expression of the key of [RetrieverOptions.OrderBy]
+// ordering the documents before the tiebreaker, or "" if they are ordered by
+// the tiebreaker only.
+func (ds *docStore) orderKey(opts *RetrieverOptions, args *queryArgs) (string, error) {
+	switch opts.OrderBy {
+	case "", ds.config.TiebreakerColumn:
+		return "", nil
+	case ds.config.IDColumn:
+		return fmt.Sprintf(`"%s"`, opts.OrderBy), nil
+	}
+	return ds.metadataKeyExpr("order key", opts.OrderBy, args)
+}
+
+// orderQuery returns the query returning the rows of query ordered by opts.
+// query selects the order key, if any, as order_key and the tiebreaker as
+// order_tiebreaker.
+func orderQuery(query string, key string, opts *RetrieverOptions) string {
+	dir := ""
+	if opts.OrderDesc {
+		dir = " DESC"
+	}
+	order := "order_tiebreaker" + dir
+	if key != "" {
+		order = "order_key" + dir + ", " + order
+	}
+	return fmt.Sprintf(`SELECT * FROM (%s) AS nearest ORDER BY %s`, query, order)
+}
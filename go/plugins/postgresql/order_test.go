@@ -0,0 +1,41 @@
+package postgresql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildRetrieveQueryOrdered(t *testing.T) {
+	ds := testDocStore()
+	query, args, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{OrderBy: "published_at", OrderDesc: true})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM (SELECT "id", "content", "metadata", "source", "embedding" <=> $1 AS distance,`+
+		` "metadata"->>$2 AS order_key, "id" AS order_tiebreaker FROM "public"."documents" ORDER BY distance, "id" LIMIT 4) AS nearest`+
+		` ORDER BY order_key DESC, order_tiebreaker DESC`, query)
+	assert.Equal(t, "published_at", args[1])
+
+	// The nearest documents are rescored before they are ordered.
+	ds.engine.config.rescoreMultiplier = 2
+	ds.engine.config.rescorePrecision = RescoreHalfVec
+	ds.dimension = 2
+	query, _, err = ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{OrderBy: "source"})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM (SELECT * FROM (SELECT "id", "content", "metadata", "source", "embedding" <=> $1 AS distance,`+
+		` "source" AS order_key, "id" AS order_tiebreaker, "id" AS rescore_tiebreaker FROM "public"."documents"`+
+		` ORDER BY "embedding"::halfvec(2) <=> $1::halfvec(2), "id" LIMIT 8) AS candidates`+
+		` ORDER BY distance, rescore_tiebreaker LIMIT 4) AS nearest ORDER BY order_key, order_tiebreaker`, query)
+
+	ds.config.MetadataJSONColumn = ""
+	_, _, err = ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{OrderBy: "published_at"})
+	assert.ErrorContains(t, err, `order key "published_at" requires a metadata JSON column`)
+}
+
+func TestCheckOrder(t *testing.T) {
+	ds := testDocStore()
+	assert.NoError(t, ds.checkOrder(&RetrieverOptions{OrderBy: "source"}, false))
+	assert.Error(t, ds.checkOrder(&RetrieverOptions{OrderBy: "source"}, true))
+	assert.Error(t, ds.checkOrder(&RetrieverOptions{OrderDesc: true, GroupBy: &GroupOptions{Key: "source"}}, false))
+	ds.config.QueryTemplate = "SELECT 1"
+	assert.Error(t, ds.checkOrder(&RetrieverOptions{OrderBy: "source"}, false))
+}
@@ -0,0 +1,211 @@
+package postgresql
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// Cursor is a position in the results of a similarity search, used to
+// fetch the page of results that follows it with [RetrieverOptions.After].
+//
+// Results are ordered by distance and then by [Config.TiebreakerColumn], so
+// a cursor holds both values of the last document of a page. Unlike an
+// OFFSET, which makes the database read and discard all the rows of the
+// previous pages, and shifts the pages when rows are written between
+// requests, a cursor resumes the search where the previous page ended: no row
+// is returned twice, and rows written since are only returned if they come
+// after the cursor. [Cursor.Token] encodes a cursor as an opaque string that
+// can be stored between processes.
+//
+// Vector indexes are approximate and scan a bounded number of candidates, so
+// deep pages over an index may return fewer documents than requested, as
+// with filters; raise [RetrieverOptions.HNSWEfSearch] or
+// [RetrieverOptions.IVFFlatProbes] if needed.
+type Cursor struct {
+	Distance float64 `json:"distance"` // Distance of the last document.
+	Key      any     `json:"key"`      // Tiebreaker column value of the last document.
+}
+
+// NextCursor returns the cursor of the page ending with doc, a document
+// returned by a retriever, whose tiebreaker column is keyColumn, by default
+// the id column. It requires the distance in the document metadata, which
+// [WithScoreInMetadata] must not disable, and keyColumn among the metadata.
+func NextCursor(doc *ai.Document, keyColumn string) (*Cursor, error) {
+	if doc == nil {
+		return nil, errors.New("postgres.NextCursor: document is required")
+	}
+	distance, ok := doc.Metadata[DistanceMetadataKey].(float64)
+	if !ok {
+		return nil, fmt.Errorf("postgres.NextCursor: document has no %q metadata", DistanceMetadataKey)
+	}
+	key, ok := doc.Metadata[keyColumn]
+	if !ok || key == nil {
+		return nil, fmt.Errorf("postgres.NextCursor: document has no %q metadata", keyColumn)
+	}
+	return &Cursor{Distance: distance, Key: key}, nil
+}
+
+// afterPredicate returns the condition selecting the rows that follow
+// cursor c in the order of the results, where distance is the expression of
+// the distance of a row.
+func (ds *docStore) afterPredicate(distance string, c *Cursor, args *queryArgs) (string, error) {
+	if c.Key == nil {
+		return "", errors.New("cursor key must not be nil")
+	}
+	return fmt.Sprintf(`(%s, "%s") > (%s::float8, %s)`,
+		distance, ds.config.TiebreakerColumn, args.add(c.Distance), args.add(c.Key)), nil
+}
+
+// cursorTokenVersion is the version of the format of cursor tokens, which
+// [ParseCursorToken] checks so that tokens of another format are rejected
+// rather than misread.
+const cursorTokenVersion = 1
+
+// cursorToken is the encoded content of a cursor token. The key is held as
+// text along with its type, so that it is decoded with the type it had.
+type cursorToken struct {
+	Version  int     `json:"v"`
+	Distance float64 `json:"d"`
+	KeyType  string  `json:"t"`
+	Key      string  `json:"k"`
+}
+
+// Token returns c as an opaque token, such as to store the position of a
+// scan of a table in similarity order and resume it after a restart with
+// [RetrieverOptions.AfterToken]. The key must be a string, an integer, a
+// float, a boolean or a time, as are the values of the tiebreaker columns
+// read by retrievers. Tokens are versioned, and [ParseCursorToken] rejects
+// those of other versions with an error wrapping [ErrInvalidCursorToken].
+func (c *Cursor) Token() (string, error) {
+	if math.IsNaN(c.Distance) || math.IsInf(c.Distance, 0) {
+		return "", fmt.Errorf("postgres.Cursor.Token: cursor distance %v is not finite", c.Distance)
+	}
+	t := cursorToken{Version: cursorTokenVersion, Distance: c.Distance}
+	switch key := c.Key.(type) {
+	case string:
+		t.KeyType, t.Key = "string", key
+	case int:
+		t.KeyType, t.Key = "int", strconv.FormatInt(int64(key), 10)
+	case int16:
+		t.KeyType, t.Key = "int", strconv.FormatInt(int64(key), 10)
+	case int32:
+		t.KeyType, t.Key = "int", strconv.FormatInt(int64(key), 10)
+	case int64:
+		t.KeyType, t.Key = "int", strconv.FormatInt(key, 10)
+	case float32:
+		t.KeyType, t.Key = "float", strconv.FormatFloat(float64(key), 'g', -1, 32)
+	case float64:
+		t.KeyType, t.Key = "float", strconv.FormatFloat(key, 'g', -1, 64)
+	case bool:
+		t.KeyType, t.Key = "bool", strconv.FormatBool(key)
+	case time.Time:
+		t.KeyType, t.Key = "time", key.Format(time.RFC3339Nano)
+	case nil:
+		return "", errors.New("postgres.Cursor.Token: cursor key must not be nil")
+	default:
+		return "", fmt.Errorf("postgres.Cursor.Token: unsupported cursor key type %T", c.Key)
+	}
+	b, err := json.Marshal(t)
+	if err != nil {
+		return "", fmt.Errorf("postgres.Cursor.Token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ParseCursorToken returns the cursor encoded in token by [Cursor.Token].
+// Malformed tokens and tokens of another version are rejected with an error
+// wrapping [ErrInvalidCursorToken].
+func ParseCursorToken(token string) (*Cursor, error) {
+	c, err := parseCursorToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.ParseCursorToken: %w: %w", ErrInvalidCursorToken, err)
+	}
+	return c, nil
+}
+
+func parseCursorToken(token string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.New("malformed token")
+	}
+	var t cursorToken
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, errors.New("malformed token")
+	}
+	if t.Version != cursorTokenVersion {
+		return nil, fmt.Errorf("token version %d is not supported, want %d", t.Version, cursorTokenVersion)
+	}
+	c := &Cursor{Distance: t.Distance}
+	switch t.KeyType {
+	case "string":
+		c.Key = t.Key
+	case "int":
+		c.Key, err = strconv.ParseInt(t.Key, 10, 64)
+	case "float":
+		c.Key, err = strconv.ParseFloat(t.Key, 64)
+	case "bool":
+		c.Key, err = strconv.ParseBool(t.Key)
+	case "time":
+		c.Key, err = time.Parse(time.RFC3339Nano, t.Key)
+	default:
+		return nil, fmt.Errorf("unknown key type %q", t.KeyType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s key %q", t.KeyType, t.Key)
+	}
+	return c, nil
+}
+
+// withAfterToken returns opts with the cursor of [RetrieverOptions.AfterToken]
+// as [RetrieverOptions.After], if set.
+func withAfterToken(opts *RetrieverOptions) (*RetrieverOptions, error) {
+	if opts.AfterToken == "" {
+		return opts, nil
+	}
+	if opts.After != nil {
+		return nil, errors.New("After and AfterToken cannot both be set")
+	}
+	c, err := parseCursorToken(opts.AfterToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCursorToken, err)
+	}
+	decoded := *opts
+	decoded.After = c
+	decoded.AfterToken = ""
+	return &decoded, nil
+}
+
+// pageable reports whether the documents of r are ordered by distance and
+// then by the tiebreaker column, so that the last of them is a cursor from
+// which the next page of r follows.
+func (r *retrieval) pageable() bool {
+	o := r.opts
+	return !r.rerank && !r.rollUp && o.MMR == nil && o.Hybrid == nil && o.GroupBy == nil &&
+		o.Boost == nil && o.MergeChunks == nil && !ordered(o)
+}
+
+// nextToken returns the token of the cursor following the last document of
+// res, or "" if res is empty or its last document has no distance or no
+// value of the tiebreaker column among its metadata.
+func (ds *docStore) nextToken(res *RetrieveResult) string {
+	if len(res.Documents) == 0 {
+		return ""
+	}
+	last := res.Documents[len(res.Documents)-1]
+	key, ok := last.Document.Metadata[ds.config.TiebreakerColumn]
+	if last.Distance == nil || !ok || key == nil {
+		return ""
+	}
+	token, err := (&Cursor{Distance: *last.Distance, Key: key}).Token()
+	if err != nil {
+		return ""
+	}
+	return token
+}
@@ -0,0 +1,115 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/base64"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildRetrieveQueryAfter(t *testing.T) {
+	ds := testDocStore()
+	opts := &RetrieverOptions{
+		Filters: []Filter{{Key: "lang", Value: "en"}},
+		After:   &Cursor{Distance: 0.25, Key: "doc-7"},
+	}
+	query, args, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", "embedding" <=> $1 AS distance FROM "public"."documents"`+
+		` WHERE "metadata"->>$2 = $3 AND ("embedding" <=> $1, "id") > ($4::float8, $5) ORDER BY distance, "id" LIMIT 4`, query)
+	assert.Equal(t, []any{"lang", "en", 0.25, "doc-7"}, args[1:])
+
+	_, _, err = ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{After: &Cursor{Distance: 0.25}})
+	assert.Error(t, err)
+}
+
+func TestNextCursor(t *testing.T) {
+	doc := ai.DocumentFromText("a", map[string]any{"id": "doc-7", DistanceMetadataKey: 0.25})
+	c, err := NextCursor(doc, "id")
+	assert.NoError(t, err)
+	assert.Equal(t, &Cursor{Distance: 0.25, Key: "doc-7"}, c)
+
+	_, err = NextCursor(doc, "created_at")
+	assert.Error(t, err)
+	_, err = NextCursor(ai.DocumentFromText("a", map[string]any{"id": "doc-7"}), "id")
+	assert.Error(t, err)
+	_, err = NextCursor(nil, "id")
+	assert.Error(t, err)
+}
+
+func TestCursorToken(t *testing.T) {
+	for _, c := range []*Cursor{
+		{Distance: 0.25, Key: "doc-7"},
+		{Distance: -1.5, Key: int64(1) << 60},
+		{Distance: 0, Key: 2.5},
+		{Distance: 0.125, Key: true},
+		{Distance: 1, Key: time.Date(2026, 10, 14, 9, 30, 0, 123456789, time.UTC)},
+	} {
+		token, err := c.Token()
+		assert.NoError(t, err)
+		got, err := ParseCursorToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, c, got)
+	}
+
+	token, err := (&Cursor{Distance: 0.25, Key: 7}).Token()
+	assert.NoError(t, err)
+	got, err := ParseCursorToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, &Cursor{Distance: 0.25, Key: int64(7)}, got)
+
+	for _, c := range []*Cursor{{Distance: 0.25}, {Distance: 0.25, Key: []byte("a")}, {Distance: math.NaN(), Key: "a"}} {
+		_, err := c.Token()
+		assert.Error(t, err)
+	}
+
+	v2 := base64.RawURLEncoding.EncodeToString([]byte(`{"v":2,"d":0.25,"t":"string","k":"doc-7"}`))
+	for _, token := range []string{"", "not a token!", v2, base64.RawURLEncoding.EncodeToString([]byte(`{"v":1,"t":"int","k":"x"}`))} {
+		_, err := ParseCursorToken(token)
+		assert.ErrorIs(t, err, ErrInvalidCursorToken, token)
+	}
+}
+
+func TestPrepareRetrievalAfterToken(t *testing.T) {
+	ds := testDocStore()
+	token, err := (&Cursor{Distance: 0.25, Key: "doc-7"}).Token()
+	assert.NoError(t, err)
+	r, err := ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{
+		Options: &RetrieverOptions{QueryEmbedding: []float32{1, 2}, AfterToken: token},
+	}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, &Cursor{Distance: 0.25, Key: "doc-7"}, r.opts.After)
+	assert.Contains(t, r.query, `("embedding" <=> $1, "id") > ($2::float8, $3)`)
+	assert.True(t, r.pageable())
+
+	for _, opts := range []*RetrieverOptions{
+		{QueryEmbedding: []float32{1, 2}, AfterToken: "bad"},
+		{QueryEmbedding: []float32{1, 2}, AfterToken: token, After: &Cursor{Distance: 0.25, Key: "doc-7"}},
+		{QueryEmbedding: []float32{1, 2}, AfterToken: token, MMR: &MMROptions{}},
+	} {
+		_, err := ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{Options: opts}, false)
+		assert.Error(t, err)
+	}
+}
+
+func TestNextToken(t *testing.T) {
+	ds := testDocStore()
+	distance := 0.25
+	res := ds.retrieveResult([]*ai.Document{
+		ai.DocumentFromText("a", map[string]any{"id": "doc-6"}),
+		ai.DocumentFromText("b", map[string]any{"id": "doc-7"}),
+	}, nil, 2)
+	assert.Empty(t, ds.nextToken(res))
+	res.Documents[1].Distance = &distance
+	c, err := ParseCursorToken(ds.nextToken(res))
+	assert.NoError(t, err)
+	assert.Equal(t, &Cursor{Distance: 0.25, Key: "doc-7"}, c)
+	assert.Empty(t, ds.nextToken(&RetrieveResult{}))
+
+	assert.False(t, (&retrieval{opts: &RetrieverOptions{MMR: &MMROptions{}}}).pageable())
+	assert.False(t, (&retrieval{opts: &RetrieverOptions{}, rerank: true}).pageable())
+}
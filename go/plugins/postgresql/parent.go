@@ -0,0 +1,239 @@
+package postgresql
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/core/logger"
+)
+
+// ParentOptions configures a parent/child layout, in which the documents of
+// the table are chunks of larger parent documents stored in a table of their
+// own, so that retrievals can return the parents of the nearest chunks with
+// [RetrieverOptions.RollUp]. The parent table only needs an ID and a content
+// column; to also search whole-document embeddings, such as for clustering or
+// deduplication, give it an embedding column and define a retriever and an
+// indexer for it with a Config of its own.
+type ParentOptions struct {
+	// Column is the column of the table holding the ID of the parent of each
+	// chunk, of the type of the parent IDs. Chunks without a parent are
+	// skipped by roll-ups. List it in [Config.MetadataColumns] for the
+	// indexer to write it from the metadata of the chunks. Required.
+	Column string
+	// TableName is the name of the table of the parent documents. Required.
+	TableName string
+	// SchemaName is the schema of the parent table. The default is the
+	// schema of the chunk table.
+	SchemaName string
+	// IDColumn is the ID column of the parent table. The default is "id".
+	IDColumn string
+	// ContentColumn is the text content column of the parent table. The
+	// default is "content".
+	ContentColumn string
+	// MetadataJSONColumn is the JSON metadata column of the parent table, if
+	// any, whose contents are the metadata of the parent documents.
+	MetadataJSONColumn string
+}
+
+// RollUpOptions returns the parent documents of the nearest chunks in place
+// of the chunks, each once, at the distance of its nearest chunk. See
+// [ParentOptions].
+type RollUpOptions struct {
+	// FetchK is the number of nearest chunks fetched as candidates before
+	// rolling them up, so that the vector index can serve the search. It
+	// must be at least the K of the retrieval. The default is 5*K. Fewer
+	// than K parents are returned if the candidates have too few parents.
+	FetchK int `json:"fetchK,omitempty"`
+}
+
+// withDefaults returns a copy of o with the defaults applied for a retrieval
+// of k parents, or an error if o is invalid.
+func (o RollUpOptions) withDefaults(k int) (RollUpOptions, error) {
+	if o.FetchK == 0 {
+		o.FetchK = 5 * k
+	}
+	if o.FetchK < k {
+		return RollUpOptions{}, fmt.Errorf("roll-up fetchK (%d) must be at least k (%d)", o.FetchK, k)
+	}
+	return o, nil
+}
+
+// validateParents applies the defaults of the parent configuration of the
+// table, if any, and checks its names.
+func (ds *docStore) validateParents() error {
+	p := ds.config.Parents
+	if p == nil {
+		return nil
+	}
+	withDefaults := *p
+	withDefaults.SchemaName = cmp.Or(p.SchemaName, ds.config.SchemaName)
+	withDefaults.IDColumn = cmp.Or(p.IDColumn, defaultIDColumn)
+	withDefaults.ContentColumn = cmp.Or(p.ContentColumn, defaultContentColumn)
+	ds.config.Parents = &withDefaults
+	if p.Column == "" || p.TableName == "" {
+		return errors.New("parents require a parent column and a parent table name")
+	}
+	names := []struct{ kind, name string }{
+		{"parent column", p.Column},
+		{"parent table name", p.TableName},
+		{"parent id column", withDefaults.IDColumn},
+		{"parent content column", withDefaults.ContentColumn},
+	}
+	if p.MetadataJSONColumn != "" {
+		names = append(names, struct{ kind, name string }{"parent metadata JSON column", p.MetadataJSONColumn})
+	}
+	for _, n := range names {
+		if err := validateQuotedIdentifier(n.kind, n.name); err != nil {
+			return err
+		}
+	}
+	return validateIdentifier("parent schema name", withDefaults.SchemaName)
+}
+
+// checkRollUp reports whether the retrieval of req with opts, which sets
+// RollUp, is supported.
+func (ds *docStore) checkRollUp(req *ai.RetrieverRequest, opts *RetrieverOptions) error {
+	switch {
+	case ds.config.Parents == nil:
+		return errors.New("rolling up requires parents to be configured for the table")
+	case isLookup(req, opts):
+		return errors.New("rolling up requires a query")
+	case ds.config.TextSearch != nil || ds.config.QueryTemplate != "":
+		return errors.New("rolling up cannot be combined with text search or a query template")
+	case opts.MMR != nil || opts.Hybrid != nil || opts.GroupBy != nil || opts.MultiVector != nil || opts.After != nil:
+		return errors.New("rolling up cannot be combined with MMR, hybrid retrieval, grouping, multi-vector retrieval or pagination")
+	case opts.CountTotal || opts.ReturnEmbedding || len(opts.MetadataKeys) > 0:
+		return errors.New("rolling up cannot be combined with total counts, returned embeddings or metadata keys")
+	}
+	return nil
+}
+
+// buildParentQuery returns the query of the k parents of the chunks nearest
+// to vec, and its arguments. The nearest chunks with a parent are selected
+// in a subquery, then the nearest chunk of each parent. Rows are the ID, the
+// content and the JSON metadata, if any, of the parents, then the distance.
+func (ds *docStore) buildParentQuery(vec []float32, k int, opts *RetrieverOptions) (string, []any, error) {
+	rollUp, err := opts.RollUp.withDefaults(k)
+	if err != nil {
+		return "", nil, err
+	}
+	queryVec, err := newVector(vec)
+	if err != nil {
+		return "", nil, fmt.Errorf("query %w", err)
+	}
+	column, err := ds.searchColumn(opts)
+	if err != nil {
+		return "", nil, err
+	}
+	args := &queryArgs{}
+	distance := fmt.Sprintf(`"%s" %s %s`, column, ds.config.DistanceStrategy.operator(), ds.engine.vectorType().cast(args.add(ds.engine.vectorArg(queryVec))))
+	p := ds.config.Parents
+	where, err := ds.retrieveWhere(column, opts, args)
+	if err != nil {
+		return "", nil, err
+	}
+	conds := []string{fmt.Sprintf(`"%s" IS NOT NULL`, p.Column)}
+	if where != "" {
+		conds = append(conds, where)
+	}
+	bounds, err := distanceBounds(distance, opts, args)
+	if err != nil {
+		return "", nil, err
+	}
+	if bounds != "" {
+		conds = append(conds, bounds)
+	}
+	chunks := fmt.Sprintf(`SELECT "%s" AS parent_id, %s AS distance FROM %s WHERE %s ORDER BY distance, "%s" LIMIT %d`,
+		p.Column, distance, qualifiedName(ds.config.SchemaName, ds.config.TableName), strings.Join(conds, " AND "), ds.config.TiebreakerColumn, rollUp.FetchK)
+	cols := fmt.Sprintf(`p."%s", p."%s"`, p.IDColumn, p.ContentColumn)
+	if p.MetadataJSONColumn != "" {
+		cols += fmt.Sprintf(`, p."%s"`, p.MetadataJSONColumn)
+	}
+	query := fmt.Sprintf(`SELECT %s, c.distance FROM (SELECT parent_id, min(distance) AS distance FROM (%s) AS chunks GROUP BY parent_id) AS c`+
+		` JOIN %s AS p ON p."%s" = c.parent_id ORDER BY c.distance, p."%[4]s" LIMIT %d`,
+		cols, chunks, qualifiedName(p.SchemaName, p.TableName), p.IDColumn, k)
+	return query, args.args, nil
+}
+
+// parentRowToDocument converts a row selected by buildParentQuery into a
+// document, whose metadata holds the contents of the JSON metadata column,
+// the ID and, unless disabled with [WithScoreInMetadata], the distance and
+// score.
+func (ds *docStore) parentRowToDocument(values []any) (*ai.Document, float64, error) {
+	p := ds.config.Parents
+	n := 3
+	if p.MetadataJSONColumn != "" {
+		n++
+	}
+	if len(values) != n {
+		return nil, 0, fmt.Errorf("expected %d columns, got %d", n, len(values))
+	}
+	content, ok := values[1].(string)
+	if !ok {
+		return nil, 0, fmt.Errorf("parent content column %q must be a text column, got %T", p.ContentColumn, values[1])
+	}
+	distance, ok := values[n-1].(float64)
+	if !ok {
+		return nil, 0, fmt.Errorf("expected a distance, got %T", values[n-1])
+	}
+	metadata := make(map[string]any)
+	if p.MetadataJSONColumn != "" {
+		if err := mergeJSONMetadata(metadata, values[2]); err != nil {
+			return nil, 0, fmt.Errorf("invalid metadata in parent column %q: %w", p.MetadataJSONColumn, err)
+		}
+	}
+	metadata[p.IDColumn] = idToString(values[0])
+	if !ds.engine.config.omitScore {
+		metadata[DistanceMetadataKey] = distance
+		metadata[ScoreMetadataKey] = ds.score(distance)
+	}
+	return ai.DocumentFromText(content, metadata), distance, nil
+}
+
+// retrieveParents reads the parents selected by the roll-up retrieval r of
+// req from rows, and returns them like retrieve.
+func (ds *docStore) retrieveParents(ctx, qctx context.Context, req *ai.RetrieverRequest, r *retrieval, rows queryRows) (*RetrieveResult, error) {
+	docs := []*ai.Document{}
+	distances := make(map[*ai.Document]float64)
+	candidates := 0
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, fmt.Errorf("postgres.Retrieve: failed to read row: %w", queryTimeoutError(qctx, err))
+		}
+		candidates++
+		doc, distance, err := ds.parentRowToDocument(values)
+		if err != nil {
+			return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+		}
+		if math.IsNaN(distance) || math.IsInf(distance, 0) {
+			logger.FromContext(ctx).Warn("skipping a retrieved parent document at a non-finite distance; check the embeddings of its chunks",
+				"table", ds.config.TableName, "id", doc.Metadata[ds.config.Parents.IDColumn], "distance", distance)
+			continue
+		}
+		if r.opts.ScoreThreshold != nil && ds.score(distance) < float64(*r.opts.ScoreThreshold) {
+			continue
+		}
+		distances[doc] = distance
+		docs = append(docs, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres.Retrieve: %w", queryTimeoutError(qctx, describeQueryError(err, ds.config)))
+	}
+	if r.rerank {
+		var err error
+		if docs, err = r.rerankDocuments(ctx, ds, req.Query, docs); err != nil {
+			return nil, err
+		}
+	}
+	docs, err := ds.engine.transformResult(ctx, ds.engine.withinTokenBudget(docs))
+	if err != nil {
+		return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+	}
+	return ds.retrieveResult(docs, distances, candidates), nil
+}
@@ -0,0 +1,97 @@
+package postgresql
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testParentDocStore(t *testing.T) *docStore {
+	t.Helper()
+	ds := testDocStore()
+	ds.config.Parents = &ParentOptions{Column: "parent_id", TableName: "articles", MetadataJSONColumn: "metadata"}
+	require.NoError(t, ds.validateParents())
+	return ds
+}
+
+// valueRows are query rows holding values.
+type valueRows struct {
+	sliceRows
+	rows [][]any
+}
+
+func (r *valueRows) Next() bool {
+	r.pos++
+	return r.pos <= len(r.rows)
+}
+
+func (r *valueRows) Values() ([]any, error) { return r.rows[r.pos-1], nil }
+
+func TestBuildParentQuery(t *testing.T) {
+	ds := testParentDocStore(t)
+	assert.Equal(t, &ParentOptions{Column: "parent_id", TableName: "articles", SchemaName: "public",
+		IDColumn: "id", ContentColumn: "content", MetadataJSONColumn: "metadata"}, ds.config.Parents)
+
+	query, args, err := ds.buildParentQuery([]float32{1, 2}, 3, &RetrieverOptions{
+		RollUp:  &RollUpOptions{},
+		Filters: []Filter{{Key: "source", Value: "wiki"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT p."id", p."content", p."metadata", c.distance FROM (SELECT parent_id, min(distance) AS distance FROM (`+
+		`SELECT "parent_id" AS parent_id, "embedding" <=> $1 AS distance FROM "public"."documents"`+
+		` WHERE "parent_id" IS NOT NULL AND "source" = $2 ORDER BY distance, "id" LIMIT 15) AS chunks GROUP BY parent_id) AS c`+
+		` JOIN "public"."articles" AS p ON p."id" = c.parent_id ORDER BY c.distance, p."id" LIMIT 3`, query)
+	assert.Len(t, args, 2)
+
+	_, _, err = ds.buildParentQuery([]float32{1, 2}, 3, &RetrieverOptions{RollUp: &RollUpOptions{FetchK: 2}})
+	assert.ErrorContains(t, err, "at least k")
+}
+
+func TestValidateParents(t *testing.T) {
+	ds := testDocStore()
+	require.NoError(t, ds.validateParents())
+	ds.config.Parents = &ParentOptions{TableName: "articles"}
+	assert.ErrorContains(t, ds.validateParents(), "parent column")
+	ds.config.Parents = &ParentOptions{Column: "parent_id", TableName: `art"icles`}
+	assert.Error(t, ds.validateParents())
+}
+
+func TestCheckRollUp(t *testing.T) {
+	req := &ai.RetrieverRequest{Query: ai.DocumentFromText("q", nil)}
+	err := testDocStore().checkRollUp(req, &RetrieverOptions{RollUp: &RollUpOptions{}})
+	assert.ErrorContains(t, err, "parents to be configured")
+
+	ds := testParentDocStore(t)
+	assert.NoError(t, ds.checkRollUp(req, &RetrieverOptions{RollUp: &RollUpOptions{}}))
+	lookup := &RetrieverOptions{RollUp: &RollUpOptions{}, Filters: []Filter{{Key: "source", Value: "wiki"}}}
+	assert.ErrorContains(t, ds.checkRollUp(&ai.RetrieverRequest{}, lookup), "requires a query")
+	assert.ErrorContains(t, ds.checkRollUp(req, &RetrieverOptions{RollUp: &RollUpOptions{}, MMR: &MMROptions{}}), "MMR")
+	assert.ErrorContains(t, ds.checkRollUp(req, &RetrieverOptions{RollUp: &RollUpOptions{}, CountTotal: true}), "total counts")
+}
+
+func TestRetrieveParents(t *testing.T) {
+	ds := testParentDocStore(t)
+	threshold := float32(0.5)
+	r := &retrieval{opts: &RetrieverOptions{RollUp: &RollUpOptions{}, ScoreThreshold: &threshold}, k: 3, rollUp: true}
+	rows := &valueRows{rows: [][]any{
+		{"a", "article a", map[string]any{"title": "A"}, 0.25},
+		{"b", "article b", nil, math.NaN()},
+		{"c", "article c", nil, 0.75},
+	}}
+	res, err := ds.retrieveParents(context.Background(), context.Background(), &ai.RetrieverRequest{}, r, rows)
+	require.NoError(t, err)
+	require.Len(t, res.Documents, 1)
+	doc := res.Documents[0].Document
+	assert.Equal(t, "article a", doc.Content[0].Text)
+	assert.Equal(t, "a", doc.Metadata["id"])
+	assert.Equal(t, "A", doc.Metadata["title"])
+	assert.Equal(t, 0.25, doc.Metadata[DistanceMetadataKey])
+	assert.Equal(t, 0.25, *res.Documents[0].Distance)
+
+	_, _, err = ds.parentRowToDocument([]any{"a", []byte("x"), nil, 0.25})
+	assert.ErrorContains(t, err, "text column")
+}
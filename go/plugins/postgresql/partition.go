@@ -0,0 +1,177 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PartitionMethod is the method of declarative partitioning of a table.
+type PartitionMethod string
+
+const (
+	// PartitionByRange assigns rows to partitions by ranges of the
+	// partition key, such as one partition per month.
+	PartitionByRange PartitionMethod = "range"
+	// PartitionByList assigns rows to partitions by lists of values of the
+	// partition key, such as one partition per tenant.
+	PartitionByList PartitionMethod = "list"
+	// PartitionByHash spreads rows evenly over partitions by the hash of
+	// the partition key.
+	PartitionByHash PartitionMethod = "hash"
+)
+
+func (m PartitionMethod) validate() error {
+	switch m {
+	case PartitionByRange, PartitionByList, PartitionByHash:
+		return nil
+	}
+	return fmt.Errorf("unknown partition method %q", m)
+}
+
+// TablePartitioning makes [PostgresEngine.InitVectorstoreTable] create a
+// declaratively partitioned table. Only the parent table is created; its
+// partitions, such as one per month, are created with CREATE TABLE ...
+// PARTITION OF. Documents are indexed into and retrieved from the parent
+// table, and retrievals whose [RetrieverOptions.Filters] restrict the
+// partition key only scan the matching partitions.
+//
+// Postgres requires the unique constraints of a partitioned table to include
+// the partition key, so the primary key of the table is the id column and
+// Column. Set [Config.ConflictColumns] to both for the indexer to detect
+// existing documents.
+type TablePartitioning struct {
+	// Method is the partitioning method. The default is [PartitionByRange].
+	Method PartitionMethod
+	// Column is the partition key. It must be one of the non-nullable
+	// MetadataColumns of the table.
+	Column string
+}
+
+// validatePartitioning applies the defaults to the partitioning of opts, if
+// any, and checks that its column is a non-nullable metadata column.
+func validatePartitioning(opts *VectorstoreTableOptions) error {
+	p := opts.Partitioning
+	if p == nil {
+		return nil
+	}
+	if p.Method == "" {
+		p.Method = PartitionByRange
+	}
+	if err := p.Method.validate(); err != nil {
+		return err
+	}
+	for _, col := range opts.MetadataColumns {
+		if col.Name != p.Column {
+			continue
+		}
+		if col.Nullable {
+			return fmt.Errorf("partition column %q must not be nullable, as it is part of the primary key", p.Column)
+		}
+		return nil
+	}
+	return fmt.Errorf("partition column %q must be one of the metadata columns", p.Column)
+}
+
+// partitionNode is a table of a partition tree, as reported by
+// pg_partition_tree for the root table.
+type partitionNode struct {
+	schema, table string
+	// parentSchema and parent are the table the node is a partition of, or
+	// empty for the root.
+	parentSchema, parent string
+	leaf                 bool
+	foreign              bool
+}
+
+// partitionTree returns the tables of the partition tree rooted at a table,
+// parents before their partitions. A table that is not partitioned is
+// returned alone, and a table that does not exist yields no nodes.
+func (pgEngine *PostgresEngine) partitionTree(ctx context.Context, schemaName, tableName string) ([]partitionNode, error) {
+	const query = `SELECT n.nspname, c.relname, coalesce(pn.nspname, ''), coalesce(p.relname, ''), t.isleaf, c.relkind = 'f'
+		FROM pg_partition_tree(to_regclass(format('%I.%I', $1::text, $2::text))) t
+		JOIN pg_class c ON c.oid = t.relid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_class p ON p.oid = t.parentrelid
+		LEFT JOIN pg_namespace pn ON pn.oid = p.relnamespace
+		ORDER BY t.level, n.nspname, c.relname`
+	qctx, cancel := pgEngine.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := pgEngine.querier().Query(qctx, query, schemaName, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the partitions of table %q: %w", tableName, queryTimeoutError(qctx, err))
+	}
+	defer rows.Close()
+	var nodes []partitionNode
+	for rows.Next() {
+		var n partitionNode
+		if err := rows.Scan(&n.schema, &n.table, &n.parentSchema, &n.parent, &n.leaf, &n.foreign); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to look up the partitions of table %q: %w", tableName, queryTimeoutError(qctx, err))
+	}
+	return nodes, nil
+}
+
+// leafPartitions returns the number of partitions of tree that hold rows, or
+// 1 if the table is not partitioned.
+func leafPartitions(tree []partitionNode) int {
+	n := 0
+	for _, node := range tree {
+		if node.leaf {
+			n++
+		}
+	}
+	return max(1, n)
+}
+
+// partitionIndexQueries returns the statements creating the index name,
+// defined by using, concurrently on the partitioned table at the root of
+// tree, in order. As Postgres cannot build an index of a partitioned table
+// concurrently, the index is created on each partitioned table alone, built
+// concurrently on each partition that holds rows, and each index is attached
+// to the index of its parent, which becomes valid once all of its partitions
+// have an attached index. The index of a partition is named after the
+// partition and name.
+func partitionIndexQueries(tree []partitionNode, name, using string) ([]string, error) {
+	names := make(map[string]string, len(tree))
+	var queries []string
+	for i, node := range tree {
+		if node.foreign {
+			return nil, fmt.Errorf("partition %q is a foreign table, which cannot be indexed; create the index without Concurrently", node.table)
+		}
+		index := name
+		if i > 0 {
+			index = node.table + "_" + name
+		}
+		names[node.schema+"."+node.table] = index
+		table := pgx.Identifier{node.schema, node.table}.Sanitize()
+		if node.leaf {
+			queries = append(queries, fmt.Sprintf(`CREATE INDEX CONCURRENTLY %s ON %s %s`, pgx.Identifier{index}.Sanitize(), table, using))
+		} else {
+			queries = append(queries, fmt.Sprintf(`CREATE INDEX %s ON ONLY %s %s`, pgx.Identifier{index}.Sanitize(), table, using))
+		}
+		if i == 0 {
+			continue
+		}
+		parent, ok := names[node.parentSchema+"."+node.parent]
+		if !ok {
+			return nil, fmt.Errorf("partition %q is listed before its parent %q", node.table, node.parent)
+		}
+		queries = append(queries, fmt.Sprintf(`ALTER INDEX %s ATTACH PARTITION %s`,
+			pgx.Identifier{node.parentSchema, parent}.Sanitize(), pgx.Identifier{node.schema, index}.Sanitize()))
+	}
+	return queries, nil
+}
+
+// partitionClause returns the primary key constraint and the partitioning
+// clause closing the statement creating a table partitioned by p.
+func partitionClause(idColumn string, p *TablePartitioning) string {
+	return fmt.Sprintf(`, PRIMARY KEY ("%s", "%s")) PARTITION BY %s ("%s")`,
+		idColumn, p.Column, strings.ToUpper(string(p.Method)), p.Column)
+}
@@ -0,0 +1,66 @@
+package postgresql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionIndexQueries(t *testing.T) {
+	tree := []partitionNode{
+		{schema: "public", table: "documents"},
+		{schema: "public", table: "documents_2026", parentSchema: "public", parent: "documents"},
+		{schema: "public", table: "documents_2026_01", parentSchema: "public", parent: "documents_2026", leaf: true},
+		{schema: "archive", table: "documents_2025", parentSchema: "public", parent: "documents", leaf: true},
+	}
+	queries, err := partitionIndexQueries(tree, "docs_idx", `USING hnsw ("embedding" vector_cosine_ops) WITH (m = 16)`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`CREATE INDEX "docs_idx" ON ONLY "public"."documents" USING hnsw ("embedding" vector_cosine_ops) WITH (m = 16)`,
+		`CREATE INDEX "documents_2026_docs_idx" ON ONLY "public"."documents_2026" USING hnsw ("embedding" vector_cosine_ops) WITH (m = 16)`,
+		`ALTER INDEX "public"."docs_idx" ATTACH PARTITION "public"."documents_2026_docs_idx"`,
+		`CREATE INDEX CONCURRENTLY "documents_2026_01_docs_idx" ON "public"."documents_2026_01" USING hnsw ("embedding" vector_cosine_ops) WITH (m = 16)`,
+		`ALTER INDEX "public"."documents_2026_docs_idx" ATTACH PARTITION "public"."documents_2026_01_docs_idx"`,
+		`CREATE INDEX CONCURRENTLY "documents_2025_docs_idx" ON "archive"."documents_2025" USING hnsw ("embedding" vector_cosine_ops) WITH (m = 16)`,
+		`ALTER INDEX "public"."docs_idx" ATTACH PARTITION "archive"."documents_2025_docs_idx"`,
+	}, queries)
+	assert.Equal(t, 2, leafPartitions(tree))
+	assert.Equal(t, 1, leafPartitions(tree[:1]))
+
+	_, err = partitionIndexQueries([]partitionNode{tree[0], {schema: "public", table: "remote", parentSchema: "public", parent: "documents", leaf: true, foreign: true}}, "docs_idx", "")
+	assert.ErrorContains(t, err, "foreign table")
+	_, err = partitionIndexQueries([]partitionNode{tree[0], tree[2]}, "docs_idx", "")
+	assert.ErrorContains(t, err, "listed before its parent")
+}
+
+func TestCreatePartitionedTableQuery(t *testing.T) {
+	pgEngine := &PostgresEngine{}
+	opts := VectorstoreTableOptions{
+		TableName:       "documents",
+		VectorSize:      3,
+		MetadataColumns: []Column{{Name: "created_at", DataType: "timestamptz"}},
+		Partitioning:    &TablePartitioning{Column: "created_at"},
+	}
+	assert.NoError(t, pgEngine.validateVectorstoreTableOptions(&opts))
+	assert.Equal(t, PartitionByRange, opts.Partitioning.Method)
+	query := pgEngine.createTableQuery(opts)
+	assert.Contains(t, query, `"id" UUID,`)
+	assert.NotContains(t, query, "UUID PRIMARY KEY")
+	assert.Contains(t, query, `"created_at" timestamptz NOT NULL, PRIMARY KEY ("id", "created_at")) PARTITION BY RANGE ("created_at");`)
+
+	opts.Partitioning = nil
+	assert.Contains(t, pgEngine.createTableQuery(opts), `"id" UUID PRIMARY KEY,`)
+
+	for _, tc := range []struct {
+		partitioning TablePartitioning
+		columns      []Column
+		want         string
+	}{
+		{TablePartitioning{Column: "tenant"}, []Column{{Name: "created_at", DataType: "timestamptz"}}, "must be one of the metadata columns"},
+		{TablePartitioning{Column: "tenant"}, []Column{{Name: "tenant", DataType: "text", Nullable: true}}, "must not be nullable"},
+		{TablePartitioning{Column: "tenant", Method: "weekly"}, []Column{{Name: "tenant", DataType: "text"}}, "unknown partition method"},
+	} {
+		opts := VectorstoreTableOptions{TableName: "documents", VectorSize: 3, MetadataColumns: tc.columns, Partitioning: &tc.partitioning}
+		assert.ErrorContains(t, pgEngine.validateVectorstoreTableOptions(&opts), tc.want)
+	}
+}
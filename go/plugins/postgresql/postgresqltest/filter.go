@@ -0,0 +1,276 @@
+package postgresqltest
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/firebase/genkit/go/plugins/postgresql"
+)
+
+// matches reports whether r satisfies all of filters.
+func (s *Store) matches(r row, filters []postgresql.Filter) (bool, error) {
+	for _, f := range filters {
+		ok, err := s.matchFilter(r, f)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// matchFilter reports whether r satisfies f. As in SQL, a document without
+// the key of f, or with a null value, satisfies no comparison.
+func (s *Store) matchFilter(r row, f postgresql.Filter) (bool, error) {
+	if f.Op == postgresql.Contains {
+		return s.matchContains(r, f)
+	}
+	if f.Key == "" {
+		return false, errors.New("filter key must not be empty")
+	}
+	op := cmp.Or(f.Op, postgresql.Eq)
+	values, err := filterValues(op, f.Value)
+	if err != nil {
+		return false, fmt.Errorf("filter on key %q: %w", f.Key, err)
+	}
+	for i, v := range values {
+		if v == nil {
+			return false, fmt.Errorf("filter on key %q: nil value is not supported", f.Key)
+		}
+		if i > 0 && kind(v) != kind(values[0]) {
+			return false, fmt.Errorf("filter on key %q: values %v and %v have different types", f.Key, values[0], v)
+		}
+	}
+	text, ok := s.text(r, f.Key)
+	if !ok {
+		return false, nil
+	}
+	compare := func(v any) (int, error) {
+		c, err := compareText(text, v)
+		if err != nil {
+			return 0, fmt.Errorf("filter on key %q: %w", f.Key, err)
+		}
+		return c, nil
+	}
+	switch op {
+	case postgresql.In, postgresql.NotIn:
+		for _, v := range values {
+			c, err := compare(v)
+			if err != nil {
+				return false, err
+			}
+			if c == 0 {
+				return op == postgresql.In, nil
+			}
+		}
+		return op == postgresql.NotIn, nil
+	case postgresql.Between:
+		lo, err := compare(values[0])
+		if err != nil {
+			return false, err
+		}
+		hi, err := compare(values[1])
+		if err != nil {
+			return false, err
+		}
+		return lo >= 0 && hi <= 0, nil
+	}
+	c, err := compare(values[0])
+	if err != nil {
+		return false, err
+	}
+	switch op {
+	case postgresql.Eq:
+		return c == 0, nil
+	case postgresql.Ne:
+		return c != 0, nil
+	case postgresql.Gt:
+		return c > 0, nil
+	case postgresql.Ge:
+		return c >= 0, nil
+	case postgresql.Lt:
+		return c < 0, nil
+	default:
+		return c <= 0, nil
+	}
+}
+
+// filterValues returns the values compared by a filter with operator op and
+// value v, the elements of v for the operators that take a slice.
+func filterValues(op postgresql.FilterOp, v any) ([]any, error) {
+	switch op {
+	case postgresql.Eq, postgresql.Ne, postgresql.Gt, postgresql.Ge, postgresql.Lt, postgresql.Le:
+		return []any{v}, nil
+	case postgresql.In, postgresql.NotIn, postgresql.Between:
+	default:
+		return nil, fmt.Errorf("unsupported filter operator %q", op)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("operator %s requires a slice value, got %T", op, v)
+	}
+	values := make([]any, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
+	}
+	switch {
+	case op == postgresql.Between && len(values) != 2:
+		return nil, fmt.Errorf("operator BETWEEN requires two values, got %d", len(values))
+	case len(values) == 0:
+		return nil, fmt.Errorf("operator %s requires at least one value", op)
+	}
+	return values, nil
+}
+
+// kind returns the kind of comparison of filter value v, which values of
+// the same filter must share.
+func kind(v any) string {
+	switch v.(type) {
+	case string:
+		return "text"
+	case bool:
+		return "boolean"
+	case time.Time:
+		return "timestamptz"
+	default:
+		if isNumber(v) {
+			return "numeric"
+		}
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func isNumber(v any) bool {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return true
+	}
+	return false
+}
+
+// text returns the value of key in r as text, as the ->> operator returns
+// it, and false if the value is missing or null.
+func (s *Store) text(r row, key string) (string, bool) {
+	if key == s.cfg.IDKey {
+		return r.id, true
+	}
+	v, ok := r.metadata[key]
+	if !ok || v == nil {
+		return "", false
+	}
+	if str, ok := v.(string); ok {
+		return str, true
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// compareText compares text, a metadata value as text, with filter value v,
+// casting text to the type of v as the filters of the plugin do.
+func compareText(text string, v any) (int, error) {
+	switch v := v.(type) {
+	case string:
+		return cmp.Compare(text, v), nil
+	case bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return 0, fmt.Errorf("value %q is not a boolean", text)
+		}
+		if b == v {
+			return 0, nil
+		}
+		if v {
+			return -1, nil
+		}
+		return 1, nil
+	case time.Time:
+		t, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return 0, fmt.Errorf("value %q is not a timestamp", text)
+		}
+		return t.Compare(v), nil
+	}
+	if !isNumber(v) {
+		return 0, fmt.Errorf("unsupported value type %T", v)
+	}
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, fmt.Errorf("value %q is not a number", text)
+	}
+	return cmp.Compare(n, reflect.ValueOf(v).Convert(reflect.TypeFor[float64]()).Float()), nil
+}
+
+// matchContains reports whether r satisfies f, a [postgresql.Contains]
+// filter, with the containment rules of jsonb.
+func (s *Store) matchContains(r row, f postgresql.Filter) (bool, error) {
+	var fragment []byte
+	switch v := f.Value.(type) {
+	case string:
+		fragment = []byte(v)
+	case []byte:
+		fragment = v
+	case nil:
+		return false, fmt.Errorf("containment filter on key %q: nil value is not supported", f.Key)
+	default:
+		var err error
+		if fragment, err = json.Marshal(v); err != nil {
+			return false, fmt.Errorf("containment filter on key %q: %w", f.Key, err)
+		}
+	}
+	var want any
+	if err := json.Unmarshal(fragment, &want); err != nil {
+		return false, fmt.Errorf("containment filter on key %q: value is not valid JSON", f.Key)
+	}
+	var have any = r.metadata
+	if f.Key != "" {
+		v, ok := r.metadata[f.Key]
+		if !ok {
+			return false, nil
+		}
+		have = v
+	}
+	return jsonContains(have, want, true), nil
+}
+
+// jsonContains reports whether the decoded JSON value have contains want,
+// as with the jsonb @> operator. At the top level, an array contains a
+// scalar that is one of its elements.
+func jsonContains(have, want any, top bool) bool {
+	switch want := want.(type) {
+	case map[string]any:
+		have, ok := have.(map[string]any)
+		if !ok {
+			return false
+		}
+		for key, w := range want {
+			h, ok := have[key]
+			if !ok || !jsonContains(h, w, false) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		have, ok := have.([]any)
+		if !ok {
+			return false
+		}
+		for _, w := range want {
+			if !slices.ContainsFunc(have, func(h any) bool { return jsonContains(h, w, false) }) {
+				return false
+			}
+		}
+		return true
+	}
+	if h, ok := have.([]any); ok && top {
+		return slices.ContainsFunc(h, func(h any) bool { return reflect.DeepEqual(h, want) })
+	}
+	return reflect.DeepEqual(have, want)
+}
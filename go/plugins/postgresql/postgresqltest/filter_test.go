@@ -0,0 +1,75 @@
+package postgresqltest
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/plugins/postgresql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchFilter(t *testing.T) {
+	s := New(Config{})
+	var metadata map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{"source": "wiki", "year": 2024, "draft": false,
+		"created": "2024-03-01T10:00:00Z", "tags": ["a", "b"], "author": {"name": "ada", "langs": ["en"]}, "none": null}`), &metadata))
+	r := row{id: "doc-1", metadata: metadata}
+
+	testCases := []struct {
+		name   string
+		filter postgresql.Filter
+		want   bool
+	}{
+		{"eq", postgresql.Filter{Key: "source", Value: "wiki"}, true},
+		{"ne", postgresql.Filter{Key: "source", Op: postgresql.Ne, Value: "wiki"}, false},
+		{"id", postgresql.Filter{Key: "id", Value: "doc-1"}, true},
+		{"number as text", postgresql.Filter{Key: "year", Value: "2024"}, true},
+		{"gt", postgresql.Filter{Key: "year", Op: postgresql.Gt, Value: 2023.5}, true},
+		{"le", postgresql.Filter{Key: "year", Op: postgresql.Le, Value: 2023}, false},
+		{"bool", postgresql.Filter{Key: "draft", Value: false}, true},
+		{"time", postgresql.Filter{Key: "created", Op: postgresql.Lt, Value: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)}, true},
+		{"in", postgresql.Filter{Key: "source", Op: postgresql.In, Value: []string{"blog", "wiki"}}, true},
+		{"not in", postgresql.Filter{Key: "source", Op: postgresql.NotIn, Value: []string{"blog", "wiki"}}, false},
+		{"between", postgresql.Filter{Key: "year", Op: postgresql.Between, Value: []int{2020, 2024}}, true},
+		{"missing", postgresql.Filter{Key: "lang", Op: postgresql.Ne, Value: "en"}, false},
+		{"null", postgresql.Filter{Key: "none", Op: postgresql.Ne, Value: "en"}, false},
+		{"contains array", postgresql.Filter{Key: "tags", Op: postgresql.Contains, Value: []string{"b"}}, true},
+		{"contains scalar", postgresql.Filter{Key: "tags", Op: postgresql.Contains, Value: `"a"`}, true},
+		{"contains nested", postgresql.Filter{Op: postgresql.Contains, Value: map[string]any{"author": map[string]any{"langs": []string{"en"}}}}, true},
+		{"contains missing", postgresql.Filter{Op: postgresql.Contains, Value: `{"author": {"name": "bob"}}`}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := s.matchFilter(r, tc.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestMatchFilterErrors(t *testing.T) {
+	s := New(Config{})
+	r := row{id: "doc-1", metadata: map[string]any{"source": "wiki"}}
+	testCases := []struct {
+		name   string
+		filter postgresql.Filter
+		want   string
+	}{
+		{"no key", postgresql.Filter{Value: "wiki"}, "filter key must not be empty"},
+		{"operator", postgresql.Filter{Key: "source", Op: "~", Value: "wiki"}, "unsupported filter operator"},
+		{"in scalar", postgresql.Filter{Key: "source", Op: postgresql.In, Value: "wiki"}, "requires a slice value"},
+		{"between", postgresql.Filter{Key: "source", Op: postgresql.Between, Value: []string{"a"}}, "requires two values"},
+		{"mixed", postgresql.Filter{Key: "source", Op: postgresql.In, Value: []any{"a", 1}}, "have different types"},
+		{"nil", postgresql.Filter{Key: "source"}, "nil value"},
+		{"cast", postgresql.Filter{Key: "source", Value: true}, "is not a boolean"},
+		{"json", postgresql.Filter{Op: postgresql.Contains, Value: "{"}, "not valid JSON"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := s.matchFilter(r, tc.filter)
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+}
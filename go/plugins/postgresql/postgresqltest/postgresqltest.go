@@ -0,0 +1,480 @@
+// Package postgresqltest provides an in-memory fake of the retriever and
+// indexer of the postgresql plugin, for unit tests of code that uses them
+// without a database.
+//
+// The fake stores documents in memory, ranks them by brute-force distance
+// computation and evaluates [postgresql.Filter] values in Go, following the
+// semantics of the plugin closely enough for tests: metadata round-trips
+// through JSON as it does through the metadata column, filters compare
+// values as the plugin's SQL does, and retrieved documents carry
+// [postgresql.DistanceMetadataKey] and [postgresql.ScoreMetadataKey].
+// Retriever options that depend on the database, such as MMR, hybrid search
+// or additional embedding columns, are rejected rather than ignored.
+package postgresqltest
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/firebase/genkit/go/plugins/postgresql"
+	"github.com/google/uuid"
+)
+
+const (
+	provider     = "postgres"
+	defaultName  = "documents"
+	defaultIDKey = "id"
+	defaultK     = 4
+)
+
+// Config configures a [Store].
+type Config struct {
+	// Name is the name of the retriever and indexer. The default is
+	// "documents".
+	Name string
+	// Embedder embeds indexed documents and retrieval queries. It may be
+	// nil if all documents carry [postgresql.EmbeddingMetadataKey] and all
+	// requests set [postgresql.RetrieverOptions.QueryEmbedding].
+	Embedder        ai.Embedder
+	EmbedderOptions any
+	// DistanceStrategy ranks the documents. The default is
+	// [postgresql.CosineDistance].
+	DistanceStrategy postgresql.DistanceStrategy
+	// IDKey is the metadata key holding the id of the documents, as
+	// [postgresql.Config.IDColumn]. The default is "id".
+	IDKey string
+	// K is the number of documents returned, unless overridden per request.
+	// The default is 4.
+	K int
+}
+
+// Store is an in-memory fake of a table of the postgresql plugin. It
+// implements [ai.Indexer] and [ai.Retriever], and is safe for concurrent use.
+type Store struct {
+	cfg Config
+
+	mu   sync.Mutex
+	rows map[string]row
+}
+
+// row is a stored document.
+type row struct {
+	id        string
+	content   []*ai.Part
+	metadata  map[string]any
+	embedding []float32
+}
+
+// New returns an empty store configured by cfg.
+func New(cfg Config) *Store {
+	if cfg.Name == "" {
+		cfg.Name = defaultName
+	}
+	if cfg.DistanceStrategy == "" {
+		cfg.DistanceStrategy = postgresql.CosineDistance
+	}
+	if cfg.IDKey == "" {
+		cfg.IDKey = defaultIDKey
+	}
+	if cfg.K == 0 {
+		cfg.K = defaultK
+	}
+	return &Store{cfg: cfg, rows: make(map[string]row)}
+}
+
+// Define returns a new store configured by cfg, with its indexer and
+// retriever defined in g under the provider of the postgresql plugin, as
+// [postgresql.DefineIndexer] and [postgresql.DefineRetriever] do.
+func Define(g *genkit.Genkit, cfg Config) (*Store, ai.Indexer, ai.Retriever) {
+	s := New(cfg)
+	return s, genkit.DefineIndexer(g, provider, s.cfg.Name, s.Index),
+		genkit.DefineRetriever(g, provider, s.cfg.Name, s.Retrieve)
+}
+
+// Name returns the name of the store.
+func (s *Store) Name() string {
+	return s.cfg.Name
+}
+
+// Index embeds and stores the documents of req, replacing those with the
+// same id. Documents without an id get the same deterministic id as with
+// the plugin.
+func (s *Store) Index(ctx context.Context, req *ai.IndexerRequest) error {
+	rows := make([]row, len(req.Documents))
+	var pending []int
+	for i, doc := range req.Documents {
+		r, err := s.newRow(doc)
+		if err != nil {
+			return fmt.Errorf("postgresqltest.Index: document %d: %w", i, err)
+		}
+		rows[i] = r
+		if r.embedding == nil {
+			pending = append(pending, i)
+		}
+	}
+	if len(pending) > 0 {
+		if s.cfg.Embedder == nil {
+			return fmt.Errorf("postgresqltest.Index: document %d has no embedding and the store has no embedder", pending[0])
+		}
+		docs := make([]*ai.Document, len(pending))
+		for j, i := range pending {
+			docs[j] = req.Documents[i]
+		}
+		embeddings, err := s.embed(ctx, docs)
+		if err != nil {
+			return fmt.Errorf("postgresqltest.Index: %w", err)
+		}
+		for j, i := range pending {
+			rows[i].embedding = embeddings[j]
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dim := s.dimension()
+	for i, r := range rows {
+		if dim < 0 {
+			dim = len(r.embedding)
+		}
+		if len(r.embedding) != dim {
+			return fmt.Errorf("postgresqltest.Index: document %d (id %q): %w: embedding has %d dimensions, but the store expects %d",
+				i, r.id, postgresql.ErrDimensionMismatch, len(r.embedding), dim)
+		}
+		for j, f := range r.embedding {
+			if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+				return fmt.Errorf("postgresqltest.Index: document %d (id %q): %w: element %d is %v",
+					i, r.id, postgresql.ErrNonFiniteEmbedding, j, f)
+			}
+		}
+	}
+	for _, r := range rows {
+		s.rows[r.id] = r
+	}
+	return nil
+}
+
+// newRow returns the row stored for doc, whose embedding is nil unless doc
+// carries one under [postgresql.EmbeddingMetadataKey].
+func (s *Store) newRow(doc *ai.Document) (row, error) {
+	metadata := maps.Clone(doc.Metadata)
+	id, _ := metadata[s.cfg.IDKey].(string)
+	if id == "" {
+		b, err := json.Marshal(doc)
+		if err != nil {
+			return row{}, fmt.Errorf("error marshaling document: %w", err)
+		}
+		id = uuid.NewSHA1(uuid.NameSpaceOID, b).String()
+	}
+	var embedding []float32
+	if v, ok := metadata[postgresql.EmbeddingMetadataKey]; ok {
+		if embedding, ok = v.([]float32); !ok {
+			return row{}, fmt.Errorf("id %q: embedding in metadata key %q has type %T, want []float32", id, postgresql.EmbeddingMetadataKey, v)
+		}
+		embedding = slices.Clone(embedding)
+	}
+	delete(metadata, postgresql.EmbeddingMetadataKey)
+	delete(metadata, s.cfg.IDKey)
+
+	// Metadata is stored as JSON, so that retrieved documents and filters
+	// see the same values as with the metadata column of the plugin.
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return row{}, fmt.Errorf("id %q: invalid metadata: %w", id, err)
+	}
+	var stored map[string]any
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return row{}, fmt.Errorf("id %q: invalid metadata: %w", id, err)
+	}
+	content := make([]*ai.Part, len(doc.Content))
+	for i, p := range doc.Content {
+		c := *p
+		content[i] = &c
+	}
+	return row{id: id, content: content, metadata: stored, embedding: embedding}, nil
+}
+
+// dimension returns the dimension of the stored embeddings, or -1 if the
+// store is empty. The caller must hold s.mu.
+func (s *Store) dimension() int {
+	for _, r := range s.rows {
+		return len(r.embedding)
+	}
+	return -1
+}
+
+// embed embeds docs with the embedder of the store.
+func (s *Store) embed(ctx context.Context, docs []*ai.Document) ([][]float32, error) {
+	res, err := s.cfg.Embedder.Embed(ctx, &ai.EmbedRequest{Documents: docs, Options: s.cfg.EmbedderOptions})
+	if err != nil {
+		return nil, fmt.Errorf("embedding failed: %w", err)
+	}
+	if len(res.Embeddings) != len(docs) {
+		return nil, fmt.Errorf("embedder returned %d embeddings for %d documents", len(res.Embeddings), len(docs))
+	}
+	embeddings := make([][]float32, len(docs))
+	for i, e := range res.Embeddings {
+		embeddings[i] = e.Embedding
+	}
+	return embeddings, nil
+}
+
+// Retrieve returns the documents nearest to the query of req, or, for
+// requests with filters but no query, the first matching documents, as the
+// retriever of the plugin does. req.Options, if set, must be a
+// *[postgresql.RetrieverOptions].
+func (s *Store) Retrieve(ctx context.Context, req *ai.RetrieverRequest) (*ai.RetrieverResponse, error) {
+	opts := &postgresql.RetrieverOptions{}
+	if req.Options != nil {
+		var ok bool
+		if opts, ok = req.Options.(*postgresql.RetrieverOptions); !ok {
+			return nil, fmt.Errorf("postgresqltest.Retrieve options have type %T, want %T", req.Options, &postgresql.RetrieverOptions{})
+		}
+	}
+	if err := checkSupported(opts); err != nil {
+		return nil, fmt.Errorf("postgresqltest.Retrieve: %w", err)
+	}
+	if opts.K < 0 {
+		return nil, fmt.Errorf("postgresqltest.Retrieve: k must be positive, got %d", opts.K)
+	}
+	k := cmp.Or(opts.K, s.cfg.K)
+
+	queryVec := opts.QueryEmbedding
+	if opts.QueryEmbeddingBytes != nil {
+		if queryVec != nil {
+			return nil, errors.New("postgresqltest.Retrieve: QueryEmbedding and QueryEmbeddingBytes cannot both be set")
+		}
+		var err error
+		if queryVec, err = postgresql.DecodeEmbedding(opts.QueryEmbeddingBytes); err != nil {
+			return nil, fmt.Errorf("postgresqltest.Retrieve: query embedding: %w", err)
+		}
+	}
+	lookup := req.Query == nil && queryVec == nil
+	if lookup {
+		if len(opts.Filters) == 0 {
+			return nil, errors.New("postgresqltest.Retrieve: request has no query document")
+		}
+		if opts.ScoreThreshold != nil || opts.MinDistance != nil || opts.MaxDistance != nil {
+			return nil, errors.New("postgresqltest.Retrieve: score and distance bounds require a query")
+		}
+	}
+
+	if !lookup {
+		switch {
+		case queryVec != nil:
+		case opts.QueryEmbedder != nil:
+			res, err := opts.QueryEmbedder.Embed(ctx, &ai.EmbedRequest{Documents: []*ai.Document{req.Query}, Options: opts.QueryEmbedderOptions})
+			if err != nil {
+				return nil, fmt.Errorf("postgresqltest.Retrieve: embedding failed: %w", err)
+			}
+			if len(res.Embeddings) == 0 {
+				return nil, errors.New("postgresqltest.Retrieve: embedder returned no embeddings")
+			}
+			queryVec = res.Embeddings[0].Embedding
+		case s.cfg.Embedder == nil:
+			return nil, errors.New("postgresqltest.Retrieve: the store has no embedder; set QueryEmbedding")
+		default:
+			embeddings, err := s.embed(ctx, []*ai.Document{req.Query})
+			if err != nil {
+				return nil, fmt.Errorf("postgresqltest.Retrieve: %w", err)
+			}
+			queryVec = embeddings[0]
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if dim := s.dimension(); !lookup && dim >= 0 && len(queryVec) != dim {
+		return nil, fmt.Errorf("postgresqltest.Retrieve: %w: query embedding has %d dimensions, but the store expects %d",
+			postgresql.ErrDimensionMismatch, len(queryVec), dim)
+	}
+
+	var hits []hit
+	for _, r := range s.rows {
+		ok, err := s.matches(r, opts.Filters)
+		if err != nil {
+			return nil, fmt.Errorf("postgresqltest.Retrieve: %w", err)
+		}
+		if !ok {
+			continue
+		}
+		h := hit{row: r}
+		if !lookup {
+			h.distance = s.distance(queryVec, r.embedding)
+			if opts.MinDistance != nil && h.distance < *opts.MinDistance ||
+				opts.MaxDistance != nil && h.distance > *opts.MaxDistance {
+				continue
+			}
+		}
+		hits = append(hits, h)
+	}
+	if lookup {
+		s.sortLookup(hits, opts)
+	} else {
+		slices.SortFunc(hits, func(a, b hit) int {
+			return cmp.Or(cmp.Compare(a.distance, b.distance), cmp.Compare(a.row.id, b.row.id))
+		})
+	}
+	hits = hits[:min(k, len(hits))]
+	if !lookup && (opts.OrderBy != "" || opts.OrderDesc) {
+		s.sortLookup(hits, opts)
+	}
+
+	docs := make([]*ai.Document, 0, len(hits))
+	for _, h := range hits {
+		score := s.cfg.DistanceStrategy.Score(h.distance)
+		if !lookup && opts.ScoreThreshold != nil && score < float64(*opts.ScoreThreshold) {
+			continue
+		}
+		docs = append(docs, s.document(h, !lookup, opts))
+	}
+	return &ai.RetrieverResponse{Documents: docs}, nil
+}
+
+// hit is a row selected by a retrieval, at distance from its query.
+type hit struct {
+	row      row
+	distance float64
+}
+
+// checkSupported returns an error if opts sets options that the fake does
+// not implement.
+func checkSupported(opts *postgresql.RetrieverOptions) error {
+	var unsupported string
+	switch {
+	case opts.EmbeddingColumn != "":
+		unsupported = "EmbeddingColumn"
+	case opts.Embedder != "":
+		unsupported = "Embedder"
+	case opts.MMR != nil:
+		unsupported = "MMR"
+	case opts.Hybrid != nil:
+		unsupported = "Hybrid"
+	case opts.After != nil:
+		unsupported = "After"
+	case opts.AfterToken != "":
+		unsupported = "AfterToken"
+	case opts.GroupBy != nil:
+		unsupported = "GroupBy"
+	case opts.MultiVector != nil:
+		unsupported = "MultiVector"
+	case opts.RollUp != nil:
+		unsupported = "RollUp"
+	case opts.Boost != nil:
+		unsupported = "Boost"
+	default:
+		return nil
+	}
+	return fmt.Errorf("option %s is not supported by the fake store", unsupported)
+}
+
+// sortLookup orders the hits of a lookup, or the nearest hits of a search,
+// by [postgresql.RetrieverOptions.OrderBy], compared as text, and then by id.
+func (s *Store) sortLookup(hits []hit, opts *postgresql.RetrieverOptions) {
+	slices.SortFunc(hits, func(a, b hit) int {
+		if opts.OrderBy != "" {
+			av, aok := s.text(a.row, opts.OrderBy)
+			bv, bok := s.text(b.row, opts.OrderBy)
+			// NULL values sort last in ascending order, as in PostgreSQL.
+			c := cmp.Or(cmp.Compare(boolInt(!aok), boolInt(!bok)), cmp.Compare(av, bv))
+			if opts.OrderDesc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(a.row.id, b.row.id)
+	})
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// document returns the retrieved document of h.
+func (s *Store) document(h hit, scored bool, opts *postgresql.RetrieverOptions) *ai.Document {
+	metadata := make(map[string]any, len(h.row.metadata)+3)
+	for key, v := range h.row.metadata {
+		if opts.MetadataKeys == nil || slices.Contains(opts.MetadataKeys, key) {
+			metadata[key] = v
+		}
+	}
+	metadata[s.cfg.IDKey] = h.row.id
+	if scored {
+		metadata[postgresql.DistanceMetadataKey] = h.distance
+		metadata[postgresql.ScoreMetadataKey] = s.cfg.DistanceStrategy.Score(h.distance)
+	}
+	if opts.ReturnEmbedding {
+		metadata[postgresql.EmbeddingMetadataKey] = slices.Clone(h.row.embedding)
+	}
+	content := make([]*ai.Part, len(h.row.content))
+	for i, p := range h.row.content {
+		c := *p
+		content[i] = &c
+	}
+	return &ai.Document{Content: content, Metadata: metadata}
+}
+
+// distance returns the distance between a and b with the distance strategy
+// of the store, as computed by pgvector.
+func (s *Store) distance(a, b []float32) float64 {
+	var dot, na, nb, l2 float64
+	for i := range a {
+		x, y := float64(a[i]), float64(b[i])
+		dot += x * y
+		na += x * x
+		nb += y * y
+		l2 += (x - y) * (x - y)
+	}
+	switch s.cfg.DistanceStrategy {
+	case postgresql.EuclideanDistance:
+		return math.Sqrt(l2)
+	case postgresql.InnerProduct:
+		return -dot
+	default:
+		if na == 0 || nb == 0 {
+			return math.NaN()
+		}
+		return 1 - dot/math.Sqrt(na*nb)
+	}
+}
+
+// Documents returns the stored documents, ordered by id, with their id in
+// their metadata.
+func (s *Store) Documents() []*ai.Document {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := slices.Sorted(maps.Keys(s.rows))
+	docs := make([]*ai.Document, len(ids))
+	for i, id := range ids {
+		docs[i] = s.document(hit{row: s.rows[id]}, false, &postgresql.RetrieverOptions{})
+	}
+	return docs
+}
+
+// Delete removes the documents with the given ids, and returns the number
+// of documents removed.
+func (s *Store) Delete(ids ...string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int
+	for _, id := range ids {
+		if _, ok := s.rows[id]; ok {
+			delete(s.rows, id)
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,205 @@
+package postgresqltest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/plugins/postgresql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mapEmbedder embeds each document as the vector of its text.
+type mapEmbedder map[string][]float32
+
+func (e mapEmbedder) Name() string { return "map" }
+
+func (e mapEmbedder) Embed(ctx context.Context, req *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+	res := &ai.EmbedResponse{}
+	for _, doc := range req.Documents {
+		vec, ok := e[doc.Content[0].Text]
+		if !ok {
+			return nil, fmt.Errorf("no embedding for %q", doc.Content[0].Text)
+		}
+		res.Embeddings = append(res.Embeddings, &ai.DocumentEmbedding{Embedding: vec})
+	}
+	return res, nil
+}
+
+func testStore(t *testing.T) *Store {
+	t.Helper()
+	s := New(Config{Embedder: mapEmbedder{
+		"north": {0, 1},
+		"east":  {1, 0},
+		"ne":    {1, 1},
+		"query": {0.1, 1},
+	}})
+	err := s.Index(context.Background(), &ai.IndexerRequest{Documents: []*ai.Document{
+		ai.DocumentFromText("north", map[string]any{"id": "n", "source": "wiki", "year": 2023}),
+		ai.DocumentFromText("east", map[string]any{"id": "e", "source": "blog", "year": 2024}),
+		ai.DocumentFromText("ne", map[string]any{"id": "ne", "source": "wiki", "year": 2024}),
+	}})
+	require.NoError(t, err)
+	return s
+}
+
+func ids(docs []*ai.Document) []string {
+	var ids []string
+	for _, doc := range docs {
+		ids = append(ids, doc.Metadata["id"].(string))
+	}
+	return ids
+}
+
+func TestRetrieve(t *testing.T) {
+	s := testStore(t)
+	var _ ai.Retriever = s
+	var _ ai.Indexer = s
+
+	res, err := s.Retrieve(context.Background(), &ai.RetrieverRequest{Query: ai.DocumentFromText("query", nil)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"n", "ne", "e"}, ids(res.Documents))
+	doc := res.Documents[0]
+	assert.Equal(t, "north", doc.Content[0].Text)
+	assert.Equal(t, "wiki", doc.Metadata["source"])
+	assert.Equal(t, float64(2023), doc.Metadata["year"])
+	distance := doc.Metadata[postgresql.DistanceMetadataKey].(float64)
+	assert.InDelta(t, 1-1/1.00498756, distance, 1e-6)
+	assert.InDelta(t, 1-distance, doc.Metadata[postgresql.ScoreMetadataKey], 1e-9)
+
+	threshold := float32(0.5)
+	res, err = s.Retrieve(context.Background(), &ai.RetrieverRequest{
+		Query: ai.DocumentFromText("query", nil),
+		Options: &postgresql.RetrieverOptions{
+			K:               2,
+			Filters:         []postgresql.Filter{{Key: "year", Op: postgresql.Ge, Value: 2024}},
+			ScoreThreshold:  &threshold,
+			MetadataKeys:    []string{"year"},
+			ReturnEmbedding: true,
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, res.Documents, 1)
+	assert.Equal(t, "ne", res.Documents[0].Metadata["id"])
+	assert.NotContains(t, res.Documents[0].Metadata, "source")
+	assert.Equal(t, []float32{1, 1}, res.Documents[0].Metadata[postgresql.EmbeddingMetadataKey])
+
+	maxDistance := 0.1
+	res, err = s.Retrieve(context.Background(), &ai.RetrieverRequest{Options: &postgresql.RetrieverOptions{
+		QueryEmbedding: []float32{1, 0},
+		MaxDistance:    &maxDistance,
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e"}, ids(res.Documents))
+
+	res, err = s.Retrieve(context.Background(), &ai.RetrieverRequest{Options: &postgresql.RetrieverOptions{
+		QueryEmbeddingBytes: postgresql.EncodeEmbedding([]float32{1, 0}),
+		MaxDistance:         &maxDistance,
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e"}, ids(res.Documents))
+
+	res, err = s.Retrieve(context.Background(), &ai.RetrieverRequest{
+		Query:   ai.DocumentFromText("query", nil),
+		Options: &postgresql.RetrieverOptions{K: 1, QueryEmbedder: mapEmbedder{"query": {1, 0.1}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e"}, ids(res.Documents))
+}
+
+func TestRetrieveOrdered(t *testing.T) {
+	s := testStore(t)
+	// The two nearest documents, most recent first.
+	res, err := s.Retrieve(context.Background(), &ai.RetrieverRequest{
+		Query:   ai.DocumentFromText("query", nil),
+		Options: &postgresql.RetrieverOptions{K: 2, OrderBy: "year", OrderDesc: true},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ne", "n"}, ids(res.Documents))
+	assert.Contains(t, res.Documents[0].Metadata, postgresql.DistanceMetadataKey)
+}
+
+func TestRetrieveLookup(t *testing.T) {
+	s := testStore(t)
+	res, err := s.Retrieve(context.Background(), &ai.RetrieverRequest{Options: &postgresql.RetrieverOptions{
+		Filters:   []postgresql.Filter{{Key: "source", Value: "wiki"}},
+		OrderBy:   "year",
+		OrderDesc: true,
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ne", "n"}, ids(res.Documents))
+	assert.NotContains(t, res.Documents[0].Metadata, postgresql.DistanceMetadataKey)
+}
+
+func TestRetrieveErrors(t *testing.T) {
+	s := testStore(t)
+	query := ai.DocumentFromText("query", nil)
+	testCases := []struct {
+		name string
+		req  *ai.RetrieverRequest
+		want string
+	}{
+		{"options type", &ai.RetrieverRequest{Query: query, Options: 3}, "options have type int"},
+		{"no query", &ai.RetrieverRequest{}, "no query document"},
+		{"negative k", &ai.RetrieverRequest{Query: query, Options: &postgresql.RetrieverOptions{K: -1}}, "k must be positive"},
+		{"mmr", &ai.RetrieverRequest{Query: query, Options: &postgresql.RetrieverOptions{MMR: &postgresql.MMROptions{}}}, "MMR is not supported"},
+		{"dimensions", &ai.RetrieverRequest{Options: &postgresql.RetrieverOptions{QueryEmbedding: []float32{1}}}, "dimension mismatch"},
+		{"bad filter", &ai.RetrieverRequest{Query: query, Options: &postgresql.RetrieverOptions{
+			Filters: []postgresql.Filter{{Key: "source", Op: postgresql.Gt, Value: 1}}}}, `on key "source": value`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := s.Retrieve(context.Background(), tc.req)
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+}
+
+func TestIndex(t *testing.T) {
+	s := testStore(t)
+	err := s.Index(context.Background(), &ai.IndexerRequest{Documents: []*ai.Document{
+		ai.DocumentFromText("East, again", map[string]any{"id": "e", postgresql.EmbeddingMetadataKey: []float32{2, 0}}),
+		ai.DocumentFromText("no id", map[string]any{postgresql.EmbeddingMetadataKey: []float32{3, 3}}),
+	}})
+	require.NoError(t, err)
+	docs := s.Documents()
+	require.Len(t, docs, 4)
+	byID := make(map[string]*ai.Document)
+	for _, doc := range docs {
+		byID[doc.Metadata["id"].(string)] = doc
+	}
+	assert.Equal(t, "East, again", byID["e"].Content[0].Text)
+	assert.NotContains(t, byID["e"].Metadata, postgresql.EmbeddingMetadataKey)
+	assert.NotContains(t, byID["e"].Metadata, "source")
+	delete(byID, "e")
+	delete(byID, "n")
+	delete(byID, "ne")
+	for id, doc := range byID {
+		assert.Len(t, id, 36)
+		assert.Equal(t, "no id", doc.Content[0].Text)
+	}
+
+	err = s.Index(context.Background(), &ai.IndexerRequest{Documents: []*ai.Document{
+		ai.DocumentFromText("x", map[string]any{"id": "x", postgresql.EmbeddingMetadataKey: []float32{1}}),
+	}})
+	assert.ErrorIs(t, err, postgresql.ErrDimensionMismatch)
+	err = s.Index(context.Background(), &ai.IndexerRequest{Documents: []*ai.Document{
+		ai.DocumentFromText("x", map[string]any{"id": "x", postgresql.EmbeddingMetadataKey: []float32{1, float32(math.NaN())}}),
+	}})
+	assert.ErrorIs(t, err, postgresql.ErrNonFiniteEmbedding)
+	err = s.Index(context.Background(), &ai.IndexerRequest{Documents: []*ai.Document{ai.DocumentFromText("unknown", nil)}})
+	assert.ErrorContains(t, err, "embedding failed")
+
+	assert.Equal(t, 1, s.Delete("e", "missing"))
+	assert.Len(t, s.Documents(), 3)
+}
+
+func TestDistance(t *testing.T) {
+	a, b := []float32{1, 2}, []float32{3, 4}
+	assert.InDelta(t, 1-11/(2.2360679775*5), New(Config{}).distance(a, b), 1e-9)
+	assert.InDelta(t, 2.8284271247, New(Config{DistanceStrategy: postgresql.EuclideanDistance}).distance(a, b), 1e-9)
+	assert.Equal(t, -11.0, New(Config{DistanceStrategy: postgresql.InnerProduct}).distance(a, b))
+}
@@ -0,0 +1,69 @@
+package postgresql
+
+import (
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// preparedShapes holds the retrieval queries prepared on the connections of
+// an engine with [WithPreparedRetrieval]: the first max distinct queries
+// run. A query holds the table and the shape of the request, such as the
+// keys and operators of its filters and K, and binds the values, so that
+// requests of the same shape share it.
+type preparedShapes struct {
+	max int
+	// uncached is set if a connection of the engine has no statement
+	// cache, in which case every query runs as an unnamed statement.
+	uncached bool
+
+	mu     sync.Mutex
+	shapes map[string]bool
+}
+
+func newPreparedShapes(max int) *preparedShapes {
+	return &preparedShapes{max: max, shapes: make(map[string]bool)}
+}
+
+// execMode returns the pgx execution mode of query: prepared and cached by
+// each connection if it is one of the prepared shapes, which it becomes if
+// there is room left, or else run as an unnamed statement, which does not
+// evict the prepared ones from the statement cache of the connections.
+func (s *preparedShapes) execMode(query string) pgx.QueryExecMode {
+	if s.uncached {
+		return pgx.QueryExecModeDescribeExec
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.shapes[query] {
+		if len(s.shapes) >= s.max {
+			return pgx.QueryExecModeDescribeExec
+		}
+		s.shapes[query] = true
+	}
+	return pgx.QueryExecModeCacheStatement
+}
+
+// retrievalArgs returns the arguments of the retrieval query, preceded by
+// its execution mode if [WithPreparedRetrieval] is set.
+func (pgEngine *PostgresEngine) retrievalArgs(query string, args []any) []any {
+	s := pgEngine.config.preparedShapes
+	if s == nil {
+		return args
+	}
+	return append([]any{s.execMode(query)}, args...)
+}
+
+// cachesStatements reports whether every connection of pgEngine has a
+// statement cache, without which pgx cannot run a query in the
+// [pgx.QueryExecModeCacheStatement] mode.
+func (pgEngine *PostgresEngine) cachesStatements() bool {
+	c := pgEngine.config
+	for _, pool := range []*pgxpool.Pool{c.connPool, c.readPool} {
+		if pool != nil && pool.Config().ConnConfig.StatementCacheCapacity == 0 {
+			return false
+		}
+	}
+	return c.conn == nil || c.conn.Config().StatementCacheCapacity > 0
+}
@@ -0,0 +1,67 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreparedShapes(t *testing.T) {
+	s := newPreparedShapes(2)
+	assert.Equal(t, pgx.QueryExecModeCacheStatement, s.execMode("SELECT 1"))
+	assert.Equal(t, pgx.QueryExecModeCacheStatement, s.execMode("SELECT 2"))
+	assert.Equal(t, pgx.QueryExecModeDescribeExec, s.execMode("SELECT 3"))
+	assert.Equal(t, pgx.QueryExecModeCacheStatement, s.execMode("SELECT 1"))
+
+	// Without a statement cache, no query is prepared.
+	s.uncached = true
+	assert.Equal(t, pgx.QueryExecModeDescribeExec, s.execMode("SELECT 1"))
+}
+
+func TestCachesStatements(t *testing.T) {
+	newPool := func(capacity string) *pgxpool.Pool {
+		config, err := pgxpool.ParseConfig("postgres://localhost/testdb?statement_cache_capacity=" + capacity)
+		require.NoError(t, err)
+		pool, err := pgxpool.NewWithConfig(context.Background(), config)
+		require.NoError(t, err)
+		t.Cleanup(pool.Close)
+		return pool
+	}
+	cached, uncached := newPool("512"), newPool("0")
+
+	pgEngine := &PostgresEngine{}
+	assert.True(t, pgEngine.cachesStatements())
+	pgEngine.config.connPool = cached
+	assert.True(t, pgEngine.cachesStatements())
+	pgEngine.config.readPool = uncached
+	assert.False(t, pgEngine.cachesStatements())
+	pgEngine.config.connPool, pgEngine.config.readPool = uncached, nil
+	assert.False(t, pgEngine.cachesStatements())
+}
+
+func TestRetrievalArgs(t *testing.T) {
+	pgEngine := &PostgresEngine{}
+	assert.Equal(t, []any{"a"}, pgEngine.retrievalArgs("SELECT $1", []any{"a"}))
+
+	cfg, err := applyEngineOptions([]Option{WithPool(&pgxpool.Pool{}), WithDatabase("testdb"), WithPreparedRetrieval(8)})
+	require.NoError(t, err)
+	pgEngine.config = cfg
+	assert.Equal(t, []any{pgx.QueryExecModeCacheStatement, "a"}, pgEngine.retrievalArgs("SELECT $1", []any{"a"}))
+
+	db, err := sql.Open("pgx", "postgres://localhost/testdb")
+	require.NoError(t, err)
+	defer db.Close()
+	for _, opts := range [][]Option{
+		{WithPool(&pgxpool.Pool{}), WithPreparedRetrieval(-1)},
+		{WithPool(&pgxpool.Pool{}), WithPreparedRetrieval(8), WithSQLCommenter(true)},
+		{WithDB(db), WithPreparedRetrieval(8)},
+	} {
+		_, err := applyEngineOptions(append(opts, WithDatabase("testdb")))
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,507 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// querier runs the statements of the engine, through either a pgx pool or
+// a database/sql handle.
+type querier interface {
+	// Exec runs a statement and returns the number of affected rows.
+	Exec(ctx context.Context, query string, args ...any) (int64, error)
+	Query(ctx context.Context, query string, args ...any) (queryRows, error)
+	QueryRow(ctx context.Context, query string, args ...any) pgx.Row
+	// QueryBatch runs query once per argument list, atomically, passing the
+	// row returned by the i-th statement to scan. On failure it returns the
+	// position of the failing statement, or len(argLists) if the batch
+	// failed as a whole.
+	QueryBatch(ctx context.Context, query string, argLists [][]any, scan func(i int, row pgx.Row) error) (int, error)
+	// QueryLocal runs a query in a transaction in which settings are applied
+	// as with SET LOCAL, so they do not leak to other users of the
+	// connection. The transaction is committed once all the rows are read,
+	// which Err reports the failure of, and rolled back if the query fails
+	// or the rows are closed before; either way the connection is released.
+	QueryLocal(ctx context.Context, settings []setting, query string, args ...any) (queryRows, error)
+	// QueryCursor runs a query like QueryLocal, through a cursor from which
+	// the rows are fetched fetchSize at a time. The transaction ends like
+	// that of QueryLocal.
+	QueryCursor(ctx context.Context, settings []setting, fetchSize int, query string, args ...any) (queryRows, error)
+}
+
+// setting is a run-time configuration parameter set by QueryLocal.
+type setting struct {
+	name  string
+	value string
+}
+
+// setLocalQuery sets a configuration parameter for the current transaction.
+const setLocalQuery = "SELECT set_config($1, $2, true)"
+
+// cursorName is the name of the cursor declared by QueryCursor.
+const cursorName = "genkit_cursor"
+
+// declareCursorQuery returns the statement declaring the cursor of
+// QueryCursor for query, and the statement fetching from it.
+func declareCursorQuery(query string, fetchSize int) (declare, fetch string) {
+	return fmt.Sprintf("DECLARE %s NO SCROLL CURSOR FOR %s", cursorName, query),
+		fmt.Sprintf("FETCH FORWARD %d FROM %s", fetchSize, cursorName)
+}
+
+// queryRows is the subset of [pgx.Rows] used by the engine.
+type queryRows interface {
+	Next() bool
+	Values() ([]any, error)
+	Scan(dest ...any) error
+	Err() error
+	Close()
+}
+
+// Consistency selects the connection that retrievals read from when a read
+// pool is set with [WithReadPool].
+type Consistency string
+
+const (
+	// ConsistencyReplica reads from the read pool. It is the default.
+	ConsistencyReplica Consistency = "replica"
+	// ConsistencyPrimary reads from the primary connection, such as to see
+	// documents indexed just before, which a replica may not have yet.
+	ConsistencyPrimary Consistency = "primary"
+)
+
+type consistencyKey struct{}
+
+// WithConsistency returns a context whose retrievals read from the
+// connection selected by c, overriding the default routing to the read pool.
+// It has no effect if no read pool is configured.
+func WithConsistency(ctx context.Context, c Consistency) context.Context {
+	return context.WithValue(ctx, consistencyKey{}, c)
+}
+
+// consistency returns the consistency set on ctx by WithConsistency.
+func consistency(ctx context.Context) Consistency {
+	c, _ := ctx.Value(consistencyKey{}).(Consistency)
+	return c
+}
+
+// querier returns the querier of the configured connection.
+func (pgEngine *PostgresEngine) querier() querier {
+	var q querier = poolQuerier{pgEngine.executor(pgEngine.Pool)}
+	switch {
+	case pgEngine.config.db != nil:
+		q = sqlQuerier{pgEngine.config.db}
+	case pgEngine.config.conn != nil:
+		q = poolQuerier{pgEngine.config.conn}
+	case pgEngine.pools != nil:
+		q = reconnectingQuerier{pgEngine.pools, pgEngine.config.acquireTimeout}
+	}
+	if pgEngine.config.retry.maxAttempts > 1 {
+		q = retryingQuerier{q, pgEngine.config.retry}
+	}
+	return pgEngine.commented(q)
+}
+
+// pgxExecutor is implemented by [pgxpool.Pool], [pgx.Conn] and [pgx.Tx].
+type pgxExecutor interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+var (
+	_ pgxExecutor = (*pgxpool.Pool)(nil)
+	_ pgxExecutor = (*pgx.Conn)(nil)
+	_ pgxExecutor = pgx.Tx(nil)
+)
+
+// readQuerier returns the querier used for retrieval with ctx: that of the
+// read pool if one is configured and ctx does not require the primary, or
+// else the primary querier.
+func (pgEngine *PostgresEngine) readQuerier(ctx context.Context) querier {
+	if pgEngine.config.readPool == nil || consistency(ctx) == ConsistencyPrimary {
+		return pgEngine.querier()
+	}
+	var q querier = poolQuerier{pgEngine.executor(pgEngine.config.readPool)}
+	if pgEngine.config.retry.maxAttempts > 1 {
+		q = retryingQuerier{q, pgEngine.config.retry}
+	}
+	return pgEngine.commented(q)
+}
+
+// poolQuerier runs statements on a pgx pool, connection or transaction.
+type poolQuerier struct {
+	pool pgxExecutor
+}
+
+func (q poolQuerier) Exec(ctx context.Context, query string, args ...any) (int64, error) {
+	tag, err := q.pool.Exec(ctx, query, args...)
+	return tag.RowsAffected(), err
+}
+
+func (q poolQuerier) Query(ctx context.Context, query string, args ...any) (queryRows, error) {
+	return q.pool.Query(ctx, query, args...)
+}
+
+func (q poolQuerier) QueryRow(ctx context.Context, query string, args ...any) pgx.Row {
+	return q.pool.QueryRow(ctx, query, args...)
+}
+
+// QueryBatch sends the statements in a single round trip. The statements of a
+// batch run in an implicit transaction, or in the transaction of q.
+func (q poolQuerier) QueryBatch(ctx context.Context, query string, argLists [][]any, scan func(i int, row pgx.Row) error) (int, error) {
+	b := &pgx.Batch{}
+	for _, args := range argLists {
+		b.Queue(query, args...)
+	}
+	br := q.pool.SendBatch(ctx, b)
+	for i := range argLists {
+		if err := scan(i, br.QueryRow()); err != nil {
+			br.Close()
+			return i, err
+		}
+	}
+	if err := br.Close(); err != nil {
+		return len(argLists), err
+	}
+	return 0, nil
+}
+
+func (q poolQuerier) QueryLocal(ctx context.Context, settings []setting, query string, args ...any) (queryRows, error) {
+	tx, err := q.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range settings {
+		if _, err := tx.Exec(ctx, setLocalQuery, s.name, s.value); err != nil {
+			tx.Rollback(context.WithoutCancel(ctx))
+			return nil, err
+		}
+	}
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		tx.Rollback(context.WithoutCancel(ctx))
+		return nil, err
+	}
+	return &txRows{Rows: rows, tx: tx, ctx: ctx}, nil
+}
+
+func (q poolQuerier) QueryCursor(ctx context.Context, settings []setting, fetchSize int, query string, args ...any) (queryRows, error) {
+	tx, err := q.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rollback := func() { tx.Rollback(context.WithoutCancel(ctx)) }
+	for _, s := range settings {
+		if _, err := tx.Exec(ctx, setLocalQuery, s.name, s.value); err != nil {
+			rollback()
+			return nil, err
+		}
+	}
+	declare, fetch := declareCursorQuery(query, fetchSize)
+	if _, err := tx.Exec(ctx, declare, args...); err != nil {
+		rollback()
+		return nil, err
+	}
+	return &cursorRows{
+		fetchSize: fetchSize,
+		fetch:     func() (queryRows, error) { return tx.Query(ctx, fetch) },
+		commit:    func() error { return tx.Commit(ctx) },
+		end:       rollback,
+	}, nil
+}
+
+// txRows are the rows of a query run by QueryLocal. Reading all of them
+// commits the transaction, and closing them before rolls it back.
+type txRows struct {
+	pgx.Rows
+	tx    pgx.Tx
+	ctx   context.Context
+	err   error // error committing the transaction
+	ended bool
+}
+
+func (r *txRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.end(r.Rows.Err() == nil)
+	return false
+}
+
+func (r *txRows) Err() error {
+	if err := r.Rows.Err(); err != nil {
+		return err
+	}
+	return r.err
+}
+
+func (r *txRows) Close() {
+	r.Rows.Close()
+	r.end(false)
+}
+
+// end commits or rolls back the transaction, unless it already ended.
+func (r *txRows) end(commit bool) {
+	if r.ended {
+		return
+	}
+	r.ended = true
+	if commit {
+		r.err = r.tx.Commit(r.ctx)
+		return
+	}
+	r.tx.Rollback(context.WithoutCancel(r.ctx))
+}
+
+// sqlQuerier runs statements through a database/sql handle opened with the
+// pgx stdlib driver.
+type sqlQuerier struct {
+	db *sql.DB
+}
+
+func (q sqlQuerier) Exec(ctx context.Context, query string, args ...any) (int64, error) {
+	res, err := q.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (q sqlQuerier) Query(ctx context.Context, query string, args ...any) (queryRows, error) {
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlRows{Rows: rows}, nil
+}
+
+func (q sqlQuerier) QueryRow(ctx context.Context, query string, args ...any) pgx.Row {
+	return sqlRow{q.db.QueryRowContext(ctx, query, args...)}
+}
+
+// QueryBatch runs the statements in a transaction.
+func (q sqlQuerier) QueryBatch(ctx context.Context, query string, argLists [][]any, scan func(i int, row pgx.Row) error) (int, error) {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return len(argLists), err
+	}
+	for i, args := range argLists {
+		if err := scan(i, sqlRow{tx.QueryRowContext(ctx, query, args...)}); err != nil {
+			tx.Rollback()
+			return i, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return len(argLists), err
+	}
+	return 0, nil
+}
+
+func (q sqlQuerier) QueryLocal(ctx context.Context, settings []setting, query string, args ...any) (queryRows, error) {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range settings {
+		if _, err := tx.ExecContext(ctx, setLocalQuery, s.name, s.value); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return &sqlTxRows{sqlRows: &sqlRows{Rows: rows}, tx: tx}, nil
+}
+
+func (q sqlQuerier) QueryCursor(ctx context.Context, settings []setting, fetchSize int, query string, args ...any) (queryRows, error) {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range settings {
+		if _, err := tx.ExecContext(ctx, setLocalQuery, s.name, s.value); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	declare, fetch := declareCursorQuery(query, fetchSize)
+	if _, err := tx.ExecContext(ctx, declare, args...); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return &cursorRows{
+		fetchSize: fetchSize,
+		fetch: func() (queryRows, error) {
+			rows, err := tx.QueryContext(ctx, fetch)
+			if err != nil {
+				return nil, err
+			}
+			return &sqlRows{Rows: rows}, nil
+		},
+		commit: tx.Commit,
+		end:    func() { tx.Rollback() },
+	}, nil
+}
+
+// cursorRows are the rows of a query run by QueryCursor, read a batch at a
+// time. Reading all of them commits the transaction of the cursor, if commit
+// is set, and closing them before ends it.
+type cursorRows struct {
+	fetchSize int
+	fetch     func() (queryRows, error) // fetches the next batch
+	commit    func() error              // commits the transaction
+	end       func()                    // ends the transaction
+	batch     queryRows                 // current batch, if any
+	read      int                       // rows read from the current batch
+	done      bool
+	err       error
+}
+
+func (r *cursorRows) Next() bool {
+	for !r.done {
+		if r.batch == nil {
+			if r.batch, r.err = r.fetch(); r.err != nil {
+				r.done = true
+				return false
+			}
+			r.read = 0
+		}
+		if r.batch.Next() {
+			r.read++
+			return true
+		}
+		r.batch.Close()
+		r.err = r.batch.Err()
+		// A short batch is the last one.
+		r.done = r.err != nil || r.read < r.fetchSize
+		r.batch = nil
+		if r.done && r.err == nil && r.commit != nil {
+			r.err = r.commit()
+			r.end = nil
+		}
+	}
+	return false
+}
+
+func (r *cursorRows) Values() ([]any, error) {
+	if r.batch == nil {
+		return nil, errors.New("no current row")
+	}
+	return r.batch.Values()
+}
+
+func (r *cursorRows) Scan(dest ...any) error {
+	if r.batch == nil {
+		return errors.New("no current row")
+	}
+	return r.batch.Scan(dest...)
+}
+
+func (r *cursorRows) Err() error {
+	return r.err
+}
+
+func (r *cursorRows) Close() {
+	if r.batch != nil {
+		r.batch.Close()
+		r.batch = nil
+	}
+	if r.end != nil {
+		r.end()
+		r.end = nil
+	}
+	r.done = true
+}
+
+// sqlTxRows are the rows of a query run by sqlQuerier.QueryLocal, which
+// end the transaction like txRows.
+type sqlTxRows struct {
+	*sqlRows
+	tx    *sql.Tx
+	err   error // error committing the transaction
+	ended bool
+}
+
+func (r *sqlTxRows) Next() bool {
+	if r.sqlRows.Next() {
+		return true
+	}
+	r.end(r.sqlRows.Err() == nil)
+	return false
+}
+
+func (r *sqlTxRows) Err() error {
+	if err := r.sqlRows.Err(); err != nil {
+		return err
+	}
+	return r.err
+}
+
+func (r *sqlTxRows) Close() {
+	r.sqlRows.Close()
+	r.end(false)
+}
+
+// end commits or rolls back the transaction, unless it already ended.
+func (r *sqlTxRows) end(commit bool) {
+	if r.ended {
+		return
+	}
+	r.ended = true
+	if commit {
+		r.err = r.tx.Commit()
+		return
+	}
+	r.tx.Rollback()
+}
+
+// sqlRows adapts [sql.Rows] to queryRows.
+type sqlRows struct {
+	*sql.Rows
+}
+
+// Values returns the values of the current row, as converted by the driver.
+func (r *sqlRows) Values() ([]any, error) {
+	cols, err := r.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, len(cols))
+	dest := make([]any, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := r.Rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (r *sqlRows) Close() {
+	r.Rows.Close()
+}
+
+// sqlRow adapts [sql.Row] to [pgx.Row], reporting a missing row as
+// [pgx.ErrNoRows].
+type sqlRow struct {
+	row *sql.Row
+}
+
+func (r sqlRow) Scan(dest ...any) error {
+	err := r.row.Scan(dest...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return pgx.ErrNoRows
+	}
+	return err
+}
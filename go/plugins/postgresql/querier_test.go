@@ -0,0 +1,367 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/assert"
+)
+
+type otherDriver struct{}
+
+func (otherDriver) Open(string) (driver.Conn, error) { return nil, errors.New("not implemented") }
+
+func init() {
+	sql.Register("postgresql-test-other", otherDriver{})
+}
+
+func TestApplyEngineOptionsDB(t *testing.T) {
+	db, err := sql.Open("pgx", "postgres://localhost/testdb")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cfg, err := applyEngineOptions([]Option{WithDB(db), WithDatabase("testdb")})
+	assert.NoError(t, err)
+	pgEngine := &PostgresEngine{config: cfg}
+	assert.IsType(t, sqlQuerier{}, pgEngine.querier())
+	assert.Same(t, db, pgEngine.DB())
+	assert.Nil(t, pgEngine.GetClient())
+
+	_, err = applyEngineOptions([]Option{WithDB(db), WithPool(&pgxpool.Pool{}), WithDatabase("testdb")})
+	assert.Error(t, err)
+	_, err = applyEngineOptions([]Option{WithDB(db), WithConnectionString("postgres://localhost/testdb")})
+	assert.Error(t, err)
+	_, err = applyEngineOptions([]Option{WithDB(db), WithDatabase("testdb"), WithMaxConns(4)})
+	assert.Error(t, err)
+
+	other, err := sql.Open("postgresql-test-other", "")
+	assert.NoError(t, err)
+	defer other.Close()
+	_, err = applyEngineOptions([]Option{WithDB(other), WithDatabase("testdb")})
+	assert.Error(t, err)
+}
+
+func TestApplyEngineOptionsConn(t *testing.T) {
+	conn := &pgx.Conn{}
+	cfg, err := applyEngineOptions([]Option{WithConn(conn), WithDatabase("testdb")})
+	assert.NoError(t, err)
+	pgEngine := &PostgresEngine{config: cfg}
+	assert.Same(t, conn, pgEngine.querier().(poolQuerier).pool)
+	assert.Nil(t, pgEngine.GetClient())
+	// The engine does not close connections it did not open.
+	assert.NoError(t, pgEngine.Close(context.Background()))
+
+	_, err = applyEngineOptions([]Option{WithConn(conn), WithPool(&pgxpool.Pool{}), WithDatabase("testdb")})
+	assert.Error(t, err)
+	_, err = applyEngineOptions([]Option{WithConn(conn), WithConnectionString("postgres://localhost/testdb")})
+	assert.Error(t, err)
+	_, err = applyEngineOptions([]Option{WithConn(conn), WithDatabase("testdb"), WithMaxConns(4)})
+	assert.Error(t, err)
+	_, err = applyEngineOptions([]Option{WithConn(conn), WithDatabase("testdb"), WithTracer(&recordingTracer{})})
+	assert.Error(t, err)
+}
+
+func TestPoolQuerierByDefault(t *testing.T) {
+	assert.IsType(t, poolQuerier{}, (&PostgresEngine{}).querier())
+}
+
+// localTx is a transaction that records the statements run in it.
+type localTx struct {
+	pgx.Tx
+	execs      [][]any
+	queries    []string
+	rolledBack bool
+}
+
+func (tx *localTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	tx.execs = append(tx.execs, append([]any{sql}, args...))
+	return pgconn.CommandTag{}, nil
+}
+
+func (tx *localTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	tx.queries = append(tx.queries, sql)
+	return localRows{}, nil
+}
+
+func (tx *localTx) Rollback(ctx context.Context) error {
+	tx.rolledBack = true
+	return nil
+}
+
+type localRows struct {
+	pgx.Rows
+}
+
+func (localRows) Close() {}
+
+// localPool is a pool whose transactions are a single localTx.
+type localPool struct {
+	pgxExecutor
+	tx *localTx
+}
+
+func (p localPool) Begin(ctx context.Context) (pgx.Tx, error) {
+	return p.tx, nil
+}
+
+func TestPoolQuerierQueryLocal(t *testing.T) {
+	tx := &localTx{}
+	rows, err := poolQuerier{localPool{tx: tx}}.QueryLocal(context.Background(),
+		[]setting{{"hnsw.ef_search", "100"}}, "SELECT 1")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]any{{setLocalQuery, "hnsw.ef_search", "100"}}, tx.execs)
+	assert.Equal(t, []string{"SELECT 1"}, tx.queries)
+	assert.False(t, tx.rolledBack)
+	rows.Close()
+	assert.True(t, tx.rolledBack)
+}
+
+// sessionConn is a connection that keeps run-time parameters like
+// PostgreSQL: those set with set_config(name, value, true) last until the
+// end of the transaction.
+type sessionConn struct {
+	pgxExecutor
+	local     map[string]string // parameters of the open transaction, if any
+	queryErr  error             // error of the queries run in a transaction
+	commits   int
+	rollbacks int
+}
+
+func (c *sessionConn) Begin(ctx context.Context) (pgx.Tx, error) {
+	c.local = make(map[string]string)
+	return &sessionTx{conn: c}, nil
+}
+
+// QueryRow returns the value of the parameter named by args[0], as
+// current_setting does.
+func (c *sessionConn) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return settingRow(c.local[args[0].(string)])
+}
+
+type sessionTx struct {
+	pgx.Tx
+	conn *sessionConn
+}
+
+func (tx *sessionTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if sql == setLocalQuery {
+		tx.conn.local[args[0].(string)] = args[1].(string)
+	}
+	return pgconn.CommandTag{}, nil
+}
+
+func (tx *sessionTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if err := tx.conn.queryErr; err != nil {
+		return nil, err
+	}
+	return &settingRows{values: []string{tx.conn.local[args[0].(string)]}}, nil
+}
+
+func (tx *sessionTx) Commit(ctx context.Context) error {
+	tx.conn.commits++
+	tx.conn.local = nil
+	return nil
+}
+
+func (tx *sessionTx) Rollback(ctx context.Context) error {
+	tx.conn.rollbacks++
+	tx.conn.local = nil
+	return nil
+}
+
+// settingRow is a row of a single text value.
+type settingRow string
+
+func (r settingRow) Scan(dest ...any) error {
+	*dest[0].(*string) = string(r)
+	return nil
+}
+
+// settingRows are rows of single text values.
+type settingRows struct {
+	pgx.Rows
+	values []string
+	pos    int
+}
+
+func (r *settingRows) Next() bool {
+	r.pos++
+	return r.pos <= len(r.values)
+}
+
+func (r *settingRows) Scan(dest ...any) error { return settingRow(r.values[r.pos-1]).Scan(dest...) }
+func (r *settingRows) Err() error             { return nil }
+func (r *settingRows) Close()                 {}
+
+func TestPoolQuerierQueryLocalDoesNotLeakSettings(t *testing.T) {
+	ctx := context.Background()
+	conn := &sessionConn{}
+	q := poolQuerier{conn}
+	settings := []setting{{"role", "tenant_reader"}}
+	const query = "SELECT current_setting($1)"
+	// checkout reads the parameter on the next use of the connection.
+	checkout := func() string {
+		var v string
+		assert.NoError(t, q.QueryRow(ctx, query, "role").Scan(&v))
+		return v
+	}
+
+	// Reading all the rows commits the transaction.
+	rows, err := q.QueryLocal(ctx, settings, query, "role")
+	assert.NoError(t, err)
+	var got []string
+	for rows.Next() {
+		var v string
+		assert.NoError(t, rows.Scan(&v))
+		got = append(got, v)
+	}
+	assert.NoError(t, rows.Err())
+	rows.Close()
+	assert.Equal(t, []string{"tenant_reader"}, got)
+	assert.Equal(t, 1, conn.commits)
+	assert.Zero(t, conn.rollbacks)
+	assert.Empty(t, checkout())
+
+	// Closing the rows before rolls it back.
+	rows, err = q.QueryLocal(ctx, settings, query, "role")
+	assert.NoError(t, err)
+	assert.True(t, rows.Next())
+	rows.Close()
+	assert.Equal(t, 1, conn.commits)
+	assert.Equal(t, 1, conn.rollbacks)
+	assert.Empty(t, checkout())
+
+	// So does a failing query.
+	conn.queryErr = errors.New("permission denied for table documents")
+	_, err = q.QueryLocal(ctx, settings, query, "role")
+	assert.ErrorIs(t, err, conn.queryErr)
+	assert.Equal(t, 2, conn.rollbacks)
+	assert.Empty(t, checkout())
+}
+
+func TestReadQuerier(t *testing.T) {
+	primary, replica := &pgxpool.Pool{}, &pgxpool.Pool{}
+	cfg, err := applyEngineOptions([]Option{WithPool(primary), WithReadPool(replica), WithDatabase("testdb")})
+	assert.NoError(t, err)
+	pgEngine := &PostgresEngine{Pool: primary, config: cfg}
+	ctx := context.Background()
+	assert.Same(t, replica, pgEngine.readQuerier(ctx).(poolQuerier).pool.(acquiringPool).pool)
+	assert.Same(t, primary, pgEngine.querier().(poolQuerier).pool.(acquiringPool).pool)
+	assert.Same(t, primary, pgEngine.readQuerier(WithConsistency(ctx, ConsistencyPrimary)).(poolQuerier).pool.(acquiringPool).pool)
+	assert.Same(t, replica, pgEngine.readQuerier(WithConsistency(ctx, ConsistencyReplica)).(poolQuerier).pool.(acquiringPool).pool)
+
+	pgEngine.config.readPool = nil
+	assert.Same(t, primary, pgEngine.readQuerier(ctx).(poolQuerier).pool.(acquiringPool).pool)
+	assert.Same(t, primary, pgEngine.readQuerier(WithConsistency(ctx, ConsistencyReplica)).(poolQuerier).pool.(acquiringPool).pool)
+}
+
+func TestQuerierAcquireTimeout(t *testing.T) {
+	pool := &pgxpool.Pool{}
+	cfg, err := applyEngineOptions([]Option{WithPool(pool), WithDatabase("testdb"), WithAcquireTimeout(time.Second)})
+	assert.NoError(t, err)
+	pgEngine := &PostgresEngine{Pool: pool, config: cfg}
+	assert.Equal(t, acquiringPool{pool, time.Second}, pgEngine.querier().(poolQuerier).pool)
+
+	cfg, err = applyEngineOptions([]Option{WithPool(pool), WithDatabase("testdb")})
+	assert.NoError(t, err)
+	assert.Equal(t, defaultAcquireTimeout, cfg.acquireTimeout)
+
+	_, err = applyEngineOptions([]Option{WithPool(pool), WithDatabase("testdb"), WithAcquireTimeout(-time.Second)})
+	assert.Error(t, err)
+}
+
+func TestPoolQuerierQueryCursor(t *testing.T) {
+	tx := &localTx{}
+	rows, err := poolQuerier{localPool{tx: tx}}.QueryCursor(context.Background(),
+		[]setting{{"hnsw.ef_search", "100"}}, 500, "SELECT $1", 7)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]any{
+		{setLocalQuery, "hnsw.ef_search", "100"},
+		{"DECLARE genkit_cursor NO SCROLL CURSOR FOR SELECT $1", 7},
+	}, tx.execs)
+	assert.Empty(t, tx.queries)
+	rows.Close()
+	assert.True(t, tx.rolledBack)
+}
+
+// sliceRows are rows of single values.
+type sliceRows struct {
+	values []any
+	pos    int
+}
+
+func (r *sliceRows) Next() bool {
+	r.pos++
+	return r.pos <= len(r.values)
+}
+
+func (r *sliceRows) Values() ([]any, error) { return []any{r.values[r.pos-1]}, nil }
+func (r *sliceRows) Scan(dest ...any) error { return nil }
+func (r *sliceRows) Err() error             { return nil }
+func (r *sliceRows) Close()                 {}
+
+func TestCursorRows(t *testing.T) {
+	testCases := []struct {
+		name    string
+		batches [][]any
+		fetches int
+	}{
+		{name: "short last batch", batches: [][]any{{1, 2}, {3}}, fetches: 2},
+		{name: "empty last batch", batches: [][]any{{1, 2}, {3, 4}, {}}, fetches: 3},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fetches, ended := 0, false
+			rows := &cursorRows{
+				fetchSize: 2,
+				fetch: func() (queryRows, error) {
+					fetches++
+					return &sliceRows{values: tc.batches[fetches-1]}, nil
+				},
+				end: func() { ended = true },
+			}
+			var got []any
+			for rows.Next() {
+				v, err := rows.Values()
+				assert.NoError(t, err)
+				got = append(got, v[0])
+			}
+			assert.NoError(t, rows.Err())
+			var want []any
+			for _, b := range tc.batches {
+				want = append(want, b...)
+			}
+			assert.Equal(t, want, got)
+			assert.Equal(t, tc.fetches, fetches)
+			rows.Close()
+			assert.True(t, ended)
+		})
+	}
+
+	// Reading all the rows commits the transaction rather than ending it.
+	committed, ended := false, false
+	rows := &cursorRows{
+		fetchSize: 2,
+		fetch:     func() (queryRows, error) { return &sliceRows{values: []any{1}}, nil },
+		commit:    func() error { committed = true; return nil },
+		end:       func() { ended = true },
+	}
+	for rows.Next() {
+	}
+	assert.NoError(t, rows.Err())
+	rows.Close()
+	assert.True(t, committed)
+	assert.False(t, ended)
+
+	rows = &cursorRows{fetchSize: 2, fetch: func() (queryRows, error) { return nil, errors.New("boom") }}
+	assert.False(t, rows.Next())
+	assert.Error(t, rows.Err())
+}
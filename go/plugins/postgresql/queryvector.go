@@ -0,0 +1,22 @@
+package postgresql
+
+import "fmt"
+
+// checkQueryVector returns an error wrapping [ErrInvalidQueryVector] if vec
+// cannot rank documents: if it is empty, or, with [CosineDistance] and
+// unless [Config.AllowZeroQueryVector] is set, if all its elements are zero,
+// as the cosine distance of such a vector to any other is undefined.
+func (ds *docStore) checkQueryVector(vec []float32) error {
+	if len(vec) == 0 {
+		return fmt.Errorf("%w: query embedding is empty", ErrInvalidQueryVector)
+	}
+	if ds.config.DistanceStrategy != CosineDistance || ds.config.AllowZeroQueryVector {
+		return nil
+	}
+	for _, f := range vec {
+		if f != 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: query embedding has only zero elements, for which the cosine distance is undefined", ErrInvalidQueryVector)
+}
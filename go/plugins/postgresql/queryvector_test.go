@@ -0,0 +1,23 @@
+package postgresql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckQueryVector(t *testing.T) {
+	ds := &docStore{config: &Config{DistanceStrategy: CosineDistance}}
+	assert.NoError(t, ds.checkQueryVector([]float32{0, 0.5, 0}))
+	assert.ErrorIs(t, ds.checkQueryVector(nil), ErrInvalidQueryVector)
+	assert.ErrorIs(t, ds.checkQueryVector([]float32{}), ErrInvalidQueryVector)
+	assert.ErrorIs(t, ds.checkQueryVector([]float32{0, 0, 0}), ErrInvalidQueryVector)
+
+	ds.config.AllowZeroQueryVector = true
+	assert.NoError(t, ds.checkQueryVector([]float32{0, 0, 0}))
+	assert.ErrorIs(t, ds.checkQueryVector(nil), ErrInvalidQueryVector)
+
+	ds = &docStore{config: &Config{DistanceStrategy: EuclideanDistance}}
+	assert.NoError(t, ds.checkQueryVector([]float32{0, 0, 0}))
+	assert.ErrorIs(t, ds.checkQueryVector(nil), ErrInvalidQueryVector)
+}
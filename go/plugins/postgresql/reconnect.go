@@ -0,0 +1,157 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/puddle/v2"
+)
+
+// poolState holds the connection pool of an engine. It is shared by the
+// copies of an engine, so that a pool built by the engine and closed by
+// someone else can be replaced for all of them.
+type poolState struct {
+	mu     sync.Mutex
+	pool   *pgxpool.Pool
+	owned  bool // the pool was built by the engine
+	closed bool // the engine was closed
+}
+
+func (s *poolState) current() *pgxpool.Pool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pool
+}
+
+// reopen replaces old, which was found closed, by a new pool with the same
+// configuration, unless another caller already replaced it. It returns an
+// error wrapping [ErrPoolClosed] if the pool cannot be replaced.
+func (s *poolState) reopen(ctx context.Context, old *pgxpool.Pool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pool != old {
+		return nil
+	}
+	switch {
+	case s.closed:
+		return fmt.Errorf("%w: the engine was closed", ErrPoolClosed)
+	case !s.owned:
+		return fmt.Errorf("%w: the pool provided with WithPool was closed", ErrPoolClosed)
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, old.Config())
+	if err != nil {
+		return fmt.Errorf("%w: failed to reopen it: %w", ErrPoolClosed, err)
+	}
+	s.pool = pool
+	return nil
+}
+
+// close closes the current pool and prevents it from being reopened.
+func (s *poolState) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.pool.Close()
+}
+
+// do runs f with the current pool. If f fails because the pool is closed,
+// the pool is reopened and f runs once more.
+func (s *poolState) do(ctx context.Context, f func(pool *pgxpool.Pool) error) error {
+	pool := s.current()
+	err := f(pool)
+	if !errors.Is(err, puddle.ErrClosedPool) {
+		return err
+	}
+	if err := s.reopen(ctx, pool); err != nil {
+		return err
+	}
+	return f(s.current())
+}
+
+// pool returns the current connection pool of the engine, or nil if it has
+// none.
+func (pgEngine *PostgresEngine) pool() *pgxpool.Pool {
+	if pgEngine.pools == nil {
+		return pgEngine.Pool
+	}
+	return pgEngine.pools.current()
+}
+
+// withPool runs f with the current pool of the engine, as [poolState.do].
+func (pgEngine *PostgresEngine) withPool(ctx context.Context, f func(pool *pgxpool.Pool) error) error {
+	if pgEngine.pools == nil {
+		return f(pgEngine.Pool)
+	}
+	return pgEngine.pools.do(ctx, f)
+}
+
+// reconnectingQuerier runs statements on the current pool of an engine,
+// reopening the pool if it was closed.
+type reconnectingQuerier struct {
+	pools          *poolState
+	acquireTimeout time.Duration
+}
+
+func (q reconnectingQuerier) Exec(ctx context.Context, query string, args ...any) (n int64, err error) {
+	err = q.pools.do(ctx, func(pool *pgxpool.Pool) error {
+		n, err = poolQuerier{acquiring(pool, q.acquireTimeout)}.Exec(ctx, query, args...)
+		return err
+	})
+	return n, err
+}
+
+func (q reconnectingQuerier) Query(ctx context.Context, query string, args ...any) (rows queryRows, err error) {
+	err = q.pools.do(ctx, func(pool *pgxpool.Pool) error {
+		rows, err = poolQuerier{acquiring(pool, q.acquireTimeout)}.Query(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+func (q reconnectingQuerier) QueryRow(ctx context.Context, query string, args ...any) pgx.Row {
+	return reconnectingRow{q: q, ctx: ctx, query: query, args: args}
+}
+
+func (q reconnectingQuerier) QueryBatch(ctx context.Context, query string, argLists [][]any, scan func(i int, row pgx.Row) error) (i int, err error) {
+	err = q.pools.do(ctx, func(pool *pgxpool.Pool) error {
+		i, err = poolQuerier{acquiring(pool, q.acquireTimeout)}.QueryBatch(ctx, query, argLists, scan)
+		return err
+	})
+	return i, err
+}
+
+func (q reconnectingQuerier) QueryLocal(ctx context.Context, settings []setting, query string, args ...any) (rows queryRows, err error) {
+	err = q.pools.do(ctx, func(pool *pgxpool.Pool) error {
+		rows, err = poolQuerier{acquiring(pool, q.acquireTimeout)}.QueryLocal(ctx, settings, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+func (q reconnectingQuerier) QueryCursor(ctx context.Context, settings []setting, fetchSize int, query string, args ...any) (rows queryRows, err error) {
+	err = q.pools.do(ctx, func(pool *pgxpool.Pool) error {
+		rows, err = poolQuerier{acquiring(pool, q.acquireTimeout)}.QueryCursor(ctx, settings, fetchSize, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// reconnectingRow runs its query when scanned, as a closed pool is only
+// reported then.
+type reconnectingRow struct {
+	q     reconnectingQuerier
+	ctx   context.Context
+	query string
+	args  []any
+}
+
+func (r reconnectingRow) Scan(dest ...any) error {
+	return r.q.pools.do(r.ctx, func(pool *pgxpool.Pool) error {
+		return acquiring(pool, r.q.acquireTimeout).QueryRow(r.ctx, r.query, r.args...).Scan(dest...)
+	})
+}
@@ -0,0 +1,56 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/puddle/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// closedPool returns a closed pool whose connections would be refused.
+func closedPool(t *testing.T) *pgxpool.Pool {
+	config, err := pgxpool.ParseConfig("host=127.0.0.1 port=1 user=test dbname=test connect_timeout=1")
+	assert.NoError(t, err)
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	assert.NoError(t, err)
+	pool.Close()
+	return pool
+}
+
+func TestReconnectOwnedPool(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pool := closedPool(t)
+	pgEngine := &PostgresEngine{Pool: pool, pools: &poolState{pool: pool, owned: true}}
+
+	_, err := pgEngine.querier().Exec(ctx, "SELECT 1")
+	// The reopened pool is used: the connection is refused, but the pool is
+	// no longer closed.
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, puddle.ErrClosedPool)
+	assert.NotErrorIs(t, err, ErrPoolClosed)
+	reopened := pgEngine.GetClient()
+	assert.NotSame(t, pool, reopened)
+
+	// Copies of the engine share the reopened pool.
+	engineCopy := *pgEngine
+	assert.Same(t, reopened, engineCopy.GetClient())
+
+	// Once the engine is closed, the pool is not reopened.
+	assert.NoError(t, pgEngine.Close(ctx))
+	err = pgEngine.querier().QueryRow(ctx, "SELECT 1").Scan()
+	assert.ErrorIs(t, err, ErrPoolClosed)
+}
+
+func TestReconnectInjectedPool(t *testing.T) {
+	pool := closedPool(t)
+	pgEngine := &PostgresEngine{Pool: pool, pools: &poolState{pool: pool}}
+
+	_, err := pgEngine.querier().Query(context.Background(), "SELECT 1")
+	assert.ErrorIs(t, err, ErrPoolClosed)
+	assert.ErrorIs(t, pgEngine.Ping(context.Background()), ErrPoolClosed)
+	assert.Same(t, pool, pgEngine.GetClient())
+}
@@ -0,0 +1,228 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ReembedOptions configures [PostgresEngine.ReembedTable].
+type ReembedOptions struct {
+	// Column is the embedding column written. The default is
+	// [Config.EmbeddingColumn]. Its dimension must be that of the
+	// embeddings of the new embedder: for a model of another dimension,
+	// add a column of that dimension first, such as with ALTER TABLE ... ADD
+	// COLUMN, re-embed into it, and then make it the embedding column.
+	Column string
+	// EmbedderOptions are passed to the embedder.
+	EmbedderOptions any
+	// BatchSize is the number of rows read, embedded and updated at a time.
+	// The default is [Config.IndexBatchSize].
+	BatchSize int
+	// OnlyMissing re-embeds only the rows whose Column is NULL, such as to
+	// fill a new column or to resume an interrupted run.
+	OnlyMissing bool
+	// Progress, if set, is called after each batch with the number of rows
+	// updated so far.
+	Progress func(updated int64)
+}
+
+// ReembedTable recomputes the embeddings of the rows of the table described
+// by cfg with embedder, such as after upgrading the embedding model, and
+// returns the number of rows updated. The content, metadata and id of the
+// rows are left unchanged. Rows are read in order of [Config.IDColumn], a
+// batch at a time, and each batch is updated in a single round trip, so the
+// rows updated before a failure keep their new embeddings; with
+// [ReembedOptions.OnlyMissing], running ReembedTable again resumes where it
+// stopped. The documents passed to embedder only hold the content of the
+// rows, loaded with [ExternalContentOptions.Load] for tables with external
+// content. Embeddings are normalized as configured by [Config.Normalization].
+//
+// Rows written concurrently with earlier embeddings may be left with them,
+// so the indexers of the table should use embedder before ReembedTable is
+// run.
+func (pgEngine *PostgresEngine) ReembedTable(ctx context.Context, cfg *Config, embedder ai.Embedder, opts ReembedOptions) (n int64, err error) {
+	if err := pgEngine.checkWrite("re-embed documents"); err != nil {
+		return 0, fmt.Errorf("postgres.ReembedTable: %w", err)
+	}
+	if embedder == nil {
+		return 0, errors.New("postgres.ReembedTable: embedder is required")
+	}
+	if opts.BatchSize < 0 {
+		return 0, fmt.Errorf("postgres.ReembedTable: batch size must not be negative, got %d", opts.BatchSize)
+	}
+	tableCfg := *cfg
+	if tableCfg.Embedder == nil {
+		tableCfg.Embedder = embedder
+	}
+	ds, err := newEngineDocStore(ctx, *pgEngine, &tableCfg)
+	if err != nil {
+		return 0, fmt.Errorf("postgres.ReembedTable: %w", err)
+	}
+	if opts.Column == "" {
+		opts.Column = ds.config.EmbeddingColumn
+	}
+	if !ds.vectorColumns[opts.Column] {
+		return 0, fmt.Errorf("postgres.ReembedTable: column %q is not an embedding column of table %q", opts.Column, ds.config.TableName)
+	}
+	if opts.BatchSize == 0 {
+		opts.BatchSize = ds.config.IndexBatchSize
+	}
+	ctx, span := ds.startSpan(ctx, "postgresql.reembed",
+		attribute.String("postgresql.column", opts.Column),
+		attribute.Int("postgresql.batch_size", opts.BatchSize))
+	defer func() {
+		span.SetAttributes(attribute.Int64("postgresql.result_count", n))
+		endSpan(span, err)
+	}()
+
+	dim, err := ds.columnDimension(ctx, opts.Column)
+	if err != nil {
+		return 0, fmt.Errorf("postgres.ReembedTable: %w", err)
+	}
+	update := ds.reembedUpdateQuery(opts.Column)
+	var after any
+	for {
+		ids, docs, err := ds.readReembedBatch(ctx, opts, after)
+		if err != nil {
+			return n, fmt.Errorf("postgres.ReembedTable: %w", err)
+		}
+		if len(ids) == 0 {
+			return n, nil
+		}
+		updated, err := ds.reembedBatch(ctx, embedder, opts, update, dim, ids, docs)
+		n += updated
+		if err != nil {
+			return n, fmt.Errorf("postgres.ReembedTable: %w", err)
+		}
+		if opts.Progress != nil {
+			opts.Progress(n)
+		}
+		after = ids[len(ids)-1]
+	}
+}
+
+// reembedSelectQuery returns the query reading a batch of rows to re-embed
+// after the row whose id is bound to $1, or from the first row if after is
+// false.
+func (ds *docStore) reembedSelectQuery(opts ReembedOptions, after bool) string {
+	var conds []string
+	if after {
+		conds = append(conds, fmt.Sprintf(`"%s" > $1`, ds.config.IDColumn))
+	}
+	if opts.OnlyMissing {
+		conds = append(conds, fmt.Sprintf(`"%s" IS NULL`, opts.Column))
+	}
+	query := fmt.Sprintf(`SELECT "%s", "%s" FROM %s`, ds.config.IDColumn, ds.config.ContentColumn,
+		qualifiedName(ds.config.SchemaName, ds.config.TableName))
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	return query + fmt.Sprintf(` ORDER BY "%s" LIMIT %d`, ds.config.IDColumn, opts.BatchSize)
+}
+
+// reembedUpdateQuery returns the statement setting column to $1 for the row
+// whose id is $2.
+func (ds *docStore) reembedUpdateQuery(column string) string {
+	return fmt.Sprintf(`UPDATE %s SET "%s" = %s WHERE "%s" = $2 RETURNING true`,
+		qualifiedName(ds.config.SchemaName, ds.config.TableName), column, ds.engine.vectorType().cast("$1"), ds.config.IDColumn)
+}
+
+// readReembedBatch reads the ids and the content of the rows of the next
+// batch, after the row whose id is after if it is not nil.
+func (ds *docStore) readReembedBatch(ctx context.Context, opts ReembedOptions, after any) ([]any, []*ai.Document, error) {
+	var args []any
+	if after != nil {
+		args = append(args, after)
+	}
+	qctx, cancel := ds.engine.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := ds.engine.querier().Query(qctx, ds.reembedSelectQuery(opts, after != nil), args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read rows: %w", queryTimeoutError(qctx, err))
+	}
+	defer rows.Close()
+	var ids []any
+	var docs []*ai.Document
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read row: %w", queryTimeoutError(qctx, err))
+		}
+		parts, err := ds.contentParts(values[1])
+		if err != nil {
+			return nil, nil, fmt.Errorf("row %q: %w", idToString(values[0]), err)
+		}
+		metadata := map[string]any{}
+		if ds.config.ExternalContent != nil {
+			metadata[ContentRefMetadataKey] = parts[0].Text
+		}
+		ids = append(ids, values[0])
+		docs = append(docs, &ai.Document{Content: parts, Metadata: metadata})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read rows: %w", queryTimeoutError(qctx, err))
+	}
+	if ec := ds.config.ExternalContent; ec != nil {
+		if ec.Load == nil {
+			return nil, nil, errors.New("re-embedding documents with external content requires a loader")
+		}
+		if err := ds.loadContent(ctx, docs); err != nil {
+			return nil, nil, err
+		}
+	}
+	return ids, docs, nil
+}
+
+// reembedBatch embeds docs, the content of the rows whose ids are ids, and
+// updates their embeddings with the update statement in a single round
+// trip. It returns the number of rows updated, which excludes rows deleted
+// since they were read.
+func (ds *docStore) reembedBatch(ctx context.Context, embedder ai.Embedder, opts ReembedOptions, update string, dim int, ids []any, docs []*ai.Document) (int64, error) {
+	embeddings, err := embedWith(ctx, embedder, opts.EmbedderOptions, docs)
+	if err != nil {
+		return 0, fmt.Errorf("embedding rows %q to %q failed: %w", idToString(ids[0]), idToString(ids[len(ids)-1]), err)
+	}
+	argLists := make([][]any, len(ids))
+	for i, emb := range embeddings {
+		emb, err := ds.sanitize(idToString(ids[i]), emb)
+		if err == nil {
+			emb, err = ds.normalize(emb)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("row %q: %w", idToString(ids[i]), err)
+		}
+		if dim > 0 && len(emb) != dim {
+			return 0, fmt.Errorf("row %q: %w: embedding has %d dimensions, but column %q expects %d; add a column of the new dimension and re-embed into it",
+				idToString(ids[i]), ErrDimensionMismatch, len(emb), opts.Column, dim)
+		}
+		vec, err := newVector(emb)
+		if err != nil {
+			return 0, fmt.Errorf("row %q: %w", idToString(ids[i]), err)
+		}
+		argLists[i] = []any{ds.engine.vectorArg(vec), ids[i]}
+	}
+	var updated int64
+	scan := func(i int, row pgx.Row) error {
+		var ok bool
+		err := row.Scan(&ok)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err == nil {
+			updated++
+		}
+		return err
+	}
+	qctx, cancel := ds.engine.withQueryTimeout(ctx)
+	defer cancel()
+	if _, err := ds.engine.querier().QueryBatch(qctx, update, argLists, scan); err != nil {
+		return 0, fmt.Errorf("failed to update rows: %w", queryTimeoutError(qctx, describeQueryError(err, ds.config)))
+	}
+	return updated, nil
+}
@@ -0,0 +1,48 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReembedSelectQuery(t *testing.T) {
+	ds := testDocStore()
+	opts := ReembedOptions{Column: "embedding", BatchSize: 100}
+	assert.Equal(t, `SELECT "id", "content" FROM "public"."documents" ORDER BY "id" LIMIT 100`,
+		ds.reembedSelectQuery(opts, false))
+	assert.Equal(t, `SELECT "id", "content" FROM "public"."documents" WHERE "id" > $1 ORDER BY "id" LIMIT 100`,
+		ds.reembedSelectQuery(opts, true))
+
+	opts.Column = "embedding_v2"
+	opts.OnlyMissing = true
+	assert.Equal(t, `SELECT "id", "content" FROM "public"."documents" WHERE "embedding_v2" IS NULL ORDER BY "id" LIMIT 100`,
+		ds.reembedSelectQuery(opts, false))
+	assert.Equal(t, `SELECT "id", "content" FROM "public"."documents" WHERE "id" > $1 AND "embedding_v2" IS NULL ORDER BY "id" LIMIT 100`,
+		ds.reembedSelectQuery(opts, true))
+}
+
+func TestReembedUpdateQuery(t *testing.T) {
+	ds := testDocStore()
+	assert.Equal(t, `UPDATE "public"."documents" SET "embedding_v2" = $1 WHERE "id" = $2 RETURNING true`,
+		ds.reembedUpdateQuery("embedding_v2"))
+}
+
+func TestReembedBatchDimensionMismatch(t *testing.T) {
+	ds := testDocStore()
+	opts := ReembedOptions{Column: "embedding"}
+	_, err := ds.reembedBatch(context.Background(), &fakeEmbedder{}, opts, ds.reembedUpdateQuery("embedding"), 3,
+		[]any{"a", "b"}, testDocuments("1", "2"))
+	require.ErrorIs(t, err, ErrDimensionMismatch)
+	assert.Contains(t, err.Error(), `row "a"`)
+}
+
+func TestReembedTableValidation(t *testing.T) {
+	engine := &PostgresEngine{}
+	_, err := engine.ReembedTable(context.Background(), &Config{TableName: "documents"}, nil, ReembedOptions{})
+	assert.ErrorContains(t, err, "embedder is required")
+	_, err = engine.ReembedTable(context.Background(), &Config{TableName: "documents"}, &fakeEmbedder{}, ReembedOptions{BatchSize: -1})
+	assert.ErrorContains(t, err, "batch size must not be negative")
+}
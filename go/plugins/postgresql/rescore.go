@@ -0,0 +1,103 @@
+package postgresql
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// RescorePrecision is the precision at which the candidates of
+// [WithExactRescore] are searched for.
+type RescorePrecision string
+
+const (
+	// RescoreFull searches candidates at the precision of the column. It is
+	// the default: the search is then only widened, by raising
+	// hnsw.ef_search, since the candidates are already ordered by exact
+	// distance.
+	RescoreFull RescorePrecision = "full"
+	// RescoreHalfVec searches candidates by the distance between the
+	// embeddings cast to halfvec, as served by an expression index such as
+	// USING hnsw (("embedding"::halfvec(768)) halfvec_cosine_ops), and
+	// reorders them by exact distance.
+	RescoreHalfVec RescorePrecision = "halfvec"
+	// RescoreBinary searches candidates by the Hamming distance between the
+	// binary quantized embeddings, as served by an expression index such as
+	// USING hnsw ((binary_quantize("embedding")::bit(768)) bit_hamming_ops),
+	// and reorders them by exact distance.
+	RescoreBinary RescorePrecision = "binary"
+)
+
+// validate reports an error if p is not a known precision.
+func (p RescorePrecision) validate() error {
+	switch p {
+	case RescoreFull, RescoreHalfVec, RescoreBinary:
+		return nil
+	}
+	return fmt.Errorf("unknown rescore precision %q", p)
+}
+
+// maxEfSearch is the largest hnsw.ef_search pgvector accepts.
+const maxEfSearch = 1000
+
+// defaultEfSearch is the default hnsw.ef_search of pgvector.
+const defaultEfSearch = 40
+
+// rescoring reports whether a similarity search with opts fetches more
+// candidates than it returns, to rescore them. See [WithExactRescore].
+func (ds *docStore) rescoring(opts *RetrieverOptions) bool {
+	return ds.engine.config.rescoreMultiplier > 1 && opts.GroupBy == nil && opts.Boost == nil
+}
+
+// candidateDistance returns the lower-precision distance between column and
+// vecParam by which the candidates of a rescored search are fetched, or ""
+// with [RescoreFull]. It requires the dimension of column, read when the
+// query vector was checked.
+func (ds *docStore) candidateDistance(column, vecParam string) (string, error) {
+	p := ds.engine.config.rescorePrecision
+	if p == "" || p == RescoreFull {
+		return "", nil
+	}
+	ds.mu.Lock()
+	dim := ds.dimension
+	if column != ds.config.EmbeddingColumn {
+		dim = ds.columnDimensions[column]
+	}
+	ds.mu.Unlock()
+	if dim <= 0 {
+		return "", fmt.Errorf("rescoring at %s precision requires column %q to have a dimension", p, column)
+	}
+	if p == RescoreHalfVec {
+		return fmt.Sprintf(`"%s"::halfvec(%d) %s %s::halfvec(%d)`, column, dim, ds.config.DistanceStrategy.operator(), vecParam, dim), nil
+	}
+	return fmt.Sprintf(`binary_quantize("%s")::bit(%d) <~> binary_quantize(%s::%s)::bit(%d)`,
+		column, dim, vecParam, ds.engine.vectorType(), dim), nil
+}
+
+// rescoreQuery returns the query returning the k candidates of query nearest
+// to the query vector, ordered by their exact distance. query selects the
+// candidates by their lower-precision distance, with the exact distance and
+// the rescore_tiebreaker column.
+func rescoreQuery(query string, k int) string {
+	return fmt.Sprintf(`SELECT * FROM (%s) AS candidates ORDER BY distance, rescore_tiebreaker LIMIT %d`, query, k)
+}
+
+// rescoreSettings returns settings with the HNSW search list raised to the
+// number of candidates fetched by a rescored search of k documents, unless
+// opts sets it. Without it, HNSW scans return at most hnsw.ef_search rows,
+// and the larger candidate set would not be fetched.
+func (ds *docStore) rescoreSettings(settings []setting, k int, opts *RetrieverOptions) []setting {
+	if !ds.rescoring(opts) {
+		return settings
+	}
+	return efSearchSettings(settings, k*ds.engine.config.rescoreMultiplier, opts)
+}
+
+// efSearchSettings returns settings with the HNSW search list raised to
+// fetch candidates, up to the largest accepted, unless opts sets it.
+func efSearchSettings(settings []setting, fetch int, opts *RetrieverOptions) []setting {
+	fetch = min(fetch, maxEfSearch)
+	if opts.HNSWEfSearch > 0 || fetch <= defaultEfSearch {
+		return settings
+	}
+	return append(settings, setting{"hnsw.ef_search", strconv.Itoa(fetch)})
+}
@@ -0,0 +1,72 @@
+package postgresql
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExactRescore(t *testing.T) {
+	ds := testDocStore()
+	ds.engine.config.rescoreMultiplier = 10
+
+	// At full precision, the candidates are already ordered by exact
+	// distance, and only the HNSW search is widened.
+	query, _, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", "embedding" <=> $1 AS distance`+
+		` FROM "public"."documents" ORDER BY distance, "id" LIMIT 4`, query)
+
+	// At lower precision, the candidates are fetched in the order of the
+	// quantized index and reordered by exact distance.
+	ds.engine.config.rescorePrecision = RescoreHalfVec
+	_, _, err = ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{})
+	assert.ErrorContains(t, err, "requires column \"embedding\" to have a dimension")
+	ds.dimension = 2
+	query, _, err = ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM (SELECT "id", "content", "metadata", "source", "embedding" <=> $1 AS distance, "id" AS rescore_tiebreaker`+
+		` FROM "public"."documents" ORDER BY "embedding"::halfvec(2) <=> $1::halfvec(2), "id" LIMIT 40) AS candidates`+
+		` ORDER BY distance, rescore_tiebreaker LIMIT 4`, query)
+
+	ds.engine.config.rescorePrecision = RescoreBinary
+	query, _, err = ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, query, `ORDER BY binary_quantize("embedding")::bit(2) <~> binary_quantize($1::vector)::bit(2), "id" LIMIT 40) AS candidates`+
+		` ORDER BY distance, rescore_tiebreaker LIMIT 4`)
+
+	// The total stays last.
+	query, _, err = ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{CountTotal: true})
+	require.NoError(t, err)
+	assert.Contains(t, query, `"id" AS rescore_tiebreaker, `+totalColumn)
+
+	// Grouped searches are not rescored.
+	query, _, err = ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{GroupBy: &GroupOptions{Key: "source"}})
+	require.NoError(t, err)
+	assert.NotContains(t, query, "rescore_tiebreaker")
+}
+
+func TestRescoreSettings(t *testing.T) {
+	ds := testDocStore()
+	probes := []setting{{"ivfflat.probes", "10"}}
+	assert.Equal(t, probes, ds.rescoreSettings(probes, 4, &RetrieverOptions{}))
+
+	ds.engine.config.rescoreMultiplier = 5
+	assert.Equal(t, probes, ds.rescoreSettings(probes, 4, &RetrieverOptions{}), "within the default search list")
+	assert.Equal(t, []setting{{"ivfflat.probes", "10"}, {"hnsw.ef_search", "100"}}, ds.rescoreSettings(probes, 20, &RetrieverOptions{}))
+	assert.Equal(t, []setting{{"hnsw.ef_search", "1000"}}, ds.rescoreSettings(nil, 500, &RetrieverOptions{}))
+	assert.Empty(t, ds.rescoreSettings(nil, 20, &RetrieverOptions{HNSWEfSearch: 64}))
+
+	pool := WithPool(&pgxpool.Pool{})
+	_, err := applyEngineOptions([]Option{pool, WithDatabase("testdb"), WithExactRescore(-1)})
+	assert.Error(t, err)
+	_, err = applyEngineOptions([]Option{pool, WithDatabase("testdb"), WithRescorePrecision(RescoreBinary)})
+	assert.ErrorContains(t, err, "requires WithExactRescore")
+	_, err = applyEngineOptions([]Option{pool, WithDatabase("testdb"), WithExactRescore(4), WithRescorePrecision("int8")})
+	assert.Error(t, err)
+	cfg, err := applyEngineOptions([]Option{pool, WithDatabase("testdb"), WithExactRescore(4), WithRescorePrecision(RescoreHalfVec)})
+	assert.NoError(t, err)
+	assert.Equal(t, RescoreHalfVec, cfg.rescorePrecision)
+}
@@ -0,0 +1,82 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// RetrieveResult is the detailed result of a retrieval, returned by
+// [PostgresEngine.RetrieveDetailed].
+type RetrieveResult struct {
+	// Documents holds the retrieved documents, nearest first, or in the
+	// order of the reranker set with [WithReranker].
+	Documents []RetrievedDocument
+	// Candidates is the number of rows returned by the query, before the
+	// score threshold, MMR and reranking were applied.
+	Candidates int
+	// Total is the number of documents matching the retrieval regardless
+	// of K, with [RetrieverOptions.CountTotal], and nil otherwise.
+	Total *int64
+	// NextToken is the token of the cursor following the last document,
+	// from which [RetrieverOptions.AfterToken] continues the retrieval with
+	// the next page. It is empty if no document was returned, if the
+	// documents are not ordered by distance, such as with MMR, reranking or
+	// grouping, or if the value of [Config.TiebreakerColumn] of the last
+	// document is not among its metadata.
+	NextToken string
+}
+
+// RetrievedDocument is a document of a [RetrieveResult].
+type RetrievedDocument struct {
+	Document *ai.Document
+	// Rank is the 1-based position of the document in the result.
+	Rank int
+	// Distance is the distance between the document and the query, and Score
+	// the similarity score derived from it with
+	// [DistanceStrategy.Score], or its full-text relevance with
+	// [Config.TextSearch]. Both are nil for lookups, which have no
+	// query, and for documents returned by a reranker in place of those it
+	// was given.
+	Distance *float64
+	Score    *float64
+}
+
+// RetrieveDetailed runs the retrieval of req against the table described by
+// cfg, like the retriever defined with cfg, and returns the rank, distance
+// and score of each document as fields rather than metadata, along with the
+// number of candidates the query returned. The metadata of the documents is
+// the same as with the retriever, including [DistanceMetadataKey] and
+// [ScoreMetadataKey] unless disabled with [WithScoreInMetadata].
+func (pgEngine *PostgresEngine) RetrieveDetailed(ctx context.Context, cfg *Config, req *ai.RetrieverRequest) (*RetrieveResult, error) {
+	ds, err := newEngineDocStore(ctx, *pgEngine, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.RetrieveDetailed: %w", err)
+	}
+	return ds.retrieveDetailed(ctx, req)
+}
+
+// retrieveResult returns the result of a retrieval of docs out of
+// candidates rows, with the distances of the documents read from the rows.
+func (ds *docStore) retrieveResult(docs []*ai.Document, distances map[*ai.Document]float64, candidates int) *RetrieveResult {
+	res := &RetrieveResult{Documents: make([]RetrievedDocument, len(docs)), Candidates: candidates}
+	for i, doc := range docs {
+		res.Documents[i] = RetrievedDocument{Document: doc, Rank: i + 1}
+		if distance, ok := distances[doc]; ok {
+			score := ds.score(distance)
+			res.Documents[i].Distance = &distance
+			res.Documents[i].Score = &score
+		}
+	}
+	return res
+}
+
+// documents returns the documents of res.
+func (res *RetrieveResult) documents() []*ai.Document {
+	docs := make([]*ai.Document, len(res.Documents))
+	for i, d := range res.Documents {
+		docs[i] = d.Document
+	}
+	return docs
+}
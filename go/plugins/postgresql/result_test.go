@@ -0,0 +1,30 @@
+package postgresql
+
+import (
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetrieveResult(t *testing.T) {
+	ds := testDocStore()
+	a := ai.DocumentFromText("a", nil)
+	b := ai.DocumentFromText("b", nil)
+	res := ds.retrieveResult([]*ai.Document{a, b}, map[*ai.Document]float64{a: 0.25}, 5)
+
+	assert.Equal(t, 5, res.Candidates)
+	if assert.Len(t, res.Documents, 2) {
+		assert.Same(t, a, res.Documents[0].Document)
+		assert.Equal(t, 1, res.Documents[0].Rank)
+		if assert.NotNil(t, res.Documents[0].Distance) && assert.NotNil(t, res.Documents[0].Score) {
+			assert.Equal(t, 0.25, *res.Documents[0].Distance)
+			assert.Equal(t, CosineDistance.Score(0.25), *res.Documents[0].Score)
+		}
+		// Documents without a distance, such as those of lookups, have no score.
+		assert.Equal(t, 2, res.Documents[1].Rank)
+		assert.Nil(t, res.Documents[1].Distance)
+		assert.Nil(t, res.Documents[1].Score)
+	}
+	assert.Equal(t, []*ai.Document{a, b}, res.documents())
+}
@@ -0,0 +1,44 @@
+package postgresql
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// retrievedColumns returns the columns of [Config.RetrievedColumns], sorted
+// so that they are selected in a stable order.
+func (ds *docStore) retrievedColumns() []string {
+	if len(ds.config.RetrievedColumns) == 0 {
+		return nil
+	}
+	return slices.Sorted(maps.Keys(ds.config.RetrievedColumns))
+}
+
+// validateRetrievedColumns checks that the retrieved columns of the table
+// are not read otherwise, and that their metadata keys are distinct from
+// each other and from those of the other columns.
+func (ds *docStore) validateRetrievedColumns() error {
+	read := []string{ds.config.IDColumn, ds.config.ContentColumn, ds.config.EmbeddingColumn}
+	if ds.config.MetadataJSONColumn != "" {
+		read = append(read, ds.config.MetadataJSONColumn)
+	}
+	read = append(read, ds.config.MetadataColumns...)
+	reserved := []string{ds.config.IDColumn, DistanceMetadataKey, ScoreMetadataKey, EmbeddingMetadataKey, ContentRefMetadataKey}
+	keys := make(map[string]string)
+	for _, col := range ds.retrievedColumns() {
+		if slices.Contains(read, col) {
+			return fmt.Errorf("retrieved column %q is already read by the retriever", col)
+		}
+		key := cmp.Or(ds.config.RetrievedColumns[col], col)
+		if slices.Contains(reserved, key) || slices.Contains(ds.config.MetadataColumns, key) {
+			return fmt.Errorf("retrieved column %q: metadata key %q is reserved", col, key)
+		}
+		if other, ok := keys[key]; ok {
+			return fmt.Errorf("retrieved columns %q and %q have the same metadata key %q", other, col, key)
+		}
+		keys[key] = col
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package postgresql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetrievedColumns(t *testing.T) {
+	ds := testDocStore()
+	ds.config.RetrievedColumns = map[string]string{"view_count": "views", "updated_at": ""}
+	require.NoError(t, ds.validateRetrievedColumns())
+
+	query, _, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", "updated_at", "view_count", "embedding" <=> $1 AS distance`+
+		` FROM "public"."documents" ORDER BY distance, "id" LIMIT 4`, query)
+
+	doc, err := ds.rowToDocument([]any{"a", "text", map[string]any{"views": "stale"}, "wiki", "2024-01-01", int64(7), 0.25})
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), doc.Metadata["views"])
+	assert.Equal(t, "2024-01-01", doc.Metadata["updated_at"])
+	assert.Equal(t, 0.25, doc.Metadata[DistanceMetadataKey])
+}
+
+func TestValidateRetrievedColumns(t *testing.T) {
+	testCases := []struct {
+		name    string
+		columns map[string]string
+		want    string
+	}{
+		{"read column", map[string]string{"source": "src"}, "already read"},
+		{"embedding column", map[string]string{"embedding": "vec"}, "already read"},
+		{"id key", map[string]string{"external_id": "id"}, "reserved"},
+		{"metadata column key", map[string]string{"origin": "source"}, "reserved"},
+		{"score key", map[string]string{"rank": ScoreMetadataKey}, "reserved"},
+		{"same key", map[string]string{"a": "x", "b": "x"}, `same metadata key "x"`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ds := testDocStore()
+			ds.config.RetrievedColumns = tc.columns
+			assert.ErrorContains(t, ds.validateRetrievedColumns(), tc.want)
+		})
+	}
+}
@@ -1,17 +1,1036 @@
 package postgresql
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/firebase/genkit/go/ai"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// RetrieverOptions options for retriever
+// RetrieverOptions may be passed in the Options field of [ai.RetrieverRequest]
+// to configure a single retrieval. The Options field should be either nil or
+// a value of type *RetrieverOptions.
 type RetrieverOptions struct {
+	// K is the number of documents to return. The default is [Config.K].
+	K int `json:"k,omitempty"`
+	// EmbeddingColumn is the embedding column to search, such as one of
+	// the [VectorstoreTableOptions.AdditionalEmbeddingColumns]. Rows whose
+	// embedding in that column is NULL are skipped. The default is
+	// [Config.EmbeddingColumn].
+	EmbeddingColumn string `json:"embeddingColumn,omitempty"`
+	// Embedder, if set, searches the embedding column of the embedder of
+	// that name: [Config.Embedder] or one of [Config.ColumnEmbedders]. It
+	// is an alternative to EmbeddingColumn, for callers that choose an
+	// embedding model rather than a column.
+	Embedder string `json:"embedder,omitempty"`
+	// QueryEmbedder, if set, embeds the query document of this retrieval,
+	// with QueryEmbedderOptions, in place of the embedder of the searched
+	// column, such as to try the query model of an asymmetric model
+	// without defining another retriever. Its embedding must have the
+	// dimension of the column. It cannot be combined with QueryEmbedding
+	// or MultiVector.
+	QueryEmbedder        ai.Embedder `json:"-"`
+	QueryEmbedderOptions any         `json:"-"`
+	// Filters restrict the results to documents whose metadata matches
+	// all of the filters. A retrieval with filters but neither a query
+	// document nor a QueryEmbedding is a plain lookup: it returns the
+	// first K matching documents in the order set by OrderBy, without
+	// similarity ranking or scores. MMR, Hybrid, After, GroupBy and
+	// ScoreThreshold require a query, and lookups are not reranked. On a
+	// partitioned table, filters on the partition key, held by a metadata
+	// column, let Postgres skip the partitions that cannot match.
+	Filters []Filter `json:"filters,omitempty"`
+	// OrderBy is the id column, metadata column or JSON metadata key, compared
+	// as text, that orders the documents of a lookup, or the K nearest
+	// documents of a similarity search, with ties broken by
+	// [Config.TiebreakerColumn]. In a similarity search it cannot be combined
+	// with MMR, Hybrid, GroupBy, MultiVector, After, RollUp, Boost,
+	// [Config.TextSearch], [Config.QueryTemplate], reranking or batch
+	// retrieval.
+	OrderBy string `json:"orderBy,omitempty"`
+	// OrderDesc sorts the documents by OrderBy in descending order.
+	OrderDesc bool `json:"orderDesc,omitempty"`
+	// ScoreThreshold, if set, drops the results whose score is below it.
+	// Scores are computed with [DistanceStrategy.Score], so higher is always
+	// more similar: for cosine distance the score is the cosine similarity,
+	// between -1 and 1; for inner product it is the raw inner product, whose
+	// range depends on the magnitude of the embeddings; for Euclidean
+	// distance it is 1/(1+d), between 0 and 1. The threshold is applied
+	// after the nearest neighbors are selected, so fewer than the requested
+	// number of documents, possibly none, may be returned.
+	ScoreThreshold *float32 `json:"scoreThreshold,omitempty"`
+	// MinDistance and MaxDistance, if set, restrict the results to the
+	// documents whose distance to the query, as in [DistanceMetadataKey],
+	// is within these bounds, inclusive, such as to find documents that are
+	// similar but not identical. Unlike ScoreThreshold, the bounds are
+	// part of the query, so that K documents are returned if enough match,
+	// but, as with filters, a vector index may return fewer. They cannot be
+	// combined with Hybrid.
+	MinDistance *float64 `json:"minDistance,omitempty"`
+	MaxDistance *float64 `json:"maxDistance,omitempty"`
+	// MMR, if set, re-ranks the nearest neighbors with Maximal Marginal
+	// Relevance to reduce near-duplicate results.
+	MMR *MMROptions `json:"mmr,omitempty"`
+	// Hybrid, if set, combines a full-text search with the similarity
+	// search. It cannot be combined with MMR.
+	Hybrid *HybridOptions `json:"hybrid,omitempty"`
+	// MetadataKeys, if set, limits the keys of the JSON metadata column
+	// returned in the document metadata to these, so that large metadata
+	// values are not transferred. The id and metadata columns are always
+	// returned.
+	MetadataKeys []string `json:"metadataKeys,omitempty"`
+	// IVFFlatProbes, if positive, sets ivfflat.probes for this query: the
+	// number of IVFFlat lists searched, trading latency for recall.
+	IVFFlatProbes int `json:"ivfflatProbes,omitempty"`
+	// HNSWEfSearch, if positive, sets hnsw.ef_search for this query: the
+	// size of the HNSW candidate list, trading latency for recall.
+	HNSWEfSearch int `json:"hnswEfSearch,omitempty"`
+	// QueryEmbedding, if set, is the embedding searched for, computed by
+	// the caller with the embedder of the table, and the query document is
+	// not embedded. The query document may then be nil, except for hybrid
+	// retrieval without [HybridOptions.Query].
+	QueryEmbedding []float32 `json:"queryEmbedding,omitempty"`
+	// QueryEmbeddingBytes is an alternative to QueryEmbedding for callers
+	// holding the embedding in the binary format of [EncodeEmbedding], such
+	// as services in other languages; JSON encodes it in base64. It cannot
+	// be combined with QueryEmbedding.
+	QueryEmbeddingBytes []byte `json:"queryEmbeddingBytes,omitempty"`
+	// After, if set, returns the page of K results that follows the cursor,
+	// as returned by [NextCursor] for the last document of the previous
+	// page. It cannot be combined with MMR or Hybrid, which do not order
+	// results by distance.
+	After *Cursor `json:"after,omitempty"`
+	// AfterToken is an alternative to After for cursors encoded with
+	// [Cursor.Token], such as [RetrieveResult.NextToken] stored by a job
+	// scanning a table in similarity order, to resume it after a restart.
+	// It cannot be combined with After.
+	AfterToken string `json:"afterToken,omitempty"`
+	// ReturnEmbedding adds the embedding of each document in the searched
+	// column to its metadata, under [EmbeddingMetadataKey], such as for
+	// re-ranking by the caller. It is off by default, as embeddings are
+	// large. They are []float32, or []byte with [WithBinaryEmbeddingFormat].
+	ReturnEmbedding bool `json:"returnEmbedding,omitempty"`
+	// RerankFetchK is the number of documents retrieved as candidates for
+	// the reranker set with [WithReranker], of which K are returned. It
+	// must be at least K. The default is 5*K.
+	RerankFetchK int `json:"rerankFetchK,omitempty"`
+	// GroupBy, if set, keeps only the nearest documents of each distinct
+	// value of a metadata key, for more diverse results. It cannot be
+	// combined with MMR, Hybrid or After.
+	GroupBy *GroupOptions `json:"groupBy,omitempty"`
+	// MultiVector, if set, ranks documents by a weighted sum of their
+	// distances in several embedding columns, in place of EmbeddingColumn
+	// and QueryEmbedding. It cannot be combined with MMR, Hybrid, GroupBy
+	// or ReturnEmbedding.
+	MultiVector *MultiVectorOptions `json:"multiVector,omitempty"`
+	// CountTotal counts the documents matching the filters, the distance
+	// bounds and the cursor of the retrieval, regardless of K, and returns
+	// the count in [RetrieveResult.Total], such as to show "10 of 243
+	// results". The count is computed in the same query, with a window
+	// function, which must then read every matching row rather than stop
+	// at the K nearest: the query costs about as much as scanning the
+	// matching rows, however selective K and the vector index are. It
+	// cannot be combined with Hybrid, GroupBy, MultiVector,
+	// [Config.TextSearch] or [Config.QueryTemplate], and is not supported
+	// by streaming and batch retrieval.
+	CountTotal bool `json:"countTotal,omitempty"`
+	// RollUp, if set, returns the parent documents of the nearest chunks in
+	// place of the chunks, with the distance and score of the nearest chunk
+	// of each parent. It requires [Config.Parents], and cannot be combined
+	// with MMR, Hybrid, GroupBy, MultiVector, After, CountTotal,
+	// ReturnEmbedding, MetadataKeys, [Config.TextSearch] or
+	// [Config.QueryTemplate]. It is not supported by streaming and batch
+	// retrieval.
+	RollUp *RollUpOptions `json:"rollUp,omitempty"`
+	// Boost, if set, ranks the nearest documents by their distance minus
+	// boosts read from their metadata. It cannot be combined with MMR,
+	// Hybrid, GroupBy, MultiVector, After, RollUp, [Config.TextSearch] or
+	// [Config.QueryTemplate], and is not supported by batch retrieval.
+	Boost *BoostOptions `json:"boost,omitempty"`
+	// MergeChunks, if set, merges the retrieved chunks of a source document
+	// that are adjacent or overlap into single documents, after reranking.
+	// Fewer than K documents may then be returned. It cannot be combined
+	// with RollUp, and is not supported by streaming and batch retrieval.
+	MergeChunks *MergeOptions `json:"mergeChunks,omitempty"`
 }
 
+// Reranker reorders the documents retrieved for query, such as with a
+// cross-encoder model, and may drop some of them. query is nil for requests
+// that set [RetrieverOptions.QueryEmbedding] without a query document.
+type Reranker func(ctx context.Context, query *ai.Document, docs []*ai.Document) ([]*ai.Document, error)
+
 // Retrieve returns the result of the query
 func (ds *docStore) Retrieve(ctx context.Context, req *ai.RetrieverRequest) (*ai.RetrieverResponse, error) {
-	// TODO: implement
-	return nil, nil
+	res, err := ds.retrieveDetailed(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &ai.RetrieverResponse{Documents: res.documents()}, nil
+}
+
+// retrieveDetailed runs the retrieval of req like Retrieve, and returns its
+// detailed result.
+func (ds *docStore) retrieveDetailed(ctx context.Context, req *ai.RetrieverRequest) (res *RetrieveResult, err error) {
+	start := time.Now()
+	ctx, cancel := ds.engine.withFallbackTimeout(ctx)
+	defer cancel()
+	ctx, span := ds.startSpan(ctx, "postgresql.retrieve",
+		attribute.String("postgresql.distance_strategy", string(ds.config.DistanceStrategy)))
+	defer func() {
+		var n int
+		if res != nil {
+			n = len(res.Documents)
+			span.SetAttributes(attribute.Int("postgresql.result_count", n))
+		}
+		endSpan(span, err)
+		ds.recordRequest(ctx, "retrieve", n, err)
+		ds.logSlowRequest(ctx, "retrieve", start, err, "k", ds.requestK(req), "documents", n)
+	}()
+	return ds.retrieve(ctx, req)
+}
+
+// retrieval is a similarity search prepared for a retriever request.
+type retrieval struct {
+	opts     *RetrieverOptions
+	queryVec []float32
+	mmr      MMROptions // resolved MMR options, if opts.MMR is set
+	k        int        // number of documents returned
+	rerank   bool       // the results are reranked
+	rollUp   bool       // the rows are parent documents
+	query    string
+	args     []any
+	settings []setting // index search settings of the query
+}
+
+// run runs the query of r on the read connection of ds.
+func (r *retrieval) run(ctx context.Context, ds *docStore) (queryRows, error) {
+	settings, err := ds.engine.requestSettings(ctx, r.settings)
+	if err != nil {
+		return nil, err
+	}
+	args := ds.engine.retrievalArgs(r.query, r.args)
+	if len(settings) > 0 {
+		return ds.engine.readQuerier(ctx).QueryLocal(ctx, settings, r.query, args...)
+	}
+	return ds.engine.readQuerier(ctx).Query(ctx, r.query, args...)
+}
+
+// stream runs the query of r like run, through a cursor if a fetch size is
+// set with [WithFetchSize].
+func (r *retrieval) stream(ctx context.Context, ds *docStore) (queryRows, error) {
+	if n := ds.engine.config.fetchSize; n > 0 {
+		settings, err := ds.engine.requestSettings(ctx, r.settings)
+		if err != nil {
+			return nil, err
+		}
+		return ds.engine.readQuerier(ctx).QueryCursor(ctx, settings, n, r.query, r.args...)
+	}
+	return r.run(ctx, ds)
+}
+
+// indexSettings returns the index search settings requested by opts.
+func indexSettings(opts *RetrieverOptions) ([]setting, error) {
+	if opts.IVFFlatProbes < 0 || opts.HNSWEfSearch < 0 {
+		return nil, errors.New("index search settings must not be negative")
+	}
+	var settings []setting
+	if opts.IVFFlatProbes > 0 {
+		settings = append(settings, setting{"ivfflat.probes", strconv.Itoa(opts.IVFFlatProbes)})
+	}
+	if opts.HNSWEfSearch > 0 {
+		settings = append(settings, setting{"hnsw.ef_search", strconv.Itoa(opts.HNSWEfSearch)})
+	}
+	return settings, nil
+}
+
+func (ds *docStore) retrieve(ctx context.Context, req *ai.RetrieverRequest) (*RetrieveResult, error) {
+	r, err := ds.prepareRetrieval(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+	qctx, cancel := ds.engine.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := r.run(qctx, ds)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.Retrieve: query failed: %w", queryTimeoutError(qctx, describeQueryError(err, ds.config)))
+	}
+	defer rows.Close()
+	if r.rollUp {
+		return ds.retrieveParents(ctx, qctx, req, r, rows)
+	}
+
+	docs := []*ai.Document{}
+	distances := make(map[*ai.Document]float64)
+	candidates := 0
+	var total int64
+	var embeddings [][]float32
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, fmt.Errorf("postgres.Retrieve: failed to read row: %w", queryTimeoutError(qctx, err))
+		}
+		candidates++
+		if r.opts.CountTotal {
+			if total, err = rowTotal(values); err != nil {
+				return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+			}
+		}
+		if !ds.finiteDistance(ctx, values) || !ds.meetsThreshold(values, r.opts.ScoreThreshold) {
+			continue
+		}
+		doc, err := ds.rowToDocument(values)
+		if err != nil {
+			return nil, err
+		}
+		if distance, ok := ds.rowDistance(values); ok {
+			distances[doc] = distance
+		}
+		docs = append(docs, doc)
+		if r.opts.MMR != nil || r.opts.ReturnEmbedding {
+			emb, err := ds.rowEmbedding(values)
+			if err != nil {
+				return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+			}
+			if r.opts.MMR != nil {
+				embeddings = append(embeddings, emb)
+			}
+			if r.opts.ReturnEmbedding {
+				doc.Metadata[EmbeddingMetadataKey] = ds.returnedEmbedding(emb)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres.Retrieve: %w", queryTimeoutError(qctx, describeQueryError(err, ds.config)))
+	}
+
+	if r.opts.MMR != nil {
+		selected := make([]*ai.Document, 0, r.mmr.K)
+		for _, i := range selectMMR(r.queryVec, embeddings, r.mmr.K, r.mmr.Lambda) {
+			selected = append(selected, docs[i])
+		}
+		docs = selected
+	}
+	if err := ds.resolveContent(ctx, docs); err != nil {
+		return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+	}
+	if r.rerank {
+		if docs, err = r.rerankDocuments(ctx, ds, req.Query, docs); err != nil {
+			return nil, err
+		}
+	}
+	if r.opts.MergeChunks != nil {
+		docs = mergeChunks(docs, distances, r.opts.MergeChunks)
+	}
+	docs = ds.engine.withinTokenBudget(docs)
+	if docs, err = ds.engine.transformResult(ctx, docs); err != nil {
+		return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+	}
+
+	res := ds.retrieveResult(docs, distances, candidates)
+	if r.opts.CountTotal {
+		res.Total = &total
+	}
+	if r.pageable() {
+		res.NextToken = ds.nextToken(res)
+	}
+	return res, nil
+}
+
+// rerankDocuments reranks docs, the candidates of r, with the reranker of
+// ds, and returns the first documents it returns.
+func (r *retrieval) rerankDocuments(ctx context.Context, ds *docStore, query *ai.Document, docs []*ai.Document) ([]*ai.Document, error) {
+	docs, err := ds.engine.config.reranker(ctx, query, docs)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.Retrieve: reranking failed: %w", err)
+	}
+	return docs[:min(len(docs), r.k)], nil
+}
+
+// prepareRetrieval embeds the query of req and builds the similarity search
+// described by its options. With rerank, the search fetches the candidates
+// of the reranker set with [WithReranker], if any.
+func (ds *docStore) prepareRetrieval(ctx context.Context, req *ai.RetrieverRequest, rerank bool) (*retrieval, error) {
+	ropt := &RetrieverOptions{}
+	if req.Options != nil {
+		var ok bool
+		ropt, ok = req.Options.(*RetrieverOptions)
+		if !ok {
+			return nil, fmt.Errorf("postgres.Retrieve options have type %T, want %T", req.Options, &RetrieverOptions{})
+		}
+	}
+	ropt, err := withQueryEmbeddingBytes(ropt)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+	}
+	if ropt, err = withAfterToken(ropt); err != nil {
+		return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+	}
+	if ropt.QueryEmbedder != nil && (ropt.QueryEmbedding != nil || ropt.MultiVector != nil) {
+		return nil, errors.New("postgres.Retrieve: a query embedder cannot be combined with a query embedding or multi-vector retrieval")
+	}
+	if ropt, err = ds.routeEmbedder(ropt); err != nil {
+		return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+	}
+	k, err := ds.resolveK(ropt)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+	}
+	settings, err := indexSettings(ropt)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("postgresql.k", k))
+	if ropt.RollUp != nil {
+		if err := ds.checkRollUp(req, ropt); err != nil {
+			return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+		}
+	}
+	if ropt.Boost != nil {
+		if err := ds.checkBoost(req, ropt); err != nil {
+			return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+		}
+	}
+	if ropt.MergeChunks != nil {
+		if err := ropt.MergeChunks.validate(); err != nil {
+			return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+		}
+		if ropt.RollUp != nil {
+			return nil, errors.New("postgres.Retrieve: merging chunks cannot be combined with roll-ups")
+		}
+	}
+	if isLookup(req, ropt) {
+		if ds.config.QueryTemplate != "" {
+			return nil, errors.New("postgres.Retrieve: retrievals with a query template require a query")
+		}
+		query, args, err := ds.buildLookupQuery(k, ropt)
+		if err != nil {
+			return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+		}
+		return &retrieval{opts: ropt, k: k, query: query, args: args}, nil
+	}
+	if ropt.CountTotal && (ds.config.TextSearch != nil || ds.config.QueryTemplate != "" || ropt.Hybrid != nil || ropt.MultiVector != nil) {
+		return nil, errors.New("postgres.Retrieve: counting the total cannot be combined with text search, a query template, hybrid or multi-vector retrieval")
+	}
+	returnK := k
+	rerank = rerank && ds.engine.config.reranker != nil
+	if ordered(ropt) {
+		if err := ds.checkOrder(ropt, rerank); err != nil {
+			return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+		}
+	}
+	if rerank {
+		if k, err = resolveRerankFetchK(ropt, k); err != nil {
+			return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+		}
+	}
+
+	if ds.config.TextSearch != nil {
+		var text string
+		if req.Query != nil {
+			text = documentText(req.Query)
+		}
+		query, args, err := ds.buildTextSearchQuery(text, k, ropt)
+		if err != nil {
+			return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+		}
+		return &retrieval{opts: ropt, k: returnK, rerank: rerank, query: query, args: args, settings: settings}, nil
+	}
+
+	if ropt.MultiVector != nil {
+		if ds.config.QueryTemplate != "" {
+			return nil, errors.New("postgres.Retrieve: multi-vector retrieval cannot be combined with a query template")
+		}
+		vecs, err := ds.multiVectorEmbeddings(ctx, req, ropt)
+		if err != nil {
+			return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+		}
+		query, args, err := ds.buildMultiVectorQuery(vecs, k, ropt)
+		if err != nil {
+			return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+		}
+		return &retrieval{opts: ropt, k: returnK, rerank: rerank, query: query, args: args, settings: settings}, nil
+	}
+
+	queryVec, err := ds.queryEmbedding(ctx, req, ropt)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+	}
+	if ropt.RollUp != nil {
+		query, args, err := ds.buildParentQuery(queryVec, k, ropt)
+		if err != nil {
+			return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+		}
+		return &retrieval{opts: ropt, k: returnK, rerank: rerank, rollUp: true, query: query, args: args, settings: settings}, nil
+	}
+	var mmr MMROptions
+	if ropt.MMR != nil {
+		if mmr, err = ropt.MMR.withDefaults(k); err != nil {
+			return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+		}
+		k = mmr.FetchK
+	}
+	var query string
+	var args []any
+	if ropt.After != nil && (ropt.MMR != nil || ropt.Hybrid != nil) {
+		return nil, errors.New("postgres.Retrieve: pagination cannot be combined with MMR or hybrid retrieval")
+	}
+	if ropt.GroupBy != nil && (ropt.MMR != nil || ropt.Hybrid != nil || ropt.After != nil) {
+		return nil, errors.New("postgres.Retrieve: grouping cannot be combined with MMR, hybrid retrieval or pagination")
+	}
+	if ds.config.QueryTemplate != "" {
+		query, args, err = ds.buildTemplateQuery(queryVec, k, ropt)
+	} else if ropt.Hybrid != nil {
+		if ropt.MMR != nil {
+			return nil, errors.New("postgres.Retrieve: hybrid retrieval cannot be combined with MMR")
+		}
+		var text string
+		if req.Query != nil {
+			text = documentText(req.Query)
+		}
+		var hybrid HybridOptions
+		hybrid, err = ropt.Hybrid.withDefaults(ds, text, k)
+		if err != nil {
+			return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+		}
+		query, args, err = ds.buildHybridQuery(queryVec, k, ropt, hybrid)
+	} else {
+		query, args, err = ds.buildRetrieveQuery(queryVec, k, ropt)
+		settings = boostSettings(ds.rescoreSettings(settings, k, ropt), k, ropt)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+	}
+	return &retrieval{opts: ropt, queryVec: queryVec, mmr: mmr, k: returnK, rerank: rerank, query: query, args: args, settings: settings}, nil
+}
+
+// routeEmbedder returns opts, or a copy of opts whose EmbeddingColumn is
+// the column of the embedder named by [RetrieverOptions.Embedder].
+func (ds *docStore) routeEmbedder(opts *RetrieverOptions) (*RetrieverOptions, error) {
+	if opts.Embedder == "" {
+		return opts, nil
+	}
+	column := ""
+	if ds.config.Embedder != nil && ds.config.Embedder.Name() == opts.Embedder {
+		column = ds.config.EmbeddingColumn
+	}
+	for _, ce := range ds.config.ColumnEmbedders {
+		if ce.Embedder.Name() == opts.Embedder {
+			column = ce.Column
+		}
+	}
+	if column == "" {
+		return nil, fmt.Errorf("embedder %q populates no embedding column of table %q", opts.Embedder, ds.config.TableName)
+	}
+	if opts.EmbeddingColumn != "" && opts.EmbeddingColumn != column {
+		return nil, fmt.Errorf("embedder %q populates column %q, not the requested embedding column %q", opts.Embedder, column, opts.EmbeddingColumn)
+	}
+	routed := *opts
+	routed.EmbeddingColumn = column
+	return &routed, nil
+}
+
+// columnEmbedder returns the embedder of the queries of a search of column,
+// and its options: that of [Config.ColumnEmbedders] for the column, or else
+// the query embedder of the table.
+func (ds *docStore) columnEmbedder(column string) (ai.Embedder, any) {
+	for _, ce := range ds.config.ColumnEmbedders {
+		if ce.Column == column {
+			return ce.Embedder, ce.EmbedderOptions
+		}
+	}
+	if ds.config.QueryEmbedder != nil {
+		return ds.config.QueryEmbedder, ds.config.QueryEmbedderOptions
+	}
+	return ds.config.Embedder, ds.config.EmbedderOptions
+}
+
+// queryEmbedding returns the embedding searched for by req: that of opts, or
+// else the embedding of the query document by the embedder of the search
+// column. Its dimension is checked against that of the search column.
+func (ds *docStore) queryEmbedding(ctx context.Context, req *ai.RetrieverRequest, opts *RetrieverOptions) ([]float32, error) {
+	column := cmp.Or(opts.EmbeddingColumn, ds.config.EmbeddingColumn)
+	vec := opts.QueryEmbedding
+	if vec == nil {
+		if req.Query == nil {
+			return nil, errors.New("query document is required")
+		}
+		embedder, embedderOpts := ds.columnEmbedder(column)
+		if opts.QueryEmbedder != nil {
+			embedder, embedderOpts = opts.QueryEmbedder, opts.QueryEmbedderOptions
+		}
+		eres, err := embedder.Embed(ctx, &ai.EmbedRequest{
+			Documents: []*ai.Document{req.Query},
+			Options:   embedderOpts,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("embedding failed: %w", err)
+		}
+		if len(eres.Embeddings) == 0 {
+			return nil, errors.New("embedder returned no embeddings")
+		}
+		vec = eres.Embeddings[0].Embedding
+	}
+	if err := ds.checkQueryVector(vec); err != nil {
+		return nil, err
+	}
+	vec, err := ds.normalize(vec)
+	if err != nil {
+		return nil, fmt.Errorf("query %w", err)
+	}
+	dim, err := ds.columnDimension(ctx, column)
+	if err != nil {
+		return nil, err
+	}
+	if dim > 0 && len(vec) != dim {
+		return nil, fmt.Errorf("%w: query embedding has %d dimensions, but column %q expects %d",
+			ErrDimensionMismatch, len(vec), column, dim)
+	}
+	return vec, nil
+}
+
+// resolveRerankFetchK returns the number of candidates to rerank for opts,
+// for a retrieval of k documents.
+func resolveRerankFetchK(opts *RetrieverOptions, k int) (int, error) {
+	if opts.RerankFetchK == 0 {
+		return 5 * k, nil
+	}
+	if opts.RerankFetchK < k {
+		return 0, fmt.Errorf("rerank fetchK (%d) must be at least k (%d)", opts.RerankFetchK, k)
+	}
+	return opts.RerankFetchK, nil
+}
+
+// requestK returns the number of documents requested by req, or 0 if its
+// options are invalid.
+func (ds *docStore) requestK(req *ai.RetrieverRequest) int {
+	opts, _ := req.Options.(*RetrieverOptions)
+	if opts == nil {
+		return ds.config.K
+	}
+	k, _ := ds.resolveK(opts)
+	return k
+}
+
+// resolveK returns the number of documents to retrieve for opts.
+func (ds *docStore) resolveK(opts *RetrieverOptions) (int, error) {
+	if opts.K < 0 {
+		return 0, fmt.Errorf("k must be positive, got %d", opts.K)
+	}
+	if opts.K > 0 {
+		return opts.K, nil
+	}
+	return ds.config.K, nil
+}
+
+// selectColumns returns the columns read for each retrieved row, in the
+// order expected by rowToDocument.
+func (ds *docStore) selectColumns() []string {
+	cols := []string{ds.config.IDColumn, ds.config.ContentColumn}
+	if ds.config.MetadataJSONColumn != "" {
+		cols = append(cols, ds.config.MetadataJSONColumn)
+	}
+	cols = append(cols, ds.config.MetadataColumns...)
+	return append(cols, ds.retrievedColumns()...)
+}
+
+// buildRetrieveQuery returns the similarity search query for vec and its
+// arguments, ordered by distance and then by the tiebreaker column. The
+// query vector is bound to $1. For MMR retrieval and with
+// [RetrieverOptions.ReturnEmbedding] the embedding of each row is selected as
+// text after the distance. With [RetrieverOptions.GroupBy], the nearest
+// candidates are ranked within their groups, in a subquery.
+func (ds *docStore) buildRetrieveQuery(vec []float32, k int, opts *RetrieverOptions) (string, []any, error) {
+	queryVec, err := newVector(vec)
+	if err != nil {
+		return "", nil, fmt.Errorf("query %w", err)
+	}
+	args := &queryArgs{}
+	query, err := ds.buildSearchQuery(ds.engine.vectorType().cast(args.add(ds.engine.vectorArg(queryVec))), k, opts, args)
+	if err != nil {
+		return "", nil, err
+	}
+	return query, args.args, nil
+}
+
+// buildSearchQuery returns the similarity search query of buildRetrieveQuery
+// for the query vector vecParam, adding its arguments to args. The extra
+// expressions are selected last.
+func (ds *docStore) buildSearchQuery(vecParam string, k int, opts *RetrieverOptions, args *queryArgs, extra ...string) (string, error) {
+	column, err := ds.searchColumn(opts)
+	if err != nil {
+		return "", err
+	}
+	where, err := ds.retrieveWhere(column, opts, args)
+	if err != nil {
+		return "", err
+	}
+	distance := fmt.Sprintf(`"%s" %s %s`, column, ds.config.DistanceStrategy.operator(), vecParam)
+	if opts.After != nil {
+		after, err := ds.afterPredicate(distance, opts.After, args)
+		if err != nil {
+			return "", err
+		}
+		if where != "" {
+			where += " AND "
+		}
+		where += after
+	}
+	bounds, err := distanceBounds(distance, opts, args)
+	if err != nil {
+		return "", err
+	}
+	if bounds != "" {
+		if where != "" {
+			where += " AND "
+		}
+		where += bounds
+	}
+
+	quoted, err := ds.selectList("", opts, args)
+	if err != nil {
+		return "", err
+	}
+	quoted = append(quoted, distance+" AS distance")
+	if opts.MMR != nil || opts.ReturnEmbedding {
+		embedding := fmt.Sprintf(`"%s"::text`, column)
+		if opts.GroupBy != nil {
+			// Named, to be selected from the grouped candidates.
+			embedding += fmt.Sprintf(` AS "%s"`, column)
+		}
+		quoted = append(quoted, embedding)
+	}
+	var group GroupOptions
+	limit := k
+	if opts.GroupBy != nil {
+		if group, err = opts.GroupBy.withDefaults(k); err != nil {
+			return "", err
+		}
+		key, err := ds.groupKey(group, args)
+		if err != nil {
+			return "", err
+		}
+		quoted = append(quoted, key+" AS group_key", fmt.Sprintf(`"%s" AS group_tiebreaker`, ds.config.TiebreakerColumn))
+		limit = group.FetchK
+	}
+	quoted = append(quoted, extra...)
+	if opts.Boost != nil {
+		boost, err := opts.Boost.withDefaults(k)
+		if err != nil {
+			return "", err
+		}
+		expr, err := ds.boostExpr(boost, args)
+		if err != nil {
+			return "", err
+		}
+		quoted = append(quoted, expr+" AS boost", fmt.Sprintf(`"%s" AS boost_tiebreaker`, ds.config.TiebreakerColumn))
+		limit = boost.FetchK
+	}
+	var orderKey string
+	if ordered(opts) {
+		if orderKey, err = ds.orderKey(opts, args); err != nil {
+			return "", err
+		}
+		if orderKey != "" {
+			quoted = append(quoted, orderKey+" AS order_key")
+		}
+		quoted = append(quoted, fmt.Sprintf(`"%s" AS order_tiebreaker`, ds.config.TiebreakerColumn))
+	}
+	order := "distance"
+	rescore := false
+	if ds.rescoring(opts) {
+		candidate, err := ds.candidateDistance(column, vecParam)
+		if err != nil {
+			return "", err
+		}
+		if rescore = candidate != ""; rescore {
+			quoted = append(quoted, fmt.Sprintf(`"%s" AS rescore_tiebreaker`, ds.config.TiebreakerColumn))
+			limit = k * ds.engine.config.rescoreMultiplier
+			order = candidate
+		}
+	}
+	if opts.CountTotal {
+		if opts.GroupBy != nil {
+			return "", errors.New("counting the total cannot be combined with grouping")
+		}
+		quoted = append(quoted, totalColumn)
+	}
+	query := fmt.Sprintf(`SELECT %s FROM %s`, strings.Join(quoted, ", "), qualifiedName(ds.config.SchemaName, ds.config.TableName))
+	if where != "" {
+		query += " WHERE " + where
+	}
+	// Vector indexes still serve the distance order; Postgres sorts the rows
+	// at equal distance incrementally.
+	query += fmt.Sprintf(` ORDER BY %s, "%s" LIMIT %d`, order, ds.config.TiebreakerColumn, limit)
+	if opts.GroupBy != nil {
+		var columns []string
+		for _, col := range ds.selectColumns() {
+			columns = append(columns, fmt.Sprintf(`"%s"`, col))
+		}
+		columns = append(columns, "distance")
+		if opts.MMR != nil || opts.ReturnEmbedding {
+			columns = append(columns, fmt.Sprintf(`"%s"`, column))
+		}
+		query = groupQuery(query, columns, group, k)
+	}
+	if rescore {
+		query = rescoreQuery(query, k)
+	}
+	if opts.Boost != nil {
+		query = boostQuery(query, k)
+	}
+	if ordered(opts) {
+		query = orderQuery(query, orderKey, opts)
+	}
+	return query, nil
+}
+
+// totalColumn is the expression selecting the total number of rows matching
+// a query, regardless of its limit, for [RetrieverOptions.CountTotal]. It is
+// selected last.
+const totalColumn = "count(*) OVER () AS total"
+
+// rowTotal returns the total selected last in a row with totalColumn.
+func rowTotal(values []any) (int64, error) {
+	total, ok := values[len(values)-1].(int64)
+	if !ok {
+		return 0, fmt.Errorf("expected a total count, got %T", values[len(values)-1])
+	}
+	return total, nil
+}
+
+// selectList returns the expressions selecting the columns of selectColumns,
+// qualified with prefix, projecting the JSON metadata column onto the
+// metadata keys of opts.
+func (ds *docStore) selectList(prefix string, opts *RetrieverOptions, args *queryArgs) ([]string, error) {
+	if len(opts.MetadataKeys) > 0 && ds.config.MetadataJSONColumn == "" {
+		return nil, errors.New("metadata keys require a JSON metadata column")
+	}
+	cols := ds.selectColumns()
+	list := make([]string, 0, len(cols))
+	for _, col := range cols {
+		if col == ds.config.MetadataJSONColumn && len(opts.MetadataKeys) > 0 {
+			list = append(list, fmt.Sprintf(`(SELECT jsonb_object_agg(key, value) FROM jsonb_each(%s"%s"::jsonb) WHERE key = ANY(%s::text[])) AS "%s"`,
+				prefix, col, args.add(opts.MetadataKeys), col))
+			continue
+		}
+		list = append(list, fmt.Sprintf(`%s"%s"`, prefix, col))
+	}
+	return list, nil
+}
+
+// searchColumn returns the embedding column searched for opts.
+func (ds *docStore) searchColumn(opts *RetrieverOptions) (string, error) {
+	if opts.EmbeddingColumn == "" || opts.EmbeddingColumn == ds.config.EmbeddingColumn {
+		return ds.config.EmbeddingColumn, nil
+	}
+	if ds.vectorColumns != nil && !ds.vectorColumns[opts.EmbeddingColumn] {
+		return "", fmt.Errorf("column %q is not an embedding column of table %q", opts.EmbeddingColumn, ds.config.TableName)
+	}
+	return opts.EmbeddingColumn, nil
+}
+
+// retrieveWhere returns the WHERE condition of a search of column, combining
+// the filters of opts with a NULL check on additional embedding columns and,
+// with [WithSoftDelete] and [WithExpiryColumn], the exclusion of deleted and
+// expired rows.
+func (ds *docStore) retrieveWhere(column string, opts *RetrieverOptions, args *queryArgs) (string, error) {
+	where, err := compileFilters(ds.filters(opts), ds.config.MetadataJSONColumn, ds.config.MetadataColumns, args)
+	if err != nil {
+		return "", err
+	}
+	var conds []string
+	if column != ds.config.EmbeddingColumn {
+		conds = append(conds, fmt.Sprintf(`"%s" IS NOT NULL`, column))
+	}
+	if col := ds.engine.config.softDeleteColumn; col != "" {
+		conds = append(conds, fmt.Sprintf(`"%s" IS NULL`, col))
+	}
+	if col := ds.engine.config.expiryColumn; col != "" {
+		conds = append(conds, notExpired(col))
+	}
+	if where != "" {
+		conds = append(conds, where)
+	}
+	return strings.Join(conds, " AND "), nil
+}
+
+// filters returns the filters of a retrieval with opts: the default filters
+// of the engine and of the table, then those of opts.
+func (ds *docStore) filters(opts *RetrieverOptions) []Filter {
+	filters := slices.Concat(ds.engine.config.defaultFilters, ds.config.DefaultFilters)
+	if len(filters) == 0 {
+		return opts.Filters
+	}
+	return append(filters, opts.Filters...)
+}
+
+// rowToDocument converts a row selected by buildRetrieveQuery into a document
+// whose metadata holds the JSON metadata, the id, the metadata and retrieved
+// columns and, unless disabled with [WithScoreInMetadata], the distance and
+// score.
+func (ds *docStore) rowToDocument(values []any) (*ai.Document, error) {
+	cols := ds.selectColumns()
+	if len(values) < len(cols) {
+		return nil, fmt.Errorf("postgres.Retrieve: expected %d columns, got %d", len(cols), len(values))
+	}
+
+	metadata := make(map[string]any)
+	pos := 2
+	if ds.config.MetadataJSONColumn != "" {
+		if err := mergeJSONMetadata(metadata, values[pos]); err != nil {
+			return nil, fmt.Errorf("postgres.Retrieve: invalid metadata in column %q: %w", ds.config.MetadataJSONColumn, err)
+		}
+		pos++
+	}
+	for i, col := range ds.config.MetadataColumns {
+		v, err := columnValue(values[pos+i], ds.columnTypes[col])
+		if err != nil {
+			return nil, fmt.Errorf("postgres.Retrieve: invalid value in metadata column %q: %w", col, err)
+		}
+		metadata[col] = v
+	}
+	pos += len(ds.config.MetadataColumns)
+	for i, col := range ds.retrievedColumns() {
+		v, err := columnValue(values[pos+i], "")
+		if err != nil {
+			return nil, fmt.Errorf("postgres.Retrieve: invalid value in retrieved column %q: %w", col, err)
+		}
+		metadata[cmp.Or(ds.config.RetrievedColumns[col], col)] = v
+	}
+	metadata[ds.config.IDColumn] = idToString(values[0])
+	if distance, ok := ds.rowDistance(values); ok && !ds.engine.config.omitScore {
+		metadata[DistanceMetadataKey] = distance
+		metadata[ScoreMetadataKey] = ds.score(distance)
+	}
+
+	parts, err := ds.contentParts(values[1])
+	if err != nil {
+		return nil, fmt.Errorf("postgres.Retrieve: %w", err)
+	}
+	if ds.config.ExternalContent != nil {
+		metadata[ContentRefMetadataKey] = parts[0].Text
+	}
+	return &ai.Document{Content: parts, Metadata: metadata}, nil
+}
+
+// meetsThreshold reports whether the score of a row selected by
+// buildRetrieveQuery is at least threshold. A nil threshold accepts all rows.
+func (ds *docStore) meetsThreshold(values []any, threshold *float32) bool {
+	if threshold == nil {
+		return true
+	}
+	distance, ok := ds.rowDistance(values)
+	if !ok {
+		return false
+	}
+	return ds.score(distance) >= float64(*threshold)
+}
+
+// score returns the similarity score of a row at distance. The distance of
+// the rows of a text search is their negated rank, and their score is the
+// rank.
+func (ds *docStore) score(distance float64) float64 {
+	if ds.config.TextSearch != nil {
+		return -distance
+	}
+	return ds.config.DistanceStrategy.Score(distance)
+}
+
+// rowDistance returns the distance of a row selected by buildRetrieveQuery.
+func (ds *docStore) rowDistance(values []any) (float64, bool) {
+	n := len(ds.selectColumns())
+	if len(values) <= n {
+		return 0, false
+	}
+	distance, ok := values[n].(float64)
+	return distance, ok
+}
+
+// rowEmbedding returns the embedding selected after the distance of a row.
+// Embeddings are selected as text, which has the same format for vector and
+// halfvec columns.
+func (ds *docStore) rowEmbedding(values []any) ([]float32, error) {
+	n := len(ds.selectColumns()) + 1
+	if len(values) <= n {
+		return nil, fmt.Errorf("expected %d columns, got %d", n+1, len(values))
+	}
+	emb, err := parseEmbedding(values[n])
+	if err != nil {
+		return nil, fmt.Errorf("invalid embedding: %w", err)
+	}
+	return emb, nil
+}
+
+// idToString formats an id value read from the database.
+func idToString(v any) string {
+	if b, ok := v.([16]byte); ok {
+		return uuid.UUID(b).String()
+	}
+	return fmt.Sprint(v)
+}
+
+// mergeJSONMetadata copies the keys of a JSON metadata value, as decoded by
+// pgx, into metadata.
+func mergeJSONMetadata(metadata map[string]any, v any) error {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case map[string]any:
+		for k, val := range v {
+			metadata[k] = val
+		}
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), &metadata)
+	case []byte:
+		return json.Unmarshal(v, &metadata)
+	default:
+		return fmt.Errorf("unexpected type %T", v)
+	}
+}
+
+// columnValue converts the value of a column of the given data type, as
+// reported by information_schema, or of an unknown type if it is empty, into
+// a document metadata value of the type JSON decoding would give it:
+// numeric values become a float64 rather than a [pgtype.Numeric] or, with
+// [WithDB], a string, UUIDs become strings, and JSON values read as text are
+// decoded.
+func columnValue(v any, dataType string) (any, error) {
+	switch v := v.(type) {
+	case pgtype.Numeric:
+		f, err := v.Float64Value()
+		if err != nil || !f.Valid {
+			return nil, err
+		}
+		return f.Float64, nil
+	case [16]byte:
+		return uuid.UUID(v).String(), nil
+	case string:
+		switch dataType {
+		case "numeric":
+			return strconv.ParseFloat(v, 64)
+		case "json", "jsonb":
+			var decoded any
+			err := json.Unmarshal([]byte(v), &decoded)
+			return decoded, err
+		}
+	case []byte:
+		if dataType == "json" || dataType == "jsonb" {
+			var decoded any
+			err := json.Unmarshal(v, &decoded)
+			return decoded, err
+		}
+	}
+	return v, nil
 }
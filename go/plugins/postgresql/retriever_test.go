@@ -0,0 +1,450 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+func testDocStore() *docStore {
+	return &docStore{dimension: -1, config: &Config{
+		TableName:          "documents",
+		SchemaName:         "public",
+		IDColumn:           "id",
+		TiebreakerColumn:   "id",
+		ContentColumn:      "content",
+		EmbeddingColumn:    "embedding",
+		MetadataJSONColumn: "metadata",
+		MetadataColumns:    []string{"source"},
+		DistanceStrategy:   CosineDistance,
+	}}
+}
+
+func TestBuildRetrieveQuery(t *testing.T) {
+	testCases := []struct {
+		name     string
+		strategy DistanceStrategy
+		want     string
+	}{
+		{
+			name:     "cosine",
+			strategy: CosineDistance,
+			want:     `SELECT "id", "content", "metadata", "source", "embedding" <=> $1 AS distance FROM "public"."documents" ORDER BY distance, "id" LIMIT 4`,
+		},
+		{
+			name:     "euclidean",
+			strategy: EuclideanDistance,
+			want:     `SELECT "id", "content", "metadata", "source", "embedding" <-> $1 AS distance FROM "public"."documents" ORDER BY distance, "id" LIMIT 4`,
+		},
+		{
+			name:     "inner product",
+			strategy: InnerProduct,
+			want:     `SELECT "id", "content", "metadata", "source", "embedding" <#> $1 AS distance FROM "public"."documents" ORDER BY distance, "id" LIMIT 4`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ds := testDocStore()
+			ds.config.DistanceStrategy = tc.strategy
+			query, args, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, query)
+			assert.Len(t, args, 1)
+		})
+	}
+}
+
+func TestBuildRetrieveQueryFilters(t *testing.T) {
+	ds := testDocStore()
+	query, args, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{
+		Filters: []Filter{
+			{Key: "tenant_id", Value: "acme"},
+			{Key: "year", Op: Ge, Value: 2023},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", "embedding" <=> $1 AS distance FROM "public"."documents"`+
+		` WHERE "metadata"->>$2 = $3 AND ("metadata"->>$4)::numeric >= $5 ORDER BY distance, "id" LIMIT 4`, query)
+	assert.Equal(t, []any{"tenant_id", "acme", "year", 2023}, args[1:])
+
+	_, _, err = ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{
+		Filters: []Filter{{Key: "year", Op: "LIKE", Value: "20%"}},
+	})
+	assert.Error(t, err)
+}
+
+func TestBuildRetrieveQueryDefaultFilters(t *testing.T) {
+	ds := testDocStore()
+	ds.engine.config.defaultFilters = []Filter{{Key: "tenant_id", Value: "acme"}}
+	ds.config.DefaultFilters = []Filter{{Key: "source", Value: "wiki"}}
+	query, args, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{
+		Filters: []Filter{{Key: "year", Op: Ge, Value: 2023}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", "embedding" <=> $1 AS distance FROM "public"."documents"`+
+		` WHERE "metadata"->>$2 = $3 AND "source" = $4 AND ("metadata"->>$5)::numeric >= $6 ORDER BY distance, "id" LIMIT 4`, query)
+	assert.Equal(t, []any{"tenant_id", "acme", "wiki", "year", 2023}, args[1:])
+
+	// The default filters must not be shared between retrievals.
+	assert.Len(t, ds.filters(&RetrieverOptions{Filters: []Filter{{Key: "a", Value: "b"}}}), 3)
+	assert.Len(t, ds.filters(&RetrieverOptions{}), 2)
+	assert.Len(t, ds.engine.config.defaultFilters, 1)
+}
+
+func TestBuildRetrieveQueryCountTotal(t *testing.T) {
+	ds := testDocStore()
+	query, _, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{
+		Filters:         []Filter{{Key: "source", Value: "wiki"}},
+		ReturnEmbedding: true,
+		CountTotal:      true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", "embedding" <=> $1 AS distance, "embedding"::text, count(*) OVER () AS total`+
+		` FROM "public"."documents" WHERE "source" = $2 ORDER BY distance, "id" LIMIT 4`, query)
+
+	_, _, err = ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{GroupBy: &GroupOptions{Key: "source"}, CountTotal: true})
+	assert.ErrorContains(t, err, "grouping")
+
+	total, err := rowTotal([]any{"a", "text", nil, "wiki", 0.25, int64(243)})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(243), total)
+	_, err = rowTotal([]any{"a", "text", nil, "wiki", 0.25})
+	assert.Error(t, err)
+
+	ds.config.Embedder = &fakeEmbedder{}
+	for _, opts := range []*RetrieverOptions{
+		{Hybrid: &HybridOptions{Query: "chunks"}, CountTotal: true},
+		{MultiVector: &MultiVectorOptions{}, CountTotal: true},
+	} {
+		_, err := ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{Query: ai.DocumentFromText("1", nil), Options: opts}, false)
+		assert.ErrorContains(t, err, "counting the total")
+	}
+}
+
+func TestRowToDocument(t *testing.T) {
+	ds := testDocStore()
+	id := [16]byte{0x9b, 0x2e, 0x5a, 0x1c, 0x3d, 0x4f, 0x4a, 0x6b, 0x8c, 0x7d, 0x0e, 0x1f, 0x2a, 0x3b, 0x4c, 0x5d}
+	doc, err := ds.rowToDocument([]any{id, "hello", map[string]any{"year": float64(2024)}, "wiki", 0.25})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", doc.Content[0].Text)
+	assert.Equal(t, map[string]any{
+		"id":        "9b2e5a1c-3d4f-4a6b-8c7d-0e1f2a3b4c5d",
+		"year":      float64(2024),
+		"source":    "wiki",
+		"_distance": 0.25,
+		"_score":    0.75,
+	}, doc.Metadata)
+
+	ds.engine.config.omitScore = true
+	doc, err = ds.rowToDocument([]any{id, "hello", nil, "wiki", 0.25})
+	assert.NoError(t, err)
+	assert.NotContains(t, doc.Metadata, DistanceMetadataKey)
+	assert.NotContains(t, doc.Metadata, ScoreMetadataKey)
+
+	_, err = ds.rowToDocument([]any{1, 42, nil, "wiki", 0.25})
+	assert.Error(t, err)
+}
+
+func TestRowToDocumentMetadataTypes(t *testing.T) {
+	ds := testDocStore()
+	ds.engine.config.omitScore = true
+	want := map[string]any{
+		"id":     "a",
+		"source": "wiki",
+		"year":   float64(2024),
+		"code":   "2024",
+		"draft":  false,
+		"rating": 4.5,
+		"tags":   []any{"go", float64(1), true, nil},
+		"author": map[string]any{"name": "Ada", "langs": []any{map[string]any{"name": "go", "years": float64(3)}}},
+		"empty":  map[string]any{},
+	}
+	raw := `{"year": 2024, "code": "2024", "draft": false, "rating": 4.5, "tags": ["go", 1, true, null],
+		"author": {"name": "Ada", "langs": [{"name": "go", "years": 3}]}, "empty": {}}`
+	// pgx decodes JSON columns into maps, and database/sql reads them as
+	// text or bytes.
+	var decoded map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(raw), &decoded))
+	for _, v := range []any{decoded, raw, []byte(raw)} {
+		doc, err := ds.rowToDocument([]any{"a", "text", v, "wiki", 0.25})
+		if assert.NoError(t, err) {
+			assert.Equal(t, want, doc.Metadata)
+		}
+	}
+
+	_, err := ds.rowToDocument([]any{"a", "text", `["not", "an", "object"]`, "wiki", 0.25})
+	assert.ErrorContains(t, err, `invalid metadata in column "metadata"`)
+}
+
+func TestColumnValue(t *testing.T) {
+	var n pgtype.Numeric
+	assert.NoError(t, n.Scan("12.5"))
+	for _, tc := range []struct {
+		value    any
+		dataType string
+		want     any
+	}{
+		{n, "numeric", 12.5},
+		{pgtype.Numeric{}, "numeric", nil},
+		{"12.5", "numeric", 12.5},
+		{"12.5", "text", "12.5"},
+		{int64(7), "bigint", int64(7)},
+		{[16]byte{0x9b, 0x2e, 0x5a, 0x1c, 0x3d, 0x4f, 0x4a, 0x6b, 0x8c, 0x7d, 0x0e, 0x1f, 0x2a, 0x3b, 0x4c, 0x5d}, "uuid", "9b2e5a1c-3d4f-4a6b-8c7d-0e1f2a3b4c5d"},
+		{`{"a": [1, "b"]}`, "jsonb", map[string]any{"a": []any{float64(1), "b"}}},
+		{[]byte(`[true]`), "json", []any{true}},
+		{[]byte{1, 2}, "bytea", []byte{1, 2}},
+		{nil, "numeric", nil},
+	} {
+		got, err := columnValue(tc.value, tc.dataType)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.want, got, "%v as %s", tc.value, tc.dataType)
+	}
+	_, err := columnValue("x", "numeric")
+	assert.Error(t, err)
+
+	ds := testDocStore()
+	ds.columnTypes = map[string]string{"source": "numeric"}
+	doc, err := ds.rowToDocument([]any{"a", "text", nil, n, 0.25})
+	assert.NoError(t, err)
+	assert.Equal(t, 12.5, doc.Metadata["source"])
+	_, err = ds.rowToDocument([]any{"a", "text", nil, "x", 0.25})
+	assert.ErrorContains(t, err, `invalid value in metadata column "source"`)
+}
+
+func TestMeetsThreshold(t *testing.T) {
+	ds := testDocStore()
+	row := func(distance float64) []any { return []any{"id", "hello", nil, "wiki", distance} }
+	threshold := float32(0.8)
+
+	assert.True(t, ds.meetsThreshold(row(0.9), nil))
+	assert.True(t, ds.meetsThreshold(row(0.1), &threshold))
+	assert.False(t, ds.meetsThreshold(row(0.3), &threshold))
+
+	ds.config.DistanceStrategy = InnerProduct
+	threshold = 2
+	assert.True(t, ds.meetsThreshold(row(-2.5), &threshold))
+	assert.False(t, ds.meetsThreshold(row(-1.5), &threshold))
+}
+
+func TestBuildRetrieveQueryMMR(t *testing.T) {
+	ds := testDocStore()
+	query, _, err := ds.buildRetrieveQuery([]float32{1, 2}, 20, &RetrieverOptions{MMR: &MMROptions{Lambda: 0.5}})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", "embedding" <=> $1 AS distance, "embedding"::text FROM "public"."documents" ORDER BY distance, "id" LIMIT 20`, query)
+}
+
+func TestReturnEmbedding(t *testing.T) {
+	ds := testDocStore()
+	query, _, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{ReturnEmbedding: true})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", "embedding" <=> $1 AS distance, "embedding"::text FROM "public"."documents" ORDER BY distance, "id" LIMIT 4`, query)
+
+	emb, err := ds.rowEmbedding([]any{"1", "hello", nil, nil, 0.5, "[1,2.5]"})
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{1, 2.5}, emb)
+
+	_, err = ds.rowEmbedding([]any{"1", "hello", nil, nil, 0.5})
+	assert.Error(t, err)
+	_, err = ds.rowEmbedding([]any{"1", "hello", nil, nil, 0.5, "not a vector"})
+	assert.Error(t, err)
+}
+
+func TestResolveK(t *testing.T) {
+	ds := testDocStore()
+	ds.config.K = 4
+	k, err := ds.resolveK(&RetrieverOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, k)
+
+	k, err = ds.resolveK(&RetrieverOptions{K: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 10, k)
+
+	_, err = ds.resolveK(&RetrieverOptions{K: -1})
+	assert.Error(t, err)
+}
+
+func TestBuildRetrieveQueryEmbeddingColumn(t *testing.T) {
+	ds := testDocStore()
+	ds.vectorColumns = map[string]bool{"embedding": true, "title_embedding": true}
+	query, _, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{
+		EmbeddingColumn: "title_embedding",
+		Filters:         []Filter{{Key: "tenant_id", Value: "acme"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", "title_embedding" <=> $1 AS distance FROM "public"."documents"`+
+		` WHERE "title_embedding" IS NOT NULL AND "metadata"->>$2 = $3 ORDER BY distance, "id" LIMIT 4`, query)
+
+	_, _, err = ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{EmbeddingColumn: "source"})
+	assert.Error(t, err)
+}
+
+func TestBuildRetrieveQuerySoftDelete(t *testing.T) {
+	ds := testDocStore()
+	ds.engine.config.softDeleteColumn = "deleted_at"
+	query, _, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", "embedding" <=> $1 AS distance FROM "public"."documents"`+
+		` WHERE "deleted_at" IS NULL ORDER BY distance, "id" LIMIT 4`, query)
+
+	query, _, err = ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{Filters: []Filter{{Key: "tenant_id", Value: "acme"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", "embedding" <=> $1 AS distance FROM "public"."documents"`+
+		` WHERE "deleted_at" IS NULL AND "metadata"->>$2 = $3 ORDER BY distance, "id" LIMIT 4`, query)
+}
+
+func TestBuildRetrieveQueryTiebreaker(t *testing.T) {
+	ds := testDocStore()
+	ds.config.TiebreakerColumn = "created_at"
+	query, _, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", "embedding" <=> $1 AS distance FROM "public"."documents" ORDER BY distance, "created_at" LIMIT 4`, query)
+}
+
+func TestBuildRetrieveQueryMetadataKeys(t *testing.T) {
+	ds := testDocStore()
+	query, args, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{MetadataKeys: []string{"title", "url"}})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", (SELECT jsonb_object_agg(key, value) FROM jsonb_each("metadata"::jsonb) WHERE key = ANY($2::text[])) AS "metadata", "source", "embedding" <=> $1 AS distance FROM "public"."documents" ORDER BY distance, "id" LIMIT 4`, query)
+	assert.Equal(t, []string{"title", "url"}, args[1])
+
+	ds.config.MetadataJSONColumn = ""
+	_, _, err = ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{MetadataKeys: []string{"title"}})
+	assert.Error(t, err)
+}
+
+func TestIndexSettings(t *testing.T) {
+	settings, err := indexSettings(&RetrieverOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, settings)
+
+	settings, err = indexSettings(&RetrieverOptions{IVFFlatProbes: 10, HNSWEfSearch: 200})
+	assert.NoError(t, err)
+	assert.Equal(t, []setting{{"ivfflat.probes", "10"}, {"hnsw.ef_search", "200"}}, settings)
+
+	_, err = indexSettings(&RetrieverOptions{HNSWEfSearch: -1})
+	assert.Error(t, err)
+}
+
+func TestRerank(t *testing.T) {
+	ds := testDocStore()
+	ds.config.Embedder = &fakeEmbedder{}
+	ds.config.K = 2
+	ds.engine.config.reranker = func(ctx context.Context, query *ai.Document, docs []*ai.Document) ([]*ai.Document, error) {
+		if query == nil {
+			return nil, errors.New("no query")
+		}
+		reversed := slices.Clone(docs)
+		slices.Reverse(reversed)
+		return reversed, nil
+	}
+	ctx := context.Background()
+	req := &ai.RetrieverRequest{Query: ai.DocumentFromText("3", nil)}
+
+	// The search fetches the candidates of the reranker, but for streams.
+	r, err := ds.prepareRetrieval(ctx, req, true)
+	assert.NoError(t, err)
+	assert.True(t, r.rerank)
+	assert.Contains(t, r.query, "LIMIT 10")
+	r, err = ds.prepareRetrieval(ctx, &ai.RetrieverRequest{Query: req.Query, Options: &RetrieverOptions{RerankFetchK: 3}}, true)
+	assert.NoError(t, err)
+	assert.Contains(t, r.query, "LIMIT 3")
+	_, err = ds.prepareRetrieval(ctx, &ai.RetrieverRequest{Query: req.Query, Options: &RetrieverOptions{RerankFetchK: 1}}, true)
+	assert.Error(t, err)
+	stream, err := ds.prepareRetrieval(ctx, req, false)
+	assert.NoError(t, err)
+	assert.False(t, stream.rerank)
+	assert.Contains(t, stream.query, "LIMIT 2")
+
+	docs := testDocuments("1", "2", "3")
+	reranked, err := r.rerankDocuments(ctx, ds, req.Query, docs)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ai.Document{docs[2], docs[1]}, reranked)
+	_, err = r.rerankDocuments(ctx, ds, nil, docs)
+	assert.ErrorContains(t, err, "reranking failed: no query")
+}
+
+func TestRouteEmbedder(t *testing.T) {
+	ds := testDocStore()
+	ds.config.Embedder = &fakeEmbedder{}
+	other := &namedEmbedder{name: "other"}
+	ds.config.ColumnEmbedders = []ColumnEmbedder{{Column: "embedding_b", Embedder: other}}
+	ds.vectorColumns = map[string]bool{"embedding": true, "embedding_b": true}
+	ds.columnDimensions = map[string]int{"embedding_b": 2}
+
+	// Naming the embedder searches its column, with the query embedded by it.
+	r, err := ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{
+		Query:   ai.DocumentFromText("3", nil),
+		Options: &RetrieverOptions{Embedder: "other"},
+	}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{3, 1}, r.queryVec)
+	assert.Contains(t, r.query, `"embedding_b" <=> $1`)
+	assert.Equal(t, 1, other.calls)
+
+	// So does selecting its column.
+	r, err = ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{
+		Query:   ai.DocumentFromText("3", nil),
+		Options: &RetrieverOptions{EmbeddingColumn: "embedding_b"},
+	}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{3, 1}, r.queryVec)
+
+	opts := &RetrieverOptions{Embedder: "fake"}
+	routed, err := ds.routeEmbedder(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "embedding", routed.EmbeddingColumn)
+	assert.Empty(t, opts.EmbeddingColumn)
+
+	_, err = ds.routeEmbedder(&RetrieverOptions{Embedder: "missing"})
+	assert.Error(t, err)
+	_, err = ds.routeEmbedder(&RetrieverOptions{Embedder: "other", EmbeddingColumn: "embedding"})
+	assert.Error(t, err)
+
+	// The query embedding is checked against the dimension of its column.
+	_, err = ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{
+		Options: &RetrieverOptions{Embedder: "other", QueryEmbedding: []float32{1, 2, 3}},
+	}, true)
+	assert.ErrorIs(t, err, ErrDimensionMismatch)
+}
+
+func TestMixedCaseAndReservedIdentifiers(t *testing.T) {
+	ds := &docStore{dimension: -1, config: &Config{
+		TableName:          "MyDocs",
+		SchemaName:         "Tenants",
+		IDColumn:           "Id",
+		TiebreakerColumn:   "Id",
+		ContentColumn:      "user",
+		EmbeddingColumn:    "Embedding",
+		MetadataJSONColumn: "Metadata",
+		MetadataColumns:    []string{"order"},
+		DistanceStrategy:   CosineDistance,
+	}}
+	assert.NoError(t, ds.validateNames())
+
+	query, _, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{
+		Filters: []Filter{{Key: "order", Value: 3}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "Id", "user", "Metadata", "order", "Embedding" <=> $1 AS distance FROM "Tenants"."MyDocs"`+
+		` WHERE "order" = $2 ORDER BY distance, "Id" LIMIT 4`, query)
+	assert.Equal(t, `INSERT INTO "Tenants"."MyDocs" ("Id", "user", "Embedding", "Metadata", "order") VALUES ($1, $2, $3, $4, $5)`+
+		` ON CONFLICT ("Id") DO NOTHING RETURNING (xmax = 0)`, ds.buildInsertQuery())
+
+	for _, cfg := range []func(*Config){
+		func(c *Config) { c.TableName = `My"Docs` },
+		func(c *Config) { c.EmbeddingColumn = `Embedding"` },
+		func(c *Config) { c.MetadataColumns = []string{""} },
+		func(c *Config) { c.ConflictColumns = []string{`"Id"`} },
+	} {
+		ds := testDocStore()
+		cfg(ds.config)
+		assert.Error(t, ds.validateNames())
+	}
+}
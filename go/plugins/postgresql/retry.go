@@ -0,0 +1,177 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// defaultRetryableCodes are the SQLSTATE codes of transient failures, such
+// as those reported while an instance restarts for maintenance.
+var defaultRetryableCodes = []string{
+	"08000", // connection_exception
+	"08001", // sqlclient_unable_to_establish_sqlconnection
+	"08003", // connection_does_not_exist
+	"08004", // sqlserver_rejected_establishment_of_sqlconnection
+	"08006", // connection_failure
+	"40001", // serialization_failure
+	"40P01", // deadlock_detected
+	"57P01", // admin_shutdown
+	"57P02", // crash_shutdown
+	"57P03", // cannot_connect_now
+}
+
+// retryPolicy retries operations failing with transient errors, with
+// exponential backoff.
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	codes       map[string]bool
+}
+
+func newRetryPolicy(maxAttempts int, baseDelay time.Duration, codes []string) retryPolicy {
+	p := retryPolicy{maxAttempts: maxAttempts, baseDelay: baseDelay, codes: make(map[string]bool)}
+	for _, c := range codes {
+		p.codes[c] = true
+	}
+	return p
+}
+
+// retryable reports whether err is a transient failure worth retrying.
+func (p retryPolicy) retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return p.codes[pgErr.Code]
+	}
+	var connectErr *pgconn.ConnectError
+	return errors.As(err, &connectErr) || errors.Is(err, syscall.ECONNRESET) || pgconn.SafeToRetry(err)
+}
+
+// writeRetryable reports whether err is a transient failure of a write that
+// is safe to retry: one reported by the server, which rolled the statement
+// back, or one that occurred before the write was sent, such as while
+// connecting. A write interrupted by a connection failure may have been
+// committed, and is not retried.
+func (p retryPolicy) writeRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return p.codes[pgErr.Code]
+	}
+	var connectErr *pgconn.ConnectError
+	return errors.As(err, &connectErr) || pgconn.SafeToRetry(err)
+}
+
+// delay returns the backoff before the given retry, counting from 1: the
+// base delay doubled for each previous retry, with jitter.
+func (p retryPolicy) delay(retry int) time.Duration {
+	d := p.baseDelay << (retry - 1)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// do runs f until it succeeds, fails with an error that is not retryable,
+// or the attempts are exhausted. It does not start a retry that could not
+// complete before the deadline of ctx.
+func (p retryPolicy) do(ctx context.Context, f func() error) error {
+	return p.doIf(ctx, p.retryable, f)
+}
+
+// doIf is like do, with retryable reporting which errors are retried.
+func (p retryPolicy) doIf(ctx context.Context, retryable func(error) bool, f func() error) error {
+	err := f()
+	for retry := 1; retry < p.maxAttempts && err != nil && retryable(err); retry++ {
+		d := p.delay(retry)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+			return err
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		err = f()
+	}
+	return err
+}
+
+// retryingQuerier retries the statements of a querier according to a policy.
+// Only the execution of a query is retried, not the reading of its rows, and
+// writes, run with Exec and QueryBatch, only when
+// [retryPolicy.writeRetryable].
+type retryingQuerier struct {
+	querier
+	policy retryPolicy
+}
+
+func (q retryingQuerier) Exec(ctx context.Context, query string, args ...any) (n int64, err error) {
+	err = q.policy.doIf(ctx, q.policy.writeRetryable, func() error {
+		n, err = q.querier.Exec(ctx, query, args...)
+		return err
+	})
+	return n, err
+}
+
+func (q retryingQuerier) Query(ctx context.Context, query string, args ...any) (rows queryRows, err error) {
+	err = q.policy.do(ctx, func() error {
+		rows, err = q.querier.Query(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+func (q retryingQuerier) QueryRow(ctx context.Context, query string, args ...any) pgx.Row {
+	return retryingRow{q: q, ctx: ctx, query: query, args: args}
+}
+
+func (q retryingQuerier) QueryBatch(ctx context.Context, query string, argLists [][]any, scan func(i int, row pgx.Row) error) (i int, err error) {
+	err = q.policy.doIf(ctx, q.policy.writeRetryable, func() error {
+		i, err = q.querier.QueryBatch(ctx, query, argLists, scan)
+		return err
+	})
+	return i, err
+}
+
+func (q retryingQuerier) QueryLocal(ctx context.Context, settings []setting, query string, args ...any) (rows queryRows, err error) {
+	err = q.policy.do(ctx, func() error {
+		rows, err = q.querier.QueryLocal(ctx, settings, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+func (q retryingQuerier) QueryCursor(ctx context.Context, settings []setting, fetchSize int, query string, args ...any) (rows queryRows, err error) {
+	err = q.policy.do(ctx, func() error {
+		rows, err = q.querier.QueryCursor(ctx, settings, fetchSize, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// retryingRow runs its query when scanned, so that it can be retried.
+type retryingRow struct {
+	q     retryingQuerier
+	ctx   context.Context
+	query string
+	args  []any
+}
+
+func (r retryingRow) Scan(dest ...any) error {
+	return r.q.policy.do(r.ctx, func() error {
+		return r.q.querier.QueryRow(r.ctx, r.query, r.args...).Scan(dest...)
+	})
+}
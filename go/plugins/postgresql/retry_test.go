@@ -0,0 +1,139 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	p := newRetryPolicy(3, time.Millisecond, defaultRetryableCodes)
+	assert.True(t, p.retryable(&pgconn.PgError{Code: "57P01"}))
+	assert.True(t, p.retryable(fmt.Errorf("read: %w", syscall.ECONNRESET)))
+	assert.False(t, p.retryable(&pgconn.PgError{Code: "42601"})) // syntax_error
+	assert.False(t, p.retryable(&pgconn.PgError{Code: "23505"})) // unique_violation
+	assert.False(t, p.retryable(context.DeadlineExceeded))
+	assert.False(t, p.retryable(errors.New("boom")))
+
+	p = newRetryPolicy(3, time.Millisecond, []string{"23505"})
+	assert.True(t, p.retryable(&pgconn.PgError{Code: "23505"}))
+	assert.False(t, p.retryable(&pgconn.PgError{Code: "57P01"}))
+}
+
+func TestRetryPolicyWriteRetryable(t *testing.T) {
+	p := newRetryPolicy(3, time.Millisecond, defaultRetryableCodes)
+	assert.True(t, p.writeRetryable(&pgconn.PgError{Code: "40001"}))
+	assert.True(t, p.writeRetryable(&pgconn.ConnectError{Config: &pgconn.Config{}}))
+	assert.False(t, p.writeRetryable(&pgconn.PgError{Code: "23505"}))
+	// The write may have been committed before the connection was reset.
+	assert.False(t, p.writeRetryable(fmt.Errorf("read: %w", syscall.ECONNRESET)))
+	assert.False(t, p.writeRetryable(context.Canceled))
+}
+
+// failingQuerier fails every statement with err, counting the attempts.
+type failingQuerier struct {
+	querier
+	err      error
+	attempts int
+}
+
+func (q *failingQuerier) Exec(ctx context.Context, query string, args ...any) (int64, error) {
+	q.attempts++
+	return 0, q.err
+}
+
+func (q *failingQuerier) Query(ctx context.Context, query string, args ...any) (queryRows, error) {
+	q.attempts++
+	return nil, q.err
+}
+
+func TestRetryingQuerierWrites(t *testing.T) {
+	reset := fmt.Errorf("read: %w", syscall.ECONNRESET)
+	policy := newRetryPolicy(3, time.Millisecond, defaultRetryableCodes)
+
+	// Reads are retried after a connection reset, writes are not.
+	q := &failingQuerier{err: reset}
+	_, err := retryingQuerier{querier: q, policy: policy}.Query(context.Background(), "SELECT 1")
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Equal(t, 3, q.attempts)
+
+	q = &failingQuerier{err: reset}
+	_, err = retryingQuerier{querier: q, policy: policy}.Exec(context.Background(), "DELETE FROM documents")
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Equal(t, 1, q.attempts)
+
+	q = &failingQuerier{err: &pgconn.PgError{Code: "40P01"}}
+	_, err = retryingQuerier{querier: q, policy: policy}.Exec(context.Background(), "DELETE FROM documents")
+	assert.Error(t, err)
+	assert.Equal(t, 3, q.attempts)
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	p := newRetryPolicy(3, time.Millisecond, defaultRetryableCodes)
+	transient := &pgconn.PgError{Code: "57P01"}
+
+	calls := 0
+	err := p.do(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return transient
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = p.do(context.Background(), func() error {
+		calls++
+		return transient
+	})
+	assert.ErrorIs(t, err, transient)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = p.do(context.Background(), func() error {
+		calls++
+		return &pgconn.PgError{Code: "42601"}
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryPolicyDoDeadline(t *testing.T) {
+	p := newRetryPolicy(5, time.Hour, defaultRetryableCodes)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	calls := 0
+	err := p.do(ctx, func() error {
+		calls++
+		return &pgconn.PgError{Code: "57P01"}
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := newRetryPolicy(5, 100*time.Millisecond, nil)
+	for retry, max := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond} {
+		d := p.delay(retry + 1)
+		assert.GreaterOrEqual(t, d, max/2)
+		assert.LessOrEqual(t, d, max)
+	}
+}
+
+func TestApplyEngineOptionsRetry(t *testing.T) {
+	cfg, err := applyEngineOptions([]Option{WithPool(&pgxpool.Pool{}), WithDatabase("testdb"), WithRetry(3, time.Millisecond)})
+	assert.NoError(t, err)
+	assert.IsType(t, retryingQuerier{}, (&PostgresEngine{config: cfg}).querier())
+
+	_, err = applyEngineOptions([]Option{WithPool(&pgxpool.Pool{}), WithDatabase("testdb"), WithRetry(-1, time.Millisecond)})
+	assert.Error(t, err)
+}
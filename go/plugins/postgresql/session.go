@@ -0,0 +1,74 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// requestSettings returns settings preceded by the run-time parameters set
+// with [WithRequestSettings] for the queries run with ctx.
+func (pgEngine *PostgresEngine) requestSettings(ctx context.Context, settings []setting) ([]setting, error) {
+	f := pgEngine.config.requestSettings
+	if f == nil {
+		return settings, nil
+	}
+	params, err := f(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("request settings: %w", err)
+	}
+	if len(params) == 0 {
+		return settings, nil
+	}
+	merged := make([]setting, 0, len(params)+len(settings))
+	for _, name := range slices.Sorted(maps.Keys(params)) {
+		if name == "" {
+			return nil, errors.New("request settings: parameter name must not be empty")
+		}
+		merged = append(merged, setting{name, params[name]})
+	}
+	return append(merged, settings...), nil
+}
+
+// queryRowLocal runs a query returning a single row like QueryRow, in a
+// transaction in which the request settings of ctx are applied, if any.
+func (pgEngine *PostgresEngine) queryRowLocal(ctx context.Context, query string, args ...any) pgx.Row {
+	settings, err := pgEngine.requestSettings(ctx, nil)
+	if err != nil {
+		return errRow{err}
+	}
+	if len(settings) == 0 {
+		return pgEngine.querier().QueryRow(ctx, query, args...)
+	}
+	rows, err := pgEngine.querier().QueryLocal(ctx, settings, query, args...)
+	if err != nil {
+		return errRow{err}
+	}
+	return localRow{rows}
+}
+
+// localRow is the single row of a query run by QueryLocal.
+type localRow struct {
+	rows queryRows
+}
+
+func (r localRow) Scan(dest ...any) error {
+	defer r.rows.Close()
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return pgx.ErrNoRows
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		return err
+	}
+	// Reading past the row commits the transaction.
+	for r.rows.Next() {
+	}
+	return r.rows.Err()
+}
@@ -0,0 +1,53 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tenantKey struct{}
+
+func TestRequestSettings(t *testing.T) {
+	pgEngine := &PostgresEngine{}
+	probes := []setting{{"ivfflat.probes", "10"}}
+	settings, err := pgEngine.requestSettings(context.Background(), probes)
+	require.NoError(t, err)
+	assert.Equal(t, probes, settings)
+
+	cfg, err := applyEngineOptions([]Option{WithPool(&pgxpool.Pool{}), WithDatabase("testdb"),
+		WithRequestSettings(func(ctx context.Context) (map[string]string, error) {
+			tenant, ok := ctx.Value(tenantKey{}).(string)
+			if !ok {
+				return nil, errors.New("no tenant")
+			}
+			return map[string]string{"role": "tenant_reader", "app.current_tenant": tenant}, nil
+		})})
+	require.NoError(t, err)
+	pgEngine.config = cfg
+
+	ctx := context.WithValue(context.Background(), tenantKey{}, "acme")
+	settings, err = pgEngine.requestSettings(ctx, probes)
+	require.NoError(t, err)
+	assert.Equal(t, []setting{{"app.current_tenant", "acme"}, {"role", "tenant_reader"}, {"ivfflat.probes", "10"}}, settings)
+
+	_, err = pgEngine.requestSettings(context.Background(), nil)
+	assert.ErrorContains(t, err, "request settings: no tenant")
+	assert.ErrorContains(t, pgEngine.queryRowLocal(context.Background(), "SELECT 1").Scan(), "no tenant")
+
+	pgEngine.config.requestSettings = func(ctx context.Context) (map[string]string, error) {
+		return map[string]string{"": "x"}, nil
+	}
+	_, err = pgEngine.requestSettings(ctx, nil)
+	assert.ErrorContains(t, err, "must not be empty")
+}
+
+func TestLocalRow(t *testing.T) {
+	assert.NoError(t, localRow{&sliceRows{values: []any{int64(3)}}}.Scan())
+	assert.ErrorIs(t, localRow{&sliceRows{}}.Scan(), pgx.ErrNoRows)
+}
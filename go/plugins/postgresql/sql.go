@@ -0,0 +1,119 @@
+package postgresql
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var identifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*$`)
+
+// validateIdentifier returns an error if name is not a valid unquoted
+// Postgres identifier. kind describes the identifier in the error message.
+func validateIdentifier(kind, name string) error {
+	if name == "" {
+		return fmt.Errorf("%s must not be empty", kind)
+	}
+	if len(name) > 63 {
+		return fmt.Errorf("%s %q is longer than 63 characters", kind, name)
+	}
+	if !identifierRe.MatchString(name) {
+		return fmt.Errorf("%s %q contains invalid characters", kind, name)
+	}
+	return nil
+}
+
+// validateQuotedIdentifier returns an error if name cannot be used as a
+// quoted Postgres identifier, as the names of tables and columns are always
+// quoted in generated SQL. Unlike validateIdentifier, it accepts names that
+// need quoting, such as mixed-case names and reserved words. kind describes
+// the identifier in the error message.
+func validateQuotedIdentifier(kind, name string) error {
+	if name == "" {
+		return fmt.Errorf("%s must not be empty", kind)
+	}
+	if len(name) > 63 {
+		return fmt.Errorf("%s %q is longer than 63 characters", kind, name)
+	}
+	if strings.ContainsAny(name, "\"\x00") {
+		return fmt.Errorf("%s %q contains a double quote or a null character", kind, name)
+	}
+	return nil
+}
+
+// qualifiedName returns the quoted, schema-qualified name of a table.
+func qualifiedName(schemaName, tableName string) string {
+	return pgx.Identifier{schemaName, tableName}.Sanitize()
+}
+
+// placeholderRe matches the placeholders of a compiled expression, skipping
+// quoted identifiers, which may contain $.
+var placeholderRe = regexp.MustCompile(`"[^"]*"|\$[0-9]+`)
+
+// inlineArgs replaces the placeholders of expr with the literals of args, for
+// statements that cannot have parameters, such as index definitions.
+func inlineArgs(expr string, args []any) (string, error) {
+	var err error
+	out := placeholderRe.ReplaceAllStringFunc(expr, func(m string) string {
+		if m[0] == '"' || err != nil {
+			return m
+		}
+		n, _ := strconv.Atoi(m[1:])
+		if n < 1 || n > len(args) {
+			err = fmt.Errorf("placeholder %s has no argument", m)
+			return m
+		}
+		var lit string
+		lit, err = sqlLiteral(args[n-1])
+		return lit
+	})
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// sqlLiteral returns v as an escaped SQL literal.
+func sqlLiteral(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return quoteLiteral(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case time.Time:
+		return quoteLiteral(v.Format(time.RFC3339Nano)) + "::timestamptz", nil
+	case nil:
+		return "", fmt.Errorf("nil value is not supported")
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", fmt.Errorf("value %v is not a finite number", f)
+		}
+		return strconv.FormatFloat(f, 'g', -1, rv.Type().Bits()), nil
+	}
+	return "", fmt.Errorf("unsupported value type %T", v)
+}
+
+// quoteLiteral quotes s as a string literal. Literals containing backslashes
+// use the escape string syntax, so that they are read the same whatever the
+// value of standard_conforming_strings.
+func quoteLiteral(s string) string {
+	s = strings.ReplaceAll(s, "'", "''")
+	if strings.Contains(s, `\`) {
+		return "E'" + strings.ReplaceAll(s, `\`, `\\`) + "'"
+	}
+	return "'" + s + "'"
+}
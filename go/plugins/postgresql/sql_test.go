@@ -0,0 +1,31 @@
+package postgresql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateIdentifier(t *testing.T) {
+	for _, name := range []string{"public", "_private", "docs_2024", "a$b"} {
+		assert.NoError(t, validateIdentifier("schema name", name), name)
+	}
+	for _, name := range []string{"", "2docs", "my schema", `a"b`, "a.b", strings.Repeat("x", 64)} {
+		assert.Error(t, validateIdentifier("schema name", name), name)
+	}
+}
+
+func TestQualifiedName(t *testing.T) {
+	assert.Equal(t, `"public"."documents"`, qualifiedName("public", "documents"))
+	assert.Equal(t, `"vectors"."my""table"`, qualifiedName("vectors", `my"table`))
+}
+
+func TestValidateQuotedIdentifier(t *testing.T) {
+	for _, name := range []string{"documents", "MyDocs", "Embedding", "order", "user", "my docs", "docs-2024", "naïve"} {
+		assert.NoError(t, validateQuotedIdentifier("table name", name), name)
+	}
+	for _, name := range []string{"", `my"docs`, "a\x00b", strings.Repeat("x", 64)} {
+		assert.Error(t, validateQuotedIdentifier("table name", name), name)
+	}
+}
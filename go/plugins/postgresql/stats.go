@@ -0,0 +1,52 @@
+package postgresql
+
+import "time"
+
+// PoolStats is a snapshot of the connection pool of an engine.
+type PoolStats struct {
+	AcquiredConns int32 // Connections in use.
+	IdleConns     int32 // Connections waiting to be used.
+	TotalConns    int32 // Open connections, in use or idle.
+	MaxConns      int32 // Maximum size of the pool, or 0 if unlimited.
+	// AcquireCount is the number of connections acquired from the pool, and
+	// EmptyAcquireCount the number of those that had to wait, for a new
+	// connection or one to be returned.
+	AcquireCount      int64
+	EmptyAcquireCount int64
+	// AcquireDuration is the total time spent acquiring connections.
+	AcquireDuration time.Duration
+}
+
+// Stats returns a snapshot of the connection pool used by the retrievers and
+// indexers of the engine, such as to export pool utilization as metrics.
+// With [WithDB], the statistics of the database/sql handle are reported:
+// AcquireCount and EmptyAcquireCount are both the number of waits for a
+// connection, and AcquireDuration their total duration. Stats returns zero
+// values for an engine without a connection.
+func (pgEngine *PostgresEngine) Stats() PoolStats {
+	switch {
+	case pgEngine.pool() != nil:
+		s := pgEngine.pool().Stat()
+		return PoolStats{
+			AcquiredConns:     s.AcquiredConns(),
+			IdleConns:         s.IdleConns(),
+			TotalConns:        s.TotalConns(),
+			MaxConns:          s.MaxConns(),
+			AcquireCount:      s.AcquireCount(),
+			EmptyAcquireCount: s.EmptyAcquireCount(),
+			AcquireDuration:   s.AcquireDuration(),
+		}
+	case pgEngine.config.db != nil:
+		s := pgEngine.config.db.Stats()
+		return PoolStats{
+			AcquiredConns:     int32(s.InUse),
+			IdleConns:         int32(s.Idle),
+			TotalConns:        int32(s.OpenConnections),
+			MaxConns:          int32(s.MaxOpenConnections),
+			AcquireCount:      s.WaitCount,
+			EmptyAcquireCount: s.WaitCount,
+			AcquireDuration:   s.WaitDuration,
+		}
+	}
+	return PoolStats{}
+}
@@ -0,0 +1,115 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+
+	"github.com/firebase/genkit/go/ai"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// RetrieveStream runs the similarity search of req against the table
+// described by cfg, like the retriever defined with cfg, and yields the
+// documents as they are read from the database instead of collecting them in
+// a slice. It is meant for large values of [RetrieverOptions.K].
+//
+// Errors, including an invalid cfg, are yielded with a nil document, after
+// which iteration stops. Stopping the iteration early, or canceling ctx,
+// closes the query and releases its connection. [RetrieverOptions.MMR] is not
+// supported, since it re-ranks the whole result set.
+func (pgEngine *PostgresEngine) RetrieveStream(ctx context.Context, cfg *Config, req *ai.RetrieverRequest) iter.Seq2[*ai.Document, error] {
+	return func(yield func(*ai.Document, error) bool) {
+		ds, err := newEngineDocStore(ctx, *pgEngine, cfg)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		ds.retrieveStream(ctx, req, yield)
+	}
+}
+
+// retrieveStream runs the search of req and passes the documents to yield
+// until it returns false.
+func (ds *docStore) retrieveStream(ctx context.Context, req *ai.RetrieverRequest, yield func(*ai.Document, error) bool) {
+	var err error
+	count := 0
+	ctx, cancel := ds.engine.withFallbackTimeout(ctx)
+	defer cancel()
+	ctx, span := ds.startSpan(ctx, "postgresql.retrieve_stream",
+		attribute.String("postgresql.distance_strategy", string(ds.config.DistanceStrategy)))
+	defer func() {
+		span.SetAttributes(attribute.Int("postgresql.result_count", count))
+		endSpan(span, err)
+		ds.recordRequest(ctx, "retrieve", count, err)
+	}()
+
+	if opts, ok := req.Options.(*RetrieverOptions); ok && opts != nil && (opts.MMR != nil || opts.CountTotal || opts.RollUp != nil || opts.MergeChunks != nil) {
+		err = errors.New("postgres.RetrieveStream: MMR, total counts, roll-ups and merged chunks are not supported when streaming")
+		yield(nil, err)
+		return
+	}
+	r, err := ds.prepareRetrieval(ctx, req, false)
+	if err != nil {
+		yield(nil, err)
+		return
+	}
+	qctx, cancel := ds.engine.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := r.stream(qctx, ds)
+	if err != nil {
+		err = fmt.Errorf("postgres.RetrieveStream: query failed: %w", queryTimeoutError(qctx, describeQueryError(err, ds.config)))
+		yield(nil, err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		values, verr := rows.Values()
+		if verr != nil {
+			err = fmt.Errorf("postgres.RetrieveStream: failed to read row: %w", queryTimeoutError(qctx, verr))
+			yield(nil, err)
+			return
+		}
+		if !ds.finiteDistance(ctx, values) || !ds.meetsThreshold(values, r.opts.ScoreThreshold) {
+			continue
+		}
+		doc, derr := ds.rowToDocument(values)
+		if derr != nil {
+			err = derr
+			yield(nil, err)
+			return
+		}
+		if r.opts.ReturnEmbedding {
+			emb, eerr := ds.rowEmbedding(values)
+			if eerr != nil {
+				err = fmt.Errorf("postgres.RetrieveStream: %w", eerr)
+				yield(nil, err)
+				return
+			}
+			doc.Metadata[EmbeddingMetadataKey] = ds.returnedEmbedding(emb)
+		}
+		if rerr := ds.resolveContent(ctx, []*ai.Document{doc}); rerr != nil {
+			err = fmt.Errorf("postgres.RetrieveStream: %w", rerr)
+			yield(nil, err)
+			return
+		}
+		docs, terr := ds.engine.transformResult(ctx, []*ai.Document{doc})
+		if terr != nil {
+			err = fmt.Errorf("postgres.RetrieveStream: %w", terr)
+			yield(nil, err)
+			return
+		}
+		for _, doc := range docs {
+			count++
+			if !yield(doc, nil) {
+				return
+			}
+		}
+	}
+	if rerr := rows.Err(); rerr != nil {
+		err = fmt.Errorf("postgres.RetrieveStream: %w", queryTimeoutError(qctx, describeQueryError(rerr, ds.config)))
+		yield(nil, err)
+	}
+}
@@ -0,0 +1,73 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+// collectStream drains a stream into its documents and errors.
+func collectStream(ds *docStore, req *ai.RetrieverRequest) ([]*ai.Document, []error) {
+	var docs []*ai.Document
+	var errs []error
+	ds.retrieveStream(context.Background(), req, func(doc *ai.Document, err error) bool {
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			docs = append(docs, doc)
+		}
+		return true
+	})
+	return docs, errs
+}
+
+func TestRetrieveStreamRejectsMMR(t *testing.T) {
+	ds := testDocStore()
+	ds.config.Embedder = &fakeEmbedder{}
+	docs, errs := collectStream(ds, &ai.RetrieverRequest{
+		Query:   ai.DocumentFromText("1", nil),
+		Options: &RetrieverOptions{MMR: &MMROptions{}},
+	})
+	assert.Empty(t, docs)
+	if assert.Len(t, errs, 1) {
+		assert.ErrorContains(t, errs[0], "MMR")
+	}
+}
+
+func TestRetrieveStreamRejectsCountTotal(t *testing.T) {
+	ds := testDocStore()
+	_, errs := collectStream(ds, &ai.RetrieverRequest{
+		Query:   ai.DocumentFromText("1", nil),
+		Options: &RetrieverOptions{CountTotal: true},
+	})
+	if assert.Len(t, errs, 1) {
+		assert.ErrorContains(t, errs[0], "total counts")
+	}
+}
+
+func TestRetrieveStreamInvalidRequest(t *testing.T) {
+	ds := testDocStore()
+	ds.config.Embedder = &fakeEmbedder{}
+	docs, errs := collectStream(ds, &ai.RetrieverRequest{})
+	assert.Empty(t, docs)
+	assert.Len(t, errs, 1)
+
+	docs, errs = collectStream(ds, &ai.RetrieverRequest{
+		Query:   ai.DocumentFromText("1", nil),
+		Options: &RetrieverOptions{K: -1},
+	})
+	assert.Empty(t, docs)
+	assert.Len(t, errs, 1)
+}
+
+func TestRetrieveStreamInvalidConfig(t *testing.T) {
+	pgEngine := &PostgresEngine{}
+	var errs []error
+	for doc, err := range pgEngine.RetrieveStream(context.Background(), &Config{}, &ai.RetrieverRequest{}) {
+		assert.Nil(t, doc)
+		errs = append(errs, err)
+	}
+	assert.Len(t, errs, 1)
+}
@@ -0,0 +1,83 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// IndexSummary summarizes an index request, such as for an ingestion
+// dashboard, as returned by [PostgresEngine.IndexDocumentsSummary].
+type IndexSummary struct {
+	// Results are the ID and status of each document written, in request
+	// order, as returned by [PostgresEngine.IndexDocuments].
+	Results []IndexResult
+	// The number of documents of each status of Results.
+	Inserted, Updated, Skipped, Unchanged, Failed int
+	// Failures are the documents not written, with the reason, of a
+	// request with [IndexBestEffort].
+	Failures []IndexFailure
+	// EmbedDuration is the time spent embedding the documents, including
+	// with [Config.ColumnEmbedders], and WriteDuration the time spent
+	// writing their rows. Duration is the time of the whole request.
+	EmbedDuration time.Duration
+	WriteDuration time.Duration
+	Duration      time.Duration
+}
+
+// IndexDocumentsSummary indexes docs like [PostgresEngine.IndexDocuments],
+// and returns a summary of the request. On failure, the summary covers the
+// documents of the results of IndexDocuments, and is returned with the
+// error; with [IndexBestEffort], it lists the [IndexFailures].
+func (pgEngine *PostgresEngine) IndexDocumentsSummary(ctx context.Context, cfg *Config, docs []*ai.Document) (summary *IndexSummary, err error) {
+	start := time.Now()
+	if len(docs) == 0 {
+		return &IndexSummary{}, nil
+	}
+	ds, err := newEngineDocStore(ctx, *pgEngine, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.IndexDocumentsSummary: %w", err)
+	}
+	ctx, span := ds.startSpan(ctx, "postgresql.index",
+		attribute.Int("postgresql.document_count", len(docs)),
+		attribute.Int("postgresql.batch_size", ds.config.IndexBatchSize))
+	defer func() { endSpan(span, err) }()
+	return ds.indexSummary(ctx, docs, pgEngine.querier(), start)
+}
+
+// indexSummary indexes docs with q like index, and returns the summary of
+// the request, which started at start.
+func (ds *docStore) indexSummary(ctx context.Context, docs []*ai.Document, q querier, start time.Time) (*IndexSummary, error) {
+	var timing indexTiming
+	results, err := ds.indexTimed(ctx, docs, q, &timing)
+	summary := &IndexSummary{Results: results, EmbedDuration: timing.embed, WriteDuration: timing.write}
+	summary.count()
+	var failures *IndexFailures
+	if errors.As(err, &failures) {
+		summary.Failures = failures.Failures
+	}
+	summary.Duration = time.Since(start)
+	return summary, err
+}
+
+// count sets the counts of the statuses of s.Results.
+func (s *IndexSummary) count() {
+	for _, r := range s.Results {
+		switch r.Status {
+		case IndexInserted:
+			s.Inserted++
+		case IndexUpdated:
+			s.Updated++
+		case IndexSkipped:
+			s.Skipped++
+		case IndexUnchanged:
+			s.Unchanged++
+		case IndexFailed:
+			s.Failed++
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexSummary(t *testing.T) {
+	ds := testDocStore()
+	ds.config.Embedder = &fakeEmbedder{}
+	ds.config.IndexBatchSize = 2
+	ds.config.IndexErrors = IndexBestEffort
+	ds.contentType = TextContent
+	ds.dimension = 1
+
+	docs := testDocuments("1", "2", "3")
+	docs[1].Metadata = map[string]any{"id": "dup"}
+	start := time.Now()
+	summary, err := ds.indexSummary(context.Background(), docs, &rejectingQuerier{reject: "dup"}, start)
+	assert.ErrorIs(t, err, ErrDuplicateID)
+	assert.Len(t, summary.Results, 3)
+	assert.Equal(t, 2, summary.Inserted)
+	assert.Equal(t, 1, summary.Failed)
+	if assert.Len(t, summary.Failures, 1) {
+		assert.Equal(t, "dup", summary.Failures[0].ID)
+	}
+	assert.Positive(t, summary.EmbedDuration)
+	assert.Positive(t, summary.WriteDuration)
+	assert.GreaterOrEqual(t, summary.Duration, summary.EmbedDuration+summary.WriteDuration)
+
+	s := &IndexSummary{Results: []IndexResult{
+		{Status: IndexInserted}, {Status: IndexUpdated}, {Status: IndexUpdated},
+		{Status: IndexSkipped}, {Status: IndexUnchanged}, {Status: IndexFailed},
+	}}
+	s.count()
+	assert.Equal(t, IndexSummary{Results: s.Results, Inserted: 1, Updated: 2, Skipped: 1, Unchanged: 1, Failed: 1}, *s)
+}
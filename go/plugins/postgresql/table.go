@@ -0,0 +1,226 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+)
+
+// TableDescription describes a table as found in the database.
+type TableDescription struct {
+	SchemaName string
+	TableName  string
+	// Columns holds the names of the columns, in table order.
+	Columns []string
+	// EmbeddingDimension is the declared dimension of the embedding column
+	// of the engine, or 0 if the column does not exist or has no dimension.
+	EmbeddingDimension int
+	// Indexes holds the columns covered by HNSW and IVFFlat indexes.
+	Indexes []VectorIndex
+}
+
+// VectorIndex describes a column covered by a vector index.
+type VectorIndex struct {
+	Name          string // Name of the index.
+	Method        string // Index method, hnsw or ivfflat.
+	Column        string // Indexed column.
+	OperatorClass string // Operator class, such as vector_cosine_ops.
+}
+
+// TableExists reports whether a table exists in the schema of the engine.
+func (pgEngine *PostgresEngine) TableExists(ctx context.Context, tableName string) (bool, error) {
+	const query = `SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = $1 AND table_name = $2)`
+	tableName = pgEngine.tableName(tableName)
+	schemaName := pgEngine.schemaName()
+	qctx, cancel := pgEngine.withQueryTimeout(ctx)
+	defer cancel()
+	var exists bool
+	if err := pgEngine.querier().QueryRow(qctx, query, schemaName, tableName).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to look up table %q: %w", tableName, queryTimeoutError(qctx, err))
+	}
+	return exists, nil
+}
+
+// DescribeTable returns the columns, embedding dimension and vector indexes of
+// a table in the schema of the engine, so that setup code can check an
+// existing table against the expected shape. It returns an error if the
+// table does not exist.
+func (pgEngine *PostgresEngine) DescribeTable(ctx context.Context, tableName string) (*TableDescription, error) {
+	tableName = pgEngine.tableName(tableName)
+	schemaName := pgEngine.schemaName()
+	qctx, cancel := pgEngine.withQueryTimeout(ctx)
+	defer cancel()
+	desc := &TableDescription{SchemaName: schemaName, TableName: tableName}
+
+	rows, err := pgEngine.querier().Query(qctx, "SELECT column_name FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2 ORDER BY ordinal_position", schemaName, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe table %q: %w", tableName, queryTimeoutError(qctx, err))
+	}
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to describe table %q: %w", tableName, err)
+		}
+		desc.Columns = append(desc.Columns, col)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to describe table %q: %w", tableName, queryTimeoutError(qctx, err))
+	}
+	if len(desc.Columns) == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrTableNotFound, tableName)
+	}
+
+	dim, ok, err := pgEngine.columnDimension(qctx, schemaName, tableName, pgEngine.embeddingColumn())
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe table %q: %w", tableName, queryTimeoutError(qctx, err))
+	}
+	if ok && dim > 0 {
+		desc.EmbeddingDimension = dim
+	}
+
+	rows, err = pgEngine.querier().Query(qctx, "SELECT indexname, indexdef FROM pg_indexes WHERE schemaname = $1 AND tablename = $2 ORDER BY indexname", schemaName, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe table %q: %w", tableName, queryTimeoutError(qctx, err))
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, def string
+		if err := rows.Scan(&name, &def); err != nil {
+			return nil, fmt.Errorf("failed to describe table %q: %w", tableName, err)
+		}
+		for _, idx := range parseVectorIndex(def) {
+			idx.Name = name
+			desc.Indexes = append(desc.Indexes, idx)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to describe table %q: %w", tableName, queryTimeoutError(qctx, err))
+	}
+	return desc, nil
+}
+
+// tableColumn is the type of a column of an existing table.
+type tableColumn struct {
+	typeName string // name of the type, such as text or vector
+	typmod   int    // type modifier; the dimension of a vector column
+}
+
+// tableColumns returns the columns of a table by name, or none if the table
+// does not exist.
+func (pgEngine *PostgresEngine) tableColumns(ctx context.Context, schemaName, tableName string) (map[string]tableColumn, error) {
+	const query = `SELECT a.attname, t.typname, a.atttypmod FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_type t ON t.oid = a.atttypid
+		WHERE n.nspname = $1 AND c.relname = $2 AND a.attnum > 0 AND NOT a.attisdropped`
+	rows, err := pgEngine.querier().Query(ctx, query, schemaName, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols := make(map[string]tableColumn)
+	for rows.Next() {
+		var name, typeName string
+		var typmod int32
+		if err := rows.Scan(&name, &typeName, &typmod); err != nil {
+			return nil, err
+		}
+		cols[name] = tableColumn{typeName: typeName, typmod: int(typmod)}
+	}
+	return cols, rows.Err()
+}
+
+// compileTableFilters compiles filters against a table like compileFilters,
+// comparing the filters on its typed metadata columns, those other than the
+// id, content, embedding and JSON metadata columns, against the columns, as
+// retrieval does for [Config.MetadataColumns]. The filters are checked before
+// the table is looked up, and the columns of the table are returned, or none
+// if there are no filters.
+func (pgEngine *PostgresEngine) compileTableFilters(ctx context.Context, schemaName, tableName string, filters []Filter, args *queryArgs) (string, map[string]tableColumn, error) {
+	if len(filters) == 0 {
+		return "", nil, nil
+	}
+	jsonColumn := pgEngine.metadataJSONColumn()
+	if _, err := compileFilters(filters, jsonColumn, nil, &queryArgs{}); err != nil {
+		return "", nil, err
+	}
+	qctx, cancel := pgEngine.withQueryTimeout(ctx)
+	cols, err := pgEngine.tableColumns(qctx, schemaName, tableName)
+	cancel()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to look up table %q: %w", tableName, queryTimeoutError(qctx, err))
+	}
+	if len(cols) == 0 {
+		return "", nil, fmt.Errorf("%w: %q", ErrTableNotFound, tableName)
+	}
+	var names []string
+	for name := range cols {
+		switch name {
+		case pgEngine.idColumn(), pgEngine.contentColumn(), pgEngine.embeddingColumn(), jsonColumn:
+		default:
+			names = append(names, name)
+		}
+	}
+	where, err := compileFilters(filters, jsonColumn, names, args)
+	if err != nil {
+		return "", nil, err
+	}
+	return where, cols, nil
+}
+
+// checkExistingTable returns an error if the columns of an existing table do
+// not match the table described by opts.
+func checkExistingTable(opts VectorstoreTableOptions, vectorType VectorType, cols map[string]tableColumn) error {
+	mismatch := func(format string, args ...any) error {
+		return fmt.Errorf("table %q.%q already exists but does not match the requested table: %s",
+			opts.SchemaName, opts.TableName, fmt.Sprintf(format, args...))
+	}
+	if _, ok := cols[opts.IDColumn.Name]; !ok {
+		return mismatch("id column %q is missing", opts.IDColumn.Name)
+	}
+	content, ok := cols[opts.ContentColumnName]
+	if !ok {
+		return mismatch("content column %q is missing", opts.ContentColumnName)
+	}
+	if t, _ := contentTypeOf(content.typeName); t != opts.ContentColumnType {
+		return mismatch("content column %q has type %s, want %s", opts.ContentColumnName, content.typeName, opts.ContentColumnType)
+	}
+	embeddings := append([]EmbeddingColumn{{Name: opts.EmbeddingColumn, VectorSize: opts.VectorSize}}, opts.AdditionalEmbeddingColumns...)
+	for _, e := range embeddings {
+		col, ok := cols[e.Name]
+		if !ok {
+			return mismatch("embedding column %q is missing", e.Name)
+		}
+		if col.typeName != string(vectorType) {
+			return mismatch("embedding column %q has type %s, want %s", e.Name, col.typeName, vectorType)
+		}
+		if col.typmod <= 0 {
+			return mismatch("embedding column %q has no fixed dimension, which vector indexes require; recreate it as %s(%d)", e.Name, vectorType, e.VectorSize)
+		}
+		if col.typmod != e.VectorSize {
+			return fmt.Errorf("%w: %w", ErrDimensionMismatch,
+				mismatch("embedding column %q has dimension %d, but vector size %d was requested", e.Name, col.typmod, e.VectorSize))
+		}
+	}
+	if opts.StoreMetadata {
+		meta, ok := cols[opts.MetadataJSONColumn]
+		if !ok {
+			return mismatch("metadata column %q is missing", opts.MetadataJSONColumn)
+		}
+		if meta.typeName != "json" && meta.typeName != "jsonb" {
+			return mismatch("metadata column %q has type %s, want json", opts.MetadataJSONColumn, meta.typeName)
+		}
+	}
+	for _, mc := range opts.MetadataColumns {
+		if _, ok := cols[mc.Name]; !ok {
+			return mismatch("metadata column %q is missing", mc.Name)
+		}
+	}
+	if col := opts.ContentHashColumn; col != "" {
+		if _, ok := cols[col]; !ok {
+			return mismatch("content hash column %q is missing", col)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package postgresql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckExistingTable(t *testing.T) {
+	opts := VectorstoreTableOptions{
+		TableName:                  "documents",
+		SchemaName:                 "public",
+		VectorSize:                 768,
+		IDColumn:                   Column{Name: "id"},
+		ContentColumnName:          "content",
+		ContentColumnType:          TextContent,
+		EmbeddingColumn:            "embedding",
+		MetadataJSONColumn:         "metadata",
+		StoreMetadata:              true,
+		MetadataColumns:            []Column{{Name: "tenant"}},
+		AdditionalEmbeddingColumns: []EmbeddingColumn{{Name: "title_embedding", VectorSize: 256}},
+	}
+	matching := func() map[string]tableColumn {
+		return map[string]tableColumn{
+			"id":              {typeName: "uuid", typmod: -1},
+			"content":         {typeName: "text", typmod: -1},
+			"embedding":       {typeName: "vector", typmod: 768},
+			"title_embedding": {typeName: "vector", typmod: 256},
+			"metadata":        {typeName: "json", typmod: -1},
+			"tenant":          {typeName: "text", typmod: -1},
+		}
+	}
+
+	testCases := []struct {
+		name   string
+		modify func(cols map[string]tableColumn)
+		vt     VectorType
+		want   string
+	}{
+		{name: "matching"},
+		{name: "missing id", modify: func(c map[string]tableColumn) { delete(c, "id") }, want: `id column "id" is missing`},
+		{name: "missing content", modify: func(c map[string]tableColumn) { delete(c, "content") }, want: `content column "content" is missing`},
+		{name: "varchar content", modify: func(c map[string]tableColumn) { c["content"] = tableColumn{typeName: "varchar"} }},
+		{name: "non-text content", modify: func(c map[string]tableColumn) { c["content"] = tableColumn{typeName: "int4"} }, want: "has type int4"},
+		{name: "jsonb content", modify: func(c map[string]tableColumn) { c["content"] = tableColumn{typeName: "jsonb"} }, want: "want text"},
+		{name: "missing embedding", modify: func(c map[string]tableColumn) { delete(c, "embedding") }, want: `embedding column "embedding" is missing`},
+		{name: "embedding dimension", modify: func(c map[string]tableColumn) { c["embedding"] = tableColumn{typeName: "vector", typmod: 1536} }, want: "dimension 1536"},
+		{name: "embedding without dimension", modify: func(c map[string]tableColumn) { c["embedding"] = tableColumn{typeName: "vector", typmod: -1} }, want: `"embedding" has no fixed dimension, which vector indexes require; recreate it as vector(768)`},
+		{name: "embedding type", vt: HalfVec, want: "want halfvec"},
+		{name: "additional embedding dimension", modify: func(c map[string]tableColumn) { c["title_embedding"] = tableColumn{typeName: "vector", typmod: 768} }, want: `"title_embedding" has dimension 768`},
+		{name: "jsonb metadata", modify: func(c map[string]tableColumn) { c["metadata"] = tableColumn{typeName: "jsonb"} }},
+		{name: "non-json metadata", modify: func(c map[string]tableColumn) { c["metadata"] = tableColumn{typeName: "text"} }, want: "want json"},
+		{name: "missing metadata column", modify: func(c map[string]tableColumn) { delete(c, "tenant") }, want: `metadata column "tenant" is missing`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cols := matching()
+			if tc.modify != nil {
+				tc.modify(cols)
+			}
+			vt := tc.vt
+			if vt == "" {
+				vt = Vector
+			}
+			err := checkExistingTable(opts, vt, cols)
+			if tc.want == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.want)
+			}
+		})
+	}
+
+	cols := matching()
+	cols["embedding"] = tableColumn{typeName: "vector", typmod: 1536}
+	assert.ErrorIs(t, checkExistingTable(opts, Vector, cols), ErrDimensionMismatch)
+}
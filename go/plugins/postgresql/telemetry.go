@@ -0,0 +1,124 @@
+package postgresql
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/firebase/genkit/go/core/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/firebase/genkit/go/plugins/postgresql"
+
+// startSpan starts a span of the retriever or indexer of ds, as a child of
+// the span in ctx. Spans are recorded by the global OpenTelemetry tracer
+// provider, so they are no-ops unless one is configured.
+func (ds *docStore) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append([]attribute.KeyValue{
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.collection.name", ds.config.TableName),
+		attribute.String("db.namespace", ds.config.SchemaName),
+		attribute.String("postgresql.name", ds.observabilityName()),
+	}, attrs...)
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// observabilityName returns the name of the retriever and indexer of ds in
+// spans, metrics and logs. See [Config.ObservabilityName].
+func (ds *docStore) observabilityName() string {
+	return cmp.Or(ds.config.ObservabilityName, ds.config.SchemaName+"."+ds.config.TableName)
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// instruments are the counters of the retrievers and indexers.
+type instruments struct {
+	requests  metric.Int64Counter // retrieve and index requests
+	documents metric.Int64Counter // documents returned or written
+}
+
+// fetchInstruments creates the instruments on first use, so that a meter
+// provider set at startup, such as by the googlecloud plugin, is used. They
+// are recorded by the global OpenTelemetry meter provider, so they are
+// no-ops unless one is configured.
+var fetchInstruments = sync.OnceValue(func() *instruments {
+	meter := otel.Meter(tracerName)
+	requests, err := meter.Int64Counter("postgresql/requests",
+		metric.WithDescription("Number of retrieve and index requests."))
+	if err != nil {
+		slog.Default().Error("postgresql metric initialization failed; no metrics will be collected", "err", err)
+		return nil
+	}
+	documents, err := meter.Int64Counter("postgresql/documents",
+		metric.WithDescription("Number of documents returned by retrieve requests and written by index requests."))
+	if err != nil {
+		slog.Default().Error("postgresql metric initialization failed; no metrics will be collected", "err", err)
+		return nil
+	}
+	return &instruments{requests: requests, documents: documents}
+})
+
+// logSlowRequest logs a warning if a request of the given operation on the
+// table of ds, started at start, took longer than the threshold set with
+// [WithSlowQueryThreshold]. attrs are logged as well, and must not hold
+// query vectors or filter values; neither is err, whose message may.
+func (ds *docStore) logSlowRequest(ctx context.Context, operation string, start time.Time, err error, attrs ...any) {
+	threshold := ds.engine.config.slowThreshold
+	if threshold == 0 {
+		return
+	}
+	d := time.Since(start)
+	if d < threshold {
+		return
+	}
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	attrs = append([]any{
+		"operation", operation,
+		"name", ds.observabilityName(),
+		"schema", ds.config.SchemaName,
+		"table", ds.config.TableName,
+		"duration", d,
+		"outcome", outcome,
+	}, attrs...)
+	logger.FromContext(ctx).Warn("slow postgresql request", attrs...)
+}
+
+// recordRequest counts a request of the given operation, retrieve or index,
+// on the table of ds, and the documents it returned or wrote.
+func (ds *docStore) recordRequest(ctx context.Context, operation string, documents int, err error) {
+	insts := fetchInstruments()
+	if insts == nil {
+		return
+	}
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	attrs := metric.WithAttributes(
+		attribute.String("db.collection.name", ds.config.TableName),
+		attribute.String("db.namespace", ds.config.SchemaName),
+		attribute.String("postgresql.name", ds.observabilityName()),
+		attribute.String("operation", operation),
+		attribute.String("outcome", outcome))
+	insts.requests.Add(ctx, 1, attrs)
+	if documents > 0 {
+		insts.documents.Add(ctx, int64(documents), attrs)
+	}
+}
@@ -0,0 +1,97 @@
+package postgresql
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRetrieveSpan(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	defer otel.SetTracerProvider(prev)
+
+	ds := testDocStore()
+	_, err := ds.Retrieve(context.Background(), &ai.RetrieverRequest{})
+	assert.Error(t, err)
+
+	spans := rec.Ended()
+	if assert.Len(t, spans, 1) {
+		span := spans[0]
+		assert.Equal(t, "postgresql.retrieve", span.Name())
+		assert.Equal(t, codes.Error, span.Status().Code)
+		assert.Contains(t, span.Attributes(), attribute.String("db.collection.name", "documents"))
+		assert.Contains(t, span.Attributes(), attribute.String("postgresql.distance_strategy", "cosine"))
+		assert.Contains(t, span.Attributes(), attribute.String("postgresql.name", "public.documents"))
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	prev := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	defer otel.SetMeterProvider(prev)
+
+	ds := testDocStore()
+	ds.config.ObservabilityName = "support-docs"
+	ds.recordRequest(context.Background(), "index", 3, nil)
+	ds.recordRequest(context.Background(), "retrieve", 0, errors.New("boom"))
+
+	var rm metricdata.ResourceMetrics
+	assert.NoError(t, reader.Collect(context.Background(), &rm))
+	sums := map[string]map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				name, _ := dp.Attributes.Value("postgresql.name")
+				assert.Equal(t, "support-docs", name.AsString())
+				op, _ := dp.Attributes.Value("operation")
+				outcome, _ := dp.Attributes.Value("outcome")
+				if sums[m.Name] == nil {
+					sums[m.Name] = map[string]int64{}
+				}
+				sums[m.Name][op.AsString()+"/"+outcome.AsString()] += dp.Value
+			}
+		}
+	}
+	assert.Equal(t, map[string]int64{"index/success": 1, "retrieve/failure": 1}, sums["postgresql/requests"])
+	assert.Equal(t, map[string]int64{"index/success": 3}, sums["postgresql/documents"])
+}
+
+func TestWrittenCount(t *testing.T) {
+	assert.Equal(t, 2, writtenCount([]IndexResult{{Status: IndexInserted}, {Status: IndexSkipped}, {Status: IndexUpdated}}))
+}
+
+func TestLogSlowRequest(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	ds := testDocStore()
+	ds.logSlowRequest(context.Background(), "retrieve", time.Now().Add(-time.Hour), nil, "k", 4)
+	assert.Empty(t, buf.String(), "logged without a threshold")
+
+	ds.engine.config.slowThreshold = time.Minute
+	ds.logSlowRequest(context.Background(), "retrieve", time.Now(), nil, "k", 4)
+	assert.Empty(t, buf.String(), "logged a fast request")
+
+	ds.logSlowRequest(context.Background(), "retrieve", time.Now().Add(-time.Hour), errors.New("filter on key \"tenant\": secret"), "k", 4)
+	out := buf.String()
+	assert.Contains(t, out, `level=WARN msg="slow postgresql request" operation=retrieve name=public.documents schema=public table=documents duration=1h`)
+	assert.Contains(t, out, "outcome=failure k=4")
+	assert.NotContains(t, out, "secret")
+}
@@ -0,0 +1,71 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The placeholders of [Config.QueryTemplate].
+const (
+	templateVector  = "{vector}"
+	templateK       = "{k}"
+	templateFilter  = "{filter}"
+	templateColumns = "{columns}"
+	templateTable   = "{table}"
+)
+
+// validateQueryTemplate checks that a query template, if set, contains the
+// required placeholders.
+func validateQueryTemplate(tmpl string) error {
+	if tmpl == "" {
+		return nil
+	}
+	for _, p := range []string{templateVector, templateK, templateFilter} {
+		if !strings.Contains(tmpl, p) {
+			return fmt.Errorf("query template must contain the %s placeholder", p)
+		}
+	}
+	return nil
+}
+
+// buildTemplateQuery returns the query of the template of ds for vec,
+// fetching k rows, and its arguments. The query vector is bound to $1.
+func (ds *docStore) buildTemplateQuery(vec []float32, k int, opts *RetrieverOptions) (string, []any, error) {
+	if opts.MMR != nil || opts.Hybrid != nil || opts.After != nil || opts.GroupBy != nil || opts.ReturnEmbedding ||
+		opts.MinDistance != nil || opts.MaxDistance != nil {
+		return "", nil, errors.New("query templates cannot be combined with MMR, hybrid retrieval, pagination, grouping, returned embeddings or distance bounds")
+	}
+	queryVec, err := newVector(vec)
+	if err != nil {
+		return "", nil, fmt.Errorf("query %w", err)
+	}
+	args := &queryArgs{}
+	// Always cast, as templates may use the vector where its type cannot be
+	// inferred, such as in the select list of a CTE.
+	vecParam := fmt.Sprintf("%s::%s", args.add(ds.engine.vectorArg(queryVec)), ds.engine.vectorType())
+	column, err := ds.searchColumn(opts)
+	if err != nil {
+		return "", nil, err
+	}
+	where, err := ds.retrieveWhere(column, opts, args)
+	if err != nil {
+		return "", nil, err
+	}
+	if where == "" {
+		where = "TRUE"
+	}
+	columns, err := ds.selectList("", opts, args)
+	if err != nil {
+		return "", nil, err
+	}
+	r := strings.NewReplacer(
+		templateVector, vecParam,
+		templateK, strconv.Itoa(k),
+		templateFilter, "("+where+")",
+		templateColumns, strings.Join(columns, ", "),
+		templateTable, qualifiedName(ds.config.SchemaName, ds.config.TableName),
+	)
+	return r.Replace(ds.config.QueryTemplate), args.args, nil
+}
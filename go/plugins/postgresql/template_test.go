@@ -0,0 +1,69 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+const testQueryTemplate = `SELECT {columns}, d."embedding" <=> {vector} AS distance FROM {table} d` +
+	` JOIN "public"."acl" a ON a."doc_id" = d."id" WHERE a."user_id" = current_user AND {filter} ORDER BY distance LIMIT {k}`
+
+func TestValidateQueryTemplate(t *testing.T) {
+	assert.NoError(t, validateQueryTemplate(""))
+	assert.NoError(t, validateQueryTemplate(testQueryTemplate))
+	assert.ErrorContains(t, validateQueryTemplate(`SELECT {columns} FROM {table} WHERE {filter} LIMIT {k}`), "{vector}")
+	assert.ErrorContains(t, validateQueryTemplate(`SELECT {vector} WHERE {filter}`), "{k}")
+	assert.ErrorContains(t, validateQueryTemplate(`SELECT {vector} LIMIT {k}`), "{filter}")
+}
+
+func TestBuildTemplateQuery(t *testing.T) {
+	ds := testDocStore()
+	ds.config.QueryTemplate = testQueryTemplate
+	query, args, err := ds.buildTemplateQuery([]float32{1, 2}, 3, &RetrieverOptions{
+		Filters: []Filter{{Key: "lang", Value: "en"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", d."embedding" <=> $1::vector AS distance FROM "public"."documents" d`+
+		` JOIN "public"."acl" a ON a."doc_id" = d."id" WHERE a."user_id" = current_user AND ("metadata"->>$2 = $3) ORDER BY distance LIMIT 3`, query)
+	assert.Equal(t, []any{"lang", "en"}, args[1:])
+
+	// Without filters, the filter is TRUE.
+	query, _, err = ds.buildTemplateQuery([]float32{1, 2}, 3, &RetrieverOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, query, "AND (TRUE) ORDER BY")
+
+	for _, opts := range []*RetrieverOptions{
+		{MMR: &MMROptions{Lambda: 0.5}},
+		{After: &Cursor{Key: "doc-1"}},
+		{GroupBy: &GroupOptions{Key: "source"}},
+		{ReturnEmbedding: true},
+	} {
+		_, _, err := ds.buildTemplateQuery([]float32{1, 2}, 3, opts)
+		assert.Error(t, err, "%+v", opts)
+	}
+}
+
+func TestPrepareRetrievalQueryTemplate(t *testing.T) {
+	ds := testDocStore()
+	ds.config.Embedder = &fakeEmbedder{}
+	ds.config.QueryTemplate = testQueryTemplate
+	r, err := ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{Query: ai.DocumentFromText("3", nil)}, true)
+	assert.NoError(t, err)
+	assert.Contains(t, r.query, `JOIN "public"."acl"`)
+	_, err = ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{
+		Query:   ai.DocumentFromText("3", nil),
+		Options: &RetrieverOptions{Hybrid: &HybridOptions{}},
+	}, true)
+	assert.ErrorContains(t, err, "query template")
+
+	// Lookups and batches would bypass the template.
+	_, err = ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{
+		Options: &RetrieverOptions{Filters: []Filter{{Key: "lang", Value: "en"}}},
+	}, true)
+	assert.ErrorContains(t, err, "query template")
+	_, _, err = ds.buildBatchQuery(context.Background(), [][]float32{{1, 2}}, &RetrieverOptions{})
+	assert.ErrorContains(t, err, "query template")
+}
@@ -0,0 +1,99 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TextSearchOptions configures the full-text retrieval of
+// [Config.TextSearch]. Documents match the query parsed with
+// websearch_to_tsquery and are ranked by ts_rank_cd, most relevant first.
+// Their [ScoreMetadataKey] metadata is that rank, and their
+// [DistanceMetadataKey] metadata its negation, so that results are ordered
+// by ascending distance as with vector retrieval, and [NextCursor] and
+// [RetrieverOptions.After] page through them the same way.
+//
+// The retriever supports filters, pagination, lookups by filters, score
+// thresholds, distance bounds, metadata keys and reranking, but not MMR,
+// hybrid retrieval, grouping or options that concern embeddings.
+type TextSearchOptions struct {
+	// TSVectorColumn is a tsvector column holding the lexemes of each
+	// document. If empty, they are computed on the fly from TextColumn,
+	// which an expression index on to_tsvector can serve.
+	TSVectorColumn string
+	// TextColumn is the column the lexemes are computed from when
+	// TSVectorColumn is empty. The default is the content column.
+	TextColumn string
+	// Language is the text search configuration. The default is "english".
+	Language string
+}
+
+// withDefaults returns a copy of o with the defaults applied for a table
+// whose content column is contentColumn.
+func (o TextSearchOptions) withDefaults(contentColumn string) TextSearchOptions {
+	if o.TSVectorColumn == "" && o.TextColumn == "" {
+		o.TextColumn = contentColumn
+	}
+	if o.Language == "" {
+		o.Language = "english"
+	}
+	return o
+}
+
+// buildTextSearchQuery returns the full-text search query for text and its
+// arguments. The rows have the same shape as those of buildRetrieveQuery,
+// with the negated rank as distance, and are ordered by it and then by the
+// tiebreaker column.
+func (ds *docStore) buildTextSearchQuery(text string, k int, opts *RetrieverOptions) (string, []any, error) {
+	if opts.MMR != nil || opts.Hybrid != nil || opts.GroupBy != nil || opts.MultiVector != nil {
+		return "", nil, errors.New("text search cannot be combined with MMR, hybrid retrieval, grouping or multi-vector retrieval")
+	}
+	if opts.ReturnEmbedding || opts.QueryEmbedding != nil || opts.EmbeddingColumn != "" || opts.Embedder != "" {
+		return "", nil, errors.New("text search does not use embeddings")
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", nil, errors.New("text search requires a query")
+	}
+	ts := ds.config.TextSearch
+	args := &queryArgs{}
+	where, err := ds.retrieveWhere(ds.config.EmbeddingColumn, opts, args)
+	if err != nil {
+		return "", nil, err
+	}
+	langParam := args.add(ts.Language)
+	tsvector := fmt.Sprintf(`"%s"`, ts.TSVectorColumn)
+	if ts.TSVectorColumn == "" {
+		tsvector = fmt.Sprintf(`to_tsvector(%s::regconfig, "%s")`, langParam, ts.TextColumn)
+	}
+	// ts_rank_cd returns a real, which would not be read as a distance.
+	distance := fmt.Sprintf(`-ts_rank_cd(%s, text_query)::float8`, tsvector)
+	conds := []string{tsvector + " @@ text_query"}
+	if where != "" {
+		conds = append(conds, where)
+	}
+	if opts.After != nil {
+		after, err := ds.afterPredicate(distance, opts.After, args)
+		if err != nil {
+			return "", nil, err
+		}
+		conds = append(conds, after)
+	}
+	bounds, err := distanceBounds(distance, opts, args)
+	if err != nil {
+		return "", nil, err
+	}
+	if bounds != "" {
+		conds = append(conds, bounds)
+	}
+
+	cols, err := ds.selectList("", opts, args)
+	if err != nil {
+		return "", nil, err
+	}
+	cols = append(cols, distance+" AS distance")
+	query := fmt.Sprintf(`SELECT %s FROM %s, websearch_to_tsquery(%s::regconfig, %s) AS text_query WHERE %s ORDER BY distance, "%s" LIMIT %d`,
+		strings.Join(cols, ", "), qualifiedName(ds.config.SchemaName, ds.config.TableName),
+		langParam, args.add(text), strings.Join(conds, " AND "), ds.config.TiebreakerColumn, k)
+	return query, args.args, nil
+}
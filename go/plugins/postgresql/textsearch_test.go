@@ -0,0 +1,86 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+)
+
+func testTextSearchDocStore() *docStore {
+	ds := testDocStore()
+	ts := TextSearchOptions{}.withDefaults(ds.config.ContentColumn)
+	ds.config.TextSearch = &ts
+	ds.config.K = 3
+	return ds
+}
+
+func TestTextSearchOptionsWithDefaults(t *testing.T) {
+	assert.Equal(t, TextSearchOptions{TextColumn: "content", Language: "english"}, TextSearchOptions{}.withDefaults("content"))
+	assert.Equal(t, TextSearchOptions{TSVectorColumn: "lexemes", Language: "french"},
+		TextSearchOptions{TSVectorColumn: "lexemes", Language: "french"}.withDefaults("content"))
+}
+
+func TestBuildTextSearchQuery(t *testing.T) {
+	ds := testTextSearchDocStore()
+	query, args, err := ds.buildTextSearchQuery("vector databases", 3, &RetrieverOptions{
+		Filters: []Filter{{Key: "lang", Value: "en"}},
+		After:   &Cursor{Distance: -0.5, Key: "doc-1"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", -ts_rank_cd(to_tsvector($3::regconfig, "content"), text_query)::float8 AS distance`+
+		` FROM "public"."documents", websearch_to_tsquery($3::regconfig, $6) AS text_query`+
+		` WHERE to_tsvector($3::regconfig, "content") @@ text_query AND "metadata"->>$1 = $2`+
+		` AND (-ts_rank_cd(to_tsvector($3::regconfig, "content"), text_query)::float8, "id") > ($4::float8, $5) ORDER BY distance, "id" LIMIT 3`, query)
+	assert.Equal(t, []any{"lang", "en", "english", -0.5, "doc-1", "vector databases"}, args)
+
+	ds.config.TextSearch.TSVectorColumn = "lexemes"
+	query, _, err = ds.buildTextSearchQuery("vector databases", 3, &RetrieverOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "content", "metadata", "source", -ts_rank_cd("lexemes", text_query)::float8 AS distance`+
+		` FROM "public"."documents", websearch_to_tsquery($1::regconfig, $2) AS text_query WHERE "lexemes" @@ text_query ORDER BY distance, "id" LIMIT 3`, query)
+
+	for _, opts := range []*RetrieverOptions{
+		{MMR: &MMROptions{Lambda: 0.5}},
+		{Hybrid: &HybridOptions{Query: "chunks"}},
+		{GroupBy: &GroupOptions{Key: "source"}},
+		{ReturnEmbedding: true},
+		{QueryEmbedding: []float32{1, 2}},
+	} {
+		_, _, err := ds.buildTextSearchQuery("vector databases", 3, opts)
+		assert.Error(t, err, "%+v", opts)
+	}
+	_, _, err = ds.buildTextSearchQuery(" ", 3, &RetrieverOptions{})
+	assert.Error(t, err)
+}
+
+func TestPrepareRetrievalTextSearch(t *testing.T) {
+	// No embedder is needed.
+	ds := testTextSearchDocStore()
+	r, err := ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{Query: ai.DocumentFromText("vector databases", nil)}, true)
+	assert.NoError(t, err)
+	assert.Contains(t, r.query, "websearch_to_tsquery")
+	assert.Equal(t, []any{"english", "vector databases"}, r.args)
+
+	// Filters without a query are still lookups.
+	r, err = ds.prepareRetrieval(context.Background(), &ai.RetrieverRequest{
+		Options: &RetrieverOptions{Filters: []Filter{{Key: "lang", Value: "en"}}},
+	}, true)
+	assert.NoError(t, err)
+	assert.Contains(t, r.query, "NULL::float8 AS distance")
+
+	_, _, err = ds.buildBatchQuery(context.Background(), [][]float32{{1, 2}}, &RetrieverOptions{})
+	assert.Error(t, err)
+}
+
+func TestTextSearchScore(t *testing.T) {
+	ds := testTextSearchDocStore()
+	assert.Equal(t, 0.25, ds.score(-0.25))
+	threshold := float32(0.3)
+	assert.False(t, ds.meetsThreshold([]any{"doc-1", "text", nil, nil, -0.25}, &threshold))
+	assert.True(t, ds.meetsThreshold([]any{"doc-1", "text", nil, nil, -0.5}, &threshold))
+
+	_, err := embedWith(context.Background(), nil, nil, []*ai.Document{ai.DocumentFromText("text", nil)})
+	assert.Error(t, err)
+}
@@ -0,0 +1,55 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrQueryTimeout is wrapped by the errors of queries canceled because they
+// exceeded the timeout set with [WithQueryTimeout].
+var ErrQueryTimeout = errors.New("query timeout exceeded")
+
+// ErrFallbackTimeout is wrapped by the errors of queries canceled because
+// their operation exceeded the timeout set with
+// [WithContextTimeoutFallback], applied when the caller's context has no
+// deadline.
+var ErrFallbackTimeout = errors.New("fallback timeout exceeded")
+
+// withFallbackTimeout returns a context for a retrieve or index operation,
+// bounded by the fallback timeout of the engine if one is set and ctx has no
+// deadline. Existing deadlines are kept, even if later.
+func (pgEngine *PostgresEngine) withFallbackTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if pgEngine.config.fallbackTimeout <= 0 {
+		return ctx, func() {}
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, pgEngine.config.fallbackTimeout, ErrFallbackTimeout)
+}
+
+// withQueryTimeout returns a context for a single query, bounded by the
+// query timeout of the engine if one is set.
+func (pgEngine *PostgresEngine) withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if pgEngine.config.queryTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, pgEngine.config.queryTimeout, ErrQueryTimeout)
+}
+
+// queryTimeoutError wraps err with [ErrQueryTimeout] if the query context
+// ctx was canceled by the query timeout, or with [ErrFallbackTimeout] if it
+// was canceled by the fallback timeout of its operation.
+func queryTimeoutError(ctx context.Context, err error) error {
+	if err == nil {
+		return err
+	}
+	cause := context.Cause(ctx)
+	for _, timeout := range []error{ErrQueryTimeout, ErrFallbackTimeout} {
+		if errors.Is(cause, timeout) {
+			return fmt.Errorf("%w: %w", timeout, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithQueryTimeout(t *testing.T) {
+	pgEngine := &PostgresEngine{}
+	ctx, cancel := pgEngine.withQueryTimeout(context.Background())
+	defer cancel()
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+
+	pgEngine.config.queryTimeout = time.Millisecond
+	ctx, cancel = pgEngine.withQueryTimeout(context.Background())
+	defer cancel()
+	<-ctx.Done()
+	err := queryTimeoutError(ctx, ctx.Err())
+	assert.ErrorIs(t, err, ErrQueryTimeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestQueryTimeoutErrorParentDeadline(t *testing.T) {
+	pgEngine := &PostgresEngine{config: engineConfig{queryTimeout: time.Hour}}
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel := pgEngine.withQueryTimeout(parent)
+	defer cancel()
+	cancelParent()
+	err := queryTimeoutError(ctx, ctx.Err())
+	assert.False(t, errors.Is(err, ErrQueryTimeout))
+	assert.ErrorIs(t, err, context.Canceled)
+
+	assert.NoError(t, queryTimeoutError(ctx, nil))
+}
+
+func TestWithFallbackTimeout(t *testing.T) {
+	pgEngine := &PostgresEngine{}
+	ctx, cancel := pgEngine.withFallbackTimeout(context.Background())
+	defer cancel()
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+
+	// A caller deadline is kept, even if later than the fallback.
+	pgEngine.config.fallbackTimeout = time.Millisecond
+	parent, cancelParent := context.WithTimeout(context.Background(), time.Hour)
+	defer cancelParent()
+	want, _ := parent.Deadline()
+	ctx, cancel = pgEngine.withFallbackTimeout(parent)
+	defer cancel()
+	got, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.Equal(t, want, got)
+
+	ctx, cancel = pgEngine.withFallbackTimeout(context.Background())
+	defer cancel()
+	// Queries run in contexts derived from that of the operation.
+	qctx, cancelQuery := pgEngine.withQueryTimeout(ctx)
+	defer cancelQuery()
+	<-qctx.Done()
+	err := queryTimeoutError(qctx, qctx.Err())
+	assert.ErrorIs(t, err, ErrFallbackTimeout)
+	assert.False(t, errors.Is(err, ErrQueryTimeout))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
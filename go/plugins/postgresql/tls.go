@@ -0,0 +1,162 @@
+package postgresql
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// sslModes are the sslmode values understood by PostgreSQL clients.
+var sslModes = map[string]bool{
+	"disable":     true,
+	"allow":       true,
+	"prefer":      true,
+	"require":     true,
+	"verify-ca":   true,
+	"verify-full": true,
+}
+
+// sslSettings holds the TLS options of the engine, with the certificate files
+// already loaded.
+type sslSettings struct {
+	mode    string
+	rootCAs *x509.CertPool
+	certs   []tls.Certificate
+}
+
+// hasSSL reports whether any of the TLS options were set.
+func (cfg *engineConfig) hasSSL() bool {
+	return cfg.sslMode != "" || cfg.sslRootCert != "" || cfg.sslCert != "" || cfg.sslKey != ""
+}
+
+// loadSSLSettings validates the TLS options of cfg and loads the certificate
+// files they name. The mode defaults to verify-full when only certificates are
+// given.
+func loadSSLSettings(cfg *engineConfig) (*sslSettings, error) {
+	s := &sslSettings{mode: cfg.sslMode}
+	if s.mode == "" {
+		s.mode = "verify-full"
+	}
+	if !sslModes[s.mode] {
+		return nil, fmt.Errorf("invalid ssl mode %q: must be one of disable, allow, prefer, require, verify-ca or verify-full", s.mode)
+	}
+	if cfg.sslRootCert != "" {
+		pem, err := os.ReadFile(cfg.sslRootCert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ssl root certificate: %w", err)
+		}
+		s.rootCAs = x509.NewCertPool()
+		if !s.rootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ssl root certificate %q contains no PEM certificates", cfg.sslRootCert)
+		}
+	}
+	if (cfg.sslCert == "") != (cfg.sslKey == "") {
+		return nil, errors.New("ssl client certificate and key must be provided together")
+	}
+	if cfg.sslCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.sslCert, cfg.sslKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load ssl client certificate %q and key %q: %w", cfg.sslCert, cfg.sslKey, err)
+		}
+		s.certs = []tls.Certificate{cert}
+	}
+	return s, nil
+}
+
+// apply replaces the TLS configuration of cc, and of its fallbacks, with the
+// one described by s. As in libpq, the allow and prefer modes try a second
+// connection with and without TLS respectively.
+func (s *sslSettings) apply(cc *pgconn.Config) {
+	type host struct {
+		name string
+		port uint16
+	}
+	hosts := []host{{cc.Host, cc.Port}}
+	seen := map[host]bool{hosts[0]: true}
+	for _, fb := range cc.Fallbacks {
+		h := host{fb.Host, fb.Port}
+		if !seen[h] {
+			seen[h] = true
+			hosts = append(hosts, h)
+		}
+	}
+
+	var configs []*pgconn.FallbackConfig
+	for _, h := range hosts {
+		for _, tlsConfig := range s.tlsConfigs(h.name) {
+			configs = append(configs, &pgconn.FallbackConfig{Host: h.name, Port: h.port, TLSConfig: tlsConfig})
+		}
+	}
+	cc.Host, cc.Port, cc.TLSConfig = configs[0].Host, configs[0].Port, configs[0].TLSConfig
+	cc.Fallbacks = configs[1:]
+}
+
+// tlsConfigs returns the TLS configurations to try, in order, for host. A nil
+// configuration means a connection without TLS.
+func (s *sslSettings) tlsConfigs(host string) []*tls.Config {
+	switch s.mode {
+	case "disable":
+		return []*tls.Config{nil}
+	case "allow":
+		return []*tls.Config{nil, s.tlsConfig(host)}
+	case "prefer":
+		return []*tls.Config{s.tlsConfig(host), nil}
+	default:
+		return []*tls.Config{s.tlsConfig(host)}
+	}
+}
+
+// tlsConfig returns the TLS configuration for host.
+func (s *sslSettings) tlsConfig(host string) *tls.Config {
+	c := &tls.Config{
+		RootCAs:      s.rootCAs,
+		Certificates: s.certs,
+	}
+	mode := s.mode
+	if mode == "require" && s.rootCAs != nil {
+		// A root certificate makes require behave as verify-ca, as in libpq.
+		mode = "verify-ca"
+	}
+	switch mode {
+	case "verify-full":
+		c.ServerName = host
+	case "verify-ca":
+		// Verify the chain but not the host name.
+		c.InsecureSkipVerify = true
+		c.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyChain(rawCerts, s.rootCAs)
+		}
+	default:
+		c.InsecureSkipVerify = true
+	}
+	return c
+}
+
+// verifyChain verifies the certificate chain presented by the server against
+// roots, or the system roots when roots is nil.
+func verifyChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return errors.New("server presented no certificate")
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("failed to parse server certificate: %w", err)
+		}
+		certs[i] = cert
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(opts)
+	return err
+}
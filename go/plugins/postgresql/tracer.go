@@ -0,0 +1,115 @@
+package postgresql
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// redactedValue replaces credentials in the data passed to tracers.
+const redactedValue = "[redacted]"
+
+// redactingTracer forwards the trace events of the pool to a user tracer,
+// for every optional pgx and pgxpool tracer interface it implements. The
+// connection settings passed to TraceConnectStart have the user name and
+// password redacted, as the user is the IAM principal when IAM database
+// authentication is used.
+type redactingTracer struct {
+	pgx.QueryTracer
+}
+
+var (
+	_ pgx.BatchTracer       = redactingTracer{}
+	_ pgx.CopyFromTracer    = redactingTracer{}
+	_ pgx.PrepareTracer     = redactingTracer{}
+	_ pgx.ConnectTracer     = redactingTracer{}
+	_ pgxpool.AcquireTracer = redactingTracer{}
+	_ pgxpool.ReleaseTracer = redactingTracer{}
+)
+
+func (t redactingTracer) TraceBatchStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	if bt, ok := t.QueryTracer.(pgx.BatchTracer); ok {
+		return bt.TraceBatchStart(ctx, conn, data)
+	}
+	return ctx
+}
+
+func (t redactingTracer) TraceBatchQuery(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchQueryData) {
+	if bt, ok := t.QueryTracer.(pgx.BatchTracer); ok {
+		bt.TraceBatchQuery(ctx, conn, data)
+	}
+}
+
+func (t redactingTracer) TraceBatchEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchEndData) {
+	if bt, ok := t.QueryTracer.(pgx.BatchTracer); ok {
+		bt.TraceBatchEnd(ctx, conn, data)
+	}
+}
+
+func (t redactingTracer) TraceCopyFromStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	if ct, ok := t.QueryTracer.(pgx.CopyFromTracer); ok {
+		return ct.TraceCopyFromStart(ctx, conn, data)
+	}
+	return ctx
+}
+
+func (t redactingTracer) TraceCopyFromEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	if ct, ok := t.QueryTracer.(pgx.CopyFromTracer); ok {
+		ct.TraceCopyFromEnd(ctx, conn, data)
+	}
+}
+
+func (t redactingTracer) TracePrepareStart(ctx context.Context, conn *pgx.Conn, data pgx.TracePrepareStartData) context.Context {
+	if pt, ok := t.QueryTracer.(pgx.PrepareTracer); ok {
+		return pt.TracePrepareStart(ctx, conn, data)
+	}
+	return ctx
+}
+
+func (t redactingTracer) TracePrepareEnd(ctx context.Context, conn *pgx.Conn, data pgx.TracePrepareEndData) {
+	if pt, ok := t.QueryTracer.(pgx.PrepareTracer); ok {
+		pt.TracePrepareEnd(ctx, conn, data)
+	}
+}
+
+func (t redactingTracer) TraceConnectStart(ctx context.Context, data pgx.TraceConnectStartData) context.Context {
+	ct, ok := t.QueryTracer.(pgx.ConnectTracer)
+	if !ok {
+		return ctx
+	}
+	if data.ConnConfig != nil {
+		cc := data.ConnConfig.Copy()
+		cc.User = redactedValue
+		if cc.Password != "" {
+			cc.Password = redactedValue
+		}
+		data.ConnConfig = cc
+	}
+	return ct.TraceConnectStart(ctx, data)
+}
+
+func (t redactingTracer) TraceConnectEnd(ctx context.Context, data pgx.TraceConnectEndData) {
+	if ct, ok := t.QueryTracer.(pgx.ConnectTracer); ok {
+		ct.TraceConnectEnd(ctx, data)
+	}
+}
+
+func (t redactingTracer) TraceAcquireStart(ctx context.Context, pool *pgxpool.Pool, data pgxpool.TraceAcquireStartData) context.Context {
+	if at, ok := t.QueryTracer.(pgxpool.AcquireTracer); ok {
+		return at.TraceAcquireStart(ctx, pool, data)
+	}
+	return ctx
+}
+
+func (t redactingTracer) TraceAcquireEnd(ctx context.Context, pool *pgxpool.Pool, data pgxpool.TraceAcquireEndData) {
+	if at, ok := t.QueryTracer.(pgxpool.AcquireTracer); ok {
+		at.TraceAcquireEnd(ctx, pool, data)
+	}
+}
+
+func (t redactingTracer) TraceRelease(pool *pgxpool.Pool, data pgxpool.TraceReleaseData) {
+	if rt, ok := t.QueryTracer.(pgxpool.ReleaseTracer); ok {
+		rt.TraceRelease(pool, data)
+	}
+}
@@ -0,0 +1,59 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingTracer struct {
+	queries []string
+	connect *pgx.ConnConfig
+}
+
+func (r *recordingTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	r.queries = append(r.queries, data.SQL)
+	return ctx
+}
+
+func (r *recordingTracer) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
+
+func (r *recordingTracer) TraceConnectStart(ctx context.Context, data pgx.TraceConnectStartData) context.Context {
+	r.connect = data.ConnConfig
+	return ctx
+}
+
+func (r *recordingTracer) TraceConnectEnd(context.Context, pgx.TraceConnectEndData) {}
+
+func TestRedactingTracer(t *testing.T) {
+	rec := &recordingTracer{}
+	tracer := redactingTracer{rec}
+
+	tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	assert.Equal(t, []string{"SELECT 1"}, rec.queries)
+
+	cc, err := pgx.ParseConfig("postgres://worker@my-project.iam:secret@localhost/testdb")
+	assert.NoError(t, err)
+	tracer.TraceConnectStart(context.Background(), pgx.TraceConnectStartData{ConnConfig: cc})
+	assert.Equal(t, redactedValue, rec.connect.User)
+	assert.Equal(t, redactedValue, rec.connect.Password)
+	assert.Equal(t, "testdb", rec.connect.Database)
+	// The settings used to connect are left untouched.
+	assert.Equal(t, "secret", cc.Password)
+
+	// Events the tracer does not handle are ignored.
+	ctx := context.Background()
+	assert.Equal(t, ctx, tracer.TraceBatchStart(ctx, nil, pgx.TraceBatchStartData{}))
+	tracer.TraceRelease(nil, pgxpool.TraceReleaseData{})
+}
+
+func TestApplyEngineOptionsTracer(t *testing.T) {
+	rec := &recordingTracer{}
+	_, err := applyEngineOptions([]Option{WithConnectionString("postgres://localhost/testdb"), WithTracer(rec)})
+	assert.NoError(t, err)
+	_, err = applyEngineOptions([]Option{WithPool(&pgxpool.Pool{}), WithDatabase("testdb"), WithTracer(rec)})
+	assert.Error(t, err)
+}
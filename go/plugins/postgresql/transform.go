@@ -0,0 +1,31 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// ResultTransform post-processes the documents returned by a retrieval, such
+// as to redact personal data from their content or to rewrite their
+// metadata, and returns the documents to return in their place. It may
+// modify docs and their documents.
+type ResultTransform func(ctx context.Context, docs []*ai.Document) ([]*ai.Document, error)
+
+// transformResult applies the result transform of the engine, if any, to
+// docs.
+func (pgEngine *PostgresEngine) transformResult(ctx context.Context, docs []*ai.Document) ([]*ai.Document, error) {
+	f := pgEngine.config.resultTransform
+	if f == nil {
+		return docs, nil
+	}
+	docs, err := f(ctx, docs)
+	if err != nil {
+		return nil, fmt.Errorf("result transform failed: %w", err)
+	}
+	if docs == nil {
+		docs = []*ai.Document{}
+	}
+	return docs, nil
+}
@@ -0,0 +1,46 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransformResult(t *testing.T) {
+	docs := []*ai.Document{ai.DocumentFromText("call 555-0100", map[string]any{}), ai.DocumentFromText("no phone", map[string]any{})}
+	pgEngine := &PostgresEngine{}
+	got, err := pgEngine.transformResult(context.Background(), docs)
+	require.NoError(t, err)
+	assert.Equal(t, docs, got)
+
+	pgEngine.config.resultTransform = func(ctx context.Context, docs []*ai.Document) ([]*ai.Document, error) {
+		for _, doc := range docs {
+			doc.Content = []*ai.Part{ai.NewTextPart(strings.ReplaceAll(doc.Content[0].Text, "555-0100", "[redacted]"))}
+			doc.Metadata["redacted"] = true
+		}
+		return docs, nil
+	}
+	got, err = pgEngine.transformResult(context.Background(), docs)
+	require.NoError(t, err)
+	assert.Equal(t, "call [redacted]", got[0].Content[0].Text)
+	assert.Equal(t, true, got[1].Metadata["redacted"])
+
+	pgEngine.config.resultTransform = func(context.Context, []*ai.Document) ([]*ai.Document, error) {
+		return nil, nil
+	}
+	got, err = pgEngine.transformResult(context.Background(), docs)
+	require.NoError(t, err)
+	assert.NotNil(t, got)
+	assert.Empty(t, got)
+
+	pgEngine.config.resultTransform = func(context.Context, []*ai.Document) ([]*ai.Document, error) {
+		return nil, errors.New("classifier unavailable")
+	}
+	_, err = pgEngine.transformResult(context.Background(), docs)
+	assert.ErrorContains(t, err, "result transform failed: classifier unavailable")
+}
@@ -0,0 +1,68 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// UpdateMetadata merges patch into the JSON metadata of the documents of a
+// table matching all of filters, of which one is required, as in
+// [RetrieverOptions.Filters], and returns the number of updated rows; their
+// content, embeddings and soft-deleted rows are left unchanged. It sets the
+// column of [WithUpdatedAtColumn], checks patch against
+// [WithMetadataSchema], and is a no-op if patch is empty.
+func (pgEngine *PostgresEngine) UpdateMetadata(ctx context.Context, tableName string, filters []Filter, patch map[string]any) (int64, error) {
+	if err := pgEngine.checkWrite("update metadata"); err != nil {
+		return 0, err
+	}
+	if len(filters) == 0 {
+		return 0, errors.New("at least one filter is required")
+	}
+	if len(patch) == 0 {
+		return 0, nil
+	}
+	if _, ok := patch[pgEngine.idColumn()]; ok {
+		return 0, fmt.Errorf("the id key %q cannot be patched", pgEngine.idColumn())
+	}
+	if schema := pgEngine.config.metadataSchema; schema != nil {
+		if err := schema.checkPatch(patch); err != nil {
+			return 0, err
+		}
+	}
+	value, err := json.Marshal(patch)
+	if err != nil {
+		return 0, fmt.Errorf("invalid metadata patch: %w", err)
+	}
+	tableName = pgEngine.tableName(tableName)
+	args := &queryArgs{}
+	patchParam := args.add(string(value))
+	where, _, err := pgEngine.compileTableFilters(ctx, pgEngine.schemaName(), tableName, filters, args)
+	if err != nil {
+		return 0, err
+	}
+	query := pgEngine.updateMetadataStatement(tableName, patchParam, where)
+	qctx, cancel := pgEngine.withQueryTimeout(ctx)
+	defer cancel()
+	n, err := pgEngine.querier().Exec(qctx, query, args.args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update metadata: %w", describeTableError(queryTimeoutError(qctx, err), tableName))
+	}
+	return n, nil
+}
+
+// updateMetadataStatement returns the statement merging the JSON object
+// bound to patchParam into the metadata of the rows of a table that match
+// where and are not soft deleted.
+func (pgEngine *PostgresEngine) updateMetadataStatement(tableName, patchParam, where string) string {
+	col := pgEngine.metadataJSONColumn()
+	if sd := pgEngine.config.softDeleteColumn; sd != "" {
+		where = fmt.Sprintf(`"%s" IS NULL AND %s`, sd, where)
+	}
+	set := fmt.Sprintf(`"%s" = COALESCE("%s"::jsonb, '{}'::jsonb) || %s::jsonb`, col, col, patchParam)
+	if ua := pgEngine.config.updatedAtColumn; ua != "" {
+		set += fmt.Sprintf(`, "%s" = now()`, ua)
+	}
+	return fmt.Sprintf(`UPDATE %s SET %s WHERE %s`, qualifiedName(pgEngine.schemaName(), tableName), set, where)
+}
@@ -0,0 +1,69 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateMetadataStatement(t *testing.T) {
+	pgEngine := &PostgresEngine{}
+	assert.Equal(t, `UPDATE "public"."docs" SET "metadata" = COALESCE("metadata"::jsonb, '{}'::jsonb) || $1::jsonb WHERE "metadata"->>$2 = $3`,
+		pgEngine.updateMetadataStatement("docs", "$1", `"metadata"->>$2 = $3`))
+
+	pgEngine.config.softDeleteColumn = "deleted_at"
+	assert.Equal(t, `UPDATE "public"."docs" SET "metadata" = COALESCE("metadata"::jsonb, '{}'::jsonb) || $1::jsonb WHERE "deleted_at" IS NULL AND "metadata"->>$2 = $3`,
+		pgEngine.updateMetadataStatement("docs", "$1", `"metadata"->>$2 = $3`))
+
+	pgEngine.config.updatedAtColumn = "updated_at"
+	assert.Equal(t, `UPDATE "public"."docs" SET "metadata" = COALESCE("metadata"::jsonb, '{}'::jsonb) || $1::jsonb, "updated_at" = now() WHERE "deleted_at" IS NULL AND "metadata"->>$2 = $3`,
+		pgEngine.updateMetadataStatement("docs", "$1", `"metadata"->>$2 = $3`))
+}
+
+func TestUpdateMetadataErrors(t *testing.T) {
+	cfg, err := applyEngineOptions([]Option{WithPool(&pgxpool.Pool{}), WithDatabase("testdb"), WithMetadataSchema(MetadataSchema{
+		Fields:        []MetadataField{{Key: "tag", Type: MetadataString}, {Key: "review", Type: MetadataBool, Optional: true}},
+		RejectUnknown: true,
+	})})
+	assert.NoError(t, err)
+	pgEngine := &PostgresEngine{config: cfg}
+	ctx := context.Background()
+	filters := []Filter{{Key: "tag", Value: "draft"}}
+
+	n, err := pgEngine.UpdateMetadata(ctx, "docs", filters, nil)
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+
+	for _, tc := range []struct {
+		filters []Filter
+		patch   map[string]any
+		want    string
+	}{
+		{nil, map[string]any{"tag": "final"}, "at least one filter"},
+		{filters, map[string]any{"id": "other"}, `the id key "id" cannot be patched`},
+		{filters, map[string]any{"tag": 1}, "must be of type string"},
+		{filters, map[string]any{"tag": nil}, `key "tag" is null`},
+		{filters, map[string]any{"owner": "bob"}, "not in the metadata schema"},
+		{filters, map[string]any{"review": func() {}}, "must be of type bool"},
+	} {
+		_, err := pgEngine.UpdateMetadata(ctx, "docs", tc.filters, tc.patch)
+		assert.ErrorContains(t, err, tc.want, "%v", tc.patch)
+	}
+	assert.NoError(t, cfg.metadataSchema.checkPatch(map[string]any{"review": nil}))
+}
+
+func TestUpdateMetadataTypedColumn(t *testing.T) {
+	db := &fakeDB{results: map[string]fakeResult{
+		"pg_attribute": catalogResult("id", "text", "content", "text", "embedding", "vector", "metadata", "jsonb", "tenant_id", "text"),
+	}, affected: 4}
+	pgEngine := &PostgresEngine{config: engineConfig{db: db.open(t)}}
+
+	n, err := pgEngine.UpdateMetadata(context.Background(), "documents", []Filter{{Key: "tenant_id", Value: "acme"}}, map[string]any{"tag": "final"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+	query, args := db.statement("UPDATE")
+	assert.Equal(t, `UPDATE "public"."documents" SET "metadata" = COALESCE("metadata"::jsonb, '{}'::jsonb) || $1::jsonb WHERE "tenant_id" = $2`, query)
+	assert.Equal(t, []any{`{"tag":"final"}`, "acme"}, args)
+}
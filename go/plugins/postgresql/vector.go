@@ -0,0 +1,99 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/pgvector/pgvector-go"
+)
+
+// VectorType is the pgvector column type embeddings are stored as.
+type VectorType string
+
+const (
+	// Vector stores embeddings in single precision.
+	Vector VectorType = "vector"
+	// HalfVec stores embeddings in half precision, halving their storage at
+	// a small cost in accuracy. It requires pgvector 0.7.0 or later.
+	HalfVec VectorType = "halfvec"
+)
+
+// validate reports an error if t is not a known vector type.
+func (t VectorType) validate() error {
+	switch t {
+	case Vector, HalfVec:
+		return nil
+	}
+	return fmt.Errorf("unknown vector type %q", t)
+}
+
+// maxIndexableDimensions returns the largest dimension of a column of this
+// type that pgvector supports in HNSW and IVFFlat indexes.
+func (t VectorType) maxIndexableDimensions() int {
+	if t == HalfVec {
+		return maxIndexableHalfVecDimensions
+	}
+	return maxIndexableDimensions
+}
+
+// cast returns the placeholder p cast to this type, so that comparisons
+// with a column of this type use its operators and indexes. Parameters
+// compared with vector columns are inferred as vector and need no cast.
+func (t VectorType) cast(p string) string {
+	if t == Vector {
+		return p
+	}
+	return fmt.Sprintf("%s::%s", p, t)
+}
+
+// formatVector returns the text form of a pgvector value holding vec, with
+// elements rounded to the given number of significant digits, or with the
+// fewest digits that preserve each element exactly if digits is -1.
+func formatVector(vec []float32, digits int) string {
+	buf := make([]byte, 0, 2+len(vec)*(max(digits, 8)+6))
+	buf = append(buf, '[')
+	for i, f := range vec {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendFloat(buf, float64(f), 'g', digits, 32)
+	}
+	return string(append(buf, ']'))
+}
+
+// vectorArg returns the value bound to a vector parameter for vec: vec
+// itself, or its text form with the precision set by [WithVectorPrecision].
+func (pgEngine *PostgresEngine) vectorArg(vec pgvector.Vector) any {
+	if pgEngine.config.vectorDigits == 0 {
+		return vec
+	}
+	return formatVector(vec.Slice(), pgEngine.config.vectorDigits)
+}
+
+// vectorText returns the text form of vec, with the precision set by
+// [WithVectorPrecision].
+func (pgEngine *PostgresEngine) vectorText(vec pgvector.Vector) string {
+	if pgEngine.config.vectorDigits == 0 {
+		return vec.String()
+	}
+	return formatVector(vec.Slice(), pgEngine.config.vectorDigits)
+}
+
+// newVector converts an embedding to a pgvector value. It rejects empty
+// embeddings and elements that are not finite in single precision, which
+// pgvector does not accept.
+func newVector[T float32 | float64](v []T) (pgvector.Vector, error) {
+	if len(v) == 0 {
+		return pgvector.Vector{}, errors.New("embedding is empty")
+	}
+	vec := make([]float32, len(v))
+	for i, f := range v {
+		vec[i] = float32(f)
+		if math.IsNaN(float64(vec[i])) || math.IsInf(float64(vec[i]), 0) {
+			return pgvector.Vector{}, fmt.Errorf("%w: element %d is %v, which is not a finite single-precision value", ErrNonFiniteEmbedding, i, f)
+		}
+	}
+	return pgvector.NewVector(vec), nil
+}
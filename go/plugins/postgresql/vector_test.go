@@ -0,0 +1,70 @@
+package postgresql
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pgvector/pgvector-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVectorTypeValidate(t *testing.T) {
+	assert.NoError(t, Vector.validate())
+	assert.NoError(t, HalfVec.validate())
+	assert.Error(t, VectorType("bit").validate())
+}
+
+func TestHalfVecEngine(t *testing.T) {
+	_, err := applyEngineOptions([]Option{WithPool(&pgxpool.Pool{}), WithDatabase("testdb"), WithVectorType("bit")})
+	assert.Error(t, err)
+
+	cfg, err := applyEngineOptions([]Option{WithPool(&pgxpool.Pool{}), WithDatabase("testdb"), WithVectorType(HalfVec)})
+	assert.NoError(t, err)
+	pgEngine := &PostgresEngine{config: cfg}
+
+	opts := VectorstoreTableOptions{TableName: "documents", VectorSize: 3072}
+	assert.NoError(t, pgEngine.validateVectorstoreTableOptions(&opts))
+	opts = VectorstoreTableOptions{TableName: "documents", VectorSize: 4001}
+	assert.Error(t, pgEngine.validateVectorstoreTableOptions(&opts))
+
+	ds := testDocStore()
+	ds.engine = *pgEngine
+	query, _, err := ds.buildRetrieveQuery([]float32{1, 2}, 4, &RetrieverOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, query, `"embedding" <=> $1::halfvec AS distance`)
+	assert.Contains(t, ds.buildInsertQuery(), `VALUES ($1, $2, $3::halfvec, $4, $5)`)
+
+	q, err := pgEngine.buildIndexQuery("documents", "hnsw", &IndexOptions{}, "m = 16", "")
+	assert.NoError(t, err)
+	assert.Contains(t, q, `("embedding" halfvec_cosine_ops)`)
+}
+
+func TestFormatVector(t *testing.T) {
+	vec := []float32{0.123456789, -1, 1e-7, 3.4e38}
+	assert.Equal(t, "[0.12345679,-1,1e-07,3.4e+38]", formatVector(vec, -1))
+	assert.Equal(t, "[0.1235,-1,1e-07,3.4e+38]", formatVector(vec, 4))
+	assert.Equal(t, "[0.1,-1,1e-07,3e+38]", formatVector(vec, 1))
+
+	// The text form parses back to the same elements at full precision.
+	var parsed pgvector.Vector
+	assert.NoError(t, parsed.Scan(formatVector(vec, -1)))
+	assert.Equal(t, vec, parsed.Slice())
+}
+
+func TestVectorPrecision(t *testing.T) {
+	vec := pgvector.NewVector([]float32{0.123456789, 2})
+	pgEngine := &PostgresEngine{}
+	assert.Equal(t, vec, pgEngine.vectorArg(vec))
+	assert.Equal(t, "[0.12345679,2]", pgEngine.vectorText(vec))
+
+	cfg, err := applyEngineOptions([]Option{WithPool(&pgxpool.Pool{}), WithDatabase("testdb"), WithVectorPrecision(3)})
+	assert.NoError(t, err)
+	pgEngine = &PostgresEngine{config: cfg}
+	assert.Equal(t, "[0.123,2]", pgEngine.vectorArg(vec))
+	assert.Equal(t, "[0.123,2]", pgEngine.vectorText(vec))
+
+	for _, digits := range []int{-1, 10} {
+		_, err := applyEngineOptions([]Option{WithPool(&pgxpool.Pool{}), WithDatabase("testdb"), WithVectorPrecision(digits)})
+		assert.Error(t, err, digits)
+	}
+}
@@ -0,0 +1,160 @@
+package postgresql
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// VectorStoreConfig describes the table of [NewVectorStore].
+type VectorStoreConfig struct {
+	TableName       string      // Name of the table. Required.
+	VectorSize      int         // Dimension of the embeddings. Required.
+	Embedder        ai.Embedder // Embedder to use. Required.
+	EmbedderOptions any         // Options to pass to the embedder.
+	// Table, if set, customizes the table created if it does not exist;
+	// its TableName and VectorSize are taken from the fields above. The
+	// default has the columns of the engine and a JSON metadata column.
+	Table *VectorstoreTableOptions
+	// Config, if set, customizes the retriever and the indexer; its
+	// TableName, Embedder and EmbedderOptions are taken from the fields
+	// above.
+	Config *Config
+}
+
+// VectorStore is a retriever and an indexer bound to a single table, with
+// the engine they use.
+type VectorStore struct {
+	Engine    *PostgresEngine
+	Retriever ai.Retriever
+	Indexer   ai.Indexer
+}
+
+// NewVectorStore creates an engine with opts, creates the vector extension
+// and the table described by cfg if they do not exist, and defines a
+// retriever and an indexer for the table, named after it, such as
+// "postgres/my-docs". It is a shortcut for simple applications; the
+// engine, [PostgresEngine.InitVectorstoreTable] and [DefineRetriever] remain
+// available for more control. The engine must be closed with
+// [VectorStore.Close]. Unless [Config.SkipEmbedderCheck] is set, the
+// embedder embeds a short text first, and an embedder whose dimension is not
+// VectorSize fails with an error wrapping [ErrDimensionMismatch].
+func NewVectorStore(ctx context.Context, g *genkit.Genkit, cfg VectorStoreConfig, opts ...Option) (*VectorStore, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("postgres.NewVectorStore: %w", err)
+	}
+	dim, err := cfg.checkEmbedder(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.NewVectorStore: %w", err)
+	}
+	pgEngine, err := NewPostgresEngine(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.NewVectorStore: %w", err)
+	}
+	vs, err := newVectorStore(ctx, g, pgEngine, cfg, dim)
+	if err != nil {
+		pgEngine.Close(ctx)
+		return nil, fmt.Errorf("postgres.NewVectorStore: %w", err)
+	}
+	return vs, nil
+}
+
+// newVectorStore creates the table of cfg and defines its retriever and
+// indexer. dim is the dimension of the embeddings of the embedder of cfg, if
+// already checked.
+func newVectorStore(ctx context.Context, g *genkit.Genkit, pgEngine *PostgresEngine, cfg VectorStoreConfig, dim int) (*VectorStore, error) {
+	if err := pgEngine.InitVectorstoreTable(ctx, cfg.tableOptions()); err != nil {
+		return nil, err
+	}
+	ds, err := newEngineDocStore(ctx, *pgEngine, cfg.config())
+	if err != nil {
+		return nil, err
+	}
+	// The table may already exist with another dimension.
+	ds.embedderDimension = dim
+	if err := ds.checkEmbedderDimensions(ctx); err != nil {
+		return nil, err
+	}
+	return &VectorStore{
+		Engine:    pgEngine,
+		Retriever: genkit.DefineRetriever(g, provider, ds.config.TableName, ds.Retrieve),
+		Indexer:   genkit.DefineIndexer(g, provider, ds.config.TableName, ds.Index),
+	}, nil
+}
+
+// Close closes the engine of the vector store, as [PostgresEngine.Close].
+func (vs *VectorStore) Close(ctx context.Context) error {
+	return vs.Engine.Close(ctx)
+}
+
+func (cfg VectorStoreConfig) validate() error {
+	switch {
+	case strings.TrimSpace(cfg.TableName) == "":
+		return errors.New("table name is required")
+	case cfg.VectorSize <= 0:
+		return fmt.Errorf("vector size must be positive, got %d", cfg.VectorSize)
+	case cfg.Embedder == nil:
+		return errors.New("embedder is required")
+	}
+	return nil
+}
+
+// checkEmbedder returns the dimension of the embeddings of the embedder of
+// cfg, or an error wrapping [ErrDimensionMismatch] if it is not VectorSize,
+// so that it fails before the table is created. It returns 0 with
+// [Config.SkipEmbedderCheck].
+func (cfg VectorStoreConfig) checkEmbedder(ctx context.Context) (int, error) {
+	if cfg.Config != nil && cfg.Config.SkipEmbedderCheck {
+		return 0, nil
+	}
+	n, err := embedderDimension(ctx, cfg.Embedder, cfg.EmbedderOptions)
+	if err != nil {
+		return 0, err
+	}
+	if n != cfg.VectorSize {
+		return 0, fmt.Errorf("%w: embedder %q returns embeddings of %d dimensions, but the vector size is %d",
+			ErrDimensionMismatch, cfg.Embedder.Name(), n, cfg.VectorSize)
+	}
+	return n, nil
+}
+
+// tableOptions returns the options of the table of cfg.
+func (cfg VectorStoreConfig) tableOptions() VectorstoreTableOptions {
+	opts := VectorstoreTableOptions{StoreMetadata: true}
+	if cfg.Table != nil {
+		opts = *cfg.Table
+	}
+	opts.TableName = cfg.TableName
+	opts.VectorSize = cfg.VectorSize
+	return opts
+}
+
+// config returns the retriever and indexer configuration of cfg.
+func (cfg VectorStoreConfig) config() *Config {
+	c := &Config{}
+	if cfg.Config != nil {
+		*c = *cfg.Config
+	}
+	c.TableName = cfg.TableName
+	c.Embedder = cfg.Embedder
+	c.EmbedderOptions = cfg.EmbedderOptions
+	if cfg.Table != nil {
+		// Read the columns created for the table by default.
+		c.SchemaName = cmp.Or(c.SchemaName, cfg.Table.SchemaName)
+		c.ContentColumn = cmp.Or(c.ContentColumn, cfg.Table.ContentColumnName)
+		c.EmbeddingColumn = cmp.Or(c.EmbeddingColumn, cfg.Table.EmbeddingColumn)
+		c.MetadataJSONColumn = cmp.Or(c.MetadataJSONColumn, cfg.Table.MetadataJSONColumn)
+		c.IDColumn = cmp.Or(c.IDColumn, cfg.Table.IDColumn.Name)
+		if c.MetadataColumns == nil {
+			for _, col := range cfg.Table.MetadataColumns {
+				c.MetadataColumns = append(c.MetadataColumns, col.Name)
+			}
+		}
+	}
+	return c
+}
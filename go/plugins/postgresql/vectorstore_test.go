@@ -0,0 +1,62 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewVectorStoreValidation(t *testing.T) {
+	ctx := context.Background()
+	embedder := &fakeEmbedder{}
+	_, err := NewVectorStore(ctx, nil, VectorStoreConfig{VectorSize: 3, Embedder: embedder})
+	assert.ErrorContains(t, err, "table name is required")
+	_, err = NewVectorStore(ctx, nil, VectorStoreConfig{TableName: "docs", Embedder: embedder})
+	assert.ErrorContains(t, err, "vector size")
+	_, err = NewVectorStore(ctx, nil, VectorStoreConfig{TableName: "docs", VectorSize: 3})
+	assert.ErrorContains(t, err, "embedder is required")
+}
+
+func TestVectorStoreConfig(t *testing.T) {
+	embedder := &fakeEmbedder{}
+	cfg := VectorStoreConfig{TableName: "docs", VectorSize: 3, Embedder: embedder}
+	assert.Equal(t, VectorstoreTableOptions{TableName: "docs", VectorSize: 3, StoreMetadata: true}, cfg.tableOptions())
+	assert.Equal(t, &Config{TableName: "docs", Embedder: embedder}, cfg.config())
+
+	cfg.Table = &VectorstoreTableOptions{
+		TableName:         "ignored",
+		ContentColumnName: "body",
+		IDColumn:          Column{Name: "doc_id", DataType: "TEXT"},
+		MetadataColumns:   []Column{{Name: "tenant_id", DataType: "TEXT"}},
+	}
+	cfg.Config = &Config{K: 10}
+	table := cfg.tableOptions()
+	assert.Equal(t, "docs", table.TableName)
+	assert.Equal(t, 3, table.VectorSize)
+	assert.False(t, table.StoreMetadata)
+	c := cfg.config()
+	assert.Equal(t, "body", c.ContentColumn)
+	assert.Equal(t, "doc_id", c.IDColumn)
+	assert.Equal(t, []string{"tenant_id"}, c.MetadataColumns)
+	assert.Equal(t, 10, c.K)
+	// The given config is not modified.
+	assert.Empty(t, cfg.Config.TableName)
+}
+
+func TestNewVectorStoreEmbedderCheck(t *testing.T) {
+	ctx := context.Background()
+	embedder := &fakeEmbedder{}
+	// The fake embedder returns embeddings of one dimension.
+	_, err := NewVectorStore(ctx, nil, VectorStoreConfig{TableName: "docs", VectorSize: 3, Embedder: embedder})
+	assert.ErrorIs(t, err, ErrDimensionMismatch)
+	assert.ErrorContains(t, err, `embedder "fake" returns embeddings of 1 dimensions, but the vector size is 3`)
+	assert.Equal(t, 1, embedder.calls)
+
+	// Without the check, the store fails later, for want of a connection.
+	_, err = NewVectorStore(ctx, nil, VectorStoreConfig{TableName: "docs", VectorSize: 3, Embedder: embedder,
+		Config: &Config{SkipEmbedderCheck: true}})
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrDimensionMismatch)
+	assert.Equal(t, 1, embedder.calls)
+}
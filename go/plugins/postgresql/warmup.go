@@ -0,0 +1,272 @@
+package postgresql
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/core/logger"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/puddle/v2"
+	"golang.org/x/sync/errgroup"
+)
+
+// WarmUp opens up to n connections in parallel and runs a trivial query on
+// each, so that the first requests do not pay for the connection handshake,
+// which includes fetching a token with IAM authentication. The connections
+// are then returned to the pool, idle. n is capped at the maximum size of
+// the pool. With [WithDB], database/sql only keeps as many idle connections
+// as its MaxIdleConns setting, and with [WithConn], WarmUp pings the
+// connection.
+//
+// Engines whose pool is built with [WithMinConns] warm up that many
+// connections when they are created.
+func (pgEngine *PostgresEngine) WarmUp(ctx context.Context, n int) error {
+	if n < 0 {
+		return fmt.Errorf("postgres.WarmUp: connection count must not be negative, got %d", n)
+	}
+	if n == 0 {
+		return nil
+	}
+	if pgEngine.config.conn != nil {
+		return pgEngine.Ping(ctx)
+	}
+	if db := pgEngine.config.db; db != nil {
+		return warmUpDB(ctx, db, n)
+	}
+	return pgEngine.withPool(ctx, func(pool *pgxpool.Pool) error {
+		return warmUpPool(ctx, pool, n)
+	})
+}
+
+// warmUpPool acquires up to n connections of pool at once, so that the pool
+// opens new ones, and runs a trivial query on each.
+func warmUpPool(ctx context.Context, pool *pgxpool.Pool, n int) error {
+	n = min(n, int(pool.Config().MaxConns))
+	conns := make([]*pgxpool.Conn, n)
+	defer func() {
+		for _, conn := range conns {
+			if conn != nil {
+				conn.Release()
+			}
+		}
+	}()
+	g, gctx := errgroup.WithContext(ctx)
+	for i := range conns {
+		g.Go(func() error {
+			conn, err := pool.Acquire(gctx)
+			if err != nil {
+				return err
+			}
+			conns[i] = conn
+			_, err = conn.Exec(gctx, "SELECT 1")
+			return err
+		})
+	}
+	return warmUpError(g.Wait())
+}
+
+// warmUpDB opens up to n connections of db at once and runs a trivial query
+// on each, like warmUpPool.
+func warmUpDB(ctx context.Context, db *sql.DB, n int) error {
+	if limit := db.Stats().MaxOpenConnections; limit > 0 {
+		n = min(n, limit)
+	}
+	conns := make([]*sql.Conn, n)
+	defer func() {
+		for _, conn := range conns {
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}()
+	g, gctx := errgroup.WithContext(ctx)
+	for i := range conns {
+		g.Go(func() error {
+			conn, err := db.Conn(gctx)
+			if err != nil {
+				return err
+			}
+			conns[i] = conn
+			_, err = conn.ExecContext(gctx, "SELECT 1")
+			return err
+		})
+	}
+	return warmUpError(g.Wait())
+}
+
+// warmUpError describes err, the failure of a connection opened by
+// WarmUp. Closed pool errors are returned as is, for the pool to be
+// reopened.
+func warmUpError(err error) error {
+	if err == nil || errors.Is(err, puddle.ErrClosedPool) {
+		return err
+	}
+	return fmt.Errorf("postgres.WarmUp: %s: %w", describeConnError(err), err)
+}
+
+// RetrieverWarmUpOptions configures [PostgresEngine.WarmUpRetriever].
+type RetrieverWarmUpOptions struct {
+	// Queries is the number of similarity searches run, like those of the
+	// retriever, with the embeddings of as many rows of the table as query
+	// vectors. The default is 10; a negative value runs none, such as to
+	// only prewarm the indexes.
+	Queries int
+	// QueryEmbeddings, if set, are searched for in place of embeddings of
+	// the table, such as those of representative queries.
+	QueryEmbeddings [][]float32
+	// Prewarm loads the vector indexes of the embedding column into the
+	// buffer cache with pg_prewarm before the searches run, if the
+	// extension is installed; otherwise a warning is logged.
+	Prewarm bool
+	// Options are the options of the searches, such as
+	// [RetrieverOptions.HNSWEfSearch] or [RetrieverOptions.Filters], so that
+	// they visit the parts of the index that user queries visit. Their
+	// query embedding is set by WarmUpRetriever.
+	Options *RetrieverOptions
+}
+
+// defaultWarmUpQueries is the default [RetrieverWarmUpOptions.Queries].
+const defaultWarmUpQueries = 10
+
+// WarmUpRetriever runs similarity searches on the table described by cfg,
+// as its retriever does, so that the pages of its vector indexes are read
+// into memory and the first user queries after a start or a failover are not
+// slowed down by cold reads. With [RetrieverWarmUpOptions.Prewarm], the
+// indexes are first loaded whole with pg_prewarm. The documents found are
+// discarded.
+func (pgEngine *PostgresEngine) WarmUpRetriever(ctx context.Context, cfg *Config, opts RetrieverWarmUpOptions) error {
+	ds, err := newEngineDocStore(ctx, *pgEngine, cfg)
+	if err != nil {
+		return fmt.Errorf("postgres.WarmUpRetriever: %w", err)
+	}
+	if opts.Prewarm {
+		if err := ds.prewarmIndexes(ctx); err != nil {
+			return fmt.Errorf("postgres.WarmUpRetriever: %w", err)
+		}
+	}
+	vecs := opts.QueryEmbeddings
+	if vecs == nil {
+		n := cmp.Or(opts.Queries, defaultWarmUpQueries)
+		if n < 0 {
+			return nil
+		}
+		if vecs, err = ds.sampleEmbeddings(ctx, n); err != nil {
+			return fmt.Errorf("postgres.WarmUpRetriever: %w", err)
+		}
+	}
+	for i, vec := range vecs {
+		if err := ds.warmUpQuery(ctx, vec, opts.Options); err != nil {
+			return fmt.Errorf("postgres.WarmUpRetriever: query %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// warmUpQuery runs the similarity search of opts for vec and reads its rows.
+func (ds *docStore) warmUpQuery(ctx context.Context, vec []float32, opts *RetrieverOptions) error {
+	var qopts RetrieverOptions
+	if opts != nil {
+		qopts = *opts
+	}
+	qopts.QueryEmbedding, qopts.QueryEmbeddingBytes, qopts.QueryEmbedder = vec, nil, nil
+	r, err := ds.prepareRetrieval(ctx, &ai.RetrieverRequest{Options: &qopts}, false)
+	if err != nil {
+		return err
+	}
+	qctx, cancel := ds.engine.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := r.run(qctx, ds)
+	if err != nil {
+		return queryTimeoutError(qctx, describeQueryError(err, ds.config))
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return queryTimeoutError(qctx, rows.Err())
+}
+
+// sampleEmbeddings returns the embeddings of up to n rows of the table, the
+// first ones read, as warm-up query vectors.
+func (ds *docStore) sampleEmbeddings(ctx context.Context, n int) ([][]float32, error) {
+	query := fmt.Sprintf(`SELECT "%s"::text FROM %s WHERE "%s" IS NOT NULL LIMIT %d`,
+		ds.config.EmbeddingColumn, qualifiedName(ds.config.SchemaName, ds.config.TableName), ds.config.EmbeddingColumn, n)
+	qctx, cancel := ds.engine.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := ds.engine.querier().Query(qctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample embeddings: %w", queryTimeoutError(qctx, describeQueryError(err, ds.config)))
+	}
+	defer rows.Close()
+	var vecs [][]float32
+	for rows.Next() {
+		var text string
+		if err := rows.Scan(&text); err != nil {
+			return nil, fmt.Errorf("failed to sample embeddings: %w", err)
+		}
+		vec, err := parseEmbedding(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sample embeddings: %w", err)
+		}
+		vecs = append(vecs, vec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to sample embeddings: %w", queryTimeoutError(qctx, err))
+	}
+	return vecs, nil
+}
+
+// prewarmIndexes loads the vector indexes of the embedding column with
+// pg_prewarm, or logs a warning if the extension is not installed.
+func (ds *docStore) prewarmIndexes(ctx context.Context) error {
+	q := ds.engine.querier()
+	var installed bool
+	if err := q.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_prewarm')").Scan(&installed); err != nil {
+		return fmt.Errorf("failed to look up the pg_prewarm extension: %w", err)
+	}
+	if !installed {
+		logger.FromContext(ctx).Warn("the pg_prewarm extension is not installed; the vector indexes are only warmed up by queries",
+			"schema", ds.config.SchemaName, "table", ds.config.TableName)
+		return nil
+	}
+	rows, err := q.Query(ctx, "SELECT indexname, indexdef FROM pg_indexes WHERE schemaname = $1 AND tablename = $2 ORDER BY indexname", ds.config.SchemaName, ds.config.TableName)
+	if err != nil {
+		return fmt.Errorf("failed to list the indexes: %w", err)
+	}
+	defs := make(map[string]string)
+	for rows.Next() {
+		var name, def string
+		if err := rows.Scan(&name, &def); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to list the indexes: %w", err)
+		}
+		defs[name] = def
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list the indexes: %w", err)
+	}
+	for _, name := range vectorIndexNames(defs, ds.config.EmbeddingColumn) {
+		if _, err := q.Exec(ctx, "SELECT pg_prewarm(format('%I.%I', $1::text, $2::text)::regclass)", ds.config.SchemaName, name); err != nil {
+			return fmt.Errorf("failed to prewarm index %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// vectorIndexNames returns the names of the vector indexes of column among
+// defs, the definitions of indexes by name, in order of name.
+func vectorIndexNames(defs map[string]string, column string) []string {
+	var names []string
+	for _, name := range slices.Sorted(maps.Keys(defs)) {
+		if slices.ContainsFunc(parseVectorIndex(defs[name]), func(idx VectorIndex) bool { return idx.Column == column }) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,45 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarmUp(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pgEngine := &PostgresEngine{}
+	assert.Error(t, pgEngine.WarmUp(ctx, -1))
+	assert.NoError(t, pgEngine.WarmUp(ctx, 0))
+
+	config, err := pgxpool.ParseConfig("host=127.0.0.1 port=1 user=test dbname=test connect_timeout=1 pool_max_conns=2")
+	assert.NoError(t, err)
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	assert.NoError(t, err)
+	defer pool.Close()
+	pgEngine = &PostgresEngine{Pool: pool, pools: &poolState{pool: pool}}
+	// The connections are refused; n beyond the size of the pool does not
+	// wait for a connection to be released.
+	err = pgEngine.WarmUp(ctx, 5)
+	assert.ErrorContains(t, err, "postgres.WarmUp")
+	assert.NoError(t, ctx.Err())
+
+	closed := closedPool(t)
+	pgEngine = &PostgresEngine{Pool: closed, pools: &poolState{pool: closed}}
+	assert.ErrorIs(t, pgEngine.WarmUp(ctx, 1), ErrPoolClosed)
+}
+
+func TestVectorIndexNames(t *testing.T) {
+	defs := map[string]string{
+		"documents_pkey":          `CREATE UNIQUE INDEX documents_pkey ON public.documents USING btree (id)`,
+		"documents_hnsw_idx":      `CREATE INDEX documents_hnsw_idx ON public.documents USING hnsw (embedding vector_cosine_ops)`,
+		"documents_ivfflat_idx":   `CREATE INDEX documents_ivfflat_idx ON public.documents USING ivfflat (embedding vector_l2_ops) WITH (lists='100')`,
+		"documents_title_emb_idx": `CREATE INDEX documents_title_emb_idx ON public.documents USING hnsw (title_embedding vector_cosine_ops)`,
+	}
+	assert.Equal(t, []string{"documents_hnsw_idx", "documents_ivfflat_idx"}, vectorIndexNames(defs, "embedding"))
+	assert.Empty(t, vectorIndexNames(defs, "other"))
+}